@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// advisorPollInterval is how often the status of an Access Advisor report
+// is checked.
+const advisorPollInterval = 2 * time.Second
+
+// days is a flag.Value holding a duration, given either in days such as
+// 180d or as a Go duration such as 4320h.
+type days time.Duration
+
+func (d *days) String() string {
+	if *d == 0 {
+		return "0"
+	}
+	if time.Duration(*d)%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(time.Duration(*d)/(24*time.Hour))) + "d"
+	}
+	return time.Duration(*d).String()
+}
+
+func (d *days) Set(v string) error {
+	dur, err := time.ParseDuration(v)
+	if n := strings.TrimSuffix(v, "d"); n != v {
+		var i int
+		i, err = strconv.Atoi(n)
+		dur = time.Duration(i) * 24 * time.Hour
+	}
+	if err != nil || dur < 0 {
+		return fmt.Errorf("invalid duration %q, must be a number of days such as 90d or a duration such as 2160h", v)
+	}
+	*d = days(dur)
+	return nil
+}
+
+var (
+	unusedServicesFor days
+	unusedFor         days
+	keepUnused        = flag.Bool("keep-unused", false, "with --unused-for, keep the unused roles in the export, marked with a comment")
+	trimUnused        = flag.Bool("trim-unused-services", false, "with --unused-services-for, propose policies without the actions of the unused services")
+)
+
+func init() {
+	flag.Var(&unusedFor, "unused-for", "leave out the roles not assumed for this `duration`, e.g. 180d")
+	flag.Var(&unusedServicesFor, "unused-services-for", "annotate roles and managed policies with the services IAM Access Advisor reports as not accessed for this `duration`, e.g. 90d")
+}
+
+// annotateUnusedServices sets the services of roles and managed policies
+// not accessed for --unused-services-for, and proposes trimmed policies
+// with --trim-unused-services.
+func annotateUnusedServices(ctx context.Context, client *iam.Client, resources *model.ResourceSet) error {
+	slog.Info("Reading Access Advisor reports", "roles", len(resources.Roles), "policies", len(resources.Policies))
+	err := iamexport.FetchUnusedServices(ctx, client, resources, iamexport.AccessAdvisorOptions{
+		FetchOptions: iamexport.FetchOptions{Concurrency: *concurrency},
+		Since:        time.Now().Add(-time.Duration(unusedServicesFor)),
+		PollInterval: advisorPollInterval,
+	})
+	if err != nil {
+		return err
+	}
+	if *trimUnused {
+		return transform.TrimUnusedServices(resources)
+	}
+	return nil
+}
+
+// excludeUnusedRoles leaves out the roles not assumed for --unused-for,
+// listing them in the log. With --keep-unused they are only listed.
+func excludeUnusedRoles(resources *model.ResourceSet) {
+	unused := transform.UnusedRoles(resources, time.Now().Add(-time.Duration(unusedFor)))
+	if len(unused) == 0 {
+		return
+	}
+	if *keepUnused {
+		slog.Info("Keeping roles not assumed", "for", unusedFor.String(), "roles", strings.Join(unused, ","))
+		return
+	}
+	skip("unused-for", len(transform.RemoveRoles(resources, unused...)))
+	slog.Info("Leaving out roles not assumed", "for", unusedFor.String(), "roles", strings.Join(unused, ","))
+}
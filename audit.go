@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/securityhub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// runAudit writes the risky policy statements of resources to stdout,
+// imports them into Security Hub with --security-hub, and reports whether
+// any of them is at least as severe as --fail-on.
+func runAudit(ctx context.Context, cfg aws.Config, resources *model.ResourceSet) (bool, error) {
+	findings, err := analyze.Audit(resources)
+	if err != nil {
+		return false, err
+	}
+	if err := analyze.WriteFindings(out, findings); err != nil {
+		return false, err
+	}
+	if *toSecurityHub {
+		err := importFindings(ctx, cfg, func(src securityhub.Source) []securityhub.Finding {
+			return securityhub.FromAudit(src, findings)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	if *failOn == "" {
+		return false, nil
+	}
+	threshold, _ := analyze.ParseSeverity(*failOn)
+	for _, f := range findings {
+		if f.Severity >= threshold {
+			return true, nil
+		}
+	}
+	return false, nil
+}
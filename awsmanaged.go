@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+)
+
+var (
+	customerManagedOnly = flag.Bool("customer-managed-only", false, "leave the AWS managed policies, e.g. arn:aws:iam::aws:policy/ReadOnlyAccess, out of the managed policies of groups, roles, users and permission sets")
+	awsManagedReport    = flag.String("aws-managed-report", "", "with --customer-managed-only, write the attachments of AWS managed policies left out to this JSON `file`")
+)
+
+// detachAWSManaged leaves the AWS managed policies out of resources for
+// --customer-managed-only, and writes the attachments left out to
+// --aws-managed-report, if given.
+func detachAWSManaged(resources *model.ResourceSet) error {
+	detached := transform.DetachAWSManaged(resources)
+	if len(detached) > 0 {
+		slog.Info("Leaving out attachments of AWS managed policies", "attachments", len(detached))
+	}
+	if *awsManagedReport == "" {
+		return nil
+	}
+	if detached == nil {
+		detached = []transform.Attachment{}
+	}
+	b, err := json.MarshalIndent(detached, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*awsManagedReport, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Wrote AWS managed policy report", "file", *awsManagedReport, "attachments", len(detached))
+	return nil
+}
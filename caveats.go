@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+var (
+	caveatsReport = flag.String("caveats-report", "", "write the actions the exported policies allow that permissions boundaries, or with --scps service control policies, deny or do not allow to this `file`")
+	withSCPs      = flag.Bool("scps", false, "with --caveats-report, also read the service control policies applying to the account from AWS Organizations")
+)
+
+// writeCaveats writes the caveats of the policies of resources to
+// --caveats-report. The documents of permissions boundaries that are not
+// exported are read from IAM, unless resources are read offline.
+func writeCaveats(ctx context.Context, cfg aws.Config, resources *model.ResourceSet) error {
+	boundaries := map[string]string{}
+	for _, p := range resources.Policies {
+		boundaries[*p.Arn] = aws.ToString(p.PolicyDocument)
+	}
+	var missing []string
+	for _, r := range resources.Roles {
+		if b := r.PermissionsBoundary; b != nil {
+			missing = append(missing, *b)
+		}
+	}
+	for _, u := range resources.Users {
+		if b := u.PermissionsBoundary; b != nil {
+			missing = append(missing, *b)
+		}
+	}
+	if *input == "" && !*fromCache {
+		client := iam.NewFromConfig(cfg)
+		for _, arn := range missing {
+			if _, ok := boundaries[arn]; ok {
+				continue
+			}
+			doc, err := policyDocument(ctx, client, arn)
+			if err != nil {
+				return fmt.Errorf("permissions boundary %s: %w", arn, err)
+			}
+			boundaries[arn] = doc
+		}
+	}
+
+	var scps []analyze.SCP
+	if *withSCPs {
+		var err error
+		if scps, err = serviceControlPolicies(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	caveats, err := analyze.Caveats(resources, boundaries, scps)
+	if err != nil {
+		return err
+	}
+	b := bytes.Buffer{}
+	if err := analyze.WriteCaveats(&b, caveats); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*caveatsReport, b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Wrote caveats report", "file", *caveatsReport, "caveats", len(caveats), "scps", len(scps))
+	return nil
+}
+
+// policyDocument returns the document of the default version of the
+// managed policy arn.
+func policyDocument(ctx context.Context, client *iam.Client, arn string) (string, error) {
+	p, err := client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(arn)})
+	if err != nil {
+		return "", err
+	}
+	v, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{PolicyArn: aws.String(arn), VersionId: p.Policy.DefaultVersionId})
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(aws.ToString(v.PolicyVersion.Document))
+}
+
+// serviceControlPolicies returns the SCPs attached to the account and to
+// the organizational units and root above it. Reading them requires the
+// management account of the organization or a delegated administrator.
+func serviceControlPolicies(ctx context.Context, cfg aws.Config) ([]analyze.SCP, error) {
+	id, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("looking up account ID: %w", err)
+	}
+	client := organizations.NewFromConfig(cfg)
+
+	targets := []string{aws.ToString(id.Account)}
+	for child := targets[0]; ; {
+		resp, err := client.ListParents(ctx, &organizations.ListParentsInput{ChildId: aws.String(child)})
+		if err != nil {
+			return nil, fmt.Errorf("listing the parents of %s: %w", child, err)
+		}
+		if len(resp.Parents) == 0 {
+			break
+		}
+		child = aws.ToString(resp.Parents[0].Id)
+		targets = append(targets, child)
+		if resp.Parents[0].Type == orgtypes.ParentTypeRoot {
+			break
+		}
+	}
+
+	var scps []analyze.SCP
+	documents := map[string]string{}
+	for _, target := range targets {
+		pages := organizations.NewListPoliciesForTargetPaginator(client, &organizations.ListPoliciesForTargetInput{
+			TargetId: aws.String(target),
+			Filter:   orgtypes.PolicyTypeServiceControlPolicy,
+		})
+		for pages.HasMorePages() {
+			resp, err := pages.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("listing the SCPs of %s: %w", target, err)
+			}
+			for _, p := range resp.Policies {
+				doc, ok := documents[aws.ToString(p.Id)]
+				if !ok {
+					d, err := client.DescribePolicy(ctx, &organizations.DescribePolicyInput{PolicyId: p.Id})
+					if err != nil {
+						return nil, fmt.Errorf("SCP %s: %w", aws.ToString(p.Name), err)
+					}
+					doc = aws.ToString(d.Policy.Content)
+					documents[aws.ToString(p.Id)] = doc
+				}
+				scps = append(scps, analyze.SCP{ID: aws.ToString(p.Id), Name: aws.ToString(p.Name), Target: target, Document: doc})
+			}
+		}
+	}
+	slog.Info("Read service control policies", "targets", len(targets), "policies", len(scps))
+	return scps, nil
+}
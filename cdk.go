@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// writeCDK writes the files to migrate resources to a CDK app to
+// --output-dir, cdk by default: template.yaml for cdk migrate --from-path,
+// resource-mapping.json for cdk import --resource-mapping, and
+// construct-ids.json, a mapping of the construct IDs cdk migrate names
+// after the logical IDs to the resources, which --mapping-in reads to keep
+// them on later runs.
+func writeCDK(resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	// As with import, imported resources must keep their names and have
+	// a DeletionPolicy.
+	opts.PreserveNames = true
+	opts.DeletionPolicies = map[string]string{"": "Retain"}
+
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	if err := checkLimits(resources, b.Bytes()); err != nil {
+		return err
+	}
+	imported, err := resourcesToImport(resources)
+	if err != nil {
+		return err
+	}
+	mapping := map[string]map[string]string{}
+	for _, r := range imported {
+		mapping[aws.ToString(r.LogicalResourceId)] = r.ResourceIdentifier
+	}
+	m, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := *outputDir
+	if dir == "" {
+		dir = dirFormats["cdk"]
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "template.yaml"), b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "resource-mapping.json"), append(m, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := render.WriteMapping(filepath.Join(dir, "construct-ids.json"), ids.Entries()); err != nil {
+		return err
+	}
+	slog.Info("Wrote the CDK migration", "resources", len(imported), "dir", dir)
+	return nil
+}
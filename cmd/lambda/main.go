@@ -0,0 +1,31 @@
+// Command lambda runs exports as an AWS Lambda function, e.g. invoked by
+// an EventBridge schedule with the handler.Event of the export as input,
+// writing the template to S3.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/handler"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// version is the version of the function, set at build time with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+func main() {
+	// The function retries and honors endpoint overrides as the command
+	// does, with AWS_ENDPOINT_URL and AWS_ENDPOINT_URL_<SERVICE>.
+	cfg, err := iamexport.LoadConfig(context.Background(), iamexport.DefaultMaxAttempts, iamexport.EndpointFromEnv)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	h := handler.New(cfg)
+	h.Version = version
+	lambda.Start(h.Handle)
+}
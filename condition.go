@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/ignore"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+)
+
+// conditionRule puts the resources matching a pattern of the ignore file
+// syntax under a template condition.
+type conditionRule struct {
+	condition string
+	rule      ignore.Rule
+}
+
+// conditionRules is a flag.Value collecting the rules of --condition, of
+// which the first matching a resource applies.
+type conditionRules []conditionRule
+
+var conditions conditionRules
+
+func init() {
+	flag.Var(&conditions, "condition", "only create the resources matching a pattern when a template condition is true, given as `Condition=[type:]pattern`, e.g. IsProd=roles:prod-* (repeatable)")
+}
+
+var conditionName = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+func (c *conditionRules) String() string {
+	var l []string
+	for _, r := range *c {
+		p := r.rule.Pattern
+		if r.rule.Type != "" {
+			p = r.rule.Type + ":" + p
+		}
+		l = append(l, r.condition+"="+p)
+	}
+	return strings.Join(l, ",")
+}
+
+func (c *conditionRules) Set(v string) error {
+	i := strings.IndexByte(v, '=')
+	if i <= 0 {
+		return fmt.Errorf("invalid condition %q, must be <Condition>=[<type>:]<pattern>", v)
+	}
+	if !conditionName.MatchString(v[:i]) {
+		return fmt.Errorf("invalid condition %q: condition names must be alphanumeric", v)
+	}
+	rule, err := ignore.ParseRule(v[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid condition %q: %w", v, err)
+	}
+	*c = append(*c, conditionRule{condition: v[:i], rule: rule})
+	return nil
+}
+
+// resourceConditions returns the conditions of the resources matching the
+// rules of --condition, keyed by ARN, warning about the conditions no
+// resource matches.
+func resourceConditions(resources *model.ResourceSet) map[string]string {
+	matched := map[string]string{}
+	// Filter visits every resource, all of which are kept.
+	transform.Filter(resources, func(typ, name, arn string) bool {
+		for _, c := range conditions {
+			if c.rule.Match(typ, name, arn) {
+				matched[arn] = c.condition
+				break
+			}
+		}
+		return true
+	})
+
+	used := map[string]bool{}
+	for _, c := range matched {
+		used[c] = true
+	}
+	for _, c := range conditions {
+		if !used[c.condition] {
+			slog.Warn("No resource matches the condition", "condition", c.condition)
+			used[c.condition] = true
+		}
+	}
+	return matched
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the config file read from the working directory
+// when there is no --config.
+const defaultConfigFile = "iam-cf-generator.yaml"
+
+var configFile = flag.String("config", "", "read the resource types and flags from this YAML `file` (default "+defaultConfigFile+" if it exists)")
+
+// configTypes are the resource types given by the config file, exported
+// when none are given on the command line.
+var configTypes []string
+
+// readConfigFile reads --config, or the default config file when it
+// exists. Its keys are the names of flags, or types for the resource
+// types to export, e.g.
+//
+//	types: [roles, policies]
+//	parameterize: true
+//	deletion-policy: [Retain, policies=Delete]
+//
+// Flags given on the command line take precedence over the config file.
+func readConfigFile() error {
+	path := *configFile
+	if path == "" {
+		path = defaultConfigFile
+	}
+	b, err := os.ReadFile(path)
+	if *configFile == "" && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	m := doc.Content[0]
+	if m.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping of flag names to values", path)
+	}
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, value := m.Content[i].Value, m.Content[i+1]
+
+		var values []string
+		switch value.Kind {
+		case yaml.ScalarNode:
+			values = []string{value.Value}
+		case yaml.SequenceNode:
+			for _, v := range value.Content {
+				if v.Kind != yaml.ScalarNode {
+					return fmt.Errorf("%s: line %d: %s: expected a list of values", path, v.Line, key)
+				}
+				values = append(values, v.Value)
+			}
+		default:
+			return fmt.Errorf("%s: line %d: %s: expected a value or a list of values", path, value.Line, key)
+		}
+
+		if key == "types" {
+			configTypes = values
+			continue
+		}
+		f := flag.Lookup(key)
+		if f == nil || key == "config" {
+			return fmt.Errorf("%s: line %d: unknown flag %s", path, m.Content[i].Line, key)
+		}
+		if given[key] {
+			continue
+		}
+		for _, v := range values {
+			if err := f.Value.Set(v); err != nil {
+				return fmt.Errorf("%s: line %d: invalid value %q for %s: %v", path, value.Line, v, key, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// resourceTypes maps the resource types given on the command line to the
+// CloudFormation types they are written as.
+var resourceTypes = map[string][]string{
+	"groups":              {"AWS::IAM::Group"},
+	"policies":            {"AWS::IAM::ManagedPolicy"},
+	"roles":               {"AWS::IAM::Role"},
+	"users":               {"AWS::IAM::User"},
+	"server-certificates": {"AWS::IAM::ServerCertificate"},
+	"virtual-mfa-devices": {"AWS::IAM::VirtualMFADevice"},
+	"instance-profiles":   {"AWS::IAM::InstanceProfile"},
+	"providers":           {"AWS::IAM::OIDCProvider", "AWS::IAM::SAMLProvider"},
+	"account":             {"Custom::AccountAlias", "Custom::AccountPasswordPolicy"},
+	"sso-permission-sets": {"AWS::SSO::PermissionSet"},
+}
+
+// deletionPolicies is a flag.Value collecting DeletionPolicy settings.
+// Each value is either a policy applying to every resource, or
+// <type>=<policy> overriding it for one resource type, e.g. roles=Retain.
+// The result is keyed by CloudFormation type, with the default under "".
+type deletionPolicies map[string]string
+
+var deletionPolicy = deletionPolicies{}
+
+func init() {
+	flag.Var(deletionPolicy, "deletion-policy", "set DeletionPolicy and UpdateReplacePolicy to Delete or Retain, for every resource or for one type with `[type=]policy` (repeatable)")
+}
+
+func (d deletionPolicies) String() string {
+	var s []string
+	for typ, policy := range d {
+		s = append(s, typ+"="+policy)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (d deletionPolicies) Set(v string) error {
+	types, policy := []string{""}, v
+	if i := strings.IndexByte(v, '='); i >= 0 {
+		cmd := v[:i]
+		if types = resourceTypes[cmd]; types == nil {
+			return fmt.Errorf("unknown resource type %q", cmd)
+		}
+		policy = v[i+1:]
+	}
+
+	switch policy {
+	case "Delete", "Retain":
+	default:
+		return fmt.Errorf("unsupported deletion policy %q", policy)
+	}
+
+	for _, typ := range types {
+		d[typ] = policy
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// maxTemplateBodySize is the largest template CloudFormation accepts
+// inline; larger ones have to be uploaded to S3.
+const maxTemplateBodySize = 51200
+
+// deployWait is how long deploy waits for a change set or stack operation.
+const deployWait = 30 * time.Minute
+
+var (
+	templateBucket = flag.String("template-bucket", "", "with deploy, upload templates too large to pass inline to this S3 bucket")
+	execute        = flag.Bool("execute", false, "with deploy, execute the change set instead of only creating it")
+)
+
+// parameterValues is a flag.Value collecting template parameter values
+// given as <name>=<value>.
+type parameterValues map[string]string
+
+var parameterValue = parameterValues{}
+
+func init() {
+	flag.Var(parameterValue, "parameter", "with deploy, set the template parameter to a value with `name=value` (repeatable)")
+}
+
+func (p parameterValues) String() string {
+	var s []string
+	for name := range p {
+		s = append(s, name+"=...")
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (p parameterValues) Set(v string) error {
+	i := strings.IndexByte(v, '=')
+	if i <= 0 {
+		return fmt.Errorf("parameter %q is not name=value", v)
+	}
+	p[v[:i]] = v[i+1:]
+	return nil
+}
+
+// stackExists reports whether the stack named by --stack-name exists.
+func stackExists(ctx context.Context, client *cloudformation.Client) (bool, error) {
+	out, err := client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: stackName})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorMessage(), "does not exist") {
+			return false, nil
+		}
+		return false, fmt.Errorf("stack %s: %w", *stackName, err)
+	}
+	// A CREATE change set that was never executed leaves the stack in
+	// REVIEW_IN_PROGRESS, and it still has to be created.
+	for _, s := range out.Stacks {
+		if s.StackStatus == cftypes.StackStatusReviewInProgress {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// stackParameters returns the names of the parameters of the stack named
+// by --stack-name, which exists.
+func stackParameters(ctx context.Context, client *cloudformation.Client) (map[string]bool, error) {
+	out, err := client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: stackName})
+	if err != nil {
+		return nil, fmt.Errorf("stack %s: %w", *stackName, err)
+	}
+	names := map[string]bool{}
+	for _, s := range out.Stacks {
+		for _, p := range s.Parameters {
+			names[aws.ToString(p.ParameterKey)] = true
+		}
+	}
+	return names, nil
+}
+
+// templateParameters returns the parameters to create a change set with for
+// template: those given with --parameter and, when updating a stack with
+// the parameters previous, the previous value of any other the stack has.
+// Parameters with a Default, such as those of --substitute and
+// --condition, are otherwise left to it. previous is nil when creating a
+// stack.
+func templateParameters(template []byte, previous map[string]bool) ([]cftypes.Parameter, error) {
+	doc, _, err := templateResources(template)
+	if err != nil {
+		return nil, err
+	}
+
+	var params []cftypes.Parameter
+	declared := mappingValue(doc.Content[0], "Parameters")
+	for i := 0; declared != nil && i+1 < len(declared.Content); i += 2 {
+		name := declared.Content[i].Value
+		p := cftypes.Parameter{ParameterKey: aws.String(name)}
+		if v, ok := parameterValue[name]; ok {
+			p.ParameterValue = aws.String(v)
+		} else if previous[name] {
+			p.UsePreviousValue = aws.Bool(true)
+		} else if mappingValue(declared.Content[i+1], "Default") != nil {
+			continue
+		} else {
+			return nil, fmt.Errorf("template parameter %s has no value; set it with --parameter %s=...", name, name)
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// uploadTemplate stores the template of the stack or StackSet called name
+// in --template-bucket and returns its URL.
+func uploadTemplate(ctx context.Context, cfg aws.Config, name string, template []byte) (string, error) {
+	if *templateBucket == "" {
+		return "", fmt.Errorf("template is %d bytes, more than CloudFormation accepts inline; set --template-bucket", len(template))
+	}
+
+	key := fmt.Sprintf("iam-cf-generator/%s-%d.yaml", name, time.Now().Unix())
+	_, err := newS3Client(cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket: templateBucket,
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(template),
+	})
+	if err != nil {
+		return "", fmt.Errorf("uploading template to %s: %w", *templateBucket, err)
+	}
+	return iamexport.ObjectURL(cfg, *templateBucket, key)
+}
+
+// templateSource returns the template of the stack or StackSet called name
+// to pass to CloudFormation inline as a body, or as a URL after uploading
+// it to S3 when it is too large.
+func templateSource(ctx context.Context, cfg aws.Config, name string, template []byte) (body, url *string, err error) {
+	if len(template) <= maxTemplateBodySize {
+		return aws.String(string(template)), nil, nil
+	}
+	u, err := uploadTemplate(ctx, cfg, name, template)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, aws.String(u), nil
+}
+
+// writeChangeSet prints the resource changes of a change set.
+func writeChangeSet(ctx context.Context, client *cloudformation.Client, id *string) error {
+	b := bytes.Buffer{}
+	in := &cloudformation.DescribeChangeSetInput{ChangeSetName: id}
+	for {
+		out, err := client.DescribeChangeSet(ctx, in)
+		if err != nil {
+			return err
+		}
+		for _, c := range out.Changes {
+			r := c.ResourceChange
+			if r == nil {
+				continue
+			}
+			fmt.Fprintf(&b, "%-7s %s (%s)", r.Action, aws.ToString(r.LogicalResourceId), aws.ToString(r.ResourceType))
+			if r.Replacement == cftypes.ReplacementTrue || r.Replacement == cftypes.ReplacementConditional {
+				fmt.Fprintf(&b, " replacement: %s", r.Replacement)
+			}
+			b.WriteString("\n")
+		}
+		if out.NextToken == nil {
+			break
+		}
+		in.NextToken = out.NextToken
+	}
+	_, err := out.Write(b.Bytes())
+	return err
+}
+
+// runDeploy creates a change set deploying the template generated from
+// resources to the stack named by --stack-name, prints its changes and,
+// with --execute, executes it.
+func runDeploy(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	client := cloudformation.NewFromConfig(cfg)
+
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	template := b.Bytes()
+	if err := checkLimits(resources, template); err != nil {
+		return err
+	}
+
+	exists, err := stackExists(ctx, client)
+	if err != nil {
+		return err
+	}
+	var previous map[string]bool
+	if exists {
+		if previous, err = stackParameters(ctx, client); err != nil {
+			return err
+		}
+	}
+	params, err := templateParameters(template, previous)
+	if err != nil {
+		return err
+	}
+
+	in := &cloudformation.CreateChangeSetInput{
+		StackName:     stackName,
+		ChangeSetName: aws.String(fmt.Sprintf("iam-cf-generator-%d", time.Now().Unix())),
+		ChangeSetType: cftypes.ChangeSetTypeCreate,
+		Capabilities:  []cftypes.Capability{cftypes.CapabilityCapabilityIam, cftypes.CapabilityCapabilityNamedIam},
+		Parameters:    params,
+	}
+	if exists {
+		in.ChangeSetType = cftypes.ChangeSetTypeUpdate
+	}
+	if in.TemplateBody, in.TemplateURL, err = templateSource(ctx, cfg, *stackName, template); err != nil {
+		return err
+	}
+
+	cs, err := client.CreateChangeSet(ctx, in)
+	if err != nil {
+		return fmt.Errorf("stack %s: creating change set: %w", *stackName, err)
+	}
+
+	err = cloudformation.NewChangeSetCreateCompleteWaiter(client).Wait(ctx, &cloudformation.DescribeChangeSetInput{
+		ChangeSetName: cs.Id,
+	}, deployWait)
+	if err != nil {
+		out, derr := client.DescribeChangeSet(ctx, &cloudformation.DescribeChangeSetInput{ChangeSetName: cs.Id})
+		if derr != nil || out.Status != cftypes.ChangeSetStatusFailed {
+			return fmt.Errorf("stack %s: creating change set: %w", *stackName, err)
+		}
+		reason := aws.ToString(out.StatusReason)
+		if strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed") {
+			slog.Info("Stack is up to date", "stack", *stackName)
+			_, err := client.DeleteChangeSet(ctx, &cloudformation.DeleteChangeSetInput{ChangeSetName: cs.Id})
+			return err
+		}
+		return fmt.Errorf("stack %s: creating change set: %s", *stackName, reason)
+	}
+
+	if err := writeChangeSet(ctx, client, cs.Id); err != nil {
+		return err
+	}
+	if !*execute {
+		slog.Info("Created change set; execute it to apply the changes", "changeSet", aws.ToString(cs.Id))
+		return nil
+	}
+
+	if _, err := client.ExecuteChangeSet(ctx, &cloudformation.ExecuteChangeSetInput{ChangeSetName: cs.Id}); err != nil {
+		return fmt.Errorf("stack %s: executing change set: %w", *stackName, err)
+	}
+	describe := &cloudformation.DescribeStacksInput{StackName: cs.StackId}
+	if exists {
+		err = cloudformation.NewStackUpdateCompleteWaiter(client).Wait(ctx, describe, deployWait)
+	} else {
+		err = cloudformation.NewStackCreateCompleteWaiter(client).Wait(ctx, describe, deployWait)
+	}
+	if err != nil {
+		return fmt.Errorf("stack %s: %w", *stackName, err)
+	}
+	slog.Info("Deployed stack", "stack", *stackName)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+const roleArn = "arn:aws:iam::123456789012:role/prod-app"
+
+// deployTemplate renders a role with the parameters of --substitute
+// prod=Environment and --condition prod-app=App.
+func deployTemplate(t *testing.T) []byte {
+	t.Helper()
+	set := &model.ResourceSet{
+		Roles: model.RoleResources{{
+			Arn:                      aws.String(roleArn),
+			AssumeRolePolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[]}`),
+			MaxSessionDuration:       3600,
+			Name:                     aws.String("prod-app"),
+			Path:                     aws.String("/"),
+		}},
+	}
+	got, err := render.RenderString(set, render.NewLogicalIDs(nil), render.Options{
+		Substitutions:      []render.Substitution{{Value: "prod", Parameter: "Environment"}},
+		ResourceConditions: map[string]string{roleArn: "App"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(got)
+}
+
+// setParameters sets --parameter to values for the duration of the test.
+func setParameters(t *testing.T, values map[string]string) {
+	saved := parameterValue
+	parameterValue = values
+	t.Cleanup(func() { parameterValue = saved })
+}
+
+func parameterKeys(params []cftypes.Parameter) string {
+	var s []string
+	for _, p := range params {
+		k := aws.ToString(p.ParameterKey)
+		switch {
+		case p.ParameterValue != nil:
+			k += "=" + *p.ParameterValue
+		case aws.ToBool(p.UsePreviousValue):
+			k += "=previous"
+		}
+		s = append(s, k)
+	}
+	return strings.Join(s, ",")
+}
+
+func TestTemplateParametersDefaults(t *testing.T) {
+	template := deployTemplate(t)
+
+	// A new stack takes the defaults of --substitute and --condition.
+	setParameters(t, nil)
+	params, err := templateParameters(template, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parameterKeys(params); got != "" {
+		t.Errorf("parameters of a new stack = %q, want none", got)
+	}
+
+	setParameters(t, map[string]string{"Environment": "staging", "CreateApp": "false"})
+	params, err = templateParameters(template, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := parameterKeys(params), "Environment=staging,CreateApp=false"; got != want {
+		t.Errorf("parameters = %q, want %q", got, want)
+	}
+}
+
+func TestTemplateParametersUpdate(t *testing.T) {
+	template := deployTemplate(t)
+	setParameters(t, nil)
+
+	// The stack was deployed before --condition added CreateApp: it keeps
+	// its Environment, and CreateApp takes its default.
+	params, err := templateParameters(template, map[string]bool{"Environment": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := parameterKeys(params), "Environment=previous"; got != want {
+		t.Errorf("parameters = %q, want %q", got, want)
+	}
+}
+
+func TestTemplateParametersRequired(t *testing.T) {
+	template := []byte("Parameters:\n  Name:\n    Type: String\nResources: {}\n")
+	setParameters(t, nil)
+
+	if _, err := templateParameters(template, nil); err == nil || !strings.Contains(err.Error(), "--parameter Name=") {
+		t.Errorf("a parameter without a default or value gave %v, want an error", err)
+	}
+	if _, err := templateParameters(template, map[string]bool{"Other": true}); err == nil {
+		t.Error("a parameter the stack does not have took its previous value")
+	}
+	params, err := templateParameters(template, map[string]bool{"Name": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := parameterKeys(params), "Name=previous"; got != want {
+		t.Errorf("parameters = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/diff"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// readTemplate returns the template to diff against: the file given to
+// diff, or the template of the stack named by --stack-name.
+func readTemplate(ctx context.Context, cfg aws.Config) ([]byte, error) {
+	if *stackName == "" {
+		return os.ReadFile(diffTemplate)
+	}
+
+	out, err := cloudformation.NewFromConfig(cfg).GetTemplate(ctx, &cloudformation.GetTemplateInput{
+		StackName:     stackName,
+		TemplateStage: cftypes.TemplateStageOriginal,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stack %s: %w", *stackName, err)
+	}
+	return []byte(aws.ToString(out.TemplateBody)), nil
+}
+
+// runDiff prints the differences between the existing template and the one
+// generated from resources, and reports whether there are any.
+func runDiff(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) (bool, error) {
+	old, err := readTemplate(ctx, cfg)
+	if err != nil {
+		return false, err
+	}
+
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return false, err
+	}
+
+	changes, err := diff.Templates(old, b.Bytes())
+	if err != nil {
+		return false, err
+	}
+	if err := diff.Write(out, changes); err != nil {
+		return false, err
+	}
+	if len(changes) > 0 {
+		source := diffTemplate
+		if *stackName != "" {
+			source = "stack " + *stackName
+		}
+		subject := fmt.Sprintf("%d IAM resources differ from %s", len(changes), source)
+		if err := notifyChanges(ctx, cfg, subject, changes); err != nil {
+			return false, err
+		}
+	}
+	return len(changes) > 0, nil
+}
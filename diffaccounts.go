@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log/slog"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/diff"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+var (
+	accountA = flag.String("account-a", "", "with diff-accounts, the profile or role ARN of the first account")
+	accountB = flag.String("account-b", "", "with diff-accounts, the profile or role ARN of the second account")
+)
+
+// accountConfig returns the configuration to read the account given by
+// account: a role ARN assumed with the default credentials, or a profile.
+func accountConfig(ctx context.Context, cfg aws.Config, account string) (aws.Config, error) {
+	if !strings.HasPrefix(account, "arn:") {
+		return loadConfig(ctx, config.WithSharedConfigProfile(account))
+	}
+	cfg = cfg.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), account, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = "iam-cf-generator"
+	}))
+	return cfg, nil
+}
+
+// accountTemplate fetches the requested resource types from account and
+// returns their template, with the account ID, region and partition
+// replaced by pseudo parameters so that it compares equal to the template
+// of an account holding the same resources.
+func accountTemplate(ctx context.Context, cfg aws.Config, account string, cmds []string) ([]byte, error) {
+	cfg, err := accountConfig(ctx, cfg, account)
+	if err != nil {
+		return nil, err
+	}
+	p, err := transform.NewParameterizer(ctx, sts.NewFromConfig(cfg), cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Fetching account", "account", p.AccountID, "from", account, "types", strings.Join(cmds, ","))
+
+	var resources *model.ResourceSet
+	if resources, err = fetch(ctx, iam.NewFromConfig(cfg), ssoadmin.NewFromConfig(cfg), cmds, nil); err != nil {
+		return nil, err
+	}
+	if err := p.Apply(resources); err != nil {
+		return nil, err
+	}
+
+	b := bytes.Buffer{}
+	opts := render.Options{PreserveNames: *preserveNames}
+	if err := render.Write(&b, resources, render.NewLogicalIDs(nil), opts); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// runDiffAccounts prints the resources that exist only in --account-a or
+// --account-b, or differ between them, and reports whether there are any.
+func runDiffAccounts(ctx context.Context, cfg aws.Config, cmds []string) (bool, error) {
+	a, err := accountTemplate(ctx, cfg, *accountA, cmds)
+	if err != nil {
+		return false, err
+	}
+	b, err := accountTemplate(ctx, cfg, *accountB, cmds)
+	if err != nil {
+		return false, err
+	}
+
+	changes, err := diff.Templates(a, b)
+	if err != nil {
+		return false, err
+	}
+	slog.Info("Compared accounts; - only in --account-a, + only in --account-b", "differ", len(changes), "accountA", *accountA, "accountB", *accountB)
+	if err := diff.Write(out, changes); err != nil {
+		return false, err
+	}
+	return len(changes) > 0, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"gopkg.in/yaml.v3"
+)
+
+// driftPollInterval is how often the status of a drift detection is
+// checked.
+const driftPollInterval = 5 * time.Second
+
+// detectDrift runs drift detection on the stack named by --stack-name and
+// returns the resources that were modified or deleted outside of
+// CloudFormation.
+func detectDrift(ctx context.Context, client *cloudformation.Client) ([]cftypes.StackResourceDrift, error) {
+	start, err := client.DetectStackDrift(ctx, &cloudformation.DetectStackDriftInput{
+		StackName: stackName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stack %s: detecting drift: %w", *stackName, err)
+	}
+
+	for {
+		status, err := client.DescribeStackDriftDetectionStatus(ctx, &cloudformation.DescribeStackDriftDetectionStatusInput{
+			StackDriftDetectionId: start.StackDriftDetectionId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("stack %s: detecting drift: %w", *stackName, err)
+		}
+		if status.DetectionStatus != cftypes.StackDriftDetectionStatusDetectionInProgress {
+			// A failed detection still has results for the resources
+			// it could check.
+			if status.DetectionStatus == cftypes.StackDriftDetectionStatusDetectionFailed {
+				slog.Warn("Drift detection failed for some resources", "reason", aws.ToString(status.DetectionStatusReason))
+			}
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(driftPollInterval):
+		}
+	}
+
+	var drifts []cftypes.StackResourceDrift
+	pages := cloudformation.NewDescribeStackResourceDriftsPaginator(client, &cloudformation.DescribeStackResourceDriftsInput{
+		StackName: stackName,
+		StackResourceDriftStatusFilters: []cftypes.StackResourceDriftStatus{
+			cftypes.StackResourceDriftStatusModified,
+			cftypes.StackResourceDriftStatusDeleted,
+		},
+	})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("stack %s: listing drifted resources: %w", *stackName, err)
+		}
+		drifts = append(drifts, resp.StackResourceDrifts...)
+	}
+	return drifts, nil
+}
+
+// mappingValue returns the value under key in the mapping node n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue replaces the value under key in the mapping node n,
+// deleting the key when v is nil and appending it when missing.
+func setMappingValue(n *yaml.Node, key string, v *yaml.Node) {
+	if n == nil {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != key {
+			continue
+		}
+		if v == nil {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+		} else {
+			n.Content[i+1] = v
+		}
+		return
+	}
+	if v != nil {
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	}
+}
+
+// physicalNameKeys are the properties naming resources. They are kept from
+// the stack's template when updating a resource, as changing them would
+// replace it.
+var physicalNameKeys = []string{
+	"GroupName",
+	"ManagedPolicyName",
+	"Name",
+	"RoleName",
+	"ServerCertificateName",
+	"UserName",
+	"VirtualMfaDeviceName",
+}
+
+// templateResources parses template and returns its document node and
+// Resources mapping.
+func templateResources(template []byte) (*yaml.Node, *yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(template, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("empty template")
+	}
+	res := mappingValue(doc.Content[0], "Resources")
+	if res == nil {
+		return nil, nil, fmt.Errorf("template has no Resources")
+	}
+	return &doc, res, nil
+}
+
+// freshLogicalID returns the logical ID allocated for the resource of type
+// typ with the given physical ID, which is its name or ARN depending on the
+// type.
+func freshLogicalID(entries []render.MappingEntry, typ, physicalID string) (string, bool) {
+	for _, e := range entries {
+		if e.Type != typ {
+			continue
+		}
+		if physicalID == e.Name || (e.Arn != "" && strings.Contains(physicalID, e.Arn)) {
+			return e.LogicalID, true
+		}
+	}
+	return "", false
+}
+
+// updateResource replaces the properties of the resource node r with
+// props, but for its physical names, kept as the template writes them, be
+// it a string or an intrinsic function in either form.
+func updateResource(r, props *yaml.Node) {
+	oldProps := mappingValue(r, "Properties")
+	for _, key := range physicalNameKeys {
+		if v := mappingValue(oldProps, key); v != nil {
+			setMappingValue(props, key, v)
+		}
+	}
+	setMappingValue(r, "Properties", props)
+}
+
+// runDrift detects drift on the stack named by --stack-name and writes its
+// template to stdout with the properties of every modified resource taken
+// from resources, and every deleted resource removed.
+func runDrift(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	client := cloudformation.NewFromConfig(cfg)
+
+	old, err := readTemplate(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	doc, oldRes, err := templateResources(old)
+	if err != nil {
+		return fmt.Errorf("stack %s: %w", *stackName, err)
+	}
+
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	fresh, freshRes, err := templateResources(b.Bytes())
+	if err != nil {
+		return err
+	}
+
+	drifts, err := detectDrift(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, d := range drifts {
+		id := aws.ToString(d.LogicalResourceId)
+		typ := aws.ToString(d.ResourceType)
+
+		if d.StackResourceDriftStatus == cftypes.StackResourceDriftStatusDeleted {
+			setMappingValue(oldRes, id, nil)
+			slog.Info("Resource was deleted; removed it from the template", "logicalId", id, "type", typ)
+			continue
+		}
+
+		freshID, ok := freshLogicalID(ids.Entries(), typ, aws.ToString(d.PhysicalResourceId))
+		if !ok {
+			slog.Warn("Resource was modified but not fetched; left unchanged", "logicalId", id, "type", typ)
+			continue
+		}
+		updateResource(mappingValue(oldRes, id), mappingValue(mappingValue(freshRes, freshID), "Properties"))
+		changed = true
+		slog.Info("Resource was modified; updated it from the live resource", "logicalId", id, "type", typ)
+	}
+
+	// Updated resources may refer to parameters, such as user passwords,
+	// that the stack does not have yet.
+	if params := mappingValue(fresh.Content[0], "Parameters"); changed && params != nil {
+		oldParams := mappingValue(doc.Content[0], "Parameters")
+		if oldParams == nil {
+			oldParams = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingValue(doc.Content[0], "Parameters", oldParams)
+		}
+		for i := 0; i+1 < len(params.Content); i += 2 {
+			if mappingValue(oldParams, params.Content[i].Value) == nil {
+				setMappingValue(oldParams, params.Content[i].Value, params.Content[i+1])
+			}
+		}
+	}
+
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// renderRole renders the role prod-app, with an inline policy and the
+// description description, with opts.
+func renderRole(t *testing.T, description string, opts render.Options) []byte {
+	t.Helper()
+	set := &model.ResourceSet{
+		Roles: model.RoleResources{{
+			Arn:                      aws.String(roleArn),
+			AssumeRolePolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[]}`),
+			Description:              aws.String(description),
+			MaxSessionDuration:       3600,
+			Name:                     aws.String("prod-app"),
+			Path:                     aws.String("/"),
+			Policies: model.PolicyResources{{
+				Name:           aws.String("s3"),
+				PolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`),
+			}},
+		}},
+	}
+	opts.Provenance = &render.Provenance{AccountID: "123456789012"}
+	got, err := render.RenderString(set, render.NewLogicalIDs(nil), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(got)
+}
+
+func TestUpdateResourceKeepsNames(t *testing.T) {
+	for _, long := range []bool{false, true} {
+		// The stack names the role with !Sub of --substitute, the
+		// fresh template with the name IAM holds.
+		_, oldRes, err := templateResources(renderRole(t, "v1", render.Options{
+			PreserveNames:  true,
+			Substitutions:  []render.Substitution{{Value: "prod", Parameter: "Environment"}},
+			LongIntrinsics: long,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, freshRes, err := templateResources(renderRole(t, "v2", render.Options{PreserveNames: true}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := oldRes.Content[0].Value
+		updateResource(mappingValue(oldRes, id), mappingValue(mappingValue(freshRes, id), "Properties"))
+
+		var props map[string]interface{}
+		if err := mappingValue(mappingValue(oldRes, id), "Properties").Decode(&props); err != nil {
+			t.Fatal(err)
+		}
+		if props["Description"] != "v2" {
+			t.Errorf("long %v: Description = %v, want v2", long, props["Description"])
+		}
+		name := mappingValue(mappingValue(mappingValue(oldRes, id), "Properties"), "RoleName")
+		var got, want interface{} = name.Tag + " " + name.Value, "!Sub ${Environment}-app"
+		if long {
+			var m map[string]interface{}
+			if err := name.Decode(&m); err != nil {
+				t.Fatal(err)
+			}
+			got, want = m, map[string]interface{}{"Fn::Sub": "${Environment}-app"}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("long %v: RoleName = %v, want %v", long, got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var dryRun = flag.Bool("dry-run", false, "only list the resources that would be exported, with their logical IDs and policy document sizes, and those left out, without fetching their details or writing the template")
+
+// maxTemplateResources is the number of resources CloudFormation accepts in
+// a template.
+const maxTemplateResources = 500
+
+// writePlan writes the resources that would be exported to stdout, with
+// the logical IDs they would get and the size of their policy documents,
+// followed by their number and those of the resources left out, by reason.
+func writePlan(resources *model.ResourceSet, ids *render.LogicalIDs) error {
+	if len(renames) > 0 {
+		if err := transform.Rename(resources, renames); err != nil {
+			return err
+		}
+	}
+	if err := render.AllocateLogicalIDs(resources, ids); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tLOGICAL ID\tSIZE\tARN")
+	var counts []string
+	total := 0
+	row := func(typ, name, id, size, arn string) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", typ, name, id, size, arn)
+	}
+	count := func(n int, one, many string) {
+		switch {
+		case n == 1:
+			counts = append(counts, "1 "+one)
+		case n > 1:
+			counts = append(counts, fmt.Sprintf("%d %s", n, many))
+		}
+		total += n
+	}
+	for _, p := range resources.Policies {
+		row("policy", *p.Name, p.LogicalID, documentSize(p.PolicyDocument), *p.Arn)
+	}
+	count(len(resources.Policies), "policy", "policies")
+	for _, g := range resources.Groups {
+		row("group", *g.Name, g.LogicalID, documentSize(inlineDocuments(g.Policies)...), *g.Arn)
+	}
+	count(len(resources.Groups), "group", "groups")
+	for _, r := range resources.Roles {
+		row("role", *r.Name, r.LogicalID, documentSize(append(inlineDocuments(r.Policies), r.AssumeRolePolicyDocument)...), *r.Arn)
+	}
+	count(len(resources.Roles), "role", "roles")
+	for _, u := range resources.Users {
+		row("user", *u.Name, u.LogicalID, documentSize(inlineDocuments(u.Policies)...), *u.Arn)
+	}
+	count(len(resources.Users), "user", "users")
+	for _, c := range resources.ServerCertificates {
+		row("server-certificate", *c.Name, c.LogicalID, "-", *c.Arn)
+	}
+	count(len(resources.ServerCertificates), "server certificate", "server certificates")
+	for _, d := range resources.VirtualMFADevices {
+		row("virtual-mfa-device", *d.Name, d.LogicalID, "-", *d.Arn)
+	}
+	count(len(resources.VirtualMFADevices), "virtual MFA device", "virtual MFA devices")
+	for _, p := range resources.InstanceProfiles {
+		row("instance-profile", *p.Name, p.LogicalID, "-", *p.Arn)
+	}
+	count(len(resources.InstanceProfiles), "instance profile", "instance profiles")
+	for _, p := range resources.Providers {
+		row(string(p.Kind)+"-provider", *p.Name, p.LogicalID, "-", *p.Arn)
+	}
+	count(len(resources.Providers), "identity provider", "identity providers")
+	if a := resources.Account; a != nil {
+		n := 0
+		if a.Alias != nil {
+			row("account-alias", *a.Alias.Name, a.Alias.LogicalID, "-", "")
+			n++
+		}
+		if a.PasswordPolicy != nil {
+			row("password-policy", "", a.PasswordPolicy.LogicalID, "-", "")
+			n++
+		}
+		count(n, "account setting", "account settings")
+	}
+	for _, ps := range resources.PermissionSets {
+		row("sso-permission-set", aws.ToString(ps.Name), ps.LogicalID, documentSize(ps.InlinePolicy), *ps.Arn)
+	}
+	count(len(resources.PermissionSets), "permission set", "permission sets")
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%d resources", total)
+	if len(counts) > 0 {
+		fmt.Fprintf(out, ": %s", strings.Join(counts, ", "))
+	}
+	fmt.Fprintln(out)
+	if total > maxTemplateResources {
+		fmt.Fprintf(out, "CloudFormation accepts %d resources per template; use --split to write nested stacks\n", maxTemplateResources)
+	}
+	return writeSkipped()
+}
+
+// writeSkipped writes the number of resources left out for every reason
+// they were, e.g. path for those left out by --exclude-path, to stdout.
+func writeSkipped() error {
+	if len(skipped) == 0 {
+		return nil
+	}
+	reasons := make([]string, 0, len(skipped))
+	for r := range skipped {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	fmt.Fprintln(out)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LEFT OUT BY\tRESOURCES")
+	for _, r := range reasons {
+		fmt.Fprintf(tw, "%s\t%d\n", r, skipped[r])
+	}
+	return tw.Flush()
+}
+
+// documentSize returns the number of characters IAM counts of docs, or -
+// when none of them is known, e.g. policy documents only listed.
+func documentSize(docs ...*string) string {
+	n, known := 0, false
+	for _, d := range docs {
+		if d != nil {
+			n += analyze.PolicySize(d)
+			known = true
+		}
+	}
+	if !known {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
+
+// inlineDocuments returns the documents of the inline policies of policies.
+func inlineDocuments(policies model.PolicyResources) []*string {
+	docs := make([]*string, 0, len(policies))
+	for _, p := range policies {
+		docs = append(docs, p.PolicyDocument)
+	}
+	return docs
+}
@@ -0,0 +1,14 @@
+package main
+
+import "github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+
+// endpointFor returns the endpoint override for service, taken from
+// --endpoint-url, AWS_ENDPOINT_URL_<SERVICE> or AWS_ENDPOINT_URL in that
+// order, as used with LocalStack or moto. It returns an empty string when
+// no override is set.
+func endpointFor(service string) string {
+	if *endpointURL != "" {
+		return *endpointURL
+	}
+	return iamexport.EndpointFromEnv(service)
+}
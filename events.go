@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/cache"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+var eventsQueue = flag.String("events-queue", "", "keep running, consuming the IAM API calls CloudTrail records from this SQS queue `url`, fed by an EventBridge rule, to fetch again only the resources they changed into --cache-dir and run the command again")
+
+// eventParameters are the request parameters of IAM API calls naming the
+// resources they change, and the types of those resources. Renamed groups
+// and users are named by both their old and new names.
+var eventParameters = map[string]string{
+	"groupName":                "groups",
+	"newGroupName":             "groups",
+	"policyArn":                "policies",
+	"roleName":                 "roles",
+	"userName":                 "users",
+	"newUserName":              "users",
+	"serverCertificateName":    "server-certificates",
+	"newServerCertificateName": "server-certificates",
+	"instanceProfileName":      "instance-profiles",
+	"openIDConnectProviderArn": "providers",
+	"sAMLProviderArn":          "providers",
+}
+
+// iamEvent is the part of a CloudTrail event delivered by EventBridge read
+// to find the resources an IAM API call changed.
+type iamEvent struct {
+	Source string `json:"source"`
+	Detail struct {
+		EventName         string                 `json:"eventName"`
+		ErrorCode         string                 `json:"errorCode"`
+		RequestParameters map[string]interface{} `json:"requestParameters"`
+	} `json:"detail"`
+}
+
+// changedResources returns the names, or ARNs, of the resources changed by
+// the IAM API calls in the events of messages, by resource type. Messages
+// that are not IAM events, and calls that failed, are ignored.
+func changedResources(messages []sqstypes.Message) map[string][]string {
+	changed := map[string][]string{}
+	for _, m := range messages {
+		var e iamEvent
+		if err := json.Unmarshal([]byte(aws.ToString(m.Body)), &e); err != nil || e.Source != "aws.iam" {
+			slog.Warn("Ignoring message that is not an IAM event", "id", aws.ToString(m.MessageId))
+			continue
+		}
+		if e.Detail.ErrorCode != "" {
+			continue
+		}
+		params := e.Detail.RequestParameters
+		for param, typ := range eventParameters {
+			if name, ok := params[param].(string); ok {
+				changed[typ] = append(changed[typ], name)
+				slog.Debug("Resource changed", "event", e.Detail.EventName, "type", typ, "name", name)
+			}
+		}
+		// Managed policies and identity providers have no ARN before they
+		// are created, and the policyName of other calls is that of an
+		// inline policy.
+		switch e.Detail.EventName {
+		case "CreatePolicy":
+			if name, ok := params["policyName"].(string); ok {
+				changed["policies"] = append(changed["policies"], name)
+			}
+		case "CreateOpenIDConnectProvider":
+			if url, ok := params["url"].(string); ok {
+				changed["providers"] = append(changed["providers"], strings.TrimPrefix(url, "https://"))
+			}
+		case "CreateSAMLProvider":
+			if name, ok := params["name"].(string); ok {
+				changed["providers"] = append(changed["providers"], name)
+			}
+		}
+	}
+	return changed
+}
+
+// runEvents runs the command, then consumes --events-queue until it is
+// interrupted. For every batch of events, the resources they changed are
+// fetched again into --cache-dir, or removed from it when they no longer
+// exist, and the command is run again from the cache, so that the account
+// is only listed in full the first time. Messages are deleted once the
+// command succeeds; otherwise SQS delivers them again.
+func runEvents(ctx context.Context, cfg aws.Config, cmds []string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Snapshots never expire: they are listed in full once, then kept up
+	// to date by the events.
+	c := &cache.Cache{Dir: *cacheDir}
+	client := iam.NewFromConfig(cfg)
+	if err := refresh(ctx, client, c, cmds); err != nil {
+		return err
+	}
+	args := []string{"--events-queue=", "--cache-ttl=0"}
+	if err := rerun(ctx, args...); err != nil {
+		return err
+	}
+
+	queue := sqs.NewFromConfig(cfg)
+	for {
+		resp, err := queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            eventsQueue,
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+		})
+		if ctx.Err() != nil {
+			slog.Info("Stopped consuming events")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(resp.Messages) == 0 {
+			continue
+		}
+
+		changed := changedResources(resp.Messages)
+		updated := false
+		for _, typ := range cmds {
+			if len(changed[typ]) == 0 {
+				continue
+			}
+			if err = refetch(ctx, client, c, typ, changed[typ]); err != nil {
+				break
+			}
+			updated = true
+		}
+		if err == nil && updated {
+			err = rerun(ctx, args...)
+		}
+		if ctx.Err() != nil {
+			slog.Info("Stopped consuming events")
+			return nil
+		}
+		if err != nil {
+			slog.Error("Run failed, retrying once the events are delivered again", "error", err)
+			continue
+		}
+
+		var entries []sqstypes.DeleteMessageBatchRequestEntry
+		for _, m := range resp.Messages {
+			entries = append(entries, sqstypes.DeleteMessageBatchRequestEntry{Id: m.MessageId, ReceiptHandle: m.ReceiptHandle})
+		}
+		if _, err := queue.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{QueueUrl: eventsQueue, Entries: entries}); err != nil {
+			return err
+		}
+	}
+}
+
+// refresh fetches the resources of types in full into the snapshots of c,
+// so that the changes made before the events are consumed are not missed.
+func refresh(ctx context.Context, client iamexport.Client, c *cache.Cache, types []string) error {
+	opts := iamexport.FetchOptions{Concurrency: *concurrency, Progress: logProgress}
+	for _, typ := range types {
+		set := &model.ResourceSet{}
+		if err := iamexport.Fetch(ctx, client, nil, typ, set, opts); err != nil {
+			return err
+		}
+		if err := c.Store(typ, iamexport.ResourceField(set, typ)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refetch fetches the resources of type typ called, or with the ARNs,
+// names again and replaces them in the snapshot of c. Resources that no
+// longer exist are removed from it. Types without a snapshot are left to
+// be fetched in full by the command.
+func refetch(ctx context.Context, client iamexport.Client, c *cache.Cache, typ string, names []string) error {
+	sort.Strings(names)
+	slog.Info("Fetching changed resources", "type", typ, "names", names)
+	selected := func(name, arn *string) bool {
+		for _, n := range names {
+			if n == aws.ToString(name) || n == aws.ToString(arn) {
+				return true
+			}
+		}
+		return false
+	}
+
+	cached := &model.ResourceSet{}
+	if ok, err := c.Load(typ, iamexport.ResourceField(cached, typ)); !ok || err != nil {
+		return err
+	}
+	fetched := &model.ResourceSet{}
+	opts := iamexport.FetchOptions{Concurrency: *concurrency, Names: names}
+	if err := iamexport.Fetch(ctx, client, nil, typ, fetched, opts); err != nil {
+		return err
+	}
+
+	// The resources of every type with events are slices of structs with a
+	// Name and an Arn; those not named are kept from the snapshot.
+	dst := reflect.ValueOf(iamexport.ResourceField(fetched, typ)).Elem()
+	src := reflect.ValueOf(iamexport.ResourceField(cached, typ)).Elem()
+	for i := 0; i < src.Len(); i++ {
+		r := src.Index(i)
+		if !selected(r.FieldByName("Name").Interface().(*string), r.FieldByName("Arn").Interface().(*string)) {
+			dst.Set(reflect.Append(dst, r))
+		}
+	}
+	return c.Store(typ, dst.Addr().Interface())
+}
+
+// hasEvents reports whether the changes to resources of type typ are read
+// from the events of --events-queue.
+func hasEvents(typ string) bool {
+	for _, t := range eventParameters {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/cache"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/iamfake"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func fakeRole(name, description string) iamfake.Role {
+	return iamfake.Role{Role: types.Role{
+		Arn:                      aws.String("arn:aws:iam::123456789012:role/" + name),
+		AssumeRolePolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[]}`),
+		Description:              aws.String(description),
+		Path:                     aws.String("/"),
+		RoleName:                 aws.String(name),
+	}}
+}
+
+func TestRefetch(t *testing.T) {
+	ctx := context.Background()
+	c := &cache.Cache{Dir: t.TempDir()}
+	client := &iamfake.Client{Roles: []iamfake.Role{fakeRole("app", "v1"), fakeRole("old", "v1"), fakeRole("web", "v1")}}
+	if err := refresh(ctx, client, c, []string{"roles"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// app changed and old was deleted; the change to web has no event.
+	client.Roles = []iamfake.Role{fakeRole("app", "v2"), fakeRole("web", "v2")}
+	if err := refetch(ctx, client, c, "roles", []string{"app", "arn:aws:iam::123456789012:role/old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var roles model.RoleResources
+	if ok, err := c.Load("roles", &roles); !ok || err != nil {
+		t.Fatalf("no snapshot of roles: %v", err)
+	}
+	got := map[string]string{}
+	for _, r := range roles {
+		got[aws.ToString(r.Name)] = aws.ToString(r.Description)
+	}
+	if len(got) != 2 || got["app"] != "v2" || got["web"] != "v1" {
+		t.Errorf("snapshot = %v, want app from the account and web from the snapshot", got)
+	}
+}
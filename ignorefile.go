@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/ignore"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+)
+
+// defaultIgnoreFile is the ignore file read from the working directory
+// when there is no --ignore-file.
+const defaultIgnoreFile = ".iamcfignore"
+
+var ignoreFile = flag.String("ignore-file", "", "leave out the resources matching the patterns in this `file` (default "+defaultIgnoreFile+" if it exists)")
+
+// ignoreRules are the rules of the ignore file, if any.
+var ignoreRules ignore.Rules
+
+// readIgnoreFile reads --ignore-file, or the default ignore file when it
+// exists.
+func readIgnoreFile() (ignore.Rules, error) {
+	path := *ignoreFile
+	if path == "" {
+		path = defaultIgnoreFile
+	}
+	rules, err := ignore.Read(path)
+	if *ignoreFile == "" && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if _, ok := resourceTypes[r.Type]; r.Type != "" && !ok {
+			return nil, fmt.Errorf("%s: invalid resource type %s", path, r.Type)
+		}
+	}
+	return rules, nil
+}
+
+// isIgnored reports whether the ignore file matches a resource, recording
+// those it does as skipped. It is called while fetching.
+func isIgnored(typ, name, arn string) bool {
+	if ignoreRules.Match(typ, name, arn) {
+		skip("ignore-file", 1)
+		return true
+	}
+	return false
+}
+
+// ignoreResources leaves out the resources matching the ignore file that
+// were not left out while fetching, e.g. those read from --input.
+func ignoreResources(resources *model.ResourceSet) {
+	n := transform.Filter(resources, func(typ, name, arn string) bool { return !ignoreRules.Match(typ, name, arn) })
+	skip("ignore-file", n)
+	if n > 0 {
+		slog.Info("Ignoring resources matching the ignore file", "resources", n)
+	}
+}
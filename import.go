@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// resourcesToImport returns the identifiers CloudFormation needs to import
+// every resource in resources. It fails for resources that can not be
+// imported, such as the account custom resources.
+func resourcesToImport(resources *model.ResourceSet) ([]cftypes.ResourceToImport, error) {
+	var l []cftypes.ResourceToImport
+	add := func(id, typ string, identifier map[string]string) {
+		l = append(l, cftypes.ResourceToImport{
+			LogicalResourceId:  aws.String(id),
+			ResourceType:       aws.String(typ),
+			ResourceIdentifier: identifier,
+		})
+	}
+
+	for _, p := range resources.Policies {
+		add(p.LogicalID, "AWS::IAM::ManagedPolicy", map[string]string{"PolicyArn": *p.Arn})
+	}
+	// Inline policies only have logical IDs of their own when written as
+	// resources with --standalone-policies.
+	for _, g := range resources.Groups {
+		add(g.LogicalID, "AWS::IAM::Group", map[string]string{"GroupName": *g.Name})
+		for _, p := range g.Policies {
+			if p.LogicalID != "" {
+				add(p.LogicalID, "AWS::IAM::GroupPolicy", map[string]string{"GroupName": *g.Name, "PolicyName": *p.Name})
+			}
+		}
+	}
+	for _, r := range resources.Roles {
+		add(r.LogicalID, "AWS::IAM::Role", map[string]string{"RoleName": *r.Name})
+		for _, p := range r.Policies {
+			if p.LogicalID != "" {
+				add(p.LogicalID, "AWS::IAM::RolePolicy", map[string]string{"PolicyName": *p.Name, "RoleName": *r.Name})
+			}
+		}
+	}
+	for _, u := range resources.Users {
+		add(u.LogicalID, "AWS::IAM::User", map[string]string{"UserName": *u.Name})
+		for _, p := range u.Policies {
+			if p.LogicalID != "" {
+				add(p.LogicalID, "AWS::IAM::UserPolicy", map[string]string{"PolicyName": *p.Name, "UserName": *u.Name})
+			}
+		}
+	}
+	for _, c := range resources.ServerCertificates {
+		add(c.LogicalID, "AWS::IAM::ServerCertificate", map[string]string{"ServerCertificateName": *c.Name})
+	}
+	for _, d := range resources.VirtualMFADevices {
+		add(d.LogicalID, "AWS::IAM::VirtualMFADevice", map[string]string{"SerialNumber": *d.Arn})
+	}
+	for _, p := range resources.InstanceProfiles {
+		add(p.LogicalID, "AWS::IAM::InstanceProfile", map[string]string{"InstanceProfileName": *p.Name})
+	}
+	for _, p := range resources.Providers {
+		if p.Kind == model.OIDCProvider {
+			add(p.LogicalID, "AWS::IAM::OIDCProvider", map[string]string{"Arn": *p.Arn})
+		} else {
+			add(p.LogicalID, "AWS::IAM::SAMLProvider", map[string]string{"Arn": *p.Arn})
+		}
+	}
+	for _, ps := range resources.PermissionSets {
+		add(ps.LogicalID, "AWS::SSO::PermissionSet", map[string]string{
+			"InstanceArn":      *ps.InstanceArn,
+			"PermissionSetArn": *ps.Arn,
+		})
+	}
+	if resources.Account != nil {
+		return nil, fmt.Errorf("the account alias and password policy are custom resources, which can not be imported")
+	}
+	return l, nil
+}
+
+// stackResources returns the logical IDs of the resources already in the
+// stack named by --stack-name.
+func stackResources(ctx context.Context, client *cloudformation.Client) (map[string]bool, error) {
+	ids := map[string]bool{}
+	pages := cloudformation.NewListStackResourcesPaginator(client, &cloudformation.ListStackResourcesInput{
+		StackName: stackName,
+	})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("stack %s: listing resources: %w", *stackName, err)
+		}
+		for _, r := range resp.StackResourceSummaries {
+			ids[aws.ToString(r.LogicalResourceId)] = true
+		}
+	}
+	return ids, nil
+}
+
+// writeImportStatus prints the final status of every imported resource, as
+// recorded in the stack events of the operation started with token.
+func writeImportStatus(ctx context.Context, client *cloudformation.Client, token string, imported []cftypes.ResourceToImport) error {
+	status := map[string]cftypes.StackEvent{}
+	pages := cloudformation.NewDescribeStackEventsPaginator(client, &cloudformation.DescribeStackEventsInput{
+		StackName: stackName,
+	})
+	// Events are listed newest first, so the first one seen for a resource
+	// is its final status.
+done:
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("stack %s: listing events: %w", *stackName, err)
+		}
+		for _, e := range resp.StackEvents {
+			if aws.ToString(e.ClientRequestToken) != token {
+				continue
+			}
+			id := aws.ToString(e.LogicalResourceId)
+			if id == *stackName && e.ResourceStatus == cftypes.ResourceStatusImportInProgress {
+				break done
+			}
+			if _, ok := status[id]; !ok {
+				status[id] = e
+			}
+		}
+	}
+
+	b := bytes.Buffer{}
+	for _, r := range imported {
+		id := aws.ToString(r.LogicalResourceId)
+		e, ok := status[id]
+		if !ok {
+			fmt.Fprintf(&b, "%-24s %s (%s)\n", "NOT_STARTED", id, aws.ToString(r.ResourceType))
+			continue
+		}
+		fmt.Fprintf(&b, "%-24s %s (%s)", e.ResourceStatus, id, aws.ToString(r.ResourceType))
+		if reason := aws.ToString(e.ResourceStatusReason); reason != "" {
+			fmt.Fprintf(&b, ": %s", reason)
+		}
+		b.WriteString("\n")
+	}
+	_, err := out.Write(b.Bytes())
+	return err
+}
+
+// waitForStack waits until no operation is in progress on the stack.
+func waitForStack(ctx context.Context, client *cloudformation.Client, stackID *string) error {
+	for {
+		out, err := client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: stackID})
+		if err != nil {
+			return err
+		}
+		if len(out.Stacks) == 0 || !strings.HasSuffix(string(out.Stacks[0].StackStatus), "_IN_PROGRESS") {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(driftPollInterval):
+		}
+	}
+}
+
+// deleteFailedStack deletes a stack created only to import resources into,
+// after the import failed. Imported resources are retained.
+func deleteFailedStack(ctx context.Context, client *cloudformation.Client, stackID *string) error {
+	if _, err := client.DeleteStack(ctx, &cloudformation.DeleteStackInput{StackName: stackID}); err != nil {
+		return err
+	}
+	return cloudformation.NewStackDeleteCompleteWaiter(client).Wait(ctx, &cloudformation.DescribeStacksInput{
+		StackName: stackID,
+	}, deployWait)
+}
+
+// runImport imports resources into the stack named by --stack-name,
+// creating it if needed, and prints the status of every resource. When
+// the import fails the stack is rolled back, and deleted if it was created
+// for the import.
+func runImport(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	client := cloudformation.NewFromConfig(cfg)
+
+	// Imported resources must keep their names and have a DeletionPolicy,
+	// and retaining them means a failed import never deletes anything.
+	opts.PreserveNames = true
+	opts.DeletionPolicies = map[string]string{"": "Retain"}
+
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	template := b.Bytes()
+	if err := checkLimits(resources, template); err != nil {
+		return err
+	}
+
+	all, err := resourcesToImport(resources)
+	if err != nil {
+		return err
+	}
+	exists, err := stackExists(ctx, client)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	if exists {
+		if existing, err = stackResources(ctx, client); err != nil {
+			return err
+		}
+	}
+	var imported []cftypes.ResourceToImport
+	for _, r := range all {
+		if !existing[aws.ToString(r.LogicalResourceId)] {
+			imported = append(imported, r)
+		}
+	}
+	if len(imported) == 0 {
+		slog.Info("Every resource is already part of the stack", "stack", *stackName)
+		return nil
+	}
+
+	var previous map[string]bool
+	if exists {
+		if previous, err = stackParameters(ctx, client); err != nil {
+			return err
+		}
+	}
+	params, err := templateParameters(template, previous)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("iam-cf-generator-import-%d", time.Now().Unix())
+	in := &cloudformation.CreateChangeSetInput{
+		StackName:         stackName,
+		ChangeSetName:     aws.String(name),
+		ChangeSetType:     cftypes.ChangeSetTypeImport,
+		Capabilities:      []cftypes.Capability{cftypes.CapabilityCapabilityIam, cftypes.CapabilityCapabilityNamedIam},
+		Parameters:        params,
+		ResourcesToImport: imported,
+	}
+	if in.TemplateBody, in.TemplateURL, err = templateSource(ctx, cfg, *stackName, template); err != nil {
+		return err
+	}
+
+	cs, err := client.CreateChangeSet(ctx, in)
+	if err != nil {
+		return fmt.Errorf("stack %s: creating import change set: %w", *stackName, err)
+	}
+
+	err = cloudformation.NewChangeSetCreateCompleteWaiter(client).Wait(ctx, &cloudformation.DescribeChangeSetInput{
+		ChangeSetName: cs.Id,
+	}, deployWait)
+	if err != nil {
+		if out, derr := client.DescribeChangeSet(ctx, &cloudformation.DescribeChangeSetInput{ChangeSetName: cs.Id}); derr == nil && out.StatusReason != nil {
+			err = fmt.Errorf("%s", aws.ToString(out.StatusReason))
+		}
+		// Nothing has been imported yet; remove what the change set left
+		// behind.
+		if exists {
+			_, derr := client.DeleteChangeSet(ctx, &cloudformation.DeleteChangeSetInput{ChangeSetName: cs.Id})
+			if derr != nil {
+				slog.Warn("Deleting change set failed", "changeSet", aws.ToString(cs.Id), "error", derr)
+			}
+		} else if derr := deleteFailedStack(ctx, client, cs.StackId); derr != nil {
+			slog.Warn("Deleting stack failed", "stack", *stackName, "error", derr)
+		}
+		return fmt.Errorf("stack %s: creating import change set: %w", *stackName, err)
+	}
+
+	if err := writeChangeSet(ctx, client, cs.Id); err != nil {
+		return err
+	}
+
+	_, err = client.ExecuteChangeSet(ctx, &cloudformation.ExecuteChangeSetInput{
+		ChangeSetName:      cs.Id,
+		ClientRequestToken: aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("stack %s: executing import change set: %w", *stackName, err)
+	}
+	importErr := cloudformation.NewStackImportCompleteWaiter(client).Wait(ctx, &cloudformation.DescribeStacksInput{
+		StackName: cs.StackId,
+	}, deployWait)
+
+	if err := writeImportStatus(ctx, client, name, imported); err != nil {
+		slog.Warn(err.Error())
+	}
+	if importErr == nil {
+		slog.Info("Imported resources into stack", "resources", len(imported), "stack", *stackName)
+		return nil
+	}
+
+	// CloudFormation rolls a failed import back on its own, releasing the
+	// resources it did import.
+	if !exists {
+		err := waitForStack(ctx, client, cs.StackId)
+		if err == nil {
+			err = deleteFailedStack(ctx, client, cs.StackId)
+		}
+		if err != nil {
+			slog.Warn("Deleting stack failed", "stack", *stackName, "error", err)
+		}
+	}
+	return fmt.Errorf("stack %s: import failed: %w", *stackName, importErr)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var timeout = flag.Duration("timeout", 0, "give up, cancelling the requests in flight, after this `duration`, e.g. 15m")
+
+// commandContext returns the context of the API requests of the command,
+// cancelled on SIGINT or SIGTERM, or once --timeout has elapsed.
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// A second signal kills the command right away.
+		stop()
+	}()
+	if *timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// cancelled handles err when it comes from the command being interrupted or
+// timing out: the output rendered so far is written, and the command exits
+// with status 130 or 1, respectively. Other errors are left to the caller.
+func cancelled(err error) {
+	var status int
+	switch {
+	case errors.Is(err, context.Canceled):
+		slog.Error("Interrupted")
+		status = 130
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.Error("Timed out", "timeout", timeout.String())
+		status = exitError
+	default:
+		return
+	}
+	if b, ok := out.(*bytes.Buffer); ok && b.Len() > 0 {
+		slog.Warn("Writing the incomplete output rendered so far")
+		writeOutput()
+	}
+	if err := writeResult(nil, status, err); err != nil {
+		slog.Error(err.Error())
+	}
+	os.Exit(status)
+}
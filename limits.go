@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var ignoreLimits = flag.Bool("ignore-limits", false, "only warn about the CloudFormation limits and IAM quotas the template exceeds, instead of failing")
+
+// checkLimits logs the CloudFormation limits template exceeds and the IAM
+// quotas the resources exceed, and fails unless they are only warnings or
+// --ignore-limits is given. template may be nil to only check the quotas.
+func checkLimits(resources *model.ResourceSet, template []byte) error {
+	violations, err := analyze.CheckLimits(resources, template)
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, v := range violations {
+		// Templates too large to pass inline are uploaded to the bucket.
+		if v.Limit == "inline-template-size" && *templateBucket != "" {
+			continue
+		}
+		if v.Warning || *ignoreLimits {
+			slog.Warn(v.Message, "resource", v.Resource, "limit", v.Limit)
+			continue
+		}
+		slog.Error(v.Message, "resource", v.Resource, "limit", v.Limit)
+		failed = true
+	}
+	if failed {
+		return errors.New("the template would fail to deploy, exceeding the limits above; use --ignore-limits to write it anyway")
+	}
+	return nil
+}
+
+// writeTemplate writes the CloudFormation template of resources to stdout,
+// once checked against the limits and, with --validate-template, validated.
+// With --s3-uri it is uploaded too, named after --output if given.
+func writeTemplate(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	template := b.Bytes()
+	if mergeBase != nil {
+		var err error
+		if template, err = mergeTemplates(mergeBase, template); err != nil {
+			return fmt.Errorf("%s: %w", *mergeTemplate, err)
+		}
+	}
+	if err := checkLimits(resources, template); err != nil {
+		return err
+	}
+	if *validateTemplate {
+		if err := runValidateTemplate(ctx, cfg, template); err != nil {
+			return err
+		}
+	}
+	if _, err := out.Write(template); err != nil {
+		return err
+	}
+	if *s3URI == "" {
+		return nil
+	}
+	u, err := newS3Uploader(cfg)
+	if err != nil {
+		return err
+	}
+	file := "template.yaml"
+	if *output != "" {
+		file = filepath.Base(*output)
+	}
+	_, err = u.upload(ctx, file, template)
+	return err
+}
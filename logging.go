@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	verbose = flag.Bool("v", false, "also log debug messages, such as every resource fetched")
+	quiet   = flag.Bool("q", false, "only log warnings and errors")
+)
+
+// setupLogging makes slog, and the log package through it, log to stderr
+// at the level of -v and -q, keeping stdout for the template.
+func setupLogging() {
+	level := slog.LevelInfo
+	switch {
+	case *verbose:
+		level = slog.LevelDebug
+	case *quiet:
+		level = slog.LevelWarn
+	}
+	slog.SetDefault(slog.New(warningRecorder{Handler: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})}))
+	// Debug messages would be drawn over by the bar.
+	if level == slog.LevelInfo && isTerminal(os.Stderr) {
+		progressBar = &bar{}
+	}
+}
+
+// fatal logs err and exits with status 1, or as cancelled does when the
+// command was interrupted or timed out.
+func fatal(err error) {
+	if progressBar != nil {
+		progressBar.clear()
+	}
+	cancelled(err)
+	slog.Error(err.Error())
+	if err := writeResult(nil, exitError, err); err != nil {
+		slog.Error(err.Error())
+	}
+	os.Exit(exitError)
+}
+
+// fatalf is like fatal with an error formatted as fmt.Errorf does.
+func fatalf(format string, args ...interface{}) {
+	fatal(fmt.Errorf(format, args...))
+}
+
+// progressEvery is the number of resources of a type between the progress
+// messages logged at info level.
+const progressEvery = 100
+
+// progressBar, when stderr is a terminal, draws the progress of fetching
+// on its last line instead of logging it.
+var progressBar *bar
+
+// barWidth is the number of characters of a progress bar.
+const barWidth = 30
+
+type bar struct {
+	mu sync.Mutex
+}
+
+// draw redraws the bar for done of total resources of type typ, and
+// clears it once they are all fetched.
+func (b *bar) draw(typ string, done, total int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if done == total {
+		b.clear()
+		return
+	}
+	filled := barWidth * done / total
+	fmt.Fprintf(os.Stderr, "\r\033[KFetching %s [%s%s] %d/%d",
+		typ, strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), done, total)
+}
+
+// clear erases the bar.
+func (b *bar) clear() {
+	fmt.Fprint(os.Stderr, "\r\033[K")
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// logProgress logs the progress of fetching resources of type typ: every
+// resource at debug level, and every progressEvery resources, and the
+// last, at info level. With a progress bar, only the last is logged.
+func logProgress(typ string, done, total int) {
+	if progressBar != nil {
+		progressBar.draw(typ, done, total)
+		if done < total {
+			return
+		}
+	}
+	level := slog.LevelDebug
+	if done%progressEvery == 0 || done == total {
+		level = slog.LevelInfo
+	}
+	slog.Log(context.Background(), level, "Fetched resources", "type", typ, "progress", fmt.Sprintf("%d/%d", done, total))
+}
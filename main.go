@@ -1,424 +1,873 @@
-// Package main provides all code
+// Package main provides the iam-cf-generator command.
 package main
 
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/url"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
-	"text/template"
-
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/cache"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/sqlite"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
-	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-func decodePolicy(p string) (*string, error) {
-	out := bytes.Buffer{}
-	pdoc, err := url.QueryUnescape(p)
-	if err != nil {
-		return nil, err
-	}
+var (
+	mappingIn        = flag.String("mapping-in", "", "read logical IDs from a mapping file written by a previous run")
+	mappingOut       = flag.String("mapping-out", "", "write a logical ID mapping file (.json or .csv)")
+	sqlitePath       = flag.String("sqlite", "", "also write the fetched roles, policies, groups and users to this SQLite `database`")
+	provenance       = flag.Bool("provenance", true, "record the source account, generation time and original ARNs in the template")
+	outputs          = flag.Bool("outputs", false, "add an Outputs section exporting the ARN of every resource")
+	sourceComments   = flag.Bool("source-comments", false, "write the original ARN, creation date and, for roles, last use of every resource as a comment above it")
+	intrinsicSyntax  = flag.String("intrinsics", "short", "write intrinsic functions in their `short` form, e.g. !Ref, or in their long form, e.g. Ref:")
+	preserveNames    = flag.Bool("preserve-names", false, "emit the original RoleName, GroupName, UserName, ManagedPolicyName and ServerCertificateName properties")
+	parameterize     = flag.Bool("parameterize", false, "replace the account ID, region and partition in policy documents with pseudo parameters")
+	canonicalize     = flag.Bool("canonicalize", false, "write policy documents in a canonical form, so exports of the same policies only differ where they do")
+	inlineToManaged  = flag.Bool("inline-to-managed", false, "convert inline role, group and user policies into managed policies")
+	dedupeInline     = flag.Bool("dedupe-inline", false, "collapse identical inline policies into one shared managed policy")
+	attachOnPolicies = flag.Bool("attach-from-policies", false, "list the groups, roles and users attached to the managed policies of the template in the Groups, Roles and Users of the policies, instead of in their ManagedPolicyArns")
+	policyVersions   = flag.Bool("policy-versions", false, "also fetch the versions of customer managed policies other than their default, recording them in the Metadata of the policies")
+	standalone       = flag.Bool("standalone-policies", false, "write inline role, group and user policies as AWS::IAM::RolePolicy, AWS::IAM::GroupPolicy and AWS::IAM::UserPolicy resources of their own")
+	maxAttempts      = flag.Int("max-attempts", iamexport.DefaultMaxAttempts, "maximum number of attempts for each IAM API call")
+	maxRPS           = flag.Float64("max-rps", 0, "maximum number of API requests per second (0 for no limit)")
+	concurrency      = flag.Int("concurrency", 4, "number of resources to fetch details for in parallel")
+	cacheDir         = flag.String("cache-dir", "", "cache fetched resources in this directory")
+	cacheTTL         = flag.Duration("cache-ttl", time.Hour, "how long cached resources are used before fetching them again")
+	fromCache        = flag.Bool("from-cache", false, "only use resources from --cache-dir, never calling IAM")
+	endpointURL      = flag.String("endpoint-url", "", "send API requests to this URL, e.g. LocalStack (defaults to $AWS_ENDPOINT_URL)")
+	stackName        = flag.String("stack-name", "", "deployed stack to diff against, detect drift on, deploy to or import into")
+	format           = flag.String("format", "cloudformation", "output format: cloudformation, sam for the policies of Lambda execution roles, pulumi, crossplane, ack, ansible, cli for a shell script, terraform, html for a report, markdown for documentation, cdk for cdk migrate and cdk import, service-catalog for a Service Catalog product, module for a CloudFormation module, or inventory-csv, inventory-json or inventory-ndjson to list the resources")
+	templateDir      = flag.String("template-dir", "", "override the templates of resource types with the <type>.tmpl files in this `directory`")
+	graphFormat      = flag.String("graph-format", "dot", "with graph, write a Graphviz `dot` graph or a mermaid flowchart")
+	validate         = flag.Bool("validate", false, "validate policy documents with IAM Access Analyzer, writing its findings as comments in the template")
+	validateFindings = flag.String("validate-findings", "", "with --validate, also write the findings of Access Analyzer to this JSON `file`")
+	failOn           = flag.String("fail-on", "", "with audit, exit with status 2 when a finding is at least this `severity`: info, low, medium, high or critical")
+	output           = flag.String("output", "", "write the template, or the output of the command, to this `file` instead of stdout")
+	input            = flag.String("input", "", "read resources from `aws iam get-account-authorization-details` output instead of the account (- for stdin)")
+)
 
-	// Indent JSON with 2 spaces in keeping with YAML conventions
-	if err := json.Indent(&out, []byte(pdoc), "", "  "); err != nil {
-		return nil, err
-	}
+// out is where the template, or the output of the command, is written:
+// stdout, or a buffer written to --output once the command succeeds.
+var out io.Writer = os.Stdout
+
+// plugins are the Go plugins given by --plugin, adding output formats.
+var plugins stringValues
 
-	strOut := out.String()
-	return &strOut, nil
+func init() {
+	flag.Var(&plugins, "plugin", "load the output formats registered by this Go plugin `file` (repeatable)")
 }
 
-type GroupResource struct {
-	Name              *string
-	ManagedPolicyArns []string
-	Path              *string
-	Policies          PolicyResources
+// dirFormats are the output formats writing a directory of files to
+// --output-dir instead of a single file, and the directory they write to
+// by default.
+var dirFormats = map[string]string{
+	"markdown":        "docs",
+	"cdk":             "cdk",
+	"service-catalog": "service-catalog",
+	"module":          "module",
 }
 
-func (g *GroupResource) setInlinePolicies(ctx context.Context, client *iam.Client) error {
-	gpolicies, err := client.ListGroupPolicies(ctx, &iam.ListGroupPoliciesInput{
-		GroupName: g.Name,
-	})
-	if err != nil {
-		return err
-	}
+// templateFormats are the output formats writing CloudFormation templates.
+var templateFormats = map[string]bool{
+	"cloudformation":  true,
+	"sam":             true,
+	"cdk":             true,
+	"service-catalog": true,
+	"module":          true,
+}
 
-	precs := make(PolicyResources, 0, len(gpolicies.PolicyNames))
+// validFormat reports whether f is a registered output format, or one of
+// dirFormats.
+func validFormat(f string) bool {
+	_, ok := render.Lookup(f)
+	_, dir := dirFormats[f]
+	return ok || dir
+}
 
-	for i := range gpolicies.PolicyNames {
-		pname := gpolicies.PolicyNames[i]
-		pout, err := client.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{
-			GroupName:  g.Name,
-			PolicyName: &pname,
-		})
-		if err != nil {
-			return err
+const typeArgs = "<groups|policies|roles|users|server-certificates|virtual-mfa-devices|instance-profiles|providers|account|sso-permission-sets>..."
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s diff [flags] <template|--stack-name name> %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s drift --stack-name name [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s deploy --stack-name name [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s import --stack-name name [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s stackset [--stack-set-name name] [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s graph [--graph-format dot|mermaid] [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s trust [flags] roles", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s audit [--fail-on severity] [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s simulate --cases file [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s verify [flags] <template|--stack-name name> %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s sync --repo dir [--branch name [--pull-request github|gitlab]] [flags] %s", os.Args[0], typeArgs)
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s diff-accounts --account-a profile|role-arn --account-b profile|role-arn [flags] %s", os.Args[0], typeArgs)
+	flag.PrintDefaults()
+}
+
+// command is the subcommand given on the command line: "" to write a
+// template, "diff" to compare it with an existing one, "drift" to
+// reconcile a deployed stack with it, "deploy" to deploy it, "import" to
+// import the existing resources into a stack, "stackset" to write it for
+// a StackSet, "graph" to draw the relationships between the resources
+// instead, "trust" to report the principals roles trust, "audit" to
+// report risky policy statements, "simulate" to check the access its
+// policies grant with the IAM policy simulator, "verify" to compare an
+// existing one with the resources, "sync" to commit it to a git
+// repository, or "diff-accounts" to compare the resources of two accounts.
+var command string
+
+// diffTemplate is the template file given to diff or verify.
+var diffTemplate string
+
+// parseArgs parses the command line and returns the resource types to
+// export. Flags may be given before, between or after the arguments.
+func parseArgs() []string {
+	var cmds []string
+
+	flag.Usage = usage
+	// Usage errors exit with exitError rather than the 2 of the flag
+	// package, which is exitChanges.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	args := os.Args[1:]
+	for {
+		switch err := flag.CommandLine.Parse(args); {
+		case errors.Is(err, flag.ErrHelp):
+			os.Exit(exitOK)
+		case err != nil:
+			os.Exit(exitError)
+		}
+		if flag.NArg() == 0 {
+			break
 		}
+		cmds = append(cmds, flag.Arg(0))
+		args = flag.Args()[1:]
+	}
 
-		pdoc, err := decodePolicy(*pout.PolicyDocument)
-		if err != nil {
-			return err
+	if err := readConfigFile(); err != nil {
+		fatal(err)
+	}
+	setupLogging()
+	if *verbose && *quiet {
+		fatalf("-v and -q can not be used together")
+	}
+	for _, path := range plugins {
+		if err := loadPlugin(path); err != nil {
+			fatalf("plugin %s: %v", path, err)
 		}
+	}
 
-		precs = append(precs, PolicyResource{
-			Name:           pout.PolicyName,
-			PolicyDocument: pdoc,
-		})
+	if len(cmds) > 0 && (cmds[0] == "diff" || cmds[0] == "drift" || cmds[0] == "deploy" || cmds[0] == "import" || cmds[0] == "stackset" || cmds[0] == "graph" || cmds[0] == "trust" || cmds[0] == "audit" || cmds[0] == "simulate" || cmds[0] == "verify" || cmds[0] == "sync" || cmds[0] == "diff-accounts") {
+		command, cmds = cmds[0], cmds[1:]
+	}
+	switch {
+	case (command == "diff" || command == "verify") && *stackName == "":
+		if len(cmds) == 0 {
+			fatalf("%s requires a template file or --stack-name", command)
+		}
+		diffTemplate, cmds = cmds[0], cmds[1:]
+	case (command == "drift" || command == "deploy" || command == "import") && *stackName == "":
+		fatalf("%s requires --stack-name", command)
+	case command == "import" && (*inlineToManaged || *dedupeInline):
+		fatalf("import can not create the managed policies of --inline-to-managed or --dedupe-inline")
+	case *format == "cdk" && (*inlineToManaged || *dedupeInline):
+		fatalf("--format cdk imports the resources, and can not create the managed policies of --inline-to-managed or --dedupe-inline")
+	case (command == "" || command == "stackset" || command == "graph" || command == "trust" || command == "audit" || command == "simulate" || command == "sync" || command == "diff-accounts") && *stackName != "":
+		fatalf("--stack-name requires diff, verify, drift, deploy or import")
+	case command == "diff-accounts" && (*accountA == "" || *accountB == ""):
+		fatalf("diff-accounts requires --account-a and --account-b")
+	case command != "diff-accounts" && (*accountA != "" || *accountB != ""):
+		fatalf("--account-a and --account-b require diff-accounts")
+	case command == "diff-accounts" && (*input != "" || *cacheDir != ""):
+		fatalf("diff-accounts reads both accounts, and can not be used with --input or --cache-dir")
+	case command != "diff" && command != "sync" && (*notifyTopic != "" || *notifyWebhook != ""):
+		fatalf("--notify-sns-topic and --notify-webhook require diff or sync")
+	case command == "sync" && *repoDir == "":
+		fatalf("sync requires --repo")
+	case command != "sync" && (*repoDir != "" || *syncBranch != "" || *pullRequest != ""):
+		fatalf("--repo, --branch and --pull-request require sync")
+	case command == "sync" && *output != "":
+		fatalf("sync writes the template to --repo, and can not be used with --output")
+	case *pullRequest != "" && *pullRequest != "github" && *pullRequest != "gitlab":
+		fatalf("Invalid pull request host %s, must be github or gitlab", *pullRequest)
+	case *pullRequest != "" && *syncBranch == "":
+		fatalf("--pull-request requires --branch")
+	case *pullRequest == "github" && os.Getenv("GITHUB_TOKEN") == "":
+		fatalf("--pull-request github requires $GITHUB_TOKEN")
+	case *pullRequest == "gitlab" && os.Getenv("GITLAB_TOKEN") == "":
+		fatalf("--pull-request gitlab requires $GITLAB_TOKEN")
+	case command != "stackset" && *stackSetName != "":
+		fatalf("--stack-set-name requires stackset")
+	case *graphFormat != "dot" && *graphFormat != "mermaid":
+		fatalf("Invalid graph format %s, must be dot or mermaid", *graphFormat)
+	case command != "graph" && *graphFormat != "dot":
+		fatalf("--graph-format requires graph")
+	case command != "audit" && *failOn != "":
+		fatalf("--fail-on requires audit")
+	case command != "audit" && command != "trust" && *toSecurityHub:
+		fatalf("--security-hub requires audit or trust")
+	case command == "simulate" && *simulateCases == "":
+		fatalf("simulate requires --cases")
+	case command != "simulate" && *simulateCases != "":
+		fatalf("--cases requires simulate")
+	case command == "simulate" && *parameterize:
+		fatalf("simulate runs the policies as exported, and can not be used with --parameterize")
+	case *output != "" && (*split != "" || dirFormats[*format] != ""):
+		fatalf("--output can not be used with --split or --format %s, which write to --output-dir", *format)
+	case *split != "" && command != "":
+		fatalf("--split can not be used with %s", command)
+	case *split != "" && *split != "type" && *split != "path" && *split != "exports" && (!strings.HasPrefix(*split, "tag:") || *split == "tag:"):
+		fatalf("Invalid split %s, must be type, path, tag:<key> or exports", *split)
+	case !validFormat(*format):
+		fatalf("Invalid format %s", *format)
+	case !templateFormats[*format] && *parameterize:
+		fatalf("--parameterize writes CloudFormation intrinsic functions, which --format %s does not support", *format)
+	case *intrinsicSyntax != "short" && *intrinsicSyntax != "long":
+		fatalf("Invalid intrinsics %s, must be short or long", *intrinsicSyntax)
+	case len(conditions) > 0 && (*format != "cloudformation" || *split != ""):
+		fatalf("--condition requires --format cloudformation, and can not be used with --split")
+	case len(substitutions) > 0 && *format != "cloudformation":
+		fatalf("--substitute requires --format cloudformation")
+	case *format == "module" && !moduleType.MatchString(*moduleTypeName):
+		fatalf("--format module requires --module-type-name, a type name such as MyOrg::IAM::Roles::MODULE")
+	case *format != "module" && *moduleTypeName != "":
+		fatalf("--module-type-name requires --format module")
+	case *format == "module" && *outputs:
+		fatalf("--format module writes a fragment without outputs, and can not be used with --outputs")
+	case *mergeTemplate != "" && (command != "" || *format != "cloudformation" || *split != ""):
+		fatalf("--merge requires --format cloudformation, and can not be used with a command or --split")
+	case *maxPathDepth < -1:
+		fatalf("Invalid --max-path-depth %d", *maxPathDepth)
+	case !validPaths(excludePaths):
+		fatalf("--exclude-path must be an IAM path starting with /, e.g. /vendor/")
+	case *watch < 0:
+		fatalf("Invalid watch interval %s", *watch)
+	case *watch > 0 && command != "" && command != "diff" && command != "sync":
+		fatalf("--watch can not be used with %s", command)
+	case *eventsQueue != "" && (*cacheDir == "" || *watch > 0 || *input != "" || *fromCache || len(names) > 0 || *namesFile != ""):
+		fatalf("--events-queue requires --cache-dir, and can not be used with --watch, --input, --from-cache or --names")
+	case *eventsQueue != "" && command != "" && command != "diff" && command != "sync":
+		fatalf("--events-queue can not be used with %s", command)
+	case (*watch > 0 || *eventsQueue != "") && command == "" && *output == "" && *split == "" && dirFormats[*format] == "" && *s3URI == "":
+		fatalf("--watch requires --output, --split, --format markdown, cdk, service-catalog or module, or --s3-uri, writing the exports to files")
+	case *s3URI != "" && (command != "" || *format != "cloudformation"):
+		fatalf("--s3-uri uploads the templates written with --format cloudformation, and can not be used with a command")
+	case *s3URI != "" && *split != "" && *templateBucket != "":
+		fatalf("--s3-uri uploads the templates of --split itself, and can not be used with --template-bucket")
+	case *s3SSE != "AES256" && *s3SSE != "aws:kms":
+		fatalf("Invalid server-side encryption %s, must be AES256 or aws:kms", *s3SSE)
+	case *s3KMSKeyID != "" && *s3SSE != "aws:kms":
+		fatalf("--s3-kms-key-id requires --s3-sse aws:kms")
+	case *s3URI == "" && (*s3SSE != "AES256" || *s3VersionKeys):
+		fatalf("--s3-sse and --s3-versioned-keys require --s3-uri")
+	case *templateDir != "" && *format != "cloudformation":
+		fatalf("--template-dir requires --format cloudformation")
+	case *format != "cloudformation" && (command != "" || *split != ""):
+		fatalf("--format %s can only be used to write a template", *format)
 	}
 
-	g.Policies = precs
+	// StackSets deploy the same template to every account.
+	if command == "stackset" {
+		*parameterize = true
+	}
 
-	return nil
+	if len(cmds) == 0 {
+		cmds = configTypes
+	}
+	for _, cmd := range cmds {
+		if _, ok := resourceTypes[cmd]; !ok {
+			fatalf("Invalid arg %s", cmd)
+		}
+		if *eventsQueue != "" && !hasEvents(cmd) {
+			fatalf("--events-queue can not be used with %s, whose changes are not read from the events", cmd)
+		}
+	}
+	if len(cmds) == 0 {
+		flag.Usage()
+		os.Exit(exitError)
+	}
+	if *concurrency < 1 {
+		fatalf("Invalid concurrency %d", *concurrency)
+	}
+	if *failOn != "" {
+		if _, err := analyze.ParseSeverity(*failOn); err != nil {
+			fatal(err)
+		}
+	}
+	if len(proposeRoles) > 0 && (*trailAccessRole == "" || len(trailArns) == 0) {
+		fatalf("--propose-policies requires --trail-access-role and --trail-arn")
+	}
+	if *activityPeriod <= 0 || *activityPeriod > 90*24*time.Hour {
+		fatalf("Invalid activity period %s, must be at most 90 days", *activityPeriod)
+	}
+	if *keepUnused && unusedFor == 0 {
+		fatalf("--keep-unused requires --unused-for")
+	}
+	if *trimUnused && unusedServicesFor == 0 {
+		fatalf("--trim-unused-services requires --unused-services-for")
+	}
+	if *validateFindings != "" && !*validate {
+		fatalf("--validate-findings requires --validate")
+	}
+	if *fromCache && *cacheDir == "" {
+		fatalf("--from-cache requires --cache-dir")
+	}
+	if *validateTemplate && (command != "" || *split != "" || *format != "cloudformation") {
+		fatalf("--validate-template checks the template written with --format cloudformation, and can not be used with a command or --split")
+	}
+	if *dryRun && (command != "" || *split != "" || *sqlitePath != "" || *validate || *caveatsReport != "" || *rulesOut != "" || unusedFor > 0 || unusedServicesFor > 0 || len(proposeRoles) > 0) {
+		fatalf("--dry-run only lists the resources of a template, and can not be used with a command, --split, --sqlite, --validate, --caveats-report, --rules-out, --unused-for, --unused-services-for or --propose-policies")
+	}
+	if *skipReport != "" && !*continueOnError {
+		fatalf("--skip-report requires --continue-on-error")
+	}
+	if *withSCPs && *caveatsReport == "" {
+		fatalf("--scps requires --caveats-report")
+	}
+	if *awsManagedReport != "" && !*customerManagedOnly {
+		fatalf("--aws-managed-report requires --customer-managed-only")
+	}
+	if *namesFile != "" {
+		l, err := readNames(*namesFile)
+		if err != nil {
+			fatal(err)
+		}
+		if len(l) == 0 {
+			fatalf("No names in %s", *namesFile)
+		}
+		names = append(names, l...)
+	}
+	if *s3URI != "" {
+		if _, _, err := iamexport.ParseS3URI(*s3URI); err != nil {
+			fatal(err)
+		}
+	}
+	var err error
+	if ignoreRules, err = readIgnoreFile(); err != nil {
+		fatal(err)
+	}
+
+	return cmds
 }
 
-type GroupResources []GroupResource
+// fetch reads the requested resource types from the account, or from c
+// when it holds a usable snapshot. c may be nil.
+func fetch(ctx context.Context, client iamexport.Client, sso iamexport.SSOAdminClient, cmds []string, c *cache.Cache) (*model.ResourceSet, error) {
+	opts := iamexport.FetchOptions{Concurrency: *concurrency, Names: names, Progress: logProgress}
+	if *continueOnError {
+		opts.OnError = recordFailure
+	}
+	opts.ListOnly = *dryRun
+	opts.PolicyVersions = *policyVersions
+	// Cached resources are filtered once loaded instead, so that the cache
+	// does not depend on the ignore file.
+	if (len(ignoreRules) > 0 || filteringPaths()) && c == nil {
+		opts.Exclude = func(typ, name, arn string) bool {
+			return isIgnored(typ, name, arn) || skipPath(arn)
+		}
+	}
+	resources := &model.ResourceSet{}
+	for _, cmd := range cmds {
+		dst := iamexport.ResourceField(resources, cmd)
+		if c != nil {
+			ok, err := c.Load(cmd, dst)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				continue
+			}
+		}
+		if *fromCache {
+			return nil, fmt.Errorf("no cached %s in %s", cmd, *cacheDir)
+		}
 
-type PolicyResource struct {
-	Description    *string
-	Name           *string
-	Path           *string
-	PolicyDocument *string
-	Tags           []types.Tag
-}
+		failed := len(failures)
+		if err := iamexport.Fetch(ctx, client, sso, cmd, resources, opts); err != nil {
+			if !canSkip(err) {
+				return nil, err
+			}
+			recordFailure(&iamexport.ResourceError{Type: cmd, Err: err})
+			continue
+		}
+		// Resources fetched by name, with some left out or without their
+		// details are only part of the account.
+		if c != nil && len(names) == 0 && len(failures) == failed && !*dryRun {
+			if err := c.Store(cmd, dst); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-type PolicyResources []PolicyResource
-
-type RoleResource struct {
-	AssumeRolePolicyDocument *string
-	Description              *string
-	ManagedPolicyArns        []string
-	MaxSessionDuration       int
-	Name                     *string
-	Path                     *string
-	Policies                 PolicyResources
-	Tags                     []types.Tag
+	return resources, nil
 }
 
-func (r *RoleResource) setInlinePolicies(ctx context.Context, client *iam.Client) error {
-	rpolicies, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{
-		RoleName: r.Name,
-	})
-	if err != nil {
-		return err
+// readInput reads the requested resource types from an authorization
+// details file, or from stdin when path is "-".
+func readInput(path string, cmds []string) (*model.ResourceSet, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
 	}
 
-	precs := make(PolicyResources, 0, len(rpolicies.PolicyNames))
+	all, err := iamexport.ReadAuthorizationDetails(f)
+	if err != nil {
+		return nil, err
+	}
 
-	for i := range rpolicies.PolicyNames {
-		pname := rpolicies.PolicyNames[i]
-		pout, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
-			RoleName:   r.Name,
-			PolicyName: &pname,
-		})
-		if err != nil {
-			return err
+	resources := &model.ResourceSet{}
+	for _, cmd := range cmds {
+		switch cmd {
+		case "groups":
+			resources.Groups = all.Groups
+		case "policies":
+			resources.Policies = all.Policies
+		case "roles":
+			resources.Roles = all.Roles
+		case "users":
+			resources.Users = all.Users
+		default:
+			return nil, fmt.Errorf("%s are not part of the authorization details", cmd)
 		}
+	}
 
-		pdoc, err := decodePolicy(*pout.PolicyDocument)
-		if err != nil {
-			return err
-		}
+	return resources, nil
+}
 
-		precs = append(precs, PolicyResource{
-			Name:           pout.PolicyName,
-			PolicyDocument: pdoc,
-		})
-	}
+// version is the version of the command, set at build time with
+// -ldflags "-X main.version=...".
+var version = "dev"
 
-	r.Policies = precs
+// firstArn returns the ARN of the first resource in resources, or "" when
+// there are none.
+func firstArn(resources *model.ResourceSet) string {
+	var arns []*string
+	for _, g := range resources.Groups {
+		arns = append(arns, g.Arn)
+	}
+	for _, p := range resources.Policies {
+		arns = append(arns, p.Arn)
+	}
+	for _, r := range resources.Roles {
+		arns = append(arns, r.Arn)
+	}
+	for _, u := range resources.Users {
+		arns = append(arns, u.Arn)
+	}
+	for _, c := range resources.ServerCertificates {
+		arns = append(arns, c.Arn)
+	}
+	for _, d := range resources.VirtualMFADevices {
+		arns = append(arns, d.Arn)
+	}
+	for _, p := range resources.InstanceProfiles {
+		arns = append(arns, p.Arn)
+	}
+	for _, p := range resources.Providers {
+		arns = append(arns, p.Arn)
+	}
+	for _, a := range arns {
+		if a != nil {
+			return *a
+		}
+	}
+	return ""
+}
 
-	return nil
+// offlineParameterizer takes the account to parameterize from the ARNs of
+// the resources, as there are no credentials to look it up with.
+func offlineParameterizer(resources *model.ResourceSet, region string) (*transform.Parameterizer, error) {
+	a := firstArn(resources)
+	if a == "" {
+		return nil, fmt.Errorf("no resources to take the account ID from")
+	}
+	return transform.ParameterizerFromArn(a, region)
 }
 
-type RoleResources []RoleResource
+// newProvenance records the source of resources for the template.
+func newProvenance(resources *model.ResourceSet) *render.Provenance {
+	p := &render.Provenance{
+		Generated: time.Now(),
+		Version:   version,
+	}
+	if a, err := arn.Parse(firstArn(resources)); err == nil {
+		p.AccountID = a.AccountID
+	}
+	return p
+}
 
-func getGroups(ctx context.Context, client *iam.Client) interface{} {
-	resp, err := client.ListGroups(ctx, &iam.ListGroupsInput{})
+// loadConfig loads the default configuration with the retries, endpoint
+// and request rate given on the command line.
+func loadConfig(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	cfg, err := iamexport.LoadConfig(ctx, *maxAttempts, endpointFor, optFns...)
 	if err != nil {
-		log.Fatal(err)
+		return cfg, err
+	}
+	cfg.APIOptions = append(cfg.APIOptions, countAPICalls)
+	if *maxRPS > 0 {
+		cfg.APIOptions = append(cfg.APIOptions, newRequestLimiter(*maxRPS).addMiddleware)
 	}
+	return cfg, nil
+}
 
-	groups := make(GroupResources, 0, len(resp.Groups))
-	for _, g := range resp.Groups {
-		rec := GroupResource{
-			Name: g.GroupName,
-			Path: g.Path,
-		}
+// writeOutput writes the buffered output to --output, if given.
+func writeOutput() {
+	b, ok := out.(*bytes.Buffer)
+	if !ok {
+		return
+	}
+	if err := os.WriteFile(*output, b.Bytes(), 0o644); err != nil {
+		fatal(err)
+	}
+	slog.Info("Wrote output", "file", *output)
+}
 
-		gpolicies, err := client.ListAttachedGroupPolicies(ctx, &iam.ListAttachedGroupPoliciesInput{
-			GroupName: g.GroupName,
-		})
-		if err != nil {
-			log.Fatal(err)
+func main() {
+	cmds := parseArgs()
+	if *watch > 0 {
+		if err := runWatch(); err != nil {
+			fatal(err)
 		}
+		return
+	}
+	if *output != "" {
+		out = &bytes.Buffer{}
+	}
 
-		for _, p := range gpolicies.AttachedPolicies {
-			rec.ManagedPolicyArns = append(rec.ManagedPolicyArns, *p.PolicyArn)
+	// pinned are the logical IDs of --mapping-in and --merge, and merged
+	// the resources of the template of --merge.
+	var pinned, merged []render.MappingEntry
+	if *mappingIn != "" {
+		var err error
+		if pinned, err = render.ReadMapping(*mappingIn); err != nil {
+			fatal(err)
 		}
-
-		if err := rec.setInlinePolicies(ctx, client); err != nil {
-			log.Fatal(err)
+	}
+	if *mergeTemplate != "" {
+		var err error
+		if mergeBase, err = os.ReadFile(*mergeTemplate); err != nil {
+			fatal(err)
 		}
-
-		groups = append(groups, rec)
+		if merged, err = mergeEntries(mergeBase); err != nil {
+			fatalf("%s: %w", *mergeTemplate, err)
+		}
+		pinned = append(pinned, merged...)
 	}
 
-	return groups
-}
+	// Events are consumed until the command is interrupted, and --timeout
+	// applies to every run instead.
+	if *eventsQueue != "" {
+		ctx := context.Background()
+		cfg, err := loadConfig(ctx)
+		if err != nil {
+			fatal(err)
+		}
+		if err := runEvents(ctx, cfg, cmds); err != nil {
+			fatal(err)
+		}
+		return
+	}
 
-func getPolicies(ctx context.Context, client *iam.Client) interface{} {
-	presp, err := client.ListPolicies(ctx, &iam.ListPoliciesInput{
-		Scope: "Local",
-	})
+	ctx, cancel := commandContext()
+	defer cancel()
+	cfg, err := loadConfig(ctx)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
-	policies := make(PolicyResources, 0, len(presp.Policies))
-	for _, p := range presp.Policies {
-		rec := PolicyResource{
-			Name: p.PolicyName,
-			Path: p.Path,
-			Tags: p.Tags,
+	// The resources of both accounts are fetched and compared on their
+	// own, without the transforms below.
+	if command == "diff-accounts" {
+		differ, err := runDiffAccounts(ctx, cfg, cmds)
+		if err != nil {
+			fatal(err)
 		}
+		if err := writeSkipReport(); err != nil {
+			fatal(err)
+		}
+		writeOutput()
+		status := exitOK
+		if differ {
+			status = exitChanges
+		}
+		finish(nil, status)
+		return
+	}
 
-		pdesc, err := client.GetPolicy(ctx, &iam.GetPolicyInput{
-			PolicyArn: p.Arn,
-		})
-		if err != nil {
-			log.Fatal(err)
+	var resourceCache *cache.Cache
+	if *cacheDir != "" {
+		resourceCache = &cache.Cache{Dir: *cacheDir, TTL: *cacheTTL}
+		if *fromCache {
+			resourceCache.TTL = 0
 		}
+	}
 
-		rec.Description = pdesc.Policy.Description
+	var resources *model.ResourceSet
+	if *input != "" {
+		resources, err = readInput(*input, cmds)
+	} else {
+		resources, err = fetch(ctx, iam.NewFromConfig(cfg), ssoadmin.NewFromConfig(cfg), cmds, resourceCache)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if err := writeSkipReport(); err != nil {
+		fatal(err)
+	}
+	if len(names) > 0 {
+		selectNames(resources)
+	}
+	if len(ignoreRules) > 0 {
+		ignoreResources(resources)
+	}
+	if filteringPaths() {
+		excludeResourcePaths(resources)
+	}
 
-		pver, err := client.GetPolicyVersion(context.TODO(), &iam.GetPolicyVersionInput{
-			PolicyArn: p.Arn,
-			VersionId: pdesc.Policy.DefaultVersionId,
-		})
+	// verify compares the template with the resources in the order IAM
+	// lists them, before they are sorted or transformed.
+	if command == "verify" {
+		lost, err := runVerify(ctx, cfg, resources)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+		writeOutput()
+		status := exitOK
+		if lost {
+			status = exitChanges
 		}
+		finish(resources, status)
+		return
+	}
 
-		pdoc, err := decodePolicy(*pver.PolicyVersion.Document)
-		if err != nil {
-			log.Fatal(err)
+	// Required tags are checked on the resources as they are in the
+	// account, before --add-tag could supply them.
+	if len(requiredTags) > 0 {
+		if err := checkRequiredTags(resources); err != nil {
+			fatal(err)
 		}
+	}
 
-		rec.PolicyDocument = pdoc
+	// Exports of the same resources are identical, whatever order IAM or
+	// the input lists them in.
+	transform.Sort(resources)
 
-		policies = append(policies, rec)
+	if *dryRun {
+		if err := writePlan(resources, render.NewLogicalIDs(pinned)); err != nil {
+			fatal(err)
+		}
+		writeOutput()
+		finish(resources, exitOK)
+		return
 	}
 
-	return policies
-}
+	if *sqlitePath != "" {
+		if err := sqlite.Write(*sqlitePath, resources); err != nil {
+			fatal(err)
+		}
+		slog.Info("Wrote SQLite database", "file", *sqlitePath)
+	}
 
-func getRoles(ctx context.Context, client *iam.Client) interface{} {
-	resp, err := client.ListRoles(ctx, &iam.ListRolesInput{})
-	if err != nil {
-		log.Fatal(err)
+	// Noisy tags are left out of everything generated from here on, so
+	// that they are not taken for conventions either.
+	if len(excludedTagPrefixes) > 0 {
+		transform.ExcludeTags(resources, excludedTagPrefixes)
 	}
 
-	roles := make(RoleResources, 0, len(resp.Roles))
-	for _, r := range resp.Roles {
-		rec := RoleResource{
-			Name:               r.RoleName,
-			Description:        r.Description,
-			MaxSessionDuration: int(*r.MaxSessionDuration),
-			Path:               r.Path,
-			Tags:               r.Tags,
+	// Documents are validated before the transforms below rewrite them,
+	// since Access Analyzer does not understand intrinsic functions.
+	var comments map[*string][]string
+	if *validate {
+		if comments, err = runValidate(ctx, cfg, resources); err != nil {
+			fatal(err)
 		}
+	}
 
-		pdoc, err := decodePolicy(*r.AssumeRolePolicyDocument)
-		if err != nil {
-			log.Fatal(err)
+	if *caveatsReport != "" {
+		if err := writeCaveats(ctx, cfg, resources); err != nil {
+			fatal(err)
 		}
-		rec.AssumeRolePolicyDocument = pdoc
+	}
 
-		rpolicies, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{
-			RoleName: r.RoleName,
-		})
-		if err != nil {
-			log.Fatal(err)
+	if *rulesOut != "" {
+		if err := writeRules(resources); err != nil {
+			fatal(err)
 		}
+	}
 
-		for _, p := range rpolicies.AttachedPolicies {
-			rec.ManagedPolicyArns = append(rec.ManagedPolicyArns, *p.PolicyArn)
+	if unusedFor > 0 {
+		excludeUnusedRoles(resources)
+	}
+
+	if unusedServicesFor > 0 {
+		if err := annotateUnusedServices(ctx, iam.NewFromConfig(cfg), resources); err != nil {
+			fatal(err)
 		}
+	}
 
-		if err := rec.setInlinePolicies(ctx, client); err != nil {
-			log.Fatal(err)
+	if len(proposeRoles) > 0 {
+		if err := proposePolicies(ctx, cfg, resources); err != nil {
+			fatal(err)
 		}
+	}
 
-		roles = append(roles, rec)
+	if *canonicalize {
+		if err := transform.Canonicalize(resources); err != nil {
+			fatal(err)
+		}
 	}
 
-	return roles
-}
+	if command == "stackset" {
+		prepareStackSet(resources)
+	}
 
-func indent(s string, indent int) string {
-	lines := strings.Split(s, "\n")
-	spaces := fmt.Sprintf("%*s", indent, " ")
-	lines[0] = spaces + lines[0]
-	return strings.Join(lines, "\n"+spaces)
-}
+	if len(renames) > 0 {
+		if err := transform.Rename(resources, renames); err != nil {
+			fatal(err)
+		}
+	}
 
-func sanitize(n string) string {
-	if !strings.ContainsAny(n, "-_.") {
-		return n
-	}
-	b := strings.Builder{}
-	ns := strings.Split(n, "-")
-	for _, c := range ns {
-		nu := strings.Split(c, "_")
-		for _, cu := range nu {
-			b.WriteString(strings.ToUpper(string(cu[0])))
-			if len(cu) > 1 {
-				b.WriteString(cu[1:])
-			}
+	if *customerManagedOnly {
+		if err := detachAWSManaged(resources); err != nil {
+			fatal(err)
 		}
 	}
-	return b.String()
-}
 
-func trim(s string) string {
-	return strings.TrimSpace(s)
-}
+	if *inlineToManaged || *dedupeInline {
+		transform.ExternalizeInline(resources, *inlineToManaged, *dedupeInline)
+	}
 
-func render(in interface{}) {
-	var tmplFmt string
+	// Tags are added after inline policies are externalized, so that the
+	// managed policies made of them are tagged too.
+	if len(addedTags) > 0 {
+		transform.AddTags(resources, addedTags)
+	}
 
-	tmpl := template.New("render")
-	tmpl.Funcs(template.FuncMap{
-		"indent":   indent,
-		"sanitize": sanitize,
-		"trim":     trim,
-	})
+	if *parameterize {
+		var p *transform.Parameterizer
+		if *input != "" || *fromCache {
+			p, err = offlineParameterizer(resources, cfg.Region)
+		} else {
+			p, err = transform.NewParameterizer(ctx, sts.NewFromConfig(cfg), cfg.Region)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if err := p.Apply(resources); err != nil {
+			fatal(err)
+		}
+	}
 
-	switch t := in.(type) {
-	default:
-		log.Fatalf("Unknown type: %T", t)
-	case GroupResources:
-		tmplFmt = `---
-Resources:
-{{- range .}}
-  {{ sanitize .Name }}:
-    Type: AWS::IAM::Group
-    Properties:
-      {{- if and .ManagedPolicyArns }}
-      ManagedPolicyArns:
-      {{- range .ManagedPolicyArns }}
-      - {{ . }}
-      {{- end }}
-      {{- end }}
-      Path: {{.Path}}
-      {{- if and .Policies }}
-      Policies:
-      {{- range .Policies }}
-      - PolicyName: {{ .Name }}
-        PolicyDocument:
-{{ indent .PolicyDocument 10 }}
-      {{- end }}
-      {{- end }}
-{{end}}`
-	case PolicyResources:
-		tmplFmt = `---
-Resources:
-{{- range .}}
-  {{ sanitize .Name }}:
-    Type: AWS::IAM::ManagedPolicy
-    Properties:
-      {{- if and .Description }}
-      Description: {{ trim .Description }}
-      {{- end }}
-      {{- if and .Path }}
-      Path: {{.Path}}
-      {{- end }}
-      PolicyDocument:
-{{ indent .PolicyDocument 8 }}
-    {{- if and .Tags }}
-      Tags:
-      {{- range .Tags }}
-      - Key: {{.Key}}
-        Value: {{.Value}}
-      {{- end }}
-    {{- end }}
-{{end}}`
-	case RoleResources:
-		tmplFmt = `---
-Resources:
-{{- range . }}
-  {{ sanitize .Name }}:
-    Type: AWS::IAM::Role
-    Properties:
-      AssumeRolePolicyDocument:
-{{ indent .AssumeRolePolicyDocument 8 }}
-      {{- if and .Description }}
-      Description: {{ trim .Description }}
-      {{- end }}
-      {{- if and .ManagedPolicyArns }}
-      ManagedPolicyArns:
-      {{- range .ManagedPolicyArns }}
-      - {{ . }}
-      {{- end }}
-      {{- end }}
-      {{- if and .MaxSessionDuration }}
-      MaxSessionDuration: {{.MaxSessionDuration}}
-      {{- end }}
-      Path: {{.Path}}
-      {{- if and .Tags }}
-      Tags:
-      {{range .Tags}}
-      - Key: {{.Key}}
-        Value: {{.Value}}
-      {{- end }}
-      {{- end }}
-      {{- if and .Policies }}
-      Policies:
-      {{- range .Policies }}
-      - PolicyName: {{ .Name }}
-        PolicyDocument:
-{{ indent .PolicyDocument 10 }}
-      {{- end }}
-      {{- end }}
-{{end}}`
-	}
-
-	if _, err := tmpl.Parse(tmplFmt); err != nil {
-		log.Fatal(err)
-	}
-
-	if err := tmpl.Execute(os.Stdout, in); err != nil {
-		log.Fatal(err)
+	opts := render.Options{
+		PreserveNames:    *preserveNames,
+		Outputs:          *outputs,
+		DeletionPolicies: deletionPolicy,
+		Comments:         comments,
+		LongIntrinsics:   *intrinsicSyntax == "long",
+		Substitutions:    substitutions,
+		SourceComments:   *sourceComments,
+
+		StandalonePolicies: *standalone,
+		AttachFromPolicies: *attachOnPolicies,
+		PolicyVersions:     *policyVersions,
+		TemplateResources:  merged,
+	}
+	if len(conditions) > 0 {
+		opts.ResourceConditions = resourceConditions(resources)
+	}
+	if *templateDir != "" {
+		if opts.Templates, err = render.ReadTemplates(*templateDir); err != nil {
+			fatal(err)
+		}
+	}
+	if unusedFor > 0 && *keepUnused {
+		opts.UnusedSince = time.Now().Add(-time.Duration(unusedFor))
+	}
+	if *provenance {
+		opts.Provenance = newProvenance(resources)
 	}
-}
 
-func main() {
-	var getter func(context.Context, *iam.Client) interface{}
+	if len(resources.VirtualMFADevices) > 0 {
+		slog.Warn("Exporting virtual MFA devices without their seeds; devices created from the template must be registered again", "devices", len(resources.VirtualMFADevices))
+	}
 
-	switch os.Args[1] {
+	ids := render.NewLogicalIDs(pinned)
+	// failed makes the exit status exitChanges: diff found differences,
+	// audit a finding at least as severe as --fail-on, or simulate a
+	// decision other than the expected one.
+	var failed bool
+	switch command {
+	case "diff":
+		failed, err = runDiff(ctx, cfg, resources, ids, opts)
+	case "drift":
+		err = runDrift(ctx, cfg, resources, ids, opts)
+	case "deploy":
+		err = runDeploy(ctx, cfg, resources, ids, opts)
+	case "import":
+		err = runImport(ctx, cfg, resources, ids, opts)
+	case "stackset":
+		err = runStackSet(ctx, cfg, resources, ids, opts)
+	case "graph":
+		err = render.WriteGraph(out, resources, *graphFormat)
+	case "trust":
+		err = runTrust(ctx, cfg, resources)
+	case "audit":
+		failed, err = runAudit(ctx, cfg, resources)
+	case "simulate":
+		failed, err = runSimulate(ctx, cfg, resources)
+	case "sync":
+		err = runSync(ctx, cfg, resources, ids, opts)
 	default:
-		log.Fatalf("Invalid arg %s\n", os.Args[1])
-	case "groups":
-		getter = getGroups
-	case "policies":
-		getter = getPolicies
-	case "roles":
-		getter = getRoles
+		switch {
+		case *format == "markdown":
+			err = writeMarkdown(resources)
+		case *format == "cdk":
+			err = writeCDK(resources, ids, opts)
+		case *format == "service-catalog":
+			err = writeServiceCatalog(resources, ids, opts)
+		case *format == "module":
+			err = writeModule(resources, ids, opts)
+		case *split != "":
+			err = writeNested(ctx, cfg, resources, ids, opts)
+		case *format == "cloudformation":
+			err = writeTemplate(ctx, cfg, resources, ids, opts)
+		default:
+			r, _ := render.Lookup(*format)
+			err = r.Render(render.NewContext(ctx, ids, opts), resources, out)
+		}
 	}
-
-	ctx := context.TODO()
-	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	writeOutput()
 
-	client := iam.NewFromConfig(cfg)
-	resources := getter(ctx, client)
+	if *mappingOut != "" {
+		if err := render.WriteMapping(*mappingOut, ids.Entries()); err != nil {
+			fatal(err)
+		}
+	}
 
-	render(resources)
+	status := exitOK
+	if failed {
+		status = exitChanges
+	}
+	finish(resources, status)
 }
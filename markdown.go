@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+)
+
+// writeMarkdown writes the Markdown documentation of resources to
+// --output-dir, docs by default.
+func writeMarkdown(resources *model.ResourceSet) error {
+	docs, err := render.Markdown(resources)
+	if err != nil {
+		return err
+	}
+	dir := *outputDir
+	if dir == "" {
+		dir = dirFormats["markdown"]
+	}
+
+	for _, d := range docs {
+		path := filepath.Join(dir, filepath.FromSlash(d.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, d.Content, 0o644); err != nil {
+			return err
+		}
+	}
+	slog.Info("Wrote documents", "documents", len(docs), "dir", dir)
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"gopkg.in/yaml.v3"
+)
+
+var mergeTemplate = flag.String("merge", "", "merge the template into the existing CloudFormation template `file`, keeping its resources and logical IDs and only refreshing or appending the exported resources")
+
+// mergeBase is the template read from --merge.
+var mergeBase []byte
+
+// mergeEntries returns the logical IDs of the resources of the template to
+// merge into, pinned by the SourceArn of their metadata or their physical
+// name, so that exported resources replace them. Inline policies written
+// as resources of their own are pinned by the name of their role, group or
+// user and the policy. The logical IDs of other resources, such as hand
+// maintained ones, are only kept from being allocated.
+func mergeEntries(template []byte) ([]render.MappingEntry, error) {
+	_, res, err := templateResources(template)
+	if err != nil {
+		return nil, err
+	}
+
+	// names are the names of the resources, for the inline policies
+	// referring to them.
+	names := map[string]string{}
+	var entries []render.MappingEntry
+	for i := 0; i+1 < len(res.Content); i += 2 {
+		id, r := res.Content[i].Value, res.Content[i+1]
+		e := render.MappingEntry{LogicalID: id}
+		if t := mappingValue(r, "Type"); t != nil {
+			e.Type = t.Value
+		}
+		if arn := mappingValue(mappingValue(r, "Metadata"), "SourceArn"); arn != nil {
+			e.Arn = arn.Value
+			e.Name = arn.Value[strings.LastIndex(arn.Value, "/")+1:]
+		}
+		props := mappingValue(r, "Properties")
+		for _, key := range physicalNameKeys {
+			if v := mappingValue(props, key); v != nil && v.Kind == yaml.ScalarNode && v.Tag == "!!str" {
+				e.Name = v.Value
+			}
+		}
+		names[id] = e.Name
+		entries = append(entries, e)
+	}
+
+	parents := map[string]string{
+		"AWS::IAM::RolePolicy":  "RoleName",
+		"AWS::IAM::GroupPolicy": "GroupName",
+		"AWS::IAM::UserPolicy":  "UserName",
+	}
+	for i, e := range entries {
+		key, ok := parents[e.Type]
+		if !ok {
+			continue
+		}
+		props := mappingValue(mappingValue(res, e.LogicalID), "Properties")
+		parent, policy := mappingValue(props, key), mappingValue(props, "PolicyName")
+		if parent == nil || policy == nil {
+			continue
+		}
+		name := parent.Value
+		if parent.Tag == "!Ref" {
+			name = names[parent.Value]
+		} else if ref := mappingValue(parent, "Ref"); ref != nil {
+			name = names[ref.Value]
+		}
+		if name != "" {
+			entries[i].Name = name + "/" + policy.Value
+		}
+	}
+	return entries, nil
+}
+
+// mergeSections are the sections of a template merged entry by entry, and
+// whether the entries of the fresh template replace those of the existing
+// one. Parameters, conditions and mappings of the existing template are
+// kept, as they may have been edited by hand.
+var mergeSections = []struct {
+	name    string
+	replace bool
+}{
+	{"Parameters", false},
+	{"Mappings", false},
+	{"Conditions", false},
+	{"Resources", true},
+	{"Outputs", true},
+}
+
+// mergeTemplates merges the fresh template into the existing one: the
+// resources and outputs of the fresh template replace those with the same
+// logical ID and are appended otherwise, and the rest of the existing
+// template is kept, but for the provenance in its metadata.
+func mergeTemplates(existing, fresh []byte) ([]byte, error) {
+	doc, _, err := templateResources(existing)
+	if err != nil {
+		return nil, err
+	}
+	freshDoc, _, err := templateResources(fresh)
+	if err != nil {
+		return nil, err
+	}
+	top, freshTop := doc.Content[0], freshDoc.Content[0]
+
+	for _, key := range []string{"AWSTemplateFormatVersion", "Description"} {
+		if mappingValue(top, key) == nil {
+			setMappingValue(top, key, mappingValue(freshTop, key))
+		}
+	}
+	if p := mappingValue(mappingValue(freshTop, "Metadata"), "IamCfGenerator"); p != nil {
+		if mappingValue(top, "Metadata") == nil {
+			setMappingValue(top, "Metadata", &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		}
+		setMappingValue(mappingValue(top, "Metadata"), "IamCfGenerator", p)
+	}
+
+	for _, s := range mergeSections {
+		entries := mappingValue(freshTop, s.name)
+		if entries == nil {
+			continue
+		}
+		section := mappingValue(top, s.name)
+		if section == nil {
+			section = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingValue(top, s.name, section)
+		}
+		for i := 0; i+1 < len(entries.Content); i += 2 {
+			key := entries.Content[i].Value
+			if s.replace || mappingValue(section, key) == nil {
+				setMappingValue(section, key, entries.Content[i+1])
+			}
+		}
+	}
+
+	b := bytes.Buffer{}
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+)
+
+func TestMergeEntriesLongIntrinsics(t *testing.T) {
+	opts := render.Options{StandalonePolicies: true}
+	short, err := mergeEntries(renderRole(t, "v1", opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.LongIntrinsics = true
+	long, err := mergeEntries(renderRole(t, "v1", opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(short, long) {
+		t.Errorf("entries of the long form = %+v, want %+v", long, short)
+	}
+
+	names := map[string]string{}
+	for _, e := range long {
+		names[e.Type] = e.Name
+	}
+	if names["AWS::IAM::Role"] != "prod-app" || names["AWS::IAM::RolePolicy"] != "prod-app/s3" {
+		t.Errorf("entries = %+v, want the role prod-app and its policy prod-app/s3", long)
+	}
+}
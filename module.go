@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+)
+
+var moduleTypeName = flag.String("module-type-name", "", "with --format module, the type `name` of the module in the CloudFormation registry, e.g. MyOrg::IAM::Roles::MODULE")
+
+// moduleType matches the type names of modules.
+var moduleType = regexp.MustCompile(`^[A-Za-z0-9]{2,64}::[A-Za-z0-9]{2,64}::[A-Za-z0-9]{2,64}::MODULE$`)
+
+// writeModule writes resources as a CloudFormation module project to
+// --output-dir, module by default, laid out as the CloudFormation CLI
+// expects: .rpdk-config, the fragment fragments/iam.yaml and schema.json,
+// ready for cfn submit to register the module.
+func writeModule(resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	if err := checkLimits(resources, b.Bytes()); err != nil {
+		return err
+	}
+	fragment, schema, err := render.Module(b.Bytes(), *moduleTypeName)
+	if err != nil {
+		return err
+	}
+	config, err := json.MarshalIndent(map[string]interface{}{
+		"artifact_type": "MODULE",
+		"typeName":      *moduleTypeName,
+		"settings":      map[string]interface{}{},
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	dir := *outputDir
+	if dir == "" {
+		dir = dirFormats["module"]
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "fragments"), 0o755); err != nil {
+		return err
+	}
+	files := []struct {
+		path    string
+		content []byte
+	}{
+		{".rpdk-config", append(config, '\n')},
+		{filepath.Join("fragments", "iam.yaml"), fragment},
+		{"schema.json", schema},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.path), f.content, 0o644); err != nil {
+			return err
+		}
+	}
+	slog.Info("Wrote the CloudFormation module", "type", *moduleTypeName, "dir", dir)
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+)
+
+var (
+	names     stringValues
+	namesFile = flag.String("names-file", "", "only export the resources named in this `file`, one name or ARN per line")
+)
+
+func init() {
+	flag.Var(&names, "names", "only export the resources with this `name` or ARN (repeatable)")
+}
+
+// readNames returns the names and ARNs in the file at path, one per line.
+// Blank lines and lines starting with # are skipped.
+func readNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var l []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l = append(l, line)
+	}
+	return l, sc.Err()
+}
+
+// selectNames keeps the resources given by --names and --names-file,
+// warning about the names no resource has.
+func selectNames(resources *model.ResourceSet) {
+	for _, n := range transform.SelectNames(resources, names) {
+		slog.Warn("No resource with this name", "name", n)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var (
+	split     = flag.String("split", "", "write one nested stack template per `type`, path or value of tag:<key>, e.g. tag:Team, and a root template creating them, or with exports, a template of the managed policies exporting their ARNs and one of the other resources importing them")
+	outputDir = flag.String("output-dir", "", "directory to write the templates of --split (default .), the documents of --format markdown (default docs), or the files of --format cdk, service-catalog or module (default the name of the format) to")
+)
+
+// writeNested writes the templates of the nested stacks generated from
+// resources to --output-dir, along with root.yaml creating them. With
+// --template-bucket the nested templates are uploaded and the root
+// template refers to their S3 URLs; otherwise it refers to the local files,
+// ready for `aws cloudformation package`. With --s3-uri every template is
+// uploaded there too, and the root template refers to the uploaded ones.
+func writeNested(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	stacks, err := render.Split(resources, ids, opts, *split)
+	if err != nil {
+		return err
+	}
+	if err := checkLimits(resources, nil); err != nil {
+		return err
+	}
+	for _, s := range stacks {
+		if err := checkLimits(&model.ResourceSet{}, s.Template); err != nil {
+			return fmt.Errorf("stack %s: %w", s.Name, err)
+		}
+	}
+	dir := *outputDir
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var uploader *s3Uploader
+	if *s3URI != "" {
+		if uploader, err = newS3Uploader(cfg); err != nil {
+			return err
+		}
+	}
+
+	urls := map[string]string{}
+	for _, s := range stacks {
+		file := s.Name + ".yaml"
+		if err := os.WriteFile(filepath.Join(dir, file), s.Template, 0o644); err != nil {
+			return err
+		}
+		urls[s.Name] = file
+		switch {
+		case uploader != nil:
+			if urls[s.Name], err = uploader.upload(ctx, file, s.Template); err != nil {
+				return err
+			}
+		case *templateBucket != "" && *split != "exports":
+			if urls[s.Name], err = uploadTemplate(ctx, cfg, s.Name, s.Template); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The stacks of exports are created on their own, without a root.
+	if *split == "exports" {
+		if err := writeDeployPlan(dir, stacks, urls, ""); err != nil {
+			return err
+		}
+		slog.Info("Wrote cross-stack templates", "stacks", len(stacks), "dir", dir)
+		return nil
+	}
+
+	b := bytes.Buffer{}
+	if err := render.Root(&b, stacks, urls); err != nil {
+		return err
+	}
+	root := filepath.Join(dir, "root.yaml")
+	if err := os.WriteFile(root, b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if uploader != nil {
+		if _, err := uploader.upload(ctx, "root.yaml", b.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := writeDeployPlan(dir, stacks, urls, "root.yaml"); err != nil {
+		return err
+	}
+	slog.Info("Wrote nested stack templates", "stacks", len(stacks), "root", root)
+	return nil
+}
+
+// deployPlanFile is the file of --output-dir describing how to roll out the
+// stacks of --split.
+const deployPlanFile = "deploy-plan.json"
+
+// writeDeployPlan writes the order to deploy stacks in, and the parameters
+// passed between them, to deployPlanFile in dir. It fails, naming them, on
+// stacks depending on each other in a cycle, which CloudFormation rejects.
+func writeDeployPlan(dir string, stacks []render.NestedStack, urls map[string]string, root string) error {
+	plan, err := render.Plan(stacks, urls, root)
+	if err != nil {
+		return fmt.Errorf("%s: %w, which CloudFormation can not deploy", deployPlanFile, err)
+	}
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, deployPlanFile), append(b, '\n'), 0o644)
+}
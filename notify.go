@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/diff"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+var (
+	notifyTopic   = flag.String("notify-sns-topic", "", "with diff or sync, publish a summary of the changes found to the SNS topic with this `arn`")
+	notifyWebhook = flag.String("notify-webhook", "", "with diff or sync, post a summary of the changes found to this webhook `url`, as a Slack-compatible JSON payload")
+)
+
+// maxSNSSubject is the length of the longest subject SNS accepts.
+const maxSNSSubject = 100
+
+// notifyChanges sends subject and the summary of changes to
+// --notify-sns-topic and --notify-webhook, when given.
+func notifyChanges(ctx context.Context, cfg aws.Config, subject string, changes []diff.Change) error {
+	if *notifyTopic == "" && *notifyWebhook == "" {
+		return nil
+	}
+	summary := bytes.Buffer{}
+	if err := diff.Write(&summary, changes); err != nil {
+		return err
+	}
+
+	if *notifyTopic != "" {
+		title := subject
+		if len(title) > maxSNSSubject {
+			title = title[:maxSNSSubject-3] + "..."
+		}
+		_, err := sns.NewFromConfig(cfg).Publish(ctx, &sns.PublishInput{
+			TopicArn: notifyTopic,
+			Subject:  aws.String(title),
+			Message:  aws.String(subject + "\n\n" + summary.String()),
+		})
+		if err != nil {
+			return fmt.Errorf("publishing to %s: %w", *notifyTopic, err)
+		}
+		slog.Info("Published the changes", "topic", *notifyTopic)
+	}
+
+	if *notifyWebhook != "" {
+		// Slack, and the chat services accepting its incoming webhooks,
+		// show the text of the payload as Markdown.
+		b, err := json.Marshal(map[string]string{"text": subject + "\n```\n" + summary.String() + "```"})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, *notifyWebhook, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("posting to the webhook: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("posting to the webhook: %s", resp.Status)
+		}
+		slog.Info("Posted the changes to the webhook")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+var (
+	maxPathDepth = flag.Int("max-path-depth", -1, "leave out the resources whose path has more than `n` elements, e.g. 1 keeps those at / and /ci/ but not /ci/deploy/ (default no limit)")
+	excludePaths stringValues
+)
+
+func init() {
+	flag.Var(&excludePaths, "exclude-path", "leave out the resources at the IAM `path` or below it, e.g. /vendor/ (repeatable)")
+}
+
+// filteringPaths reports whether resources are left out by their path.
+func filteringPaths() bool {
+	return *maxPathDepth >= 0 || len(excludePaths) > 0
+}
+
+// iamPath returns the path of the IAM resource with ARN a, e.g. /ci/ for
+// arn:aws:iam::123456789012:role/ci/deploy, or false for resources of other
+// services, such as permission sets.
+func iamPath(a string) (string, bool) {
+	parsed, err := arn.Parse(a)
+	if err != nil || parsed.Service != "iam" {
+		return "", false
+	}
+	r := parsed.Resource
+	first, last := strings.IndexByte(r, '/'), strings.LastIndexByte(r, '/')
+	if first < 0 {
+		return "", false
+	}
+	return r[first : last+1], true
+}
+
+// isExcludedPath reports whether --max-path-depth or --exclude-path leave
+// out the resource with ARN a.
+func isExcludedPath(a string) bool {
+	p, ok := iamPath(a)
+	if !ok {
+		return false
+	}
+	excluded := *maxPathDepth >= 0 && strings.Count(p, "/")-1 > *maxPathDepth
+	for _, e := range excludePaths {
+		if !strings.HasSuffix(e, "/") {
+			e += "/"
+		}
+		excluded = excluded || strings.HasPrefix(p, e)
+	}
+	return excluded
+}
+
+// skipPath reports whether a resource is left out by its path, recording
+// those that are. It is called while fetching.
+func skipPath(a string) bool {
+	if isExcludedPath(a) {
+		skip("path", 1)
+		return true
+	}
+	return false
+}
+
+// excludeResourcePaths leaves out the resources excluded by their path that
+// were not left out while fetching, e.g. those read from --input.
+func excludeResourcePaths(resources *model.ResourceSet) {
+	n := transform.Filter(resources, func(typ, name, arn string) bool { return !isExcludedPath(arn) })
+	skip("path", n)
+	if n > 0 {
+		slog.Info("Leaving out resources by their path", "resources", n)
+	}
+}
+
+// validPaths reports whether every path of l starts with a slash.
+func validPaths(l []string) bool {
+	for _, p := range l {
+		if !strings.HasPrefix(p, "/") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package iamexport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// AccessAdvisorClient is the subset of the IAM API used to read when
+// services were last accessed. *iam.Client satisfies it.
+type AccessAdvisorClient interface {
+	GenerateServiceLastAccessedDetails(context.Context, *iam.GenerateServiceLastAccessedDetailsInput, ...func(*iam.Options)) (*iam.GenerateServiceLastAccessedDetailsOutput, error)
+	GetServiceLastAccessedDetails(context.Context, *iam.GetServiceLastAccessedDetailsInput, ...func(*iam.Options)) (*iam.GetServiceLastAccessedDetailsOutput, error)
+}
+
+var _ AccessAdvisorClient = (*iam.Client)(nil)
+
+// AccessAdvisorOptions control how unused services are found.
+type AccessAdvisorOptions struct {
+	FetchOptions
+	// Since is the start of the lookback window: services not accessed
+	// since then are unused.
+	Since time.Time
+	// PollInterval is how often the status of a report is checked.
+	PollInterval time.Duration
+}
+
+// unusedServices returns the namespaces of the services the policies of
+// the resource at arn allow, but that were not accessed since opts.Since.
+func unusedServices(ctx context.Context, client AccessAdvisorClient, arn *string, opts AccessAdvisorOptions) ([]string, error) {
+	job, err := client.GenerateServiceLastAccessedDetails(ctx, &iam.GenerateServiceLastAccessedDetailsInput{Arn: arn})
+	if err != nil {
+		return nil, err
+	}
+
+	var unused []string
+	var marker *string
+	for {
+		resp, err := client.GetServiceLastAccessedDetails(ctx, &iam.GetServiceLastAccessedDetailsInput{
+			JobId:  job.JobId,
+			Marker: marker,
+		})
+		if err != nil {
+			return nil, err
+		}
+		switch resp.JobStatus {
+		case types.JobStatusTypeInProgress:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(opts.PollInterval):
+			}
+			continue
+		case types.JobStatusTypeFailed:
+			if resp.Error != nil {
+				return nil, fmt.Errorf("Access Advisor report failed: %s", aws.ToString(resp.Error.Message))
+			}
+			return nil, fmt.Errorf("Access Advisor report failed")
+		}
+
+		for _, s := range resp.ServicesLastAccessed {
+			if s.LastAuthenticated == nil || s.LastAuthenticated.Before(opts.Since) {
+				unused = append(unused, aws.ToString(s.ServiceNamespace))
+			}
+		}
+		if !resp.IsTruncated {
+			break
+		}
+		marker = resp.Marker
+	}
+	sort.Strings(unused)
+	return unused, nil
+}
+
+// FetchUnusedServices sets the UnusedServices of the roles and managed
+// policies in set to the services their policies allow but that IAM
+// Access Advisor reports as not accessed since opts.Since.
+func FetchUnusedServices(ctx context.Context, client AccessAdvisorClient, set *model.ResourceSet, opts AccessAdvisorOptions) error {
+	err := forEach(ctx, opts.concurrency(), len(set.Roles), func(ctx context.Context, i int) error {
+		r := &set.Roles[i]
+		unused, err := unusedServices(ctx, client, r.Arn, opts)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		r.UnusedServices = unused
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return forEach(ctx, opts.concurrency(), len(set.Policies), func(ctx context.Context, i int) error {
+		p := &set.Policies[i]
+		unused, err := unusedServices(ctx, client, p.Arn, opts)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+		p.UnusedServices = unused
+		return nil
+	})
+}
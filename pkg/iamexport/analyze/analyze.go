@@ -0,0 +1,99 @@
+// Package analyze inspects the policies of fetched resources for risky
+// permissions and trust relationships.
+package analyze
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity ranks how risky a trust relationship or finding is.
+type Severity int
+
+const (
+	Info Severity = iota
+	Low
+	Medium
+	High
+	Critical
+)
+
+var severityNames = []string{"info", "low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < Info || s > Critical {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText writes the severity by name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseSeverity returns the severity called name, e.g. "high".
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return Severity(i), nil
+		}
+	}
+	return Info, fmt.Errorf("invalid severity %q, must be one of %s", name, strings.Join(severityNames, ", "))
+}
+
+// accountOf returns the account ID in arn, or "" if it has none.
+func accountOf(arn string) string {
+	if parts := strings.SplitN(arn, ":", 6); len(parts) == 6 {
+		return parts[4]
+	}
+	return ""
+}
+
+// hasConditionKey reports whether c tests a key matching key, ignoring
+// case. A key starting with "*" matches any key ending with the rest,
+// e.g. "*:sub".
+func hasConditionKey(c map[string]map[string][]string, key string) bool {
+	for _, keys := range c {
+		for k := range keys {
+			k = strings.ToLower(k)
+			if strings.HasPrefix(key, "*") && strings.HasSuffix(k, strings.ToLower(key[1:])) {
+				return true
+			}
+			if k == strings.ToLower(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchAction reports whether the action pattern of a policy, which may
+// hold "*" and "?" wildcards, matches action, ignoring case.
+func matchAction(pattern, action string) bool {
+	return matchWildcard(strings.ToLower(pattern), strings.ToLower(action))
+}
+
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
@@ -0,0 +1,166 @@
+package analyze
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/policy"
+)
+
+// Finding is a risky statement of a policy.
+type Finding struct {
+	// Type and Name identify the resource owning the policy: a managed
+	// policy, or the role, group, user or permission set of an inline
+	// policy.
+	Type string
+	Name string
+	Arn  string
+	// Policy is the name of an inline policy, or "" for managed policies.
+	Policy string
+	Sid    string
+	// Check is one of "admin", "all-actions", "all-resources",
+	// "not-action", "pass-role" or "assume-any-role".
+	Check    string
+	Severity Severity
+	Reason   string
+}
+
+// Resource returns the type and name of the resource owning the policy,
+// followed by the name of the inline policy, e.g. "role/app/inline-s3".
+func (f Finding) Resource() string {
+	r := f.Type + "/" + f.Name
+	if f.Policy != "" {
+		r += "/" + f.Policy
+	}
+	return r
+}
+
+func containsWildcard(l []string) bool {
+	for _, v := range l {
+		if v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// grants returns the actions of s other than "*" matching action.
+func grants(s policy.Statement, action string) []string {
+	var l []string
+	for _, a := range s.Action {
+		if a != "*" && matchAction(a, action) {
+			l = append(l, a)
+		}
+	}
+	return l
+}
+
+// audit returns the findings of the Allow statements of doc, owned by f.
+func audit(f Finding, doc string) ([]Finding, error) {
+	statements, err := policy.Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	add := func(s policy.Statement, check string, severity Severity, reason string) {
+		f.Sid, f.Check, f.Severity, f.Reason = s.Sid, check, severity, reason
+		findings = append(findings, f)
+	}
+	for _, s := range statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+		allActions := containsWildcard(s.Action)
+		allResources := containsWildcard(s.Resource)
+
+		switch {
+		case allActions && allResources:
+			add(s, "admin", Critical, "allows every action on every resource")
+		case allActions:
+			add(s, "all-actions", High, "allows every action on "+strings.Join(s.Resource, ", "))
+		case allResources && len(s.Action) > 0:
+			add(s, "all-resources", Low, "allows "+strings.Join(s.Action, ", ")+" on every resource")
+		}
+		if len(s.NotAction) > 0 {
+			add(s, "not-action", High, "allows every action but "+strings.Join(s.NotAction, ", ")+", including actions added to AWS later")
+		}
+		if actions := grants(s, "iam:PassRole"); len(actions) > 0 && len(s.Condition) == 0 {
+			add(s, "pass-role", High, strings.Join(actions, ", ")+" without conditions allows passing "+strings.Join(s.Resource, ", ")+" to any service")
+		}
+		if actions := grants(s, "sts:AssumeRole"); len(actions) > 0 && allResources {
+			add(s, "assume-any-role", High, strings.Join(actions, ", ")+" on every resource allows assuming any role that trusts the account")
+		}
+	}
+	return findings, nil
+}
+
+// Audit returns the risky statements of the managed policies in set and of
+// the inline policies of its roles, groups, users and permission sets:
+// every action on every resource, every action, every resource, Allow
+// statements with a NotAction, iam:PassRole without conditions, and
+// sts:AssumeRole on every resource.
+func Audit(set *model.ResourceSet) ([]Finding, error) {
+	var findings []Finding
+	check := func(f Finding, doc *string) error {
+		if doc == nil || *doc == "" {
+			return nil
+		}
+		l, err := audit(f, *doc)
+		if err != nil {
+			if f.Policy != "" {
+				return fmt.Errorf("%s %s: policy %s: %w", f.Type, f.Name, f.Policy, err)
+			}
+			return fmt.Errorf("%s %s: %w", f.Type, f.Name, err)
+		}
+		findings = append(findings, l...)
+		return nil
+	}
+	inline := func(typ string, name, arn *string, policies model.PolicyResources) error {
+		for _, p := range policies {
+			if err := check(Finding{Type: typ, Name: *name, Arn: *arn, Policy: *p.Name}, p.PolicyDocument); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, p := range set.Policies {
+		if err := check(Finding{Type: "policy", Name: *p.Name, Arn: *p.Arn}, p.PolicyDocument); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range set.Roles {
+		if err := inline("role", r.Name, r.Arn, r.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range set.Groups {
+		if err := inline("group", g.Name, g.Arn, g.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range set.Users {
+		if err := inline("user", u.Name, u.Arn, u.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, ps := range set.PermissionSets {
+		if err := check(Finding{Type: "permission-set", Name: *ps.Name, Arn: *ps.Arn, Policy: "inline"}, ps.InlinePolicy); err != nil {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
+
+// WriteFindings writes findings to w as a table, one finding per line.
+func WriteFindings(w io.Writer, findings []Finding) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tSID\tCHECK\tSEVERITY\tREASON")
+	for _, f := range findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Resource(), f.Sid, f.Check, f.Severity, f.Reason)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,279 @@
+package analyze
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/policy"
+)
+
+// SCP is a service control policy applying to the account.
+type SCP struct {
+	ID   string
+	Name string
+	// Target is the root, organizational unit or account the policy is
+	// attached to. Every target above the account must allow an action
+	// for the account to be allowed it.
+	Target   string
+	Document string
+}
+
+// Caveat is an action an exported policy allows that a permissions
+// boundary or service control policy denies, or does not allow, so that
+// the principals of the policy are granted less than it reads.
+type Caveat struct {
+	// Type and Name identify the resource owning the policy, as in
+	// Finding: a managed policy, or the role, group or user of an inline
+	// policy.
+	Type string
+	Name string
+	// Policy is the name of an inline policy, or "" for managed policies.
+	Policy string
+	Sid    string
+	Action string
+	// Constraint is the policy constraining the action, e.g.
+	// "boundary arn:aws:iam::123456789012:policy/boundary" or
+	// "scp FullAWSAccess (p-FullAWSAccess)".
+	Constraint string
+	Reason     string
+}
+
+// Resource returns the type and name of the resource owning the policy,
+// followed by the name of the inline policy, as Finding.Resource does.
+func (c Caveat) Resource() string {
+	r := c.Type + "/" + c.Name
+	if c.Policy != "" {
+		r += "/" + c.Policy
+	}
+	return r
+}
+
+// sourced is a statement of the boundary or SCP named by source.
+type sourced struct {
+	policy.Statement
+	source string
+}
+
+// guardLevel is a permissions boundary, or the SCPs of a target: one of
+// its Allow statements must allow an action, and none of its Deny
+// statements deny it.
+type guardLevel struct {
+	name       string
+	statements []sourced
+}
+
+// overlaps reports whether the actions of s and action, either of which
+// may hold wildcards, have an action in common.
+func overlaps(s policy.Statement, action string) bool {
+	if len(s.NotAction) > 0 {
+		for _, a := range s.NotAction {
+			if matchAction(a, action) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, a := range s.Action {
+		if matchAction(a, action) || matchAction(action, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether s applies to every action action matches.
+func covers(s policy.Statement, action string) bool {
+	if len(s.NotAction) > 0 {
+		for _, a := range s.NotAction {
+			if matchAction(a, action) || matchAction(action, a) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, a := range s.Action {
+		if matchAction(a, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// constrain returns the policy constraining action among levels and why,
+// or "" when they allow it. Resources are not evaluated, and conditions
+// only make denials and allowances partial.
+func constrain(levels []guardLevel, action string) (string, string) {
+	for _, l := range levels {
+		for _, s := range l.statements {
+			if s.Effect == "Deny" && overlaps(s.Statement, action) {
+				if len(s.Condition) > 0 || !covers(s.Statement, action) {
+					return s.source, "partly denied"
+				}
+				return s.source, "denied"
+			}
+		}
+	}
+	for _, l := range levels {
+		reason := "not allowed"
+		for _, s := range l.statements {
+			if s.Effect != "Allow" {
+				continue
+			}
+			if covers(s.Statement, action) && len(s.Condition) == 0 {
+				reason = ""
+				break
+			}
+			if overlaps(s.Statement, action) {
+				reason = "partly allowed"
+			}
+		}
+		if reason != "" {
+			return l.name, reason
+		}
+	}
+	return "", ""
+}
+
+// parseLevel parses doc, the document of the boundary or SCP named source,
+// into the statements of level.
+func parseLevel(level *guardLevel, source, doc string) error {
+	statements, err := policy.Parse(doc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	for _, s := range statements {
+		level.statements = append(level.statements, sourced{s, source})
+	}
+	return nil
+}
+
+// Caveats returns the actions the Allow statements of the policies in set
+// grant that the service control policies scps, or the permissions
+// boundaries of its roles and users, deny or do not allow. The documents
+// of the boundaries are taken from boundaries, keyed by ARN; a boundary
+// without a document is reported once for its role or user.
+//
+// Only actions are evaluated, not resources, and conditions make denials
+// and allowances partial, so caveats point reviewers at the statements
+// constrained rather than prove them ineffective. Statements with a
+// NotAction are left out.
+func Caveats(set *model.ResourceSet, boundaries map[string]string, scps []SCP) ([]Caveat, error) {
+	// Each target of SCPs is a level an action must be allowed at.
+	var scpLevels []guardLevel
+	targets := map[string]int{}
+	for _, p := range scps {
+		i, ok := targets[p.Target]
+		if !ok {
+			i = len(scpLevels)
+			targets[p.Target] = i
+			scpLevels = append(scpLevels, guardLevel{name: "scps of " + p.Target})
+		}
+		if err := parseLevel(&scpLevels[i], fmt.Sprintf("scp %s (%s)", p.Name, p.ID), p.Document); err != nil {
+			return nil, err
+		}
+	}
+
+	var caveats []Caveat
+	check := func(c Caveat, doc *string, levels []guardLevel) error {
+		if doc == nil || *doc == "" || len(levels) == 0 {
+			return nil
+		}
+		statements, err := policy.Parse(*doc)
+		if err != nil {
+			if c.Policy != "" {
+				return fmt.Errorf("%s %s: policy %s: %w", c.Type, c.Name, c.Policy, err)
+			}
+			return fmt.Errorf("%s %s: %w", c.Type, c.Name, err)
+		}
+		for _, s := range statements {
+			if s.Effect != "Allow" {
+				continue
+			}
+			for _, a := range s.Action {
+				if constraint, reason := constrain(levels, a); constraint != "" {
+					c.Sid, c.Action, c.Constraint, c.Reason = s.Sid, a, constraint, reason
+					caveats = append(caveats, c)
+				}
+			}
+		}
+		return nil
+	}
+
+	managed := map[string]model.PolicyResource{}
+	for _, p := range set.Policies {
+		managed[*p.Arn] = p
+		if err := check(Caveat{Type: "policy", Name: *p.Name}, p.PolicyDocument, scpLevels); err != nil {
+			return nil, err
+		}
+	}
+	// The policies of roles and users with a permissions boundary are
+	// checked against it, along with the SCPs.
+	principal := func(typ string, name, boundary *string, inline model.PolicyResources, arns []string) error {
+		levels := scpLevels
+		var b *guardLevel
+		if boundary != nil {
+			if doc, ok := boundaries[*boundary]; ok {
+				b = &guardLevel{name: "boundary " + *boundary}
+				if err := parseLevel(b, b.name, doc); err != nil {
+					return err
+				}
+				levels = append([]guardLevel{*b}, scpLevels...)
+			} else {
+				caveats = append(caveats, Caveat{
+					Type:       typ,
+					Name:       *name,
+					Action:     "*",
+					Constraint: "boundary " + *boundary,
+					Reason:     "boundary not available",
+				})
+			}
+		}
+		for _, p := range inline {
+			if err := check(Caveat{Type: typ, Name: *name, Policy: *p.Name}, p.PolicyDocument, levels); err != nil {
+				return err
+			}
+		}
+		if b == nil {
+			return nil
+		}
+		// Managed policies were checked against the SCPs above; only
+		// the boundary of the principal is left to check them against.
+		for _, arn := range arns {
+			if p, ok := managed[arn]; ok {
+				if err := check(Caveat{Type: typ, Name: *name, Policy: *p.Name}, p.PolicyDocument, []guardLevel{*b}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, g := range set.Groups {
+		if err := principal("group", g.Name, nil, g.Policies, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range set.Roles {
+		if err := principal("role", r.Name, r.PermissionsBoundary, r.Policies, r.ManagedPolicyArns); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range set.Users {
+		if err := principal("user", u.Name, u.PermissionsBoundary, u.Policies, u.ManagedPolicyArns); err != nil {
+			return nil, err
+		}
+	}
+	return caveats, nil
+}
+
+// WriteCaveats writes caveats to w as a table, one action per line.
+func WriteCaveats(w io.Writer, caveats []Caveat) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tSID\tACTION\tREASON\tCONSTRAINT")
+	for _, c := range caveats {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Resource(), c.Sid, c.Action, c.Reason, c.Constraint)
+	}
+	return tw.Flush()
+}
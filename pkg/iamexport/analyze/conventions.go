@@ -0,0 +1,204 @@
+package analyze
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// Convention is what every exported resource of a type has in common, to
+// be enforced on the resources of templates by policy-as-code rules.
+type Convention struct {
+	// Type is the CloudFormation type of the resources, e.g.
+	// AWS::IAM::Role, and Name the name of its rules, e.g. roles.
+	Type string
+	Name string
+	// Tags are the keys of the tags every resource has.
+	Tags []string
+	// Paths are the top-level paths of the resources, e.g. /ci/, or / for
+	// those without a path of their own. They are left out when every
+	// resource is at /.
+	Paths []string
+	// Boundary is set when every resource has a permissions boundary.
+	Boundary bool
+}
+
+// PathPattern returns the regular expression matching the paths of c:
+// the paths under its top-level paths, and / itself.
+func (c Convention) PathPattern() string {
+	var alts []string
+	for _, p := range c.Paths {
+		if p == "/" {
+			alts = append(alts, "^/$")
+		} else {
+			alts = append(alts, "^"+regexp.QuoteMeta(p))
+		}
+	}
+	return strings.Join(alts, "|")
+}
+
+// observed accumulates what the resources of a type have in common.
+type observed struct {
+	count    int
+	tags     map[string]int
+	paths    map[string]bool
+	boundary int
+}
+
+func (o *observed) add(tags []types.Tag, path, boundary *string) {
+	if o.tags == nil {
+		o.tags = map[string]int{}
+		o.paths = map[string]bool{}
+	}
+	o.count++
+	seen := map[string]bool{}
+	for _, t := range tags {
+		if k := aws.ToString(t.Key); !seen[k] {
+			seen[k] = true
+			o.tags[k]++
+		}
+	}
+	// Paths are reduced to their first element, e.g. /ci/deploy/ to /ci/.
+	p := aws.ToString(path)
+	if p == "" {
+		p = "/"
+	}
+	if i := strings.Index(p[1:], "/"); i >= 0 {
+		p = p[:i+2]
+	}
+	o.paths[p] = true
+	if boundary != nil {
+		o.boundary++
+	}
+}
+
+func (o *observed) convention(typ, name string) Convention {
+	c := Convention{Type: typ, Name: name, Boundary: o.count > 0 && o.boundary == o.count}
+	for k, n := range o.tags {
+		if n == o.count {
+			c.Tags = append(c.Tags, k)
+		}
+	}
+	sort.Strings(c.Tags)
+	if len(o.paths) > 1 || !o.paths["/"] {
+		for p := range o.paths {
+			c.Paths = append(c.Paths, p)
+		}
+		sort.Strings(c.Paths)
+	}
+	return c
+}
+
+// Conventions returns the conventions the groups, managed policies, roles
+// and users of set follow, for the types with resources in set and at
+// least one convention.
+func Conventions(set *model.ResourceSet) []Convention {
+	var groups, policies, roles, users observed
+	for _, g := range set.Groups {
+		groups.add(nil, g.Path, nil)
+	}
+	for _, p := range set.Policies {
+		policies.add(p.Tags, p.Path, nil)
+	}
+	for _, r := range set.Roles {
+		roles.add(r.Tags, r.Path, r.PermissionsBoundary)
+	}
+	for _, u := range set.Users {
+		users.add(u.Tags, u.Path, u.PermissionsBoundary)
+	}
+
+	var l []Convention
+	for _, c := range []Convention{
+		groups.convention("AWS::IAM::Group", "groups"),
+		policies.convention("AWS::IAM::ManagedPolicy", "policies"),
+		roles.convention("AWS::IAM::Role", "roles"),
+		users.convention("AWS::IAM::User", "users"),
+	} {
+		if len(c.Tags) > 0 || len(c.Paths) > 0 || c.Boundary {
+			l = append(l, c)
+		}
+	}
+	return l
+}
+
+// WriteGuardRules writes conventions to w as cfn-guard rules checking the
+// resources of CloudFormation templates.
+func WriteGuardRules(w io.Writer, conventions []Convention) error {
+	b := strings.Builder{}
+	b.WriteString("# Conventions of the IAM resources exported by iam-cf-generator.\n")
+	for _, c := range conventions {
+		fmt.Fprintf(&b, "\nlet %s = Resources.*[ Type == '%s' ]\n", c.Name, c.Type)
+		for _, k := range c.Tags {
+			fmt.Fprintf(&b, "\nrule %s_tagged_%s when %%%s !empty {\n", c.Name, ruleName(k), c.Name)
+			fmt.Fprintf(&b, "    %%%s {\n", c.Name)
+			fmt.Fprintf(&b, "        some Properties.Tags[*].Key == '%s'\n", strings.ReplaceAll(k, "'", "\\'"))
+			fmt.Fprintf(&b, "        <<%s must be tagged with %s>>\n    }\n}\n", c.Name, k)
+		}
+		if len(c.Paths) > 0 {
+			fmt.Fprintf(&b, "\nrule %s_path when %%%s !empty {\n", c.Name, c.Name)
+			fmt.Fprintf(&b, "    %%%s {\n", c.Name)
+			fmt.Fprintf(&b, "        Properties.Path !exists or\n")
+			fmt.Fprintf(&b, "        Properties.Path == /%s/\n", strings.ReplaceAll(c.PathPattern(), "/", "\\/"))
+			fmt.Fprintf(&b, "        <<%s must be under %s>>\n    }\n}\n", c.Name, strings.Join(c.Paths, ", "))
+		}
+		if c.Boundary {
+			fmt.Fprintf(&b, "\nrule %s_boundary when %%%s !empty {\n", c.Name, c.Name)
+			fmt.Fprintf(&b, "    %%%s.Properties.PermissionsBoundary exists\n", c.Name)
+			fmt.Fprintf(&b, "    <<%s must have a permissions boundary>>\n}\n", c.Name)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteRegoRules writes conventions to w as the deny rules of a Rego
+// policy, as conftest evaluates them, checking the resources of
+// CloudFormation templates.
+func WriteRegoRules(w io.Writer, conventions []Convention) error {
+	b := strings.Builder{}
+	b.WriteString("# Conventions of the IAM resources exported by iam-cf-generator.\n")
+	b.WriteString("package main\n\nimport rego.v1\n\n")
+	b.WriteString("has_tag(resource, key) if resource.Properties.Tags[_].Key == key\n")
+	for _, c := range conventions {
+		for _, k := range c.Tags {
+			fmt.Fprintf(&b, "\ndeny contains msg if {\n")
+			fmt.Fprintf(&b, "\tsome id, resource in input.Resources\n")
+			fmt.Fprintf(&b, "\tresource.Type == %q\n", c.Type)
+			fmt.Fprintf(&b, "\tnot has_tag(resource, %q)\n", k)
+			fmt.Fprintf(&b, "\tmsg := sprintf(\"%%s: %s must be tagged with %%s\", [id, %q])\n}\n", c.Name, k)
+		}
+		if len(c.Paths) > 0 {
+			fmt.Fprintf(&b, "\ndeny contains msg if {\n")
+			fmt.Fprintf(&b, "\tsome id, resource in input.Resources\n")
+			fmt.Fprintf(&b, "\tresource.Type == %q\n", c.Type)
+			fmt.Fprintf(&b, "\tpath := object.get(resource, [\"Properties\", \"Path\"], \"/\")\n")
+			fmt.Fprintf(&b, "\tnot regex.match(`%s`, path)\n", c.PathPattern())
+			fmt.Fprintf(&b, "\tmsg := sprintf(\"%%s: %s must be under %s, not %%s\", [id, path])\n}\n", c.Name, strings.Join(c.Paths, ", "))
+		}
+		if c.Boundary {
+			fmt.Fprintf(&b, "\ndeny contains msg if {\n")
+			fmt.Fprintf(&b, "\tsome id, resource in input.Resources\n")
+			fmt.Fprintf(&b, "\tresource.Type == %q\n", c.Type)
+			fmt.Fprintf(&b, "\tnot resource.Properties.PermissionsBoundary\n")
+			fmt.Fprintf(&b, "\tmsg := sprintf(\"%%s: %s must have a permissions boundary\", [id])\n}\n", c.Name)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ruleName reduces the tag key k to the characters of a rule name.
+func ruleName(k string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, k)
+}
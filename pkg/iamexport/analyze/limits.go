@@ -0,0 +1,189 @@
+package analyze
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Limits of CloudFormation templates and IAM quotas. Quotas IAM can raise
+// on request are warned about at their default value, and only fail at
+// their highest.
+const (
+	maxTemplateBody       = 1048576
+	maxInlineTemplateBody = 51200
+	maxResources          = 500
+	maxOutputs            = 200
+	maxParameters         = 200
+
+	maxManagedPolicySize     = 6144
+	maxRoleInlineSize        = 10240
+	maxGroupInlineSize       = 5120
+	maxUserInlineSize        = 2048
+	maxPermissionSetInline   = 32768
+	defaultAttachedPolicies  = 10
+	maxAttachedPolicies      = 20
+	defaultTrustPolicySize   = 2048
+	maxTrustPolicySize       = 4096
+	maxPermissionSetPolicies = 20
+)
+
+// Violation is a CloudFormation limit or IAM quota an export exceeds.
+type Violation struct {
+	// Resource is the type and name of the resource exceeding the limit,
+	// e.g. "role/app", or "template" for the template itself.
+	Resource string
+	// Limit names the limit, e.g. "inline-template-size".
+	Limit string
+	// Warning is set for the limits that can be worked around, or quotas
+	// that can be raised, as opposed to those failing the deployment.
+	Warning bool
+	Message string
+}
+
+// PolicySize returns the number of characters of doc IAM counts against its
+// quotas, which leave out whitespace.
+func PolicySize(doc *string) int {
+	if doc == nil {
+		return 0
+	}
+	b := bytes.Buffer{}
+	if err := json.Compact(&b, []byte(*doc)); err == nil {
+		return utf8.RuneCount(b.Bytes())
+	}
+	n := 0
+	for _, r := range *doc {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func inlineSize(policies model.PolicyResources) int {
+	n := 0
+	for _, p := range policies {
+		n += PolicySize(p.PolicyDocument)
+	}
+	return n
+}
+
+// templateCounts returns the number of resources, outputs and parameters
+// of a YAML template.
+func templateCounts(template []byte) (resources, outputs, parameters int, err error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(template, &doc); err != nil {
+		return 0, 0, 0, fmt.Errorf("reading template: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return 0, 0, 0, nil
+	}
+	top := doc.Content[0].Content
+	for i := 0; i+1 < len(top); i += 2 {
+		n := len(top[i+1].Content) / 2
+		switch top[i].Value {
+		case "Resources":
+			resources = n
+		case "Outputs":
+			outputs = n
+		case "Parameters":
+			parameters = n
+		}
+	}
+	return resources, outputs, parameters, nil
+}
+
+// CheckLimits returns the CloudFormation limits template exceeds, and the
+// IAM quotas the resources of set exceed, which would otherwise only fail
+// the deployment of the template. template may be nil to only check the
+// quotas.
+func CheckLimits(set *model.ResourceSet, template []byte) ([]Violation, error) {
+	var violations []Violation
+	add := func(resource, limit string, warning bool, format string, args ...interface{}) {
+		violations = append(violations, Violation{
+			Resource: resource,
+			Limit:    limit,
+			Warning:  warning,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if template != nil {
+		switch size := len(template); {
+		case size > maxTemplateBody:
+			add("template", "template-size", false, "The template is %d bytes, above the %d bytes CloudFormation accepts; split it into nested stacks with --split", size, maxTemplateBody)
+		case size > maxInlineTemplateBody:
+			add("template", "inline-template-size", true, "The template is %d bytes, above the %d bytes CloudFormation accepts inline; upload it to S3, e.g. with --template-bucket", size, maxInlineTemplateBody)
+		}
+		resources, outputs, parameters, err := templateCounts(template)
+		if err != nil {
+			return nil, err
+		}
+		if resources > maxResources {
+			add("template", "resources", false, "The template has %d resources, above the %d CloudFormation accepts; split it into nested stacks with --split, or export fewer resource types", resources, maxResources)
+		}
+		if outputs > maxOutputs {
+			add("template", "outputs", false, "The template has %d outputs, above the %d CloudFormation accepts; leave out --outputs or split it with --split", outputs, maxOutputs)
+		}
+		if parameters > maxParameters {
+			add("template", "parameters", false, "The template has %d parameters, above the %d CloudFormation accepts; split it into nested stacks with --split", parameters, maxParameters)
+		}
+	}
+
+	for _, p := range set.Policies {
+		if size := PolicySize(p.PolicyDocument); size > maxManagedPolicySize {
+			add("policy/"+*p.Name, "managed-policy-size", false, "The document is %d characters, above the %d IAM accepts for managed policies; split it into several policies", size, maxManagedPolicySize)
+		}
+	}
+
+	// attached checks the number of managed policies attached to the
+	// resource, against the default quota and its highest value.
+	attached := func(resource string, n int) {
+		switch {
+		case n > maxAttachedPolicies:
+			add(resource, "attached-policies", false, "%d managed policies are attached, above the %d IAM accepts; merge some of them", n, maxAttachedPolicies)
+		case n > defaultAttachedPolicies:
+			add(resource, "attached-policies", true, "%d managed policies are attached, above the default quota of %d; have it raised to %d, or merge some of them", n, defaultAttachedPolicies, maxAttachedPolicies)
+		}
+	}
+	inline := func(resource string, policies model.PolicyResources, max int) {
+		if size := inlineSize(policies); size > max {
+			add(resource, "inline-policy-size", false, "The inline policies are %d characters, above the %d IAM accepts; move them to managed policies, e.g. with --inline-to-managed", size, max)
+		}
+	}
+
+	for _, g := range set.Groups {
+		attached("group/"+*g.Name, len(g.ManagedPolicyArns))
+		inline("group/"+*g.Name, g.Policies, maxGroupInlineSize)
+	}
+	for _, r := range set.Roles {
+		resource := "role/" + *r.Name
+		attached(resource, len(r.ManagedPolicyArns))
+		inline(resource, r.Policies, maxRoleInlineSize)
+		switch size := PolicySize(r.AssumeRolePolicyDocument); {
+		case size > maxTrustPolicySize:
+			add(resource, "trust-policy-size", false, "The trust policy is %d characters, above the %d IAM accepts; trust fewer principals", size, maxTrustPolicySize)
+		case size > defaultTrustPolicySize:
+			add(resource, "trust-policy-size", true, "The trust policy is %d characters, above the default quota of %d; have it raised to %d, or trust fewer principals", size, defaultTrustPolicySize, maxTrustPolicySize)
+		}
+	}
+	for _, u := range set.Users {
+		attached("user/"+*u.Name, len(u.ManagedPolicyArns))
+		inline("user/"+*u.Name, u.Policies, maxUserInlineSize)
+	}
+	for _, ps := range set.PermissionSets {
+		resource := "permission-set/" + *ps.Name
+		if size := PolicySize(ps.InlinePolicy); size > maxPermissionSetInline {
+			add(resource, "inline-policy-size", false, "The inline policy is %d characters, above the %d Identity Center accepts; attach managed policies instead", size, maxPermissionSetInline)
+		}
+		if n := len(ps.ManagedPolicies); n > maxPermissionSetPolicies {
+			add(resource, "attached-policies", false, "%d managed policies are attached, above the %d Identity Center accepts; merge some of them", n, maxPermissionSetPolicies)
+		}
+	}
+	return violations, nil
+}
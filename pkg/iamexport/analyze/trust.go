@@ -0,0 +1,138 @@
+package analyze
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/policy"
+)
+
+// Trust is a principal a role's trust policy allows to assume it.
+type Trust struct {
+	Role    string
+	RoleArn string
+	Sid     string
+	// Principal is the principal as written in the trust policy, e.g. an
+	// ARN, an account ID, a service or "*".
+	Principal string
+	// Kind is one of "wildcard", "same-account", "cross-account",
+	// "service", "federated" or "canonical-user".
+	Kind string
+	// Severity and Reason flag risky relationships. Reason is empty for
+	// relationships of Info severity.
+	Severity Severity
+	Reason   string
+}
+
+var accountID = regexp.MustCompile(`^\d{12}$`)
+
+// classify returns the trust relationship of role with the principal of
+// type typ, in statement s.
+func classify(role model.RoleResource, s policy.Statement, typ, principal string) Trust {
+	t := Trust{Role: *role.Name, RoleArn: *role.Arn, Sid: s.Sid, Principal: principal}
+	conditional := len(s.Condition) > 0
+
+	switch {
+	case typ == "*" || principal == "*":
+		t.Kind = "wildcard"
+		t.Severity, t.Reason = Critical, "any principal of any AWS account can assume the role"
+		if conditional {
+			t.Severity, t.Reason = Medium, "any principal of any AWS account can assume the role if the conditions match"
+		}
+	case typ == "AWS":
+		account := principal
+		if !accountID.MatchString(principal) {
+			account = accountOf(principal)
+		}
+		if account == accountOf(*role.Arn) {
+			t.Kind = "same-account"
+			break
+		}
+		t.Kind = "cross-account"
+		switch {
+		case hasConditionKey(s.Condition, "sts:ExternalId"):
+			t.Severity, t.Reason = Low, "account "+account+" can assume the role with the external ID"
+		case hasConditionKey(s.Condition, "aws:PrincipalOrgID") || hasConditionKey(s.Condition, "aws:PrincipalOrgPaths"):
+			t.Severity, t.Reason = Low, "account "+account+" of the organization can assume the role"
+		default:
+			t.Severity, t.Reason = High, "account "+account+" can assume the role without an sts:ExternalId condition"
+		}
+	case typ == "Service":
+		t.Kind = "service"
+	case typ == "Federated":
+		t.Kind = "federated"
+		webIdentity := false
+		for _, a := range s.Action {
+			if strings.EqualFold(a, "sts:AssumeRoleWithWebIdentity") || a == "*" || strings.EqualFold(a, "sts:*") {
+				webIdentity = true
+			}
+		}
+		switch {
+		case !conditional:
+			t.Severity, t.Reason = High, "any identity of the provider can assume the role"
+		case webIdentity && !hasConditionKey(s.Condition, "*:sub"):
+			t.Severity, t.Reason = High, "no condition on the subject, so any identity of the provider can assume the role"
+		}
+	default:
+		t.Kind = strings.ToLower(typ)
+		if typ == "CanonicalUser" {
+			t.Kind = "canonical-user"
+		}
+	}
+	return t
+}
+
+// TrustRelationships returns the principals the trust policies of the
+// roles in set allow, flagging wildcard principals, other accounts without
+// an sts:ExternalId or organization condition, and web identity
+// federation not restricted to a subject. Allow statements with a
+// NotPrincipal, which trust everyone but the listed principals, are
+// reported as wildcards.
+func TrustRelationships(set *model.ResourceSet) ([]Trust, error) {
+	var trusts []Trust
+	for _, r := range set.Roles {
+		if r.AssumeRolePolicyDocument == nil {
+			continue
+		}
+		statements, err := policy.Parse(*r.AssumeRolePolicyDocument)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: trust policy: %w", *r.Name, err)
+		}
+		for _, s := range statements {
+			if s.Effect != "Allow" {
+				continue
+			}
+			if len(s.NotPrincipal) > 0 {
+				trusts = append(trusts, Trust{
+					Role: *r.Name, RoleArn: *r.Arn, Sid: s.Sid,
+					Principal: "NotPrincipal " + strings.Join(policy.Principals(s.NotPrincipal), ", "),
+					Kind:      "wildcard",
+					Severity:  Critical,
+					Reason:    "every principal but the listed ones can assume the role",
+				})
+			}
+			for _, p := range policy.Principals(s.Principal) {
+				typ, value := p, p
+				if i := strings.IndexByte(p, ':'); i >= 0 {
+					typ, value = p[:i], p[i+1:]
+				}
+				trusts = append(trusts, classify(r, s, typ, value))
+			}
+		}
+	}
+	return trusts, nil
+}
+
+// WriteTrust writes trusts to w as a table, one principal per line.
+func WriteTrust(w io.Writer, trusts []Trust) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLE\tPRINCIPAL\tKIND\tSEVERITY\tREASON")
+	for _, t := range trusts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.Role, t.Principal, t.Kind, t.Severity, t.Reason)
+	}
+	return tw.Flush()
+}
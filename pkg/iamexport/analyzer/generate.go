@@ -0,0 +1,137 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+)
+
+// GenerateOptions select the CloudTrail activity policies are generated
+// from.
+type GenerateOptions struct {
+	// AccessRole is the ARN of the role Access Analyzer assumes to read
+	// the trails.
+	AccessRole string
+	// Trails are the ARNs of the trails to read, in every region.
+	Trails []string
+	// Start and End bound the activity read. Access Analyzer reads at
+	// most 90 days.
+	Start time.Time
+	End   time.Time
+	// PollInterval is how often the status of a generation job is
+	// checked.
+	PollInterval time.Duration
+}
+
+// startGeneration starts generating a policy from the activity of the
+// principal arn and returns the job ID.
+func startGeneration(ctx context.Context, client Client, arn string, opts GenerateOptions) (*string, error) {
+	details := &types.CloudTrailDetails{
+		AccessRole: aws.String(opts.AccessRole),
+		StartTime:  aws.Time(opts.Start),
+		EndTime:    aws.Time(opts.End),
+	}
+	for _, trail := range opts.Trails {
+		details.Trails = append(details.Trails, types.Trail{
+			CloudTrailArn: aws.String(trail),
+			AllRegions:    aws.Bool(true),
+		})
+	}
+	out, err := client.StartPolicyGeneration(ctx, &accessanalyzer.StartPolicyGenerationInput{
+		PolicyGenerationDetails: &types.PolicyGenerationDetails{PrincipalArn: aws.String(arn)},
+		CloudTrailDetails:       details,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.JobId, nil
+}
+
+// generatedPolicies waits for the generation job id to finish and returns
+// the policies it generated, with placeholders for the resources Access
+// Analyzer could not determine.
+func generatedPolicies(ctx context.Context, client Client, id *string, interval time.Duration) ([]string, error) {
+	for {
+		out, err := client.GetGeneratedPolicy(ctx, &accessanalyzer.GetGeneratedPolicyInput{
+			JobId:                       id,
+			IncludeResourcePlaceholders: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, err
+		}
+		switch out.JobDetails.Status {
+		case types.JobStatusSucceeded:
+			var policies []string
+			if out.GeneratedPolicyResult != nil {
+				for _, p := range out.GeneratedPolicyResult.GeneratedPolicies {
+					policies = append(policies, aws.ToString(p.Policy))
+				}
+			}
+			return policies, nil
+		case types.JobStatusFailed, types.JobStatusCanceled:
+			if e := out.JobDetails.JobError; e != nil {
+				return nil, fmt.Errorf("policy generation %s: %s: %s", out.JobDetails.Status, e.Code, aws.ToString(e.Message))
+			}
+			return nil, fmt.Errorf("policy generation %s", out.JobDetails.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ProposePolicies generates least-privilege policies from the CloudTrail
+// activity of the roles in set called names, and sets them as the
+// ProposedPolicies of the roles. The jobs run in parallel, and can take
+// several minutes.
+func ProposePolicies(ctx context.Context, client Client, set *model.ResourceSet, names []string, opts GenerateOptions) error {
+	type job struct {
+		role *model.RoleResource
+		id   *string
+	}
+	var jobs []job
+	for _, name := range names {
+		var role *model.RoleResource
+		for i, r := range set.Roles {
+			if *r.Name == name {
+				role = &set.Roles[i]
+			}
+		}
+		if role == nil {
+			return fmt.Errorf("role %s: not found", name)
+		}
+		id, err := startGeneration(ctx, client, *role.Arn, opts)
+		if err != nil {
+			return fmt.Errorf("role %s: generating policies: %w", name, err)
+		}
+		jobs = append(jobs, job{role, id})
+	}
+
+	for _, j := range jobs {
+		policies, err := generatedPolicies(ctx, client, j.id, opts.PollInterval)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *j.role.Name, err)
+		}
+		j.role.ProposedPolicies = nil
+		for i, doc := range policies {
+			name := *j.role.Name + "-least-privilege"
+			if len(policies) > 1 {
+				name += "-" + strconv.Itoa(i+1)
+			}
+			j.role.ProposedPolicies = append(j.role.ProposedPolicies, model.PolicyResource{
+				Name:           aws.String(name),
+				PolicyDocument: aws.String(doc),
+			})
+		}
+	}
+	return nil
+}
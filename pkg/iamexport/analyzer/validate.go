@@ -0,0 +1,182 @@
+// Package analyzer checks and rewrites the policies of fetched resources
+// with IAM Access Analyzer.
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+)
+
+// Client is the subset of the IAM Access Analyzer API used by this
+// package. *accessanalyzer.Client satisfies it.
+type Client interface {
+	accessanalyzer.ValidatePolicyAPIClient
+
+	GetGeneratedPolicy(context.Context, *accessanalyzer.GetGeneratedPolicyInput, ...func(*accessanalyzer.Options)) (*accessanalyzer.GetGeneratedPolicyOutput, error)
+	StartPolicyGeneration(context.Context, *accessanalyzer.StartPolicyGenerationInput, ...func(*accessanalyzer.Options)) (*accessanalyzer.StartPolicyGenerationOutput, error)
+}
+
+var _ Client = (*accessanalyzer.Client)(nil)
+
+// Finding is an issue Access Analyzer found in a policy document.
+type Finding struct {
+	// Type and Name identify the resource owning the policy: a managed
+	// policy, or the role, group, user or permission set of an inline or
+	// trust policy.
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Arn  string `json:"arn"`
+	// Policy is the name of an inline policy, "trust" for the trust policy
+	// of a role, or "" for managed policies.
+	Policy string `json:"policy,omitempty"`
+
+	// FindingType is ERROR, SECURITY_WARNING, WARNING or SUGGESTION.
+	FindingType   string   `json:"findingType"`
+	IssueCode     string   `json:"issueCode"`
+	Details       string   `json:"details"`
+	LearnMoreLink string   `json:"learnMoreLink,omitempty"`
+	Locations     []string `json:"locations,omitempty"`
+
+	// Document is the policy document the finding is about.
+	Document *string `json:"-"`
+}
+
+// Resource returns the type and name of the resource owning the policy,
+// followed by the name of the inline policy, e.g. "role/app/inline-s3".
+func (f Finding) Resource() string {
+	r := f.Type + "/" + f.Name
+	if f.Policy != "" {
+		r += "/" + f.Policy
+	}
+	return r
+}
+
+// location returns the path of l in the policy document, e.g.
+// Statement[0].Action[1].
+func location(l types.Location) string {
+	b := strings.Builder{}
+	for _, e := range l.Path {
+		switch e := e.(type) {
+		case *types.PathElementMemberIndex:
+			b.WriteString("[" + strconv.Itoa(int(e.Value)) + "]")
+		case *types.PathElementMemberKey:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(e.Value)
+		case *types.PathElementMemberValue:
+			b.WriteString("=" + e.Value)
+		}
+	}
+	return b.String()
+}
+
+// validate returns the findings of doc, owned by f.
+func validate(ctx context.Context, client Client, f Finding, doc *string, typ types.PolicyType) ([]Finding, error) {
+	var findings []Finding
+	pages := accessanalyzer.NewValidatePolicyPaginator(client, &accessanalyzer.ValidatePolicyInput{
+		PolicyDocument: doc,
+		PolicyType:     typ,
+	})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range resp.Findings {
+			f := f
+			f.FindingType = string(v.FindingType)
+			f.IssueCode = aws.ToString(v.IssueCode)
+			f.Details = aws.ToString(v.FindingDetails)
+			f.LearnMoreLink = aws.ToString(v.LearnMoreLink)
+			f.Document = doc
+			for _, l := range v.Locations {
+				f.Locations = append(f.Locations, location(l))
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+// Validate checks the managed policies in set, the inline policies of its
+// roles, groups, users and permission sets, and the trust policies of its
+// roles with Access Analyzer, and returns the errors, security warnings,
+// warnings and suggestions it reports.
+func Validate(ctx context.Context, client Client, set *model.ResourceSet) ([]Finding, error) {
+	var findings []Finding
+	check := func(f Finding, doc *string, typ types.PolicyType) error {
+		if doc == nil || *doc == "" {
+			return nil
+		}
+		l, err := validate(ctx, client, f, doc, typ)
+		if err != nil {
+			if f.Policy != "" {
+				return fmt.Errorf("validating %s %s: policy %s: %w", f.Type, f.Name, f.Policy, err)
+			}
+			return fmt.Errorf("validating %s %s: %w", f.Type, f.Name, err)
+		}
+		findings = append(findings, l...)
+		return nil
+	}
+	inline := func(typ string, name, arn *string, policies model.PolicyResources) error {
+		for _, p := range policies {
+			if err := check(Finding{Type: typ, Name: *name, Arn: *arn, Policy: *p.Name}, p.PolicyDocument, types.PolicyTypeIdentityPolicy); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, p := range set.Policies {
+		if err := check(Finding{Type: "policy", Name: *p.Name, Arn: *p.Arn}, p.PolicyDocument, types.PolicyTypeIdentityPolicy); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range set.Roles {
+		// Trust policies are resource policies of the role.
+		if err := check(Finding{Type: "role", Name: *r.Name, Arn: *r.Arn, Policy: "trust"}, r.AssumeRolePolicyDocument, types.PolicyTypeResourcePolicy); err != nil {
+			return nil, err
+		}
+		if err := inline("role", r.Name, r.Arn, r.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range set.Groups {
+		if err := inline("group", g.Name, g.Arn, g.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range set.Users {
+		if err := inline("user", u.Name, u.Arn, u.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, ps := range set.PermissionSets {
+		if err := check(Finding{Type: "permission-set", Name: *ps.Name, Arn: *ps.Arn, Policy: "inline"}, ps.InlinePolicy, types.PolicyTypeIdentityPolicy); err != nil {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
+
+// Comments returns the findings as comment lines keyed by the policy
+// document they are about, as used by render.Options.Comments.
+func Comments(findings []Finding) map[*string][]string {
+	comments := map[*string][]string{}
+	for _, f := range findings {
+		c := f.FindingType + " " + f.IssueCode + ": " + strings.Join(strings.Fields(f.Details), " ")
+		if len(f.Locations) > 0 {
+			c += " (" + strings.Join(f.Locations, ", ") + ")"
+		}
+		comments[f.Document] = append(comments[f.Document], c)
+	}
+	return comments
+}
@@ -0,0 +1,260 @@
+package iamexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// authDocument is a policy document as found in authorization details. The
+// AWS CLI writes documents as JSON objects while the raw API returns them
+// URL-encoded in a string; both are accepted.
+type authDocument json.RawMessage
+
+func (d *authDocument) UnmarshalJSON(b []byte) error {
+	*d = append((*d)[:0], b...)
+	return nil
+}
+
+func (d authDocument) decode() (*string, error) {
+	if len(d) == 0 || string(d) == "null" {
+		return nil, nil
+	}
+	if d[0] == '"' {
+		var s string
+		if err := json.Unmarshal(d, &s); err != nil {
+			return nil, err
+		}
+		return decodePolicy(s)
+	}
+	return indentPolicy(d)
+}
+
+type authInlinePolicy struct {
+	PolicyName     *string
+	PolicyDocument authDocument
+}
+
+type authAttachedPolicy struct {
+	PolicyName *string
+	PolicyArn  *string
+}
+
+type authGroup struct {
+	Arn                     *string
+	CreateDate              *time.Time
+	GroupName               *string
+	Path                    *string
+	GroupPolicyList         []authInlinePolicy
+	AttachedManagedPolicies []authAttachedPolicy
+}
+
+type authPolicyVersion struct {
+	CreateDate       *time.Time
+	Document         authDocument
+	VersionId        *string
+	IsDefaultVersion bool
+}
+
+type authPolicy struct {
+	Arn               *string
+	AttachmentCount   *int32
+	CreateDate        *time.Time
+	DefaultVersionId  *string
+	Description       *string
+	Path              *string
+	PolicyName        *string
+	PolicyVersionList []authPolicyVersion
+	Tags              []types.Tag
+}
+
+type authRole struct {
+	Arn                      *string
+	AssumeRolePolicyDocument authDocument
+	AttachedManagedPolicies  []authAttachedPolicy
+	CreateDate               *time.Time
+	Description              *string
+	MaxSessionDuration       *int32
+	Path                     *string
+	PermissionsBoundary      *types.AttachedPermissionsBoundary
+	RoleLastUsed             *types.RoleLastUsed
+	RoleName                 *string
+	RolePolicyList           []authInlinePolicy
+	Tags                     []types.Tag
+}
+
+type authUser struct {
+	Arn                     *string
+	AttachedManagedPolicies []authAttachedPolicy
+	CreateDate              *time.Time
+	GroupList               []string
+	Path                    *string
+	PermissionsBoundary     *types.AttachedPermissionsBoundary
+	Tags                    []types.Tag
+	UserName                *string
+	UserPolicyList          []authInlinePolicy
+}
+
+// authorizationDetails is the output of
+// `aws iam get-account-authorization-details`.
+type authorizationDetails struct {
+	GroupDetailList []authGroup
+	Policies        []authPolicy
+	RoleDetailList  []authRole
+	UserDetailList  []authUser
+}
+
+func inlinePolicies(list []authInlinePolicy) (model.PolicyResources, error) {
+	var precs model.PolicyResources
+	for _, p := range list {
+		pdoc, err := p.PolicyDocument.decode()
+		if err != nil {
+			return nil, fmt.Errorf("inline policy %s: %w", *p.PolicyName, err)
+		}
+		precs = append(precs, model.PolicyResource{
+			Name:           p.PolicyName,
+			PolicyDocument: pdoc,
+		})
+	}
+	return precs, nil
+}
+
+func attachedArns(list []authAttachedPolicy) []string {
+	var arns []string
+	for _, p := range list {
+		arns = append(arns, *p.PolicyArn)
+	}
+	return arns
+}
+
+// isAWSManaged reports whether arn belongs to a policy managed by AWS
+// rather than by the account.
+func isAWSManaged(arn string) bool {
+	parts := strings.SplitN(arn, ":", 6)
+	return len(parts) == 6 && parts[4] == "aws"
+}
+
+// ReadAuthorizationDetails reads the JSON written by
+// `aws iam get-account-authorization-details`, so templates can be
+// generated without access to the account. AWS managed policies in the
+// input are skipped, as FetchPolicies does, and the other versions of
+// managed policies are read as with FetchOptions.PolicyVersions. The input
+// does not say which users have console access, so users never have a
+// LoginProfile.
+func ReadAuthorizationDetails(r io.Reader) (*model.ResourceSet, error) {
+	var details authorizationDetails
+	if err := json.NewDecoder(r).Decode(&details); err != nil {
+		return nil, fmt.Errorf("reading authorization details: %w", err)
+	}
+
+	set := &model.ResourceSet{}
+
+	for _, g := range details.GroupDetailList {
+		policies, err := inlinePolicies(g.GroupPolicyList)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", *g.GroupName, err)
+		}
+		set.Groups = append(set.Groups, model.GroupResource{
+			Arn:               g.Arn,
+			CreateDate:        g.CreateDate,
+			Name:              g.GroupName,
+			ManagedPolicyArns: attachedArns(g.AttachedManagedPolicies),
+			Path:              g.Path,
+			Policies:          policies,
+		})
+	}
+
+	for _, p := range details.Policies {
+		if isAWSManaged(*p.Arn) {
+			continue
+		}
+		rec := model.PolicyResource{
+			Arn:         p.Arn,
+			CreateDate:  p.CreateDate,
+			Description: p.Description,
+			Name:        p.PolicyName,
+			Path:        p.Path,
+			Tags:        p.Tags,
+		}
+		if p.AttachmentCount != nil {
+			rec.AttachmentCount = int(*p.AttachmentCount)
+		}
+		for _, v := range p.PolicyVersionList {
+			pdoc, err := v.Document.decode()
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", *p.PolicyName, err)
+			}
+			if v.IsDefaultVersion {
+				rec.PolicyDocument = pdoc
+			} else if pdoc != nil {
+				rec.Versions = append(rec.Versions, model.PolicyVersion{VersionID: v.VersionId, CreateDate: v.CreateDate, Document: pdoc})
+			}
+		}
+		sortVersions(rec.Versions)
+		if rec.PolicyDocument == nil {
+			return nil, fmt.Errorf("policy %s: no default version document", *p.PolicyName)
+		}
+		set.Policies = append(set.Policies, rec)
+	}
+
+	for _, r := range details.RoleDetailList {
+		rec := model.RoleResource{
+			Arn:               r.Arn,
+			CreateDate:        r.CreateDate,
+			Description:       r.Description,
+			ManagedPolicyArns: attachedArns(r.AttachedManagedPolicies),
+			Name:              r.RoleName,
+			Path:              r.Path,
+			Tags:              r.Tags,
+		}
+		if r.MaxSessionDuration != nil {
+			rec.MaxSessionDuration = int(*r.MaxSessionDuration)
+		}
+		if r.RoleLastUsed != nil {
+			rec.LastUsed = r.RoleLastUsed.LastUsedDate
+		}
+		if r.PermissionsBoundary != nil {
+			rec.PermissionsBoundary = r.PermissionsBoundary.PermissionsBoundaryArn
+		}
+
+		pdoc, err := r.AssumeRolePolicyDocument.decode()
+		if err != nil {
+			return nil, fmt.Errorf("role %s: trust policy: %w", *r.RoleName, err)
+		}
+		rec.AssumeRolePolicyDocument = pdoc
+
+		if rec.Policies, err = inlinePolicies(r.RolePolicyList); err != nil {
+			return nil, fmt.Errorf("role %s: %w", *r.RoleName, err)
+		}
+
+		set.Roles = append(set.Roles, rec)
+	}
+
+	for _, u := range details.UserDetailList {
+		policies, err := inlinePolicies(u.UserPolicyList)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", *u.UserName, err)
+		}
+		rec := model.UserResource{
+			Arn:               u.Arn,
+			CreateDate:        u.CreateDate,
+			Groups:            u.GroupList,
+			ManagedPolicyArns: attachedArns(u.AttachedManagedPolicies),
+			Name:              u.UserName,
+			Path:              u.Path,
+			Policies:          policies,
+			Tags:              u.Tags,
+		}
+		if u.PermissionsBoundary != nil {
+			rec.PermissionsBoundary = u.PermissionsBoundary.PermissionsBoundaryArn
+		}
+		set.Users = append(set.Users, rec)
+	}
+
+	return set, nil
+}
@@ -0,0 +1,88 @@
+// Package cache keeps snapshots of fetched resources on disk, so that
+// repeated runs can skip the IAM API.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache stores one JSON snapshot per resource kind in Dir. Snapshots older
+// than TTL are ignored by Load; a zero TTL never expires them.
+type Cache struct {
+	Dir string
+	TTL time.Duration
+}
+
+type snapshot struct {
+	Fetched   time.Time       `json:"fetched"`
+	Resources json.RawMessage `json:"resources"`
+}
+
+func (c *Cache) path(kind string) string {
+	return filepath.Join(c.Dir, kind+".json")
+}
+
+// Load reads the snapshot of kind into v. It returns false, without error,
+// when there is no snapshot or it has expired.
+func (c *Cache) Load(kind string, v interface{}) (bool, error) {
+	b, err := os.ReadFile(c.path(kind))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return false, fmt.Errorf("reading cached %s: %w", kind, err)
+	}
+	if c.TTL > 0 && time.Since(s.Fetched) > c.TTL {
+		return false, nil
+	}
+	if err := json.Unmarshal(s.Resources, v); err != nil {
+		return false, fmt.Errorf("reading cached %s: %w", kind, err)
+	}
+
+	return true, nil
+}
+
+// Store writes v as the snapshot of kind, replacing any previous one.
+func (c *Cache) Store(kind string, v interface{}) error {
+	resources, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(snapshot{Fetched: time.Now().UTC(), Resources: resources})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a
+	// truncated snapshot behind.
+	tmp, err := os.CreateTemp(c.Dir, kind+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path(kind))
+}
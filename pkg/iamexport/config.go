@@ -0,0 +1,90 @@
+package iamexport
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// DefaultMaxAttempts is the number of attempts of every API call made with
+// the configuration of LoadConfig, unless given another.
+const DefaultMaxAttempts = 10
+
+// unlimitedRetries is a retry quota that never runs out. The SDK default
+// quota is sized for interactive use and is quickly drained by the
+// throttling errors a large export runs into, after which requests fail
+// without being retried.
+type unlimitedRetries struct{}
+
+func (unlimitedRetries) GetToken(context.Context, uint) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (unlimitedRetries) AddTokens(uint) error {
+	return nil
+}
+
+// NewRetryer returns a retryer constructor using the SDK's adaptive mode,
+// which backs off exponentially and slows down the client when IAM starts
+// throttling.
+func NewRetryer(maxAttempts int) func() aws.Retryer {
+	return func() aws.Retryer {
+		return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+				so.MaxAttempts = maxAttempts
+				so.RateLimiter = unlimitedRetries{}
+			})
+		})
+	}
+}
+
+// EndpointFromEnv returns the endpoint override for service, taken from
+// AWS_ENDPOINT_URL_<SERVICE> or AWS_ENDPOINT_URL in that order, as used
+// with LocalStack or moto. It returns an empty string when no override is
+// set.
+func EndpointFromEnv(service string) string {
+	if url := os.Getenv("AWS_ENDPOINT_URL_" + strings.ToUpper(strings.ReplaceAll(service, " ", "_"))); url != "" {
+		return url
+	}
+	return os.Getenv("AWS_ENDPOINT_URL")
+}
+
+// EndpointResolver points every client at the endpoint endpoint returns
+// for its service, falling back to the SDK defaults when it returns an
+// empty string.
+func EndpointResolver(endpoint func(service string) string) aws.EndpointResolverWithOptions {
+	return aws.EndpointResolverWithOptionsFunc(func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
+		url := endpoint(service)
+		if url == "" {
+			return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+		}
+
+		// IAM is a global service signed for us-east-1; local emulators
+		// accept any region.
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		return aws.Endpoint{
+			URL:               url,
+			SigningRegion:     region,
+			HostnameImmutable: true,
+		}, nil
+	})
+}
+
+// LoadConfig loads the default configuration, retrying every API call up
+// to maxAttempts times with NewRetryer, and sending the requests of every
+// service to the endpoint endpoint returns for it, if any, e.g.
+// EndpointFromEnv. optFns are applied last.
+func LoadConfig(ctx context.Context, maxAttempts int, endpoint func(service string) string, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	optFns = append([]func(*config.LoadOptions) error{
+		config.WithRetryer(NewRetryer(maxAttempts)),
+		config.WithEndpointResolverWithOptions(EndpointResolver(endpoint)),
+	}, optFns...)
+	return config.LoadDefaultConfig(ctx, optFns...)
+}
@@ -0,0 +1,480 @@
+// Package diff compares two CloudFormation templates resource by resource,
+// reporting policy documents statement by statement.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the kind of change made to a resource.
+type Kind string
+
+const (
+	Added   Kind = "+"
+	Removed Kind = "-"
+	Changed Kind = "~"
+)
+
+// Change is a resource that differs between two templates.
+type Change struct {
+	Kind      Kind
+	LogicalID string
+	Type      string
+
+	// Properties lists the changed values of a Changed resource.
+	Properties []PropertyChange
+}
+
+// PropertyChange is a value that differs within a resource. For policy
+// statement lists only the added, removed and changed statements are set;
+// for any other value Old and New hold the values on either side, nil when
+// absent.
+type PropertyChange struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+
+	AddedStatements   []interface{}
+	RemovedStatements []interface{}
+	ChangedStatements []StatementChange
+}
+
+// StatementChange is a policy statement with the same Sid on both sides
+// whose other elements differ. Elements holds the differing elements by
+// name, e.g. Action.
+type StatementChange struct {
+	Sid      string
+	Elements []PropertyChange
+}
+
+type resource struct {
+	Type       string
+	Properties interface{}
+}
+
+// intrinsics maps the short form tags of intrinsic functions to their
+// full names.
+var intrinsics = map[string]string{
+	"!Ref":       "Ref",
+	"!Condition": "Condition",
+}
+
+// value converts a YAML node into plain Go values, expanding short form
+// intrinsic functions such as !Ref into their mapping form so that both
+// forms compare equal.
+func value(n *yaml.Node) (interface{}, error) {
+	var v interface{}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return value(n.Content[0])
+	case yaml.AliasNode:
+		return value(n.Alias)
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			val, err := value(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = val
+		}
+		v = m
+	case yaml.SequenceNode:
+		l := []interface{}{}
+		for _, c := range n.Content {
+			val, err := value(c)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, val)
+		}
+		v = l
+	default:
+		if strings.HasPrefix(n.Tag, "!") && !strings.HasPrefix(n.Tag, "!!") {
+			v = n.Value
+		} else if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+	}
+
+	if !strings.HasPrefix(n.Tag, "!") || strings.HasPrefix(n.Tag, "!!") {
+		return v, nil
+	}
+	name, ok := intrinsics[n.Tag]
+	if !ok {
+		name = "Fn::" + n.Tag[1:]
+	}
+	if s, ok := v.(string); ok && name == "Fn::GetAtt" {
+		parts := strings.SplitN(s, ".", 2)
+		l := make([]interface{}, len(parts))
+		for i, p := range parts {
+			l[i] = p
+		}
+		v = l
+	}
+	return map[string]interface{}{name: v}, nil
+}
+
+func resources(template []byte) (map[string]resource, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(template, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	v, err := value(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	top, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("template is not a mapping")
+	}
+	raw, _ := top["Resources"].(map[string]interface{})
+
+	res := map[string]resource{}
+	for id, r := range raw {
+		m, _ := r.(map[string]interface{})
+		typ, _ := m["Type"].(string)
+		// IAM defaults Path to /, so templates with and without it
+		// compare equal.
+		if props, ok := m["Properties"].(map[string]interface{}); ok && strings.HasPrefix(typ, "AWS::IAM::") && props["Path"] == "/" {
+			delete(props, "Path")
+		}
+		res[id] = resource{Type: typ, Properties: m["Properties"]}
+	}
+	return res, nil
+}
+
+// Templates compares the resources of two templates in YAML or JSON,
+// ignoring anything outside their types and properties, such as metadata.
+// Changes are ordered by logical ID.
+func Templates(old, new []byte) ([]Change, error) {
+	oldRes, err := resources(old)
+	if err != nil {
+		return nil, fmt.Errorf("reading old template: %w", err)
+	}
+	newRes, err := resources(new)
+	if err != nil {
+		return nil, fmt.Errorf("reading new template: %w", err)
+	}
+
+	var changes []Change
+	for _, id := range sortedKeys(oldRes, newRes) {
+		o, inOld := oldRes[id]
+		n, inNew := newRes[id]
+		switch {
+		case !inNew:
+			changes = append(changes, Change{Kind: Removed, LogicalID: id, Type: o.Type})
+		case !inOld:
+			changes = append(changes, Change{Kind: Added, LogicalID: id, Type: n.Type})
+		default:
+			var props []PropertyChange
+			if o.Type != n.Type {
+				props = append(props, PropertyChange{Path: "Type", Old: o.Type, New: n.Type})
+			}
+			props = compare("Properties", o.Properties, n.Properties, props)
+			if len(props) > 0 {
+				changes = append(changes, Change{Kind: Changed, LogicalID: id, Type: n.Type, Properties: props})
+			}
+		}
+	}
+	return changes, nil
+}
+
+func sortedKeys(maps ...interface{}) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for _, k := range reflect.ValueOf(m).MapKeys() {
+			if !seen[k.String()] {
+				seen[k.String()] = true
+				keys = append(keys, k.String())
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compare appends the differences between o and n, found at path, to
+// changes.
+func compare(path string, o, n interface{}, changes []PropertyChange) []PropertyChange {
+	if reflect.DeepEqual(o, n) {
+		return changes
+	}
+
+	om, oIsMap := o.(map[string]interface{})
+	nm, nIsMap := n.(map[string]interface{})
+	if oIsMap && nIsMap {
+		for _, k := range sortedKeys(om, nm) {
+			p := path + "." + k
+			if k == "Statement" {
+				changes = compareStatements(p, om[k], nm[k], changes)
+				continue
+			}
+			changes = compare(p, om[k], nm[k], changes)
+		}
+		return changes
+	}
+
+	ol, oIsList := o.([]interface{})
+	nl, nIsList := n.([]interface{})
+	if oIsList && nIsList {
+		// Inline policies and tags are matched by name rather than by
+		// position.
+		for _, key := range []string{"PolicyName", "Key"} {
+			oi, ok1 := index(ol, key)
+			ni, ok2 := index(nl, key)
+			if ok1 && ok2 {
+				for _, k := range sortedKeys(oi, ni) {
+					changes = compare(fmt.Sprintf("%s[%s]", path, k), oi[k], ni[k], changes)
+				}
+				return changes
+			}
+		}
+	}
+
+	return append(changes, PropertyChange{Path: path, Old: o, New: n})
+}
+
+// index returns the maps in l keyed by their string value under key, or
+// false if any element does not have one.
+func index(l []interface{}, key string) (map[string]interface{}, bool) {
+	m := map[string]interface{}{}
+	for _, e := range l {
+		em, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		k, ok := em[key].(string)
+		if !ok {
+			return nil, false
+		}
+		m[k] = e
+	}
+	return m, true
+}
+
+// unorderedElements are the statement elements whose lists mean the same
+// in any order.
+var unorderedElements = map[string]bool{
+	"Action":      true,
+	"NotAction":   true,
+	"Resource":    true,
+	"NotResource": true,
+}
+
+// normalValues sorts and deduplicates a list of strings and returns a
+// single value on its own, so that lists and values granting the same
+// compare equal.
+func normalValues(v interface{}, fold bool) interface{} {
+	l, ok := v.([]interface{})
+	if !ok {
+		l = []interface{}{v}
+	}
+	var strs []string
+	for _, e := range l {
+		s, ok := e.(string)
+		if !ok {
+			return v
+		}
+		if fold {
+			s = strings.ToLower(s)
+		}
+		strs = append(strs, s)
+	}
+	sort.Strings(strs)
+	var out []interface{}
+	for i, s := range strs {
+		if i == 0 || s != strs[i-1] {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 1 {
+		return out[0]
+	}
+	return out
+}
+
+// normalize returns a copy of the statement s with its actions, resources,
+// principals and condition values normalized by normalValues. Actions are
+// lowercased if fold is set.
+func normalize(s interface{}, fold bool) interface{} {
+	m, ok := s.(map[string]interface{})
+	if !ok {
+		return s
+	}
+	out := map[string]interface{}{}
+	for k, v := range m {
+		switch {
+		case unorderedElements[k]:
+			v = normalValues(v, fold && (k == "Action" || k == "NotAction"))
+		case k == "Principal" || k == "NotPrincipal" || k == "Condition":
+			v = normalMap(v, k == "Condition")
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// normalMap normalizes the values of a principal, or of every operator of
+// a condition when nested is set.
+func normalMap(v interface{}, nested bool) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	out := map[string]interface{}{}
+	for k, e := range m {
+		if nested {
+			out[k] = normalMap(e, false)
+		} else {
+			out[k] = normalValues(e, false)
+		}
+	}
+	return out
+}
+
+// compareStatements compares two policy statement lists as sets of
+// normalized statements, so reordering statements or the values within
+// them, or changing the case of actions, is not reported. Statements with the same Sid on both sides are
+// reported as changed, element by element.
+func compareStatements(path string, o, n interface{}, changes []PropertyChange) []PropertyChange {
+	ol, nl := statements(o), statements(n)
+
+	count := map[string]int{}
+	for _, s := range ol {
+		count[canonical(normalize(s, true))]++
+	}
+	var added, removed []interface{}
+	for _, s := range nl {
+		c := canonical(normalize(s, true))
+		if count[c] > 0 {
+			count[c]--
+			continue
+		}
+		added = append(added, s)
+	}
+	for _, s := range ol {
+		c := canonical(normalize(s, true))
+		if count[c] > 0 {
+			count[c]--
+			removed = append(removed, s)
+		}
+	}
+
+	var changed []StatementChange
+	for i := 0; i < len(removed); i++ {
+		sid := statementSid(removed[i])
+		if sid == "" {
+			continue
+		}
+		for j := range added {
+			if statementSid(added[j]) != sid {
+				continue
+			}
+			om, _ := normalize(removed[i], false).(map[string]interface{})
+			nm, _ := normalize(added[j], false).(map[string]interface{})
+			var elements []PropertyChange
+			for _, k := range sortedKeys(om, nm) {
+				if !reflect.DeepEqual(om[k], nm[k]) {
+					elements = append(elements, PropertyChange{Path: k, Old: om[k], New: nm[k]})
+				}
+			}
+			changed = append(changed, StatementChange{Sid: sid, Elements: elements})
+			removed = append(removed[:i], removed[i+1:]...)
+			added = append(added[:j], added[j+1:]...)
+			i--
+			break
+		}
+	}
+
+	if len(added) == 0 && len(removed) == 0 && len(changed) == 0 {
+		return changes
+	}
+	return append(changes, PropertyChange{Path: path, AddedStatements: added, RemovedStatements: removed, ChangedStatements: changed})
+}
+
+// statementSid returns the Sid of the statement s, or "" if it has none.
+func statementSid(s interface{}) string {
+	m, _ := s.(map[string]interface{})
+	sid, _ := m["Sid"].(string)
+	return sid
+}
+
+// statements returns the statements of a policy, which may be a single
+// statement or a list of them.
+func statements(v interface{}) []interface{} {
+	switch s := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return s
+	default:
+		return []interface{}{s}
+	}
+}
+
+// canonical returns v as compact JSON with sorted keys.
+func canonical(v interface{}) string {
+	b := bytes.Buffer{}
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Write prints changes to w, one resource per line followed by its changed
+// values.
+func Write(w io.Writer, changes []Change) error {
+	b := bytes.Buffer{}
+	for _, c := range changes {
+		fmt.Fprintf(&b, "%s %s (%s)\n", c.Kind, c.LogicalID, c.Type)
+		for _, p := range c.Properties {
+			if p.AddedStatements != nil || p.RemovedStatements != nil || p.ChangedStatements != nil {
+				fmt.Fprintf(&b, "    ~ %s\n", p.Path)
+				for _, s := range p.ChangedStatements {
+					fmt.Fprintf(&b, "        ~ Sid %s\n", s.Sid)
+					for _, e := range s.Elements {
+						writeProperty(&b, "            ", e)
+					}
+				}
+				for _, s := range p.RemovedStatements {
+					fmt.Fprintf(&b, "        - %s\n", canonical(s))
+				}
+				for _, s := range p.AddedStatements {
+					fmt.Fprintf(&b, "        + %s\n", canonical(s))
+				}
+				continue
+			}
+			writeProperty(&b, "    ", p)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeProperty prints the change of a value, indented by indent.
+func writeProperty(b *bytes.Buffer, indent string, p PropertyChange) {
+	switch {
+	case p.Old == nil:
+		fmt.Fprintf(b, "%s+ %s: %s\n", indent, p.Path, canonical(p.New))
+	case p.New == nil:
+		fmt.Fprintf(b, "%s- %s: %s\n", indent, p.Path, canonical(p.Old))
+	default:
+		fmt.Fprintf(b, "%s~ %s: %s => %s\n", indent, p.Path, canonical(p.Old), canonical(p.New))
+	}
+}
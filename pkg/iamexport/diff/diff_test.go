@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+// policyTemplate returns a template holding a managed policy with the
+// Path property path, if any, and the statements statements.
+func policyTemplate(path, statements string) []byte {
+	return []byte(`Resources:
+  deploy:
+    Type: AWS::IAM::ManagedPolicy
+    Properties:
+` + path + `      PolicyDocument:
+        Version: "2012-10-17"
+        Statement: ` + statements + "\n")
+}
+
+const deployStatements = `[{Sid: Read, Effect: Allow, Action: [s3:GetObject, s3:ListBucket], Resource: "*"}, {Effect: Allow, Action: ec2:Describe*, Resource: "*"}]`
+
+func TestTemplatesEquivalentStatements(t *testing.T) {
+	tests := []struct {
+		name       string
+		statements string
+	}{
+		{"reordered statements", `[{Effect: Allow, Action: ec2:Describe*, Resource: "*"}, {Sid: Read, Effect: Allow, Action: [s3:GetObject, s3:ListBucket], Resource: "*"}]`},
+		{"reordered values", `[{Sid: Read, Effect: Allow, Action: [s3:ListBucket, s3:GetObject], Resource: "*"}, {Effect: Allow, Action: ec2:Describe*, Resource: "*"}]`},
+		{"list of one", `[{Sid: Read, Effect: Allow, Action: [s3:GetObject, s3:ListBucket], Resource: ["*"]}, {Effect: Allow, Action: [ec2:Describe*], Resource: "*"}]`},
+		{"case of actions", `[{Sid: Read, Effect: Allow, Action: [S3:GetObject, s3:listbucket], Resource: "*"}, {Effect: Allow, Action: EC2:Describe*, Resource: "*"}]`},
+		{"block style", `
+          - Sid: Read
+            Effect: Allow
+            Action:
+              - s3:GetObject
+              - s3:ListBucket
+            Resource: "*"
+          - Effect: Allow
+            Action: ec2:Describe*
+            Resource: "*"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Templates(policyTemplate("", deployStatements), policyTemplate("", tt.statements))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) > 0 {
+				t.Errorf("changes = %+v, want none", changes)
+			}
+		})
+	}
+}
+
+func TestTemplatesEditedStatements(t *testing.T) {
+	// The statement with a Sid is changed element by element, the one
+	// without is removed and added.
+	edited := `[{Sid: Read, Effect: Allow, Action: [s3:GetObject, s3:PutObject], Resource: "*"}, {Effect: Allow, Action: iam:List*, Resource: "*"}]`
+	changes, err := Templates(policyTemplate("", deployStatements), policyTemplate("", edited))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Kind != Changed || len(changes[0].Properties) != 1 {
+		t.Fatalf("changes = %+v, want the statements of deploy", changes)
+	}
+	got := changes[0].Properties[0]
+	if got.Path != "Properties.PolicyDocument.Statement" {
+		t.Errorf("path = %s, want Properties.PolicyDocument.Statement", got.Path)
+	}
+	want := []StatementChange{{Sid: "Read", Elements: []PropertyChange{{
+		Path: "Action",
+		Old:  []interface{}{"s3:GetObject", "s3:ListBucket"},
+		New:  []interface{}{"s3:GetObject", "s3:PutObject"},
+	}}}}
+	if !reflect.DeepEqual(got.ChangedStatements, want) {
+		t.Errorf("changed statements = %+v, want %+v", got.ChangedStatements, want)
+	}
+	removed := []interface{}{map[string]interface{}{"Effect": "Allow", "Action": "ec2:Describe*", "Resource": "*"}}
+	added := []interface{}{map[string]interface{}{"Effect": "Allow", "Action": "iam:List*", "Resource": "*"}}
+	if !reflect.DeepEqual(got.RemovedStatements, removed) || !reflect.DeepEqual(got.AddedStatements, added) {
+		t.Errorf("removed %+v and added %+v, want %+v and %+v", got.RemovedStatements, got.AddedStatements, removed, added)
+	}
+}
+
+func TestTemplatesDefaultPath(t *testing.T) {
+	changes, err := Templates(policyTemplate("", deployStatements), policyTemplate("      Path: /\n", deployStatements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) > 0 {
+		t.Errorf("changes = %+v, want none for the default path", changes)
+	}
+
+	changes, err = Templates(policyTemplate("", deployStatements), policyTemplate("      Path: /ci/\n", deployStatements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PropertyChange{{Path: "Properties.Path", New: "/ci/"}}
+	if len(changes) != 1 || !reflect.DeepEqual(changes[0].Properties, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+}
+
+func TestTemplatesShortIntrinsics(t *testing.T) {
+	short := []byte(`Resources:
+  app:
+    Type: AWS::IAM::Role
+    Condition: CreateApp
+    Properties:
+      RoleName: !Sub "app-${Environment}"
+      ManagedPolicyArns:
+        - !Ref deploy
+        - !GetAtt boundary.PolicyArn
+      PermissionsBoundary: !If [UseBoundary, !Ref boundary, !Ref AWS::NoValue]
+`)
+	long := []byte(`{"Resources": {"app": {"Type": "AWS::IAM::Role", "Condition": "CreateApp", "Properties": {
+  "RoleName": {"Fn::Sub": "app-${Environment}"},
+  "ManagedPolicyArns": [{"Ref": "deploy"}, {"Fn::GetAtt": ["boundary", "PolicyArn"]}],
+  "PermissionsBoundary": {"Fn::If": ["UseBoundary", {"Ref": "boundary"}, {"Ref": "AWS::NoValue"}]}}}}}
+`)
+	changes, err := Templates(short, long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) > 0 {
+		t.Errorf("changes = %+v, want none between the short and long forms", changes)
+	}
+
+	edited := []byte(`Resources:
+  app:
+    Type: AWS::IAM::Role
+    Properties:
+      RoleName: !Sub "app-${Environment}"
+      ManagedPolicyArns:
+        - !Ref other
+        - !GetAtt boundary.PolicyArn
+      PermissionsBoundary: !If [UseBoundary, !Ref boundary, !Ref AWS::NoValue]
+`)
+	changes, err = Templates(long, edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PropertyChange{{
+		Path: "Properties.ManagedPolicyArns",
+		Old:  []interface{}{map[string]interface{}{"Ref": "deploy"}, map[string]interface{}{"Fn::GetAtt": []interface{}{"boundary", "PolicyArn"}}},
+		New:  []interface{}{map[string]interface{}{"Ref": "other"}, map[string]interface{}{"Fn::GetAtt": []interface{}{"boundary", "PolicyArn"}}},
+	}}
+	if len(changes) != 1 || !reflect.DeepEqual(changes[0].Properties, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+}
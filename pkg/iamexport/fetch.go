@@ -0,0 +1,1011 @@
+// Package iamexport reads IAM resources from an AWS account into the
+// resource model, ready to be transformed and rendered.
+package iamexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// Client is the subset of the IAM API used by the fetcher. *iam.Client
+// satisfies it; package iamfake provides an in-memory implementation for
+// tests.
+type Client interface {
+	iam.ListAccountAliasesAPIClient
+	iam.ListAttachedGroupPoliciesAPIClient
+	iam.ListAttachedRolePoliciesAPIClient
+	iam.ListAttachedUserPoliciesAPIClient
+	iam.ListGroupPoliciesAPIClient
+	iam.ListGroupsAPIClient
+	iam.ListGroupsForUserAPIClient
+	iam.ListInstanceProfilesAPIClient
+	iam.ListPoliciesAPIClient
+	iam.ListPolicyVersionsAPIClient
+	iam.ListRolePoliciesAPIClient
+	iam.ListRolesAPIClient
+	iam.ListServerCertificatesAPIClient
+	iam.ListUserPoliciesAPIClient
+	iam.ListUsersAPIClient
+	iam.ListVirtualMFADevicesAPIClient
+
+	GetAccountPasswordPolicy(context.Context, *iam.GetAccountPasswordPolicyInput, ...func(*iam.Options)) (*iam.GetAccountPasswordPolicyOutput, error)
+	GetGroupPolicy(context.Context, *iam.GetGroupPolicyInput, ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error)
+	GetLoginProfile(context.Context, *iam.GetLoginProfileInput, ...func(*iam.Options)) (*iam.GetLoginProfileOutput, error)
+	GetOpenIDConnectProvider(context.Context, *iam.GetOpenIDConnectProviderInput, ...func(*iam.Options)) (*iam.GetOpenIDConnectProviderOutput, error)
+	GetPolicy(context.Context, *iam.GetPolicyInput, ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(context.Context, *iam.GetPolicyVersionInput, ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+	GetRole(context.Context, *iam.GetRoleInput, ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	GetRolePolicy(context.Context, *iam.GetRolePolicyInput, ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error)
+	GetSAMLProvider(context.Context, *iam.GetSAMLProviderInput, ...func(*iam.Options)) (*iam.GetSAMLProviderOutput, error)
+	GetServerCertificate(context.Context, *iam.GetServerCertificateInput, ...func(*iam.Options)) (*iam.GetServerCertificateOutput, error)
+	GetUser(context.Context, *iam.GetUserInput, ...func(*iam.Options)) (*iam.GetUserOutput, error)
+	GetUserPolicy(context.Context, *iam.GetUserPolicyInput, ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error)
+	ListMFADeviceTags(context.Context, *iam.ListMFADeviceTagsInput, ...func(*iam.Options)) (*iam.ListMFADeviceTagsOutput, error)
+	ListOpenIDConnectProviders(context.Context, *iam.ListOpenIDConnectProvidersInput, ...func(*iam.Options)) (*iam.ListOpenIDConnectProvidersOutput, error)
+	ListSAMLProviders(context.Context, *iam.ListSAMLProvidersInput, ...func(*iam.Options)) (*iam.ListSAMLProvidersOutput, error)
+}
+
+var _ Client = (*iam.Client)(nil)
+
+// FetchOptions control how resources are fetched.
+type FetchOptions struct {
+	// Concurrency is the number of resources whose details are fetched in
+	// parallel. Values below 1 fetch one resource at a time.
+	Concurrency int
+	// Names, when set, restricts the resources fetched to those whose name
+	// or ARN it holds. Only their details are fetched.
+	Names []string
+	// Exclude, when set, reports whether the resource of type typ, e.g.
+	// "roles", called name with ARN arn is left out. The details of
+	// excluded resources are not fetched.
+	Exclude func(typ, name, arn string) bool
+	// Progress, when set, is called with the resource type, e.g. "roles",
+	// every time the details of a resource are fetched: done of the total
+	// resources of that type are fetched. Calls may be concurrent.
+	Progress func(typ string, done, total int)
+	// OnError, when set, is called with the error fetching the details of
+	// a resource, which is then left out instead of failing the fetch.
+	// Calls may be concurrent.
+	OnError func(err *ResourceError)
+	// ListOnly, when set, only lists resources: the records returned only
+	// hold what the list calls return, such as names, ARNs, paths and the
+	// trust policies of roles, without policy documents or attachments.
+	ListOnly bool
+	// PolicyVersions, when set, also fetches the versions of managed
+	// policies other than their default one.
+	PolicyVersions bool
+}
+
+// ResourceError is the error fetching the details of a resource.
+type ResourceError struct {
+	// Type is the resource type, e.g. "roles".
+	Type string
+	Name string
+	Err  error
+}
+
+func (e *ResourceError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+// selected reports whether the resource of type typ called name with ARN
+// arn is to be fetched.
+func (o FetchOptions) selected(typ string, name, arn *string) bool {
+	if o.Exclude != nil && o.Exclude(typ, aws.ToString(name), aws.ToString(arn)) {
+		return false
+	}
+	if len(o.Names) == 0 {
+		return true
+	}
+	for _, n := range o.Names {
+		if (name != nil && n == *name) || (arn != nil && n == *arn) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o FetchOptions) concurrency() int {
+	if o.Concurrency < 1 {
+		return 1
+	}
+	return o.Concurrency
+}
+
+func decodePolicy(p string) (*string, error) {
+	pdoc, err := url.QueryUnescape(p)
+	if err != nil {
+		return nil, err
+	}
+	return indentPolicy([]byte(pdoc))
+}
+
+// indentPolicy indents a plain JSON policy document.
+func indentPolicy(doc []byte) (*string, error) {
+	out := bytes.Buffer{}
+
+	// Indent JSON with 2 spaces in keeping with YAML conventions
+	if err := json.Indent(&out, doc, "", "  "); err != nil {
+		return nil, err
+	}
+
+	strOut := out.String()
+	return &strOut, nil
+}
+
+func groupInlinePolicies(ctx context.Context, client Client, name *string) (model.PolicyResources, error) {
+	var precs model.PolicyResources
+
+	pages := iam.NewListGroupPoliciesPaginator(client, &iam.ListGroupPoliciesInput{
+		GroupName: name,
+	})
+	for pages.HasMorePages() {
+		gpolicies, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing inline policies: %w", err)
+		}
+
+		for i := range gpolicies.PolicyNames {
+			pname := gpolicies.PolicyNames[i]
+			pout, err := client.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{
+				GroupName:  name,
+				PolicyName: &pname,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("inline policy %s: %w", pname, err)
+			}
+
+			pdoc, err := decodePolicy(*pout.PolicyDocument)
+			if err != nil {
+				return nil, fmt.Errorf("inline policy %s: %w", pname, err)
+			}
+
+			precs = append(precs, model.PolicyResource{
+				Name:           pout.PolicyName,
+				PolicyDocument: pdoc,
+			})
+		}
+	}
+
+	return precs, nil
+}
+
+func roleInlinePolicies(ctx context.Context, client Client, name *string) (model.PolicyResources, error) {
+	var precs model.PolicyResources
+
+	pages := iam.NewListRolePoliciesPaginator(client, &iam.ListRolePoliciesInput{
+		RoleName: name,
+	})
+	for pages.HasMorePages() {
+		rpolicies, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing inline policies: %w", err)
+		}
+
+		for i := range rpolicies.PolicyNames {
+			pname := rpolicies.PolicyNames[i]
+			pout, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
+				RoleName:   name,
+				PolicyName: &pname,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("inline policy %s: %w", pname, err)
+			}
+
+			pdoc, err := decodePolicy(*pout.PolicyDocument)
+			if err != nil {
+				return nil, fmt.Errorf("inline policy %s: %w", pname, err)
+			}
+
+			precs = append(precs, model.PolicyResource{
+				Name:           pout.PolicyName,
+				PolicyDocument: pdoc,
+			})
+		}
+	}
+
+	return precs, nil
+}
+
+func userInlinePolicies(ctx context.Context, client Client, name *string) (model.PolicyResources, error) {
+	var precs model.PolicyResources
+
+	pages := iam.NewListUserPoliciesPaginator(client, &iam.ListUserPoliciesInput{
+		UserName: name,
+	})
+	for pages.HasMorePages() {
+		upolicies, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing inline policies: %w", err)
+		}
+
+		for i := range upolicies.PolicyNames {
+			pname := upolicies.PolicyNames[i]
+			pout, err := client.GetUserPolicy(ctx, &iam.GetUserPolicyInput{
+				UserName:   name,
+				PolicyName: &pname,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("inline policy %s: %w", pname, err)
+			}
+
+			pdoc, err := decodePolicy(*pout.PolicyDocument)
+			if err != nil {
+				return nil, fmt.Errorf("inline policy %s: %w", pname, err)
+			}
+
+			precs = append(precs, model.PolicyResource{
+				Name:           pout.PolicyName,
+				PolicyDocument: pdoc,
+			})
+		}
+	}
+
+	return precs, nil
+}
+
+// loginProfile returns the console access of a user, or nil when the user
+// can not sign in to the console.
+func loginProfile(ctx context.Context, client Client, name *string) (*model.LoginProfile, error) {
+	out, err := client.GetLoginProfile(ctx, &iam.GetLoginProfileInput{
+		UserName: name,
+	})
+	var nse *types.NoSuchEntityException
+	if errors.As(err, &nse) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("login profile: %w", err)
+	}
+
+	return &model.LoginProfile{
+		PasswordResetRequired: out.LoginProfile.PasswordResetRequired,
+	}, nil
+}
+
+// forEach calls fn for every index in [0, n), running up to concurrency
+// calls at a time, and returns the first error encountered. The context
+// passed to fn is cancelled as soon as any call fails, and no more calls
+// are started once it is.
+func forEach(ctx context.Context, concurrency, n int, fn func(ctx context.Context, i int) error) error {
+	eg, gctx := errgroup.WithContext(ctx)
+	eg.SetLimit(concurrency)
+	for i := 0; i < n && gctx.Err() == nil; i++ {
+		i := i
+		eg.Go(func() error {
+			return fn(gctx, i)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	// The calls not started when ctx was cancelled did not fail.
+	return ctx.Err()
+}
+
+// forEach is like the forEach function, with the concurrency of o,
+// reporting the progress of fetching the n resources of type typ, and the
+// errors fetching them to OnError. name returns the name of resource i.
+// The callers leave the records of the resources left out zero, to compact
+// them away once done.
+func (o FetchOptions) forEach(ctx context.Context, typ string, n int, name func(i int) *string, fn func(ctx context.Context, i int) error) error {
+	var done int32
+	return forEach(ctx, o.concurrency(), n, func(ctx context.Context, i int) error {
+		if err := fn(ctx, i); err != nil {
+			// Once cancelled, every remaining resource would fail.
+			if o.OnError == nil || ctx.Err() != nil {
+				return err
+			}
+			o.OnError(&ResourceError{Type: typ, Name: aws.ToString(name(i)), Err: err})
+		}
+		if o.Progress != nil {
+			o.Progress(typ, int(atomic.AddInt32(&done, 1)), n)
+		}
+		return nil
+	})
+}
+
+// FetchGroups returns every IAM group in the account along with its
+// attached and inline policies.
+func FetchGroups(ctx context.Context, client Client, opts FetchOptions) (model.GroupResources, error) {
+	var list []types.Group
+
+	pages := iam.NewListGroupsPaginator(client, &iam.ListGroupsInput{})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing groups: %w", err)
+		}
+		for _, g := range resp.Groups {
+			if opts.selected("groups", g.GroupName, g.Arn) {
+				list = append(list, g)
+			}
+		}
+	}
+
+	groups := make(model.GroupResources, len(list))
+	err := opts.forEach(ctx, "groups", len(list), func(i int) *string { return list[i].GroupName }, func(ctx context.Context, i int) error {
+		g := list[i]
+		rec := model.GroupResource{
+			Arn:        g.Arn,
+			CreateDate: g.CreateDate,
+			Name:       g.GroupName,
+			Path:       g.Path,
+		}
+		if opts.ListOnly {
+			groups[i] = rec
+			return nil
+		}
+
+		pages := iam.NewListAttachedGroupPoliciesPaginator(client, &iam.ListAttachedGroupPoliciesInput{
+			GroupName: g.GroupName,
+		})
+		for pages.HasMorePages() {
+			gpolicies, err := pages.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("group %s: listing attached policies: %w", *g.GroupName, err)
+			}
+
+			for _, p := range gpolicies.AttachedPolicies {
+				rec.ManagedPolicyArns = append(rec.ManagedPolicyArns, *p.PolicyArn)
+			}
+		}
+
+		policies, err := groupInlinePolicies(ctx, client, g.GroupName)
+		if err != nil {
+			return fmt.Errorf("group %s: %w", *g.GroupName, err)
+		}
+		rec.Policies = policies
+
+		groups[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := groups[:0]
+	for _, g := range groups {
+		if g.Name != nil {
+			fetched = append(fetched, g)
+		}
+	}
+	return fetched, nil
+}
+
+// FetchPolicies returns every customer managed policy in the account with
+// the document of its default version.
+func FetchPolicies(ctx context.Context, client Client, opts FetchOptions) (model.PolicyResources, error) {
+	var list []types.Policy
+
+	pages := iam.NewListPoliciesPaginator(client, &iam.ListPoliciesInput{
+		Scope: "Local",
+	})
+	for pages.HasMorePages() {
+		presp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing policies: %w", err)
+		}
+		for _, p := range presp.Policies {
+			if opts.selected("policies", p.PolicyName, p.Arn) {
+				list = append(list, p)
+			}
+		}
+	}
+
+	policies := make(model.PolicyResources, len(list))
+	err := opts.forEach(ctx, "policies", len(list), func(i int) *string { return list[i].PolicyName }, func(ctx context.Context, i int) error {
+		p := list[i]
+		rec := model.PolicyResource{
+			Arn:        p.Arn,
+			CreateDate: p.CreateDate,
+			Name:       p.PolicyName,
+			Path:       p.Path,
+		}
+		if p.AttachmentCount != nil {
+			rec.AttachmentCount = int(*p.AttachmentCount)
+		}
+		if opts.ListOnly {
+			policies[i] = rec
+			return nil
+		}
+
+		pdesc, err := client.GetPolicy(ctx, &iam.GetPolicyInput{
+			PolicyArn: p.Arn,
+		})
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.PolicyName, err)
+		}
+
+		// ListPolicies leaves out the tags.
+		rec.Description = pdesc.Policy.Description
+		rec.Tags = pdesc.Policy.Tags
+
+		pver, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+			PolicyArn: p.Arn,
+			VersionId: pdesc.Policy.DefaultVersionId,
+		})
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.PolicyName, err)
+		}
+
+		pdoc, err := decodePolicy(*pver.PolicyVersion.Document)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.PolicyName, err)
+		}
+
+		rec.PolicyDocument = pdoc
+
+		if opts.PolicyVersions {
+			if rec.Versions, err = policyVersions(ctx, client, p.Arn, pdesc.Policy.DefaultVersionId); err != nil {
+				return fmt.Errorf("policy %s: %w", *p.PolicyName, err)
+			}
+		}
+
+		policies[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := policies[:0]
+	for _, p := range policies {
+		if p.Name != nil {
+			fetched = append(fetched, p)
+		}
+	}
+	return fetched, nil
+}
+
+// policyVersions returns the versions of the managed policy arn other than
+// its default version, newest first.
+func policyVersions(ctx context.Context, client Client, arn, defaultVersion *string) ([]model.PolicyVersion, error) {
+	var versions []model.PolicyVersion
+	pages := iam.NewListPolicyVersionsPaginator(client, &iam.ListPolicyVersionsInput{
+		PolicyArn: arn,
+	})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing versions: %w", err)
+		}
+		for _, v := range resp.Versions {
+			if aws.ToString(v.VersionId) == aws.ToString(defaultVersion) {
+				continue
+			}
+			pver, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+				PolicyArn: arn,
+				VersionId: v.VersionId,
+			})
+			if err != nil {
+				return nil, err
+			}
+			doc, err := decodePolicy(*pver.PolicyVersion.Document)
+			if err != nil {
+				return nil, fmt.Errorf("version %s: %w", *v.VersionId, err)
+			}
+			versions = append(versions, model.PolicyVersion{VersionID: v.VersionId, CreateDate: v.CreateDate, Document: doc})
+		}
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// sortVersions sorts versions newest first.
+func sortVersions(versions []model.PolicyVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, b := versions[i].CreateDate, versions[j].CreateDate
+		return a != nil && (b == nil || a.After(*b))
+	})
+}
+
+// FetchRoles returns every IAM role in the account along with its trust
+// policy and attached and inline policies.
+func FetchRoles(ctx context.Context, client Client, opts FetchOptions) (model.RoleResources, error) {
+	var list []types.Role
+
+	pages := iam.NewListRolesPaginator(client, &iam.ListRolesInput{})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing roles: %w", err)
+		}
+		for _, r := range resp.Roles {
+			if opts.selected("roles", r.RoleName, r.Arn) {
+				list = append(list, r)
+			}
+		}
+	}
+
+	roles := make(model.RoleResources, len(list))
+	err := opts.forEach(ctx, "roles", len(list), func(i int) *string { return list[i].RoleName }, func(ctx context.Context, i int) error {
+		r := list[i]
+		rec := model.RoleResource{
+			Arn:                r.Arn,
+			CreateDate:         r.CreateDate,
+			Name:               r.RoleName,
+			Description:        r.Description,
+			MaxSessionDuration: int(aws.ToInt32(r.MaxSessionDuration)),
+			Path:               r.Path,
+			Tags:               r.Tags,
+		}
+
+		pdoc, err := decodePolicy(*r.AssumeRolePolicyDocument)
+		if err != nil {
+			return fmt.Errorf("role %s: trust policy: %w", *r.RoleName, err)
+		}
+		rec.AssumeRolePolicyDocument = pdoc
+		if opts.ListOnly {
+			roles[i] = rec
+			return nil
+		}
+
+		// ListRoles leaves out when the role was last used, its
+		// permissions boundary and its tags.
+		role, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: r.RoleName})
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.RoleName, err)
+		}
+		rec.Tags = role.Role.Tags
+		if role.Role.RoleLastUsed != nil {
+			rec.LastUsed = role.Role.RoleLastUsed.LastUsedDate
+		}
+		if b := role.Role.PermissionsBoundary; b != nil {
+			rec.PermissionsBoundary = b.PermissionsBoundaryArn
+		}
+
+		pages := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{
+			RoleName: r.RoleName,
+		})
+		for pages.HasMorePages() {
+			rpolicies, err := pages.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("role %s: listing attached policies: %w", *r.RoleName, err)
+			}
+
+			for _, p := range rpolicies.AttachedPolicies {
+				rec.ManagedPolicyArns = append(rec.ManagedPolicyArns, *p.PolicyArn)
+			}
+		}
+
+		policies, err := roleInlinePolicies(ctx, client, r.RoleName)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.RoleName, err)
+		}
+		rec.Policies = policies
+
+		roles[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := roles[:0]
+	for _, r := range roles {
+		if r.Name != nil {
+			fetched = append(fetched, r)
+		}
+	}
+	return fetched, nil
+}
+
+// FetchServerCertificates returns every server certificate in the account
+// with its certificate body, chain and tags.
+func FetchServerCertificates(ctx context.Context, client Client, opts FetchOptions) (model.ServerCertificateResources, error) {
+	var list []types.ServerCertificateMetadata
+
+	pages := iam.NewListServerCertificatesPaginator(client, &iam.ListServerCertificatesInput{})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing server certificates: %w", err)
+		}
+		for _, s := range resp.ServerCertificateMetadataList {
+			if opts.selected("server-certificates", s.ServerCertificateName, s.Arn) {
+				list = append(list, s)
+			}
+		}
+	}
+
+	certs := make(model.ServerCertificateResources, len(list))
+	err := opts.forEach(ctx, "server-certificates", len(list), func(i int) *string { return list[i].ServerCertificateName }, func(ctx context.Context, i int) error {
+		c := list[i]
+		rec := model.ServerCertificateResource{
+			Arn:  c.Arn,
+			Name: c.ServerCertificateName,
+			Path: c.Path,
+		}
+		if opts.ListOnly {
+			certs[i] = rec
+			return nil
+		}
+
+		out, err := client.GetServerCertificate(ctx, &iam.GetServerCertificateInput{
+			ServerCertificateName: c.ServerCertificateName,
+		})
+		if err != nil {
+			return fmt.Errorf("server certificate %s: %w", *c.ServerCertificateName, err)
+		}
+		rec.CertificateBody = out.ServerCertificate.CertificateBody
+		rec.CertificateChain = out.ServerCertificate.CertificateChain
+		rec.Tags = out.ServerCertificate.Tags
+
+		certs[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := certs[:0]
+	for _, c := range certs {
+		if c.Name != nil {
+			fetched = append(fetched, c)
+		}
+	}
+	return fetched, nil
+}
+
+// FetchUsers returns every IAM user in the account along with its group
+// memberships, console access, tags and attached and inline policies.
+func FetchUsers(ctx context.Context, client Client, opts FetchOptions) (model.UserResources, error) {
+	var list []types.User
+
+	pages := iam.NewListUsersPaginator(client, &iam.ListUsersInput{})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing users: %w", err)
+		}
+		for _, u := range resp.Users {
+			if opts.selected("users", u.UserName, u.Arn) {
+				list = append(list, u)
+			}
+		}
+	}
+
+	users := make(model.UserResources, len(list))
+	err := opts.forEach(ctx, "users", len(list), func(i int) *string { return list[i].UserName }, func(ctx context.Context, i int) error {
+		u := list[i]
+		rec := model.UserResource{
+			Arn:        u.Arn,
+			CreateDate: u.CreateDate,
+			Name:       u.UserName,
+			Path:       u.Path,
+		}
+		if opts.ListOnly {
+			users[i] = rec
+			return nil
+		}
+
+		gpages := iam.NewListGroupsForUserPaginator(client, &iam.ListGroupsForUserInput{
+			UserName: u.UserName,
+		})
+		for gpages.HasMorePages() {
+			groups, err := gpages.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("user %s: listing groups: %w", *u.UserName, err)
+			}
+
+			for _, g := range groups.Groups {
+				rec.Groups = append(rec.Groups, *g.GroupName)
+			}
+		}
+
+		ppages := iam.NewListAttachedUserPoliciesPaginator(client, &iam.ListAttachedUserPoliciesInput{
+			UserName: u.UserName,
+		})
+		for ppages.HasMorePages() {
+			upolicies, err := ppages.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("user %s: listing attached policies: %w", *u.UserName, err)
+			}
+
+			for _, p := range upolicies.AttachedPolicies {
+				rec.ManagedPolicyArns = append(rec.ManagedPolicyArns, *p.PolicyArn)
+			}
+		}
+
+		// ListUsers does not return tags or the permissions boundary.
+		user, err := client.GetUser(ctx, &iam.GetUserInput{UserName: u.UserName})
+		if err != nil {
+			return fmt.Errorf("user %s: %w", *u.UserName, err)
+		}
+		rec.Tags = user.User.Tags
+		if b := user.User.PermissionsBoundary; b != nil {
+			rec.PermissionsBoundary = b.PermissionsBoundaryArn
+		}
+
+		policies, err := userInlinePolicies(ctx, client, u.UserName)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", *u.UserName, err)
+		}
+		rec.Policies = policies
+
+		if rec.LoginProfile, err = loginProfile(ctx, client, u.UserName); err != nil {
+			return fmt.Errorf("user %s: %w", *u.UserName, err)
+		}
+
+		users[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := users[:0]
+	for _, u := range users {
+		if u.Name != nil {
+			fetched = append(fetched, u)
+		}
+	}
+	return fetched, nil
+}
+
+// mfaDeviceNameAndPath splits the serial number of a virtual MFA device,
+// e.g. arn:aws:iam::123456789012:mfa/path/name, into its name and path.
+func mfaDeviceNameAndPath(serial string) (name, path string) {
+	parts := strings.SplitN(serial, ":", 6)
+	resource := strings.TrimPrefix(parts[len(parts)-1], "mfa")
+	i := strings.LastIndexByte(resource, '/')
+	if i < 0 {
+		return resource, "/"
+	}
+	return resource[i+1:], resource[:i+1]
+}
+
+// FetchVirtualMFADevices returns every virtual MFA device in the account
+// with its tags and the user it is assigned to, if any.
+func FetchVirtualMFADevices(ctx context.Context, client Client, opts FetchOptions) (model.VirtualMFADeviceResources, error) {
+	var list []types.VirtualMFADevice
+
+	pages := iam.NewListVirtualMFADevicesPaginator(client, &iam.ListVirtualMFADevicesInput{
+		AssignmentStatus: types.AssignmentStatusTypeAny,
+	})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing virtual MFA devices: %w", err)
+		}
+		for _, d := range resp.VirtualMFADevices {
+			name, _ := mfaDeviceNameAndPath(*d.SerialNumber)
+			if opts.selected("virtual-mfa-devices", &name, d.SerialNumber) {
+				list = append(list, d)
+			}
+		}
+	}
+
+	devices := make(model.VirtualMFADeviceResources, len(list))
+	err := opts.forEach(ctx, "virtual-mfa-devices", len(list), func(i int) *string {
+		name, _ := mfaDeviceNameAndPath(*list[i].SerialNumber)
+		return &name
+	}, func(ctx context.Context, i int) error {
+		d := list[i]
+		name, path := mfaDeviceNameAndPath(*d.SerialNumber)
+		rec := model.VirtualMFADeviceResource{
+			Arn:  d.SerialNumber,
+			Name: &name,
+			Path: &path,
+		}
+		if d.User != nil && d.User.UserName != nil {
+			rec.Users = []string{*d.User.UserName}
+		}
+		if opts.ListOnly {
+			devices[i] = rec
+			return nil
+		}
+
+		// The SDK has no paginator for ListMFADeviceTags.
+		in := &iam.ListMFADeviceTagsInput{SerialNumber: d.SerialNumber}
+		for {
+			tags, err := client.ListMFADeviceTags(ctx, in)
+			if err != nil {
+				return fmt.Errorf("virtual MFA device %s: listing tags: %w", name, err)
+			}
+			rec.Tags = append(rec.Tags, tags.Tags...)
+			if !tags.IsTruncated {
+				break
+			}
+			in.Marker = tags.Marker
+		}
+
+		devices[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := devices[:0]
+	for _, d := range devices {
+		if d.Name != nil {
+			fetched = append(fetched, d)
+		}
+	}
+	return fetched, nil
+}
+
+// FetchInstanceProfiles returns every instance profile in the account with
+// its role, which ListInstanceProfiles returns with it.
+func FetchInstanceProfiles(ctx context.Context, client Client, opts FetchOptions) (model.InstanceProfileResources, error) {
+	var profiles model.InstanceProfileResources
+
+	pages := iam.NewListInstanceProfilesPaginator(client, &iam.ListInstanceProfilesInput{})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing instance profiles: %w", err)
+		}
+		for _, p := range resp.InstanceProfiles {
+			if !opts.selected("instance-profiles", p.InstanceProfileName, p.Arn) {
+				continue
+			}
+			rec := model.InstanceProfileResource{
+				Arn:        p.Arn,
+				CreateDate: p.CreateDate,
+				Name:       p.InstanceProfileName,
+				Path:       p.Path,
+			}
+			for _, r := range p.Roles {
+				rec.Roles = append(rec.Roles, *r.RoleName)
+			}
+			profiles = append(profiles, rec)
+		}
+	}
+	return profiles, nil
+}
+
+// providerName returns the name of the identity provider with the ARN
+// arn, e.g. arn:aws:iam::123456789012:oidc-provider/example.com/id: the
+// URL of OIDC providers without its scheme, example.com/id, or the name
+// of SAML providers.
+func providerName(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	resource := parts[len(parts)-1]
+	if i := strings.IndexByte(resource, '/'); i >= 0 {
+		return resource[i+1:]
+	}
+	return resource
+}
+
+// FetchProviders returns every OIDC and SAML identity provider in the
+// account with its configuration and tags.
+func FetchProviders(ctx context.Context, client Client, opts FetchOptions) (model.ProviderResources, error) {
+	var list []model.ProviderResource
+	add := func(kind model.ProviderKind, arn *string) {
+		name := providerName(*arn)
+		if opts.selected("providers", &name, arn) {
+			list = append(list, model.ProviderResource{Arn: arn, Kind: kind, Name: &name})
+		}
+	}
+
+	// Neither list call is paginated.
+	oidc, err := client.ListOpenIDConnectProviders(ctx, &iam.ListOpenIDConnectProvidersInput{})
+	if err != nil {
+		return nil, fmt.Errorf("listing OIDC providers: %w", err)
+	}
+	for _, p := range oidc.OpenIDConnectProviderList {
+		add(model.OIDCProvider, p.Arn)
+	}
+	saml, err := client.ListSAMLProviders(ctx, &iam.ListSAMLProvidersInput{})
+	if err != nil {
+		return nil, fmt.Errorf("listing SAML providers: %w", err)
+	}
+	for _, p := range saml.SAMLProviderList {
+		add(model.SAMLProvider, p.Arn)
+	}
+
+	providers := make(model.ProviderResources, len(list))
+	err = opts.forEach(ctx, "providers", len(list), func(i int) *string { return list[i].Name }, func(ctx context.Context, i int) error {
+		rec := list[i]
+		if opts.ListOnly {
+			providers[i] = rec
+			return nil
+		}
+
+		switch rec.Kind {
+		case model.OIDCProvider:
+			out, err := client.GetOpenIDConnectProvider(ctx, &iam.GetOpenIDConnectProviderInput{
+				OpenIDConnectProviderArn: rec.Arn,
+			})
+			if err != nil {
+				return fmt.Errorf("OIDC provider %s: %w", *rec.Name, err)
+			}
+			rec.ClientIDs = out.ClientIDList
+			rec.CreateDate = out.CreateDate
+			rec.Tags = out.Tags
+			rec.Thumbprints = out.ThumbprintList
+			// IAM returns the URL without its scheme, which
+			// CloudFormation requires.
+			u := aws.ToString(out.Url)
+			if !strings.Contains(u, "://") {
+				u = "https://" + u
+			}
+			rec.URL = &u
+		case model.SAMLProvider:
+			out, err := client.GetSAMLProvider(ctx, &iam.GetSAMLProviderInput{
+				SAMLProviderArn: rec.Arn,
+			})
+			if err != nil {
+				return fmt.Errorf("SAML provider %s: %w", *rec.Name, err)
+			}
+			rec.CreateDate = out.CreateDate
+			rec.MetadataDocument = out.SAMLMetadataDocument
+			rec.Tags = out.Tags
+		}
+
+		providers[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := providers[:0]
+	for _, p := range providers {
+		if p.Name != nil {
+			fetched = append(fetched, p)
+		}
+	}
+	return fetched, nil
+}
+
+// FetchAccount returns the account alias and password policy.
+func FetchAccount(ctx context.Context, client Client) (*model.AccountResource, error) {
+	account := &model.AccountResource{}
+
+	pages := iam.NewListAccountAliasesPaginator(client, &iam.ListAccountAliasesInput{})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing account aliases: %w", err)
+		}
+		// An account has at most one alias.
+		for i := range resp.AccountAliases {
+			account.Alias = &model.AccountAliasResource{Name: &resp.AccountAliases[i]}
+		}
+	}
+
+	out, err := client.GetAccountPasswordPolicy(ctx, &iam.GetAccountPasswordPolicyInput{})
+	var nse *types.NoSuchEntityException
+	if errors.As(err, &nse) {
+		return account, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("password policy: %w", err)
+	}
+
+	p := out.PasswordPolicy
+	account.PasswordPolicy = &model.PasswordPolicyResource{
+		AllowUsersToChangePassword: p.AllowUsersToChangePassword,
+		HardExpiry:                 p.HardExpiry,
+		MaxPasswordAge:             p.MaxPasswordAge,
+		MinimumPasswordLength:      p.MinimumPasswordLength,
+		PasswordReusePrevention:    p.PasswordReusePrevention,
+		RequireLowercaseCharacters: p.RequireLowercaseCharacters,
+		RequireNumbers:             p.RequireNumbers,
+		RequireSymbols:             p.RequireSymbols,
+		RequireUppercaseCharacters: p.RequireUppercaseCharacters,
+	}
+
+	return account, nil
+}
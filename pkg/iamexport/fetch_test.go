@@ -0,0 +1,357 @@
+package iamexport_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/iamfake"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+const (
+	readOnly  = "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	boundary  = "arn:aws:iam::123456789012:policy/boundary"
+	deployArn = "arn:aws:iam::123456789012:policy/ci/deploy"
+	allowS3   = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	trustEC2  = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+	githubArn = "arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"
+)
+
+var created = aws.Time(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+
+func tag(k, v string) types.Tag {
+	return types.Tag{Key: aws.String(k), Value: aws.String(v)}
+}
+
+// account returns a fake account with a resource of every IAM type
+// rendered, paginated one item at a time.
+func account() *iamfake.Client {
+	return &iamfake.Client{
+		PageSize: 1,
+		Groups: []iamfake.Group{
+			{
+				Group: types.Group{
+					Arn:        aws.String("arn:aws:iam::123456789012:group/admins"),
+					CreateDate: created,
+					GroupName:  aws.String("admins"),
+					Path:       aws.String("/"),
+				},
+				AttachedPolicies: []types.AttachedPolicy{{PolicyArn: aws.String(readOnly)}},
+				InlinePolicies:   []iamfake.InlinePolicy{{Name: "s3", Document: allowS3}},
+			},
+		},
+		Policies: []iamfake.Policy{
+			{
+				Policy: types.Policy{
+					Arn:              aws.String(deployArn),
+					AttachmentCount:  aws.Int32(1),
+					CreateDate:       created,
+					DefaultVersionId: aws.String("v2"),
+					Description:      aws.String("Deploys the app"),
+					Path:             aws.String("/ci/"),
+					PolicyName:       aws.String("deploy"),
+					Tags:             []types.Tag{tag("team", "ci")},
+				},
+				Documents: map[string]string{"v1": allowS3, "v2": allowS3},
+			},
+		},
+		Roles: []iamfake.Role{
+			{
+				Role: types.Role{
+					Arn:                      aws.String("arn:aws:iam::123456789012:role/ci/app"),
+					AssumeRolePolicyDocument: aws.String(trustEC2),
+					CreateDate:               created,
+					Description:              aws.String("Runs the app"),
+					MaxSessionDuration:       aws.Int32(7200),
+					Path:                     aws.String("/ci/"),
+					PermissionsBoundary:      &types.AttachedPermissionsBoundary{PermissionsBoundaryArn: aws.String(boundary)},
+					RoleName:                 aws.String("app"),
+					Tags:                     []types.Tag{tag("team", "ci"), tag("env", "prod")},
+				},
+				AttachedPolicies: []types.AttachedPolicy{{PolicyArn: aws.String(deployArn)}, {PolicyArn: aws.String(readOnly)}},
+				InlinePolicies:   []iamfake.InlinePolicy{{Name: "s3", Document: allowS3}},
+			},
+			{
+				Role: types.Role{
+					Arn:                      aws.String("arn:aws:iam::123456789012:role/plain"),
+					AssumeRolePolicyDocument: aws.String(trustEC2),
+					CreateDate:               created,
+					MaxSessionDuration:       aws.Int32(3600),
+					Path:                     aws.String("/"),
+					RoleName:                 aws.String("plain"),
+				},
+			},
+		},
+		Users: []iamfake.User{
+			{
+				User: types.User{
+					Arn:                 aws.String("arn:aws:iam::123456789012:user/alice"),
+					CreateDate:          created,
+					Path:                aws.String("/"),
+					PermissionsBoundary: &types.AttachedPermissionsBoundary{PermissionsBoundaryArn: aws.String(boundary)},
+					Tags:                []types.Tag{tag("team", "ci")},
+					UserName:            aws.String("alice"),
+				},
+				AttachedPolicies: []types.AttachedPolicy{{PolicyArn: aws.String(readOnly)}},
+				Groups:           []string{"admins"},
+				InlinePolicies:   []iamfake.InlinePolicy{{Name: "s3", Document: allowS3}},
+				LoginProfile:     &types.LoginProfile{PasswordResetRequired: true},
+			},
+		},
+		InstanceProfiles: []types.InstanceProfile{
+			{
+				Arn:                 aws.String("arn:aws:iam::123456789012:instance-profile/ci/app"),
+				CreateDate:          created,
+				InstanceProfileName: aws.String("app"),
+				Path:                aws.String("/ci/"),
+				Roles:               []types.Role{{RoleName: aws.String("app")}},
+			},
+		},
+		OIDCProviders: []iamfake.OIDCProvider{
+			{
+				Arn: githubArn,
+				GetOpenIDConnectProviderOutput: iam.GetOpenIDConnectProviderOutput{
+					ClientIDList:   []string{"sts.amazonaws.com"},
+					CreateDate:     created,
+					Tags:           []types.Tag{tag("team", "ci")},
+					ThumbprintList: []string{"6938fd4d98bab03faadb97b34396831e3780aea1"},
+					Url:            aws.String("token.actions.githubusercontent.com"),
+				},
+			},
+		},
+		SAMLProviders: []iamfake.SAMLProvider{
+			{
+				Arn: "arn:aws:iam::123456789012:saml-provider/okta",
+				GetSAMLProviderOutput: iam.GetSAMLProviderOutput{
+					CreateDate:           created,
+					SAMLMetadataDocument: aws.String("<EntityDescriptor entityID=\"http://www.okta.com/example\"/>"),
+				},
+			},
+		},
+	}
+}
+
+func TestFetchRoles(t *testing.T) {
+	roles, err := iamexport.FetchRoles(context.Background(), account(), iamexport.FetchOptions{Concurrency: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 {
+		t.Fatalf("fetched %d roles, want 2", len(roles))
+	}
+	r := roles[0]
+	if got := aws.ToString(r.Name); got != "app" {
+		t.Fatalf("first role is %q, want app", got)
+	}
+	if got := aws.ToString(r.Description); got != "Runs the app" {
+		t.Errorf("Description = %q", got)
+	}
+	if r.MaxSessionDuration != 7200 {
+		t.Errorf("MaxSessionDuration = %d, want 7200", r.MaxSessionDuration)
+	}
+	if got := aws.ToString(r.Path); got != "/ci/" {
+		t.Errorf("Path = %q, want /ci/", got)
+	}
+	// ListRoles leaves these out: they must come from GetRole.
+	if got := aws.ToString(r.PermissionsBoundary); got != boundary {
+		t.Errorf("PermissionsBoundary = %q, want %s", got, boundary)
+	}
+	if want := []types.Tag{tag("team", "ci"), tag("env", "prod")}; !reflect.DeepEqual(r.Tags, want) {
+		t.Errorf("Tags = %v, want %v", r.Tags, want)
+	}
+	if want := []string{deployArn, readOnly}; !reflect.DeepEqual(r.ManagedPolicyArns, want) {
+		t.Errorf("ManagedPolicyArns = %v, want %v", r.ManagedPolicyArns, want)
+	}
+	if len(r.Policies) != 1 || aws.ToString(r.Policies[0].Name) != "s3" || r.Policies[0].PolicyDocument == nil {
+		t.Errorf("Policies = %+v, want the inline policy s3 with its document", r.Policies)
+	}
+	if r.AssumeRolePolicyDocument == nil {
+		t.Error("the trust policy was not decoded")
+	}
+	if p := roles[1]; p.PermissionsBoundary != nil || p.Tags != nil || p.Policies != nil {
+		t.Errorf("the role plain got properties it does not have: %+v", p)
+	}
+}
+
+func TestFetchRolesListOnly(t *testing.T) {
+	roles, err := iamexport.FetchRoles(context.Background(), account(), iamexport.FetchOptions{ListOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 {
+		t.Fatalf("fetched %d roles, want 2", len(roles))
+	}
+	if r := roles[0]; r.AssumeRolePolicyDocument == nil || r.ManagedPolicyArns != nil || r.Policies != nil {
+		t.Errorf("listing only got %+v, want the trust policy without attachments", r)
+	}
+}
+
+func TestFetchPolicies(t *testing.T) {
+	policies, err := iamexport.FetchPolicies(context.Background(), account(), iamexport.FetchOptions{PolicyVersions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("fetched %d policies, want 1", len(policies))
+	}
+	p := policies[0]
+	if got := aws.ToString(p.Description); got != "Deploys the app" {
+		t.Errorf("Description = %q", got)
+	}
+	if p.AttachmentCount != 1 {
+		t.Errorf("AttachmentCount = %d, want 1", p.AttachmentCount)
+	}
+	// ListPolicies leaves the tags out: they must come from GetPolicy.
+	if want := []types.Tag{tag("team", "ci")}; !reflect.DeepEqual(p.Tags, want) {
+		t.Errorf("Tags = %v, want %v", p.Tags, want)
+	}
+	if p.PolicyDocument == nil {
+		t.Error("the document of the default version was not fetched")
+	}
+	if len(p.Versions) != 1 || aws.ToString(p.Versions[0].VersionID) != "v1" {
+		t.Errorf("Versions = %+v, want v1", p.Versions)
+	}
+}
+
+func TestFetchGroups(t *testing.T) {
+	groups, err := iamexport.FetchGroups(context.Background(), account(), iamexport.FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("fetched %d groups, want 1", len(groups))
+	}
+	g := groups[0]
+	if want := []string{readOnly}; !reflect.DeepEqual(g.ManagedPolicyArns, want) {
+		t.Errorf("ManagedPolicyArns = %v, want %v", g.ManagedPolicyArns, want)
+	}
+	if len(g.Policies) != 1 || aws.ToString(g.Policies[0].Name) != "s3" {
+		t.Errorf("Policies = %+v, want the inline policy s3", g.Policies)
+	}
+}
+
+func TestFetchUsers(t *testing.T) {
+	users, err := iamexport.FetchUsers(context.Background(), account(), iamexport.FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("fetched %d users, want 1", len(users))
+	}
+	u := users[0]
+	if want := []string{"admins"}; !reflect.DeepEqual(u.Groups, want) {
+		t.Errorf("Groups = %v, want %v", u.Groups, want)
+	}
+	if got := aws.ToString(u.PermissionsBoundary); got != boundary {
+		t.Errorf("PermissionsBoundary = %q, want %s", got, boundary)
+	}
+	if want := []types.Tag{tag("team", "ci")}; !reflect.DeepEqual(u.Tags, want) {
+		t.Errorf("Tags = %v, want %v", u.Tags, want)
+	}
+	if u.LoginProfile == nil {
+		t.Error("the login profile was not fetched")
+	}
+	if len(u.Policies) != 1 {
+		t.Errorf("Policies = %+v, want the inline policy s3", u.Policies)
+	}
+}
+
+func TestFetchInstanceProfiles(t *testing.T) {
+	profiles, err := iamexport.FetchInstanceProfiles(context.Background(), account(), iamexport.FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 {
+		t.Fatalf("fetched %d instance profiles, want 1", len(profiles))
+	}
+	if p := profiles[0]; aws.ToString(p.Name) != "app" || aws.ToString(p.Path) != "/ci/" || !reflect.DeepEqual(p.Roles, []string{"app"}) {
+		t.Errorf("fetched %+v, want app under /ci/ with the role app", p)
+	}
+}
+
+func TestFetchProviders(t *testing.T) {
+	providers, err := iamexport.FetchProviders(context.Background(), account(), iamexport.FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 2 {
+		t.Fatalf("fetched %d providers, want 2", len(providers))
+	}
+	oidc, saml := providers[0], providers[1]
+	if oidc.Kind != model.OIDCProvider || aws.ToString(oidc.Name) != "token.actions.githubusercontent.com" {
+		t.Errorf("first provider is %s %q, want the OIDC provider of GitHub", oidc.Kind, aws.ToString(oidc.Name))
+	}
+	// IAM returns the URL without its scheme.
+	if got := aws.ToString(oidc.URL); got != "https://token.actions.githubusercontent.com" {
+		t.Errorf("URL = %q", got)
+	}
+	if !reflect.DeepEqual(oidc.ClientIDs, []string{"sts.amazonaws.com"}) || len(oidc.Thumbprints) != 1 {
+		t.Errorf("ClientIDs = %v, Thumbprints = %v", oidc.ClientIDs, oidc.Thumbprints)
+	}
+	if want := []types.Tag{tag("team", "ci")}; !reflect.DeepEqual(oidc.Tags, want) {
+		t.Errorf("Tags = %v, want %v", oidc.Tags, want)
+	}
+	if saml.Kind != model.SAMLProvider || aws.ToString(saml.Name) != "okta" || saml.MetadataDocument == nil {
+		t.Errorf("second provider is %+v, want the SAML provider okta with its metadata", saml)
+	}
+
+	providers, err = iamexport.FetchProviders(context.Background(), account(), iamexport.FetchOptions{Names: []string{githubArn}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 1 || providers[0].Kind != model.OIDCProvider {
+		t.Errorf("fetched %+v by ARN, want the OIDC provider", providers)
+	}
+}
+
+func TestFetchNamesAndExclude(t *testing.T) {
+	opts := iamexport.FetchOptions{
+		Names:   []string{"app", "arn:aws:iam::123456789012:role/plain"},
+		Exclude: func(typ, name, arn string) bool { return name == "plain" },
+	}
+	roles, err := iamexport.FetchRoles(context.Background(), account(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || aws.ToString(roles[0].Name) != "app" {
+		t.Errorf("fetched %+v, want only the role app", roles)
+	}
+}
+
+func TestFetchOnError(t *testing.T) {
+	client := account()
+	// The inline policy listed for the role can not be read.
+	client.Roles[0].InlinePolicies = append(client.Roles[0].InlinePolicies, iamfake.InlinePolicy{Name: "broken", Document: "{"})
+
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	roles, err := iamexport.FetchRoles(context.Background(), client, iamexport.FetchOptions{
+		OnError: func(err *iamexport.ResourceError) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err.Type+"/"+err.Name)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || aws.ToString(roles[0].Name) != "plain" {
+		t.Errorf("fetched %+v, want only the role plain", roles)
+	}
+	if want := []string{"roles/app"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed = %v, want %v", failed, want)
+	}
+
+	if _, err := iamexport.FetchRoles(context.Background(), client, iamexport.FetchOptions{}); err == nil {
+		t.Error("FetchRoles without OnError did not fail")
+	}
+}
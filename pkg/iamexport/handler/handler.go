@@ -0,0 +1,210 @@
+// Package handler runs the fetch and render steps as a function of an
+// event, writing the template to S3, so that exports can run serverlessly,
+// e.g. as an AWS Lambda function on an EventBridge schedule. See
+// cmd/lambda for the function.
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Uploader is the subset of the S3 API used to store templates. *s3.Client
+// satisfies it.
+type Uploader interface {
+	PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+var _ Uploader = (*s3.Client)(nil)
+
+// DefaultTypes are the resource types exported when an event names none.
+var DefaultTypes = []string{"groups", "policies", "roles", "users"}
+
+// Event is the input of an export, in the JSON of a Lambda event, e.g.
+// {"types": ["roles"], "s3Uri": "s3://bucket/iam/", "versionedKeys": true}.
+type Event struct {
+	// Types are the resource types to export, as given on the command
+	// line, e.g. roles. Defaults to DefaultTypes.
+	Types []string `json:"types"`
+	// Names, when set, restricts the export to the resources with these
+	// names or ARNs.
+	Names []string `json:"names"`
+
+	// S3URI is the prefix the template is uploaded to as template.yaml,
+	// e.g. s3://bucket/iam/.
+	S3URI string `json:"s3Uri"`
+	// VersionedKeys uploads the template under a prefix named by the time
+	// it was generated, e.g. 20261015T093000Z/, keeping earlier ones.
+	VersionedKeys bool `json:"versionedKeys"`
+	// SSE is the server-side encryption of the template: AES256, the
+	// default, or aws:kms.
+	SSE string `json:"sse"`
+	// KMSKeyID is the KMS key of aws:kms, instead of the AWS managed key.
+	KMSKeyID string `json:"kmsKeyId"`
+
+	PreserveNames bool `json:"preserveNames"`
+	Parameterize  bool `json:"parameterize"`
+	Canonicalize  bool `json:"canonicalize"`
+	Outputs       bool `json:"outputs"`
+}
+
+// Result is the output of an export.
+type Result struct {
+	// Location is the S3 URI of the template.
+	Location string `json:"location"`
+	// Resources is the number of resources in the template.
+	Resources int `json:"resources"`
+}
+
+// Handler exports the resources of the account of its clients.
+type Handler struct {
+	IAM      iamexport.Client
+	SSOAdmin iamexport.SSOAdminClient
+	STS      transform.CallerIdentityClient
+	S3       Uploader
+	// Region is the region of pseudo parameters with Parameterize.
+	Region string
+	// Concurrency is the number of resources fetched in parallel.
+	Concurrency int
+	// Version is recorded in the provenance of the templates.
+	Version string
+}
+
+// New returns a Handler with the clients of cfg.
+func New(cfg aws.Config) *Handler {
+	return &Handler{
+		IAM:      iam.NewFromConfig(cfg),
+		SSOAdmin: ssoadmin.NewFromConfig(cfg),
+		STS:      sts.NewFromConfig(cfg),
+		S3: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			// Local emulators do not serve virtual hosted buckets.
+			o.UsePathStyle = iamexport.EndpointFromEnv("S3") != ""
+		}),
+		Region:      cfg.Region,
+		Concurrency: 4,
+	}
+}
+
+// Handle exports the resources of e as a CloudFormation template and
+// uploads it to e.S3URI. It fails, without uploading, when the template
+// exceeds the limits of CloudFormation.
+func (h *Handler) Handle(ctx context.Context, e Event) (*Result, error) {
+	bucket, key, err := templateKey(e)
+	if err != nil {
+		return nil, err
+	}
+	if e.SSE == "" {
+		e.SSE = string(s3types.ServerSideEncryptionAes256)
+	}
+	if len(e.Types) == 0 {
+		e.Types = DefaultTypes
+	}
+
+	resources, err := h.fetch(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	transform.Sort(resources)
+	if e.Canonicalize {
+		if err := transform.Canonicalize(resources); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := h.STS.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("looking up account ID: %w", err)
+	}
+	if e.Parameterize {
+		p, err := transform.ParameterizerFromArn(aws.ToString(id.Arn), h.Region)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Apply(resources); err != nil {
+			return nil, err
+		}
+	}
+
+	b := bytes.Buffer{}
+	ids := render.NewLogicalIDs(nil)
+	err = render.Write(&b, resources, ids, render.Options{
+		PreserveNames: e.PreserveNames,
+		Outputs:       e.Outputs,
+		Provenance: &render.Provenance{
+			AccountID: aws.ToString(id.Account),
+			Generated: time.Now(),
+			Version:   h.Version,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	violations, err := analyze.CheckLimits(resources, b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var exceeded []string
+	for _, v := range violations {
+		if !v.Warning && v.Limit != "inline-template-size" {
+			exceeded = append(exceeded, v.Message)
+		}
+	}
+	if len(exceeded) > 0 {
+		return nil, errors.New("the template would fail to deploy: " + strings.Join(exceeded, "; "))
+	}
+
+	in := &s3.PutObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(b.Bytes()),
+		ContentType:          aws.String("application/x-yaml"),
+		ServerSideEncryption: s3types.ServerSideEncryption(e.SSE),
+	}
+	if e.KMSKeyID != "" {
+		in.SSEKMSKeyId = aws.String(e.KMSKeyID)
+	}
+	if _, err := h.S3.PutObject(ctx, in); err != nil {
+		return nil, fmt.Errorf("uploading template to s3://%s/%s: %w", bucket, key, err)
+	}
+	return &Result{Location: "s3://" + bucket + "/" + key, Resources: len(ids.Entries())}, nil
+}
+
+// templateKey returns the bucket and key the template of e is uploaded to.
+func templateKey(e Event) (string, string, error) {
+	bucket, prefix, err := iamexport.ParseS3URI(e.S3URI)
+	if err != nil {
+		return "", "", err
+	}
+	if e.VersionedKeys {
+		prefix += time.Now().UTC().Format("20060102T150405Z") + "/"
+	}
+	return bucket, prefix + "template.yaml", nil
+}
+
+// fetch reads the resource types of e from the account.
+func (h *Handler) fetch(ctx context.Context, e Event) (*model.ResourceSet, error) {
+	opts := iamexport.FetchOptions{Concurrency: h.Concurrency, Names: e.Names}
+	resources := &model.ResourceSet{}
+	for _, typ := range e.Types {
+		if err := iamexport.Fetch(ctx, h.IAM, h.SSOAdmin, typ, resources, opts); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
@@ -0,0 +1,632 @@
+// Package iamfake provides an in-memory implementation of iamexport.Client
+// for tests and offline use.
+package iamfake
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+var _ iamexport.Client = (*Client)(nil)
+
+// InlinePolicy is an inline policy with a plain JSON document.
+type InlinePolicy struct {
+	Name     string
+	Document string
+}
+
+type Group struct {
+	types.Group
+	AttachedPolicies []types.AttachedPolicy
+	InlinePolicies   []InlinePolicy
+}
+
+// Policy is a customer managed policy. Documents maps version IDs to plain
+// JSON documents and must contain the policy's DefaultVersionId.
+type Policy struct {
+	types.Policy
+	Documents map[string]string
+}
+
+// Role is an IAM role. AssumeRolePolicyDocument may be given as plain JSON;
+// it is URL-encoded when returned, as IAM does.
+type Role struct {
+	types.Role
+	AttachedPolicies []types.AttachedPolicy
+	InlinePolicies   []InlinePolicy
+}
+
+// User is an IAM user. Groups names the groups the user is a member of;
+// a nil LoginProfile means the user has no console access.
+type User struct {
+	types.User
+	AttachedPolicies []types.AttachedPolicy
+	Groups           []string
+	InlinePolicies   []InlinePolicy
+	LoginProfile     *types.LoginProfile
+}
+
+// OIDCProvider is an OIDC identity provider. Its Output is returned by
+// GetOpenIDConnectProvider.
+type OIDCProvider struct {
+	Arn string
+	iam.GetOpenIDConnectProviderOutput
+}
+
+// SAMLProvider is a SAML identity provider. Its Output is returned by
+// GetSAMLProvider.
+type SAMLProvider struct {
+	Arn string
+	iam.GetSAMLProviderOutput
+}
+
+// Client serves the resources it holds through the IAM API methods used by
+// the fetcher. It is safe for concurrent use as long as it is not modified.
+type Client struct {
+	// AccountAlias and PasswordPolicy are the account settings; nil when
+	// not set.
+	AccountAlias   *string
+	PasswordPolicy *types.PasswordPolicy
+
+	Groups   []Group
+	Policies []Policy
+	Roles    []Role
+	Users    []User
+
+	// ServerCertificates must all have their ServerCertificateMetadata set.
+	ServerCertificates []types.ServerCertificate
+	VirtualMFADevices  []types.VirtualMFADevice
+
+	// InstanceProfiles need only the RoleName of their Roles set.
+	InstanceProfiles []types.InstanceProfile
+	OIDCProviders    []OIDCProvider
+	SAMLProviders    []SAMLProvider
+
+	// PageSize limits the number of items returned by each list call so
+	// that pagination is exercised. Zero returns everything at once.
+	PageSize int
+}
+
+func noSuchEntity(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return &types.NoSuchEntityException{Message: &msg}
+}
+
+// page returns the bounds of the page of an n item list starting at marker,
+// and the marker of the next page if there is one.
+func (c *Client) page(n int, marker *string) (start, end int, next *string, err error) {
+	if marker != nil {
+		if start, err = strconv.Atoi(*marker); err != nil || start < 0 || start > n {
+			return 0, 0, nil, fmt.Errorf("invalid marker %q", *marker)
+		}
+	}
+	end = n
+	if c.PageSize > 0 && start+c.PageSize < n {
+		end = start + c.PageSize
+		next = aws.String(strconv.Itoa(end))
+	}
+	return start, end, next, nil
+}
+
+func (c *Client) group(name *string) (*Group, error) {
+	for i := range c.Groups {
+		if aws.ToString(c.Groups[i].GroupName) == aws.ToString(name) {
+			return &c.Groups[i], nil
+		}
+	}
+	return nil, noSuchEntity("The group with name %s cannot be found.", aws.ToString(name))
+}
+
+func (c *Client) role(name *string) (*Role, error) {
+	for i := range c.Roles {
+		if aws.ToString(c.Roles[i].RoleName) == aws.ToString(name) {
+			return &c.Roles[i], nil
+		}
+	}
+	return nil, noSuchEntity("The role with name %s cannot be found.", aws.ToString(name))
+}
+
+func (c *Client) user(name *string) (*User, error) {
+	for i := range c.Users {
+		if aws.ToString(c.Users[i].UserName) == aws.ToString(name) {
+			return &c.Users[i], nil
+		}
+	}
+	return nil, noSuchEntity("The user with name %s cannot be found.", aws.ToString(name))
+}
+
+func (c *Client) policy(arn *string) (*Policy, error) {
+	for i := range c.Policies {
+		if aws.ToString(c.Policies[i].Arn) == aws.ToString(arn) {
+			return &c.Policies[i], nil
+		}
+	}
+	return nil, noSuchEntity("Policy %s was not found.", aws.ToString(arn))
+}
+
+func inlineNames(policies []InlinePolicy) []string {
+	names := make([]string, 0, len(policies))
+	for _, p := range policies {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func inlineDocument(policies []InlinePolicy, name *string) (string, bool) {
+	for _, p := range policies {
+		if p.Name == aws.ToString(name) {
+			return url.QueryEscape(p.Document), true
+		}
+	}
+	return "", false
+}
+
+func (c *Client) ListGroups(_ context.Context, in *iam.ListGroupsInput, _ ...func(*iam.Options)) (*iam.ListGroupsOutput, error) {
+	start, end, next, err := c.page(len(c.Groups), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListGroupsOutput{IsTruncated: next != nil, Marker: next}
+	for _, g := range c.Groups[start:end] {
+		out.Groups = append(out.Groups, g.Group)
+	}
+	return out, nil
+}
+
+func (c *Client) ListGroupPolicies(_ context.Context, in *iam.ListGroupPoliciesInput, _ ...func(*iam.Options)) (*iam.ListGroupPoliciesOutput, error) {
+	g, err := c.group(in.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(g.InlinePolicies), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListGroupPoliciesOutput{
+		IsTruncated: next != nil,
+		Marker:      next,
+		PolicyNames: inlineNames(g.InlinePolicies[start:end]),
+	}, nil
+}
+
+func (c *Client) ListAttachedGroupPolicies(_ context.Context, in *iam.ListAttachedGroupPoliciesInput, _ ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	g, err := c.group(in.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(g.AttachedPolicies), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedGroupPoliciesOutput{
+		AttachedPolicies: g.AttachedPolicies[start:end],
+		IsTruncated:      next != nil,
+		Marker:           next,
+	}, nil
+}
+
+func (c *Client) GetGroupPolicy(_ context.Context, in *iam.GetGroupPolicyInput, _ ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error) {
+	g, err := c.group(in.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := inlineDocument(g.InlinePolicies, in.PolicyName)
+	if !ok {
+		return nil, noSuchEntity("The group policy with name %s cannot be found.", aws.ToString(in.PolicyName))
+	}
+	return &iam.GetGroupPolicyOutput{
+		GroupName:      in.GroupName,
+		PolicyDocument: &doc,
+		PolicyName:     in.PolicyName,
+	}, nil
+}
+
+func (c *Client) ListPolicies(_ context.Context, in *iam.ListPoliciesInput, _ ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	start, end, next, err := c.page(len(c.Policies), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListPoliciesOutput{IsTruncated: next != nil, Marker: next}
+	for _, p := range c.Policies[start:end] {
+		// Like IAM, ListPolicies does not return tags.
+		policy := p.Policy
+		policy.Tags = nil
+		out.Policies = append(out.Policies, policy)
+	}
+	return out, nil
+}
+
+func (c *Client) GetPolicy(_ context.Context, in *iam.GetPolicyInput, _ ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	p, err := c.policy(in.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	policy := p.Policy
+	return &iam.GetPolicyOutput{Policy: &policy}, nil
+}
+
+func (c *Client) GetPolicyVersion(_ context.Context, in *iam.GetPolicyVersionInput, _ ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	p, err := c.policy(in.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := p.Documents[aws.ToString(in.VersionId)]
+	if !ok {
+		return nil, noSuchEntity("Policy %s version %s does not exist.", aws.ToString(in.PolicyArn), aws.ToString(in.VersionId))
+	}
+	doc = url.QueryEscape(doc)
+	return &iam.GetPolicyVersionOutput{
+		PolicyVersion: &types.PolicyVersion{
+			Document:         &doc,
+			IsDefaultVersion: aws.ToString(in.VersionId) == aws.ToString(p.DefaultVersionId),
+			VersionId:        in.VersionId,
+		},
+	}, nil
+}
+
+func (c *Client) ListPolicyVersions(_ context.Context, in *iam.ListPolicyVersionsInput, _ ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error) {
+	p, err := c.policy(in.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id := range p.Documents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	start, end, next, err := c.page(len(ids), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListPolicyVersionsOutput{IsTruncated: next != nil, Marker: next}
+	for _, id := range ids[start:end] {
+		out.Versions = append(out.Versions, types.PolicyVersion{
+			IsDefaultVersion: id == aws.ToString(p.DefaultVersionId),
+			VersionId:        aws.String(id),
+		})
+	}
+	return out, nil
+}
+
+func (c *Client) ListRoles(_ context.Context, in *iam.ListRolesInput, _ ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+	start, end, next, err := c.page(len(c.Roles), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListRolesOutput{IsTruncated: next != nil, Marker: next}
+	for _, r := range c.Roles[start:end] {
+		// Like IAM, ListRoles does not return tags, permissions
+		// boundaries or when roles were last used.
+		role := r.Role
+		role.PermissionsBoundary = nil
+		role.RoleLastUsed = nil
+		role.Tags = nil
+		if role.AssumeRolePolicyDocument != nil {
+			role.AssumeRolePolicyDocument = aws.String(url.QueryEscape(*role.AssumeRolePolicyDocument))
+		}
+		out.Roles = append(out.Roles, role)
+	}
+	return out, nil
+}
+
+func (c *Client) ListRolePolicies(_ context.Context, in *iam.ListRolePoliciesInput, _ ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	r, err := c.role(in.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(r.InlinePolicies), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListRolePoliciesOutput{
+		IsTruncated: next != nil,
+		Marker:      next,
+		PolicyNames: inlineNames(r.InlinePolicies[start:end]),
+	}, nil
+}
+
+func (c *Client) ListAttachedRolePolicies(_ context.Context, in *iam.ListAttachedRolePoliciesInput, _ ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	r, err := c.role(in.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(r.AttachedPolicies), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedRolePoliciesOutput{
+		AttachedPolicies: r.AttachedPolicies[start:end],
+		IsTruncated:      next != nil,
+		Marker:           next,
+	}, nil
+}
+
+func (c *Client) GetRole(_ context.Context, in *iam.GetRoleInput, _ ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	r, err := c.role(in.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	role := r.Role
+	if role.AssumeRolePolicyDocument != nil {
+		role.AssumeRolePolicyDocument = aws.String(url.QueryEscape(*role.AssumeRolePolicyDocument))
+	}
+	return &iam.GetRoleOutput{Role: &role}, nil
+}
+
+func (c *Client) GetRolePolicy(_ context.Context, in *iam.GetRolePolicyInput, _ ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	r, err := c.role(in.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := inlineDocument(r.InlinePolicies, in.PolicyName)
+	if !ok {
+		return nil, noSuchEntity("The role policy with name %s cannot be found.", aws.ToString(in.PolicyName))
+	}
+	return &iam.GetRolePolicyOutput{
+		PolicyDocument: &doc,
+		PolicyName:     in.PolicyName,
+		RoleName:       in.RoleName,
+	}, nil
+}
+
+func (c *Client) ListUsers(_ context.Context, in *iam.ListUsersInput, _ ...func(*iam.Options)) (*iam.ListUsersOutput, error) {
+	start, end, next, err := c.page(len(c.Users), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListUsersOutput{IsTruncated: next != nil, Marker: next}
+	for _, u := range c.Users[start:end] {
+		// Like IAM, ListUsers does not return tags or permissions
+		// boundaries.
+		user := u.User
+		user.PermissionsBoundary = nil
+		user.Tags = nil
+		out.Users = append(out.Users, user)
+	}
+	return out, nil
+}
+
+func (c *Client) ListGroupsForUser(_ context.Context, in *iam.ListGroupsForUserInput, _ ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	u, err := c.user(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(u.Groups), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListGroupsForUserOutput{IsTruncated: next != nil, Marker: next}
+	for _, name := range u.Groups[start:end] {
+		group := types.Group{GroupName: aws.String(name)}
+		if g, err := c.group(&name); err == nil {
+			group = g.Group
+		}
+		out.Groups = append(out.Groups, group)
+	}
+	return out, nil
+}
+
+func (c *Client) ListUserPolicies(_ context.Context, in *iam.ListUserPoliciesInput, _ ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	u, err := c.user(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(u.InlinePolicies), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserPoliciesOutput{
+		IsTruncated: next != nil,
+		Marker:      next,
+		PolicyNames: inlineNames(u.InlinePolicies[start:end]),
+	}, nil
+}
+
+func (c *Client) ListAttachedUserPolicies(_ context.Context, in *iam.ListAttachedUserPoliciesInput, _ ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	u, err := c.user(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(u.AttachedPolicies), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedUserPoliciesOutput{
+		AttachedPolicies: u.AttachedPolicies[start:end],
+		IsTruncated:      next != nil,
+		Marker:           next,
+	}, nil
+}
+
+func (c *Client) ListUserTags(_ context.Context, in *iam.ListUserTagsInput, _ ...func(*iam.Options)) (*iam.ListUserTagsOutput, error) {
+	u, err := c.user(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, next, err := c.page(len(u.Tags), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserTagsOutput{
+		IsTruncated: next != nil,
+		Marker:      next,
+		Tags:        u.Tags[start:end],
+	}, nil
+}
+
+func (c *Client) GetUser(_ context.Context, in *iam.GetUserInput, _ ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	u, err := c.user(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	user := u.User
+	return &iam.GetUserOutput{User: &user}, nil
+}
+
+func (c *Client) GetUserPolicy(_ context.Context, in *iam.GetUserPolicyInput, _ ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error) {
+	u, err := c.user(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := inlineDocument(u.InlinePolicies, in.PolicyName)
+	if !ok {
+		return nil, noSuchEntity("The user policy with name %s cannot be found.", aws.ToString(in.PolicyName))
+	}
+	return &iam.GetUserPolicyOutput{
+		PolicyDocument: &doc,
+		PolicyName:     in.PolicyName,
+		UserName:       in.UserName,
+	}, nil
+}
+
+func (c *Client) GetLoginProfile(_ context.Context, in *iam.GetLoginProfileInput, _ ...func(*iam.Options)) (*iam.GetLoginProfileOutput, error) {
+	u, err := c.user(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if u.LoginProfile == nil {
+		return nil, noSuchEntity("Login Profile for User %s cannot be found.", aws.ToString(in.UserName))
+	}
+	profile := *u.LoginProfile
+	return &iam.GetLoginProfileOutput{LoginProfile: &profile}, nil
+}
+
+func (c *Client) ListServerCertificates(_ context.Context, in *iam.ListServerCertificatesInput, _ ...func(*iam.Options)) (*iam.ListServerCertificatesOutput, error) {
+	start, end, next, err := c.page(len(c.ServerCertificates), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	out := &iam.ListServerCertificatesOutput{IsTruncated: next != nil, Marker: next}
+	for _, sc := range c.ServerCertificates[start:end] {
+		out.ServerCertificateMetadataList = append(out.ServerCertificateMetadataList, *sc.ServerCertificateMetadata)
+	}
+	return out, nil
+}
+
+func (c *Client) GetServerCertificate(_ context.Context, in *iam.GetServerCertificateInput, _ ...func(*iam.Options)) (*iam.GetServerCertificateOutput, error) {
+	for _, sc := range c.ServerCertificates {
+		if aws.ToString(sc.ServerCertificateMetadata.ServerCertificateName) == aws.ToString(in.ServerCertificateName) {
+			cert := sc
+			return &iam.GetServerCertificateOutput{ServerCertificate: &cert}, nil
+		}
+	}
+	return nil, noSuchEntity("The Server Certificate with name %s cannot be found.", aws.ToString(in.ServerCertificateName))
+}
+
+func (c *Client) ListVirtualMFADevices(_ context.Context, in *iam.ListVirtualMFADevicesInput, _ ...func(*iam.Options)) (*iam.ListVirtualMFADevicesOutput, error) {
+	var devices []types.VirtualMFADevice
+	for _, d := range c.VirtualMFADevices {
+		switch in.AssignmentStatus {
+		case types.AssignmentStatusTypeAssigned:
+			if d.User == nil {
+				continue
+			}
+		case types.AssignmentStatusTypeUnassigned:
+			if d.User != nil {
+				continue
+			}
+		}
+		// Like IAM, ListVirtualMFADevices does not return tags or seeds.
+		d.Base32StringSeed, d.QRCodePNG, d.Tags = nil, nil, nil
+		devices = append(devices, d)
+	}
+	start, end, next, err := c.page(len(devices), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListVirtualMFADevicesOutput{
+		IsTruncated:       next != nil,
+		Marker:            next,
+		VirtualMFADevices: devices[start:end],
+	}, nil
+}
+
+func (c *Client) ListMFADeviceTags(_ context.Context, in *iam.ListMFADeviceTagsInput, _ ...func(*iam.Options)) (*iam.ListMFADeviceTagsOutput, error) {
+	for _, d := range c.VirtualMFADevices {
+		if aws.ToString(d.SerialNumber) != aws.ToString(in.SerialNumber) {
+			continue
+		}
+		start, end, next, err := c.page(len(d.Tags), in.Marker)
+		if err != nil {
+			return nil, err
+		}
+		return &iam.ListMFADeviceTagsOutput{
+			IsTruncated: next != nil,
+			Marker:      next,
+			Tags:        d.Tags[start:end],
+		}, nil
+	}
+	return nil, noSuchEntity("MFA device with serial number %s cannot be found.", aws.ToString(in.SerialNumber))
+}
+
+func (c *Client) ListInstanceProfiles(_ context.Context, in *iam.ListInstanceProfilesInput, _ ...func(*iam.Options)) (*iam.ListInstanceProfilesOutput, error) {
+	start, end, next, err := c.page(len(c.InstanceProfiles), in.Marker)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListInstanceProfilesOutput{
+		IsTruncated:      next != nil,
+		Marker:           next,
+		InstanceProfiles: c.InstanceProfiles[start:end],
+	}, nil
+}
+
+func (c *Client) ListOpenIDConnectProviders(context.Context, *iam.ListOpenIDConnectProvidersInput, ...func(*iam.Options)) (*iam.ListOpenIDConnectProvidersOutput, error) {
+	out := &iam.ListOpenIDConnectProvidersOutput{}
+	for _, p := range c.OIDCProviders {
+		out.OpenIDConnectProviderList = append(out.OpenIDConnectProviderList, types.OpenIDConnectProviderListEntry{Arn: aws.String(p.Arn)})
+	}
+	return out, nil
+}
+
+func (c *Client) GetOpenIDConnectProvider(_ context.Context, in *iam.GetOpenIDConnectProviderInput, _ ...func(*iam.Options)) (*iam.GetOpenIDConnectProviderOutput, error) {
+	for _, p := range c.OIDCProviders {
+		if p.Arn == aws.ToString(in.OpenIDConnectProviderArn) {
+			out := p.GetOpenIDConnectProviderOutput
+			return &out, nil
+		}
+	}
+	return nil, noSuchEntity("OpenIDConnect Provider not found for arn %s", aws.ToString(in.OpenIDConnectProviderArn))
+}
+
+func (c *Client) ListSAMLProviders(context.Context, *iam.ListSAMLProvidersInput, ...func(*iam.Options)) (*iam.ListSAMLProvidersOutput, error) {
+	out := &iam.ListSAMLProvidersOutput{}
+	for _, p := range c.SAMLProviders {
+		out.SAMLProviderList = append(out.SAMLProviderList, types.SAMLProviderListEntry{Arn: aws.String(p.Arn), CreateDate: p.CreateDate})
+	}
+	return out, nil
+}
+
+func (c *Client) GetSAMLProvider(_ context.Context, in *iam.GetSAMLProviderInput, _ ...func(*iam.Options)) (*iam.GetSAMLProviderOutput, error) {
+	for _, p := range c.SAMLProviders {
+		if p.Arn == aws.ToString(in.SAMLProviderArn) {
+			out := p.GetSAMLProviderOutput
+			return &out, nil
+		}
+	}
+	return nil, noSuchEntity("Manifest not found for arn %s", aws.ToString(in.SAMLProviderArn))
+}
+
+func (c *Client) ListAccountAliases(context.Context, *iam.ListAccountAliasesInput, ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error) {
+	out := &iam.ListAccountAliasesOutput{AccountAliases: []string{}}
+	if c.AccountAlias != nil {
+		out.AccountAliases = append(out.AccountAliases, *c.AccountAlias)
+	}
+	return out, nil
+}
+
+func (c *Client) GetAccountPasswordPolicy(context.Context, *iam.GetAccountPasswordPolicyInput, ...func(*iam.Options)) (*iam.GetAccountPasswordPolicyOutput, error) {
+	if c.PasswordPolicy == nil {
+		return nil, noSuchEntity("The Password Policy cannot be found.")
+	}
+	policy := *c.PasswordPolicy
+	return &iam.GetAccountPasswordPolicyOutput{PasswordPolicy: &policy}, nil
+}
@@ -0,0 +1,112 @@
+// Package ignore reads ignore files, listing the resources to leave out of
+// every export, e.g. the roles IAM Identity Center or the CDK bootstrap
+// create.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule is a pattern of an ignore file.
+type Rule struct {
+	// Type is the resource type the rule applies to, e.g. "roles", or ""
+	// for every type.
+	Type    string
+	Pattern string
+	re      *regexp.Regexp
+}
+
+// Rules are the rules of an ignore file.
+type Rules []Rule
+
+var typePrefix = regexp.MustCompile(`^([a-z-]+):(.*)$`)
+
+// compile returns the regular expression of pattern: a regular expression
+// between slashes, or a glob where * matches any characters and ? any one
+// character, matching the whole value.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile(pattern[1 : len(pattern)-1])
+	}
+	glob := regexp.QuoteMeta(pattern)
+	glob = strings.ReplaceAll(glob, `\*`, ".*")
+	glob = strings.ReplaceAll(glob, `\?`, ".")
+	return regexp.Compile("^" + glob + "$")
+}
+
+// Parse reads the rules of an ignore file from r: one pattern per line,
+// optionally prefixed with the resource type it applies to, e.g.
+// roles:AWSReservedSSO_*. Blank lines and lines starting with # are
+// skipped.
+func Parse(r io.Reader) (Rules, error) {
+	var rules Rules
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
+
+// ParseRule parses one pattern of an ignore file, optionally prefixed with
+// the resource type it applies to.
+func ParseRule(s string) (Rule, error) {
+	rule := Rule{Pattern: s}
+	if m := typePrefix.FindStringSubmatch(s); m != nil && m[1] != "arn" {
+		rule.Type, rule.Pattern = m[1], strings.TrimSpace(m[2])
+	}
+	re, err := compile(rule.Pattern)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// Read reads the rules of the ignore file at path.
+func Read(path string) (Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Match reports whether a rule matches the name or ARN of the resource of
+// type typ, e.g. "roles".
+func (rs Rules) Match(typ, name, arn string) bool {
+	for _, r := range rs {
+		if r.Match(typ, name, arn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether r matches the name or ARN of the resource of type
+// typ.
+func (r Rule) Match(typ, name, arn string) bool {
+	if r.Type != "" && r.Type != typ {
+		return false
+	}
+	return r.re.MatchString(name) || (arn != "" && r.re.MatchString(arn))
+}
@@ -0,0 +1,17 @@
+// Package shorthash provides the short digests used to keep generated
+// names unique without introducing run-to-run differences.
+package shorthash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Len is the length of the strings returned by Sum.
+const Len = 8
+
+// Sum returns a stable, short hex digest of s.
+func Sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:Len]
+}
@@ -0,0 +1,234 @@
+// Package model defines the IAM resources read by the fetcher and written
+// by the renderers.
+package model
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+type GroupResource struct {
+	LogicalID         string
+	Arn               *string
+	CreateDate        *time.Time
+	Name              *string
+	ManagedPolicyArns []string
+	Path              *string
+	Policies          PolicyResources
+}
+
+type GroupResources []GroupResource
+
+type PolicyResource struct {
+	LogicalID       string
+	Arn             *string
+	AttachmentCount int
+	CreateDate      *time.Time
+	Description     *string
+	Name            *string
+	Path            *string
+	PolicyDocument  *string
+	// ProposedDocument is a narrower document proposed to replace
+	// PolicyDocument, written for review next to it.
+	ProposedDocument *string
+	Tags             []types.Tag
+	// Versions are the versions of a managed policy other than its
+	// default one, newest first, when fetched.
+	Versions []PolicyVersion
+	// UnusedServices are the namespaces of the services the policy allows
+	// but that were not accessed recently.
+	UnusedServices []string
+}
+
+type PolicyResources []PolicyResource
+
+// PolicyVersion is a version of a managed policy.
+type PolicyVersion struct {
+	VersionID  *string
+	CreateDate *time.Time
+	Document   *string
+}
+
+type RoleResource struct {
+	LogicalID                string
+	Arn                      *string
+	AssumeRolePolicyDocument *string
+	CreateDate               *time.Time
+	Description              *string
+	// LastUsed is when the role was last assumed, or nil if it was not
+	// within the period IAM tracks.
+	LastUsed           *time.Time
+	ManagedPolicyArns  []string
+	MaxSessionDuration int
+	Name               *string
+	Path               *string
+	// PermissionsBoundary is the ARN of the managed policy limiting the
+	// permissions of the role, if any.
+	PermissionsBoundary *string
+	Policies            PolicyResources
+	// ProposedPolicies are narrower policies proposed to replace the
+	// policies of the role, written for review next to them.
+	ProposedPolicies PolicyResources
+	Tags             []types.Tag
+	// UnusedServices are the namespaces of the services the policies of
+	// the role allow but that were not accessed recently.
+	UnusedServices []string
+}
+
+type RoleResources []RoleResource
+
+// PermissionSetResource is an IAM Identity Center permission set.
+// SessionDuration is an ISO 8601 duration such as PT1H.
+type PermissionSetResource struct {
+	LogicalID       string
+	Arn             *string
+	Description     *string
+	InlinePolicy    *string
+	InstanceArn     *string
+	ManagedPolicies []string
+	Name            *string
+	RelayState      *string
+	SessionDuration *string
+	Tags            []types.Tag
+}
+
+type PermissionSetResources []PermissionSetResource
+
+// ServerCertificateResource is an IAM server certificate. The private key
+// can not be read back from IAM.
+type ServerCertificateResource struct {
+	LogicalID        string
+	Arn              *string
+	CertificateBody  *string
+	CertificateChain *string
+	Name             *string
+	Path             *string
+	Tags             []types.Tag
+}
+
+type ServerCertificateResources []ServerCertificateResource
+
+// VirtualMFADeviceResource is a virtual MFA device. Its seed can not be
+// read back from IAM, so a device created from the template has a new one.
+type VirtualMFADeviceResource struct {
+	LogicalID string
+	Arn       *string
+	Name      *string
+	Path      *string
+	Tags      []types.Tag
+	Users     []string
+}
+
+type VirtualMFADeviceResources []VirtualMFADeviceResource
+
+// InstanceProfileResource is an instance profile, passing its role to the
+// EC2 instances it is associated with. CloudFormation can not tag instance
+// profiles, so their tags are not kept.
+type InstanceProfileResource struct {
+	LogicalID  string
+	Arn        *string
+	CreateDate *time.Time
+	Name       *string
+	Path       *string
+	// Roles are the names of the roles of the instance profile, at most
+	// one.
+	Roles []string
+}
+
+type InstanceProfileResources []InstanceProfileResource
+
+// ProviderKind is the protocol of an identity provider.
+type ProviderKind string
+
+const (
+	OIDCProvider ProviderKind = "oidc"
+	SAMLProvider ProviderKind = "saml"
+)
+
+// ProviderResource is an OIDC or SAML identity provider, whose users
+// assume the roles trusting it. OIDC providers are named by their URL
+// without its scheme, e.g. token.actions.githubusercontent.com.
+type ProviderResource struct {
+	LogicalID  string
+	Arn        *string
+	CreateDate *time.Time
+	Kind       ProviderKind
+	Name       *string
+	// ClientIDs, Thumbprints and URL are those of OIDC providers.
+	ClientIDs   []string
+	Thumbprints []string
+	URL         *string
+	// MetadataDocument is the SAML metadata document of SAML providers.
+	MetadataDocument *string
+	Tags             []types.Tag
+}
+
+type ProviderResources []ProviderResource
+
+// AccountResource holds the account level IAM settings. Either field is
+// nil when the account does not have it set.
+type AccountResource struct {
+	Alias          *AccountAliasResource
+	PasswordPolicy *PasswordPolicyResource
+}
+
+type AccountAliasResource struct {
+	LogicalID string
+	Name      *string
+}
+
+// PasswordPolicyResource is the account password policy. Unset limits are
+// nil.
+type PasswordPolicyResource struct {
+	LogicalID                  string
+	AllowUsersToChangePassword bool
+	HardExpiry                 *bool
+	MaxPasswordAge             *int32
+	MinimumPasswordLength      *int32
+	PasswordReusePrevention    *int32
+	RequireLowercaseCharacters bool
+	RequireNumbers             bool
+	RequireSymbols             bool
+	RequireUppercaseCharacters bool
+}
+
+// LoginProfile is the console access of a user. The password itself can
+// not be read back from IAM.
+type LoginProfile struct {
+	PasswordResetRequired bool
+}
+
+type UserResource struct {
+	LogicalID         string
+	Arn               *string
+	CreateDate        *time.Time
+	Groups            []string
+	LoginProfile      *LoginProfile
+	ManagedPolicyArns []string
+	Name              *string
+	Path              *string
+	// PermissionsBoundary is the ARN of the managed policy limiting the
+	// permissions of the user, if any.
+	PermissionsBoundary *string
+	Policies            PolicyResources
+	Tags                []types.Tag
+}
+
+type UserResources []UserResource
+
+// ResourceSet holds the resources of an account, or those written to a
+// single template. It is passed by type from the fetch functions through
+// the transforms to the renderers, with a field per resource type.
+type ResourceSet struct {
+	Account            *AccountResource
+	Groups             GroupResources
+	InstanceProfiles   InstanceProfileResources
+	PermissionSets     PermissionSetResources
+	Policies           PolicyResources
+	Providers          ProviderResources
+	Roles              RoleResources
+	ServerCertificates ServerCertificateResources
+	Users              UserResources
+	VirtualMFADevices  VirtualMFADeviceResources
+}
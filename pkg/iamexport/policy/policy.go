@@ -0,0 +1,161 @@
+// Package policy parses the statements of IAM policy documents.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Statement is a statement of a policy document. Elements that may be a
+// single string or a list are always lists. A Principal or NotPrincipal of
+// "*" is the key "*" with the value "*".
+type Statement struct {
+	Sid          string
+	Effect       string
+	Principal    map[string][]string
+	NotPrincipal map[string][]string
+	Action       []string
+	NotAction    []string
+	Resource     []string
+	NotResource  []string
+	// Condition maps condition operators to condition keys to values.
+	Condition map[string]map[string][]string
+}
+
+// stringList is a JSON string or list of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = []string{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %s", b)
+	}
+	*l = list
+	return nil
+}
+
+// principal is a JSON principal element: "*" or a map of principal type to
+// a string or list of strings.
+type principal map[string][]string
+
+func (p *principal) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = principal{s: {s}}
+		return nil
+	}
+	var m map[string]stringList
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*p = principal{}
+	for k, v := range m {
+		(*p)[k] = v
+	}
+	return nil
+}
+
+// condition is a JSON condition element. Values may be strings, numbers or
+// booleans, and are kept as their JSON text unless they are strings.
+type condition map[string]map[string][]string
+
+func (c *condition) UnmarshalJSON(b []byte) error {
+	var m map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*c = condition{}
+	for op, keys := range m {
+		(*c)[op] = map[string][]string{}
+		for key, raw := range keys {
+			var values []json.RawMessage
+			if err := json.Unmarshal(raw, &values); err != nil {
+				values = []json.RawMessage{raw}
+			}
+			for _, v := range values {
+				var s string
+				if err := json.Unmarshal(v, &s); err != nil {
+					s = string(v)
+				}
+				(*c)[op][key] = append((*c)[op][key], s)
+			}
+		}
+	}
+	return nil
+}
+
+type statement struct {
+	Sid          string
+	Effect       string
+	Principal    principal
+	NotPrincipal principal
+	Action       stringList
+	NotAction    stringList
+	Resource     stringList
+	NotResource  stringList
+	Condition    condition
+}
+
+// Parse returns the statements of the JSON policy document doc, which may
+// hold a single statement or a list of them.
+func Parse(doc string) ([]Statement, error) {
+	var d struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(doc), &d); err != nil {
+		return nil, err
+	}
+	if len(d.Statement) == 0 {
+		return nil, nil
+	}
+
+	var list []statement
+	if d.Statement[0] == '{' {
+		list = make([]statement, 1)
+		if err := json.Unmarshal(d.Statement, &list[0]); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(d.Statement, &list); err != nil {
+		return nil, err
+	}
+
+	statements := make([]Statement, len(list))
+	for i, s := range list {
+		statements[i] = Statement{
+			Sid:          s.Sid,
+			Effect:       s.Effect,
+			Principal:    s.Principal,
+			NotPrincipal: s.NotPrincipal,
+			Action:       s.Action,
+			NotAction:    s.NotAction,
+			Resource:     s.Resource,
+			NotResource:  s.NotResource,
+			Condition:    s.Condition,
+		}
+	}
+	return statements, nil
+}
+
+// Principals returns the principals of p as "type:value" strings, sorted,
+// e.g. "AWS:arn:aws:iam::123456789012:root" or "Service:lambda.amazonaws.com".
+// The wildcard principal is returned as "*".
+func Principals(p map[string][]string) []string {
+	var l []string
+	for typ, values := range p {
+		for _, v := range values {
+			if typ == "*" {
+				l = append(l, "*")
+				continue
+			}
+			l = append(l, typ+":"+v)
+		}
+	}
+	sort.Strings(l)
+	return l
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ackAPIVersion is the API group of the ACK IAM controller.
+const ackAPIVersion = "iam.services.k8s.aws/v1alpha1"
+
+// ackAnnotations returns the annotations adopting the existing resource
+// identified by field, and keeping it when the manifest is deleted.
+func ackAnnotations(field, value string) *yaml.Node {
+	fields, _ := json.Marshal(map[string]string{field: value})
+	return mapping(
+		"services.k8s.aws/adoption-policy", "adopt",
+		"services.k8s.aws/adoption-fields", string(fields),
+		"services.k8s.aws/deletion-policy", "retain",
+	)
+}
+
+func ackTags(tags []types.Tag) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, t := range tags {
+		n.Content = append(n.Content, mapping("key", *t.Key, "value", *t.Value))
+	}
+	return n
+}
+
+func ackInlinePolicies(policies model.PolicyResources) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, p := range policies {
+		n.Content = append(n.Content, scalar(*p.Name), scalar(strings.TrimSpace(*p.PolicyDocument)))
+	}
+	return n
+}
+
+// ackPolicies returns the policies and policyRefs fields attaching arns:
+// policies of the same manifests by reference, others by ARN.
+func ackPolicies(arns []string, refs map[string]string) (*yaml.Node, *yaml.Node) {
+	policies := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	policyRefs := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, arn := range arns {
+		if ref, ok := refs[arn]; ok {
+			policyRefs.Content = append(policyRefs.Content, mapping("from", mapping("name", ref)))
+			continue
+		}
+		policies.Content = append(policies.Content, scalar(arn))
+	}
+	return policies, policyRefs
+}
+
+// WriteACK writes the managed policies, groups and roles in set to w as
+// custom resources of the IAM controller of AWS Controllers for Kubernetes.
+// The adoption annotations make the controller take over the existing
+// resources instead of creating them, and keep them in IAM when the custom
+// resources are deleted. Other resource types are ignored.
+func WriteACK(w io.Writer, set *model.ResourceSet) error {
+	names := kubernetesNames{}
+	var objects []*yaml.Node
+
+	policyRefs := map[string]string{}
+	for _, p := range set.Policies {
+		name := names.name("Policy", *p.Name)
+		policyRefs[*p.Arn] = name
+		objects = append(objects, kubernetesObject(ackAPIVersion, "Policy", name,
+			ackAnnotations("arn", *p.Arn),
+			optionalMapping(
+				"name", p.Name,
+				"path", p.Path,
+				"description", p.Description,
+				"policyDocument", p.PolicyDocument,
+				"tags", ackTags(p.Tags),
+			),
+		))
+	}
+
+	for _, g := range set.Groups {
+		policies, refs := ackPolicies(g.ManagedPolicyArns, policyRefs)
+		objects = append(objects, kubernetesObject(ackAPIVersion, "Group", names.name("Group", *g.Name),
+			ackAnnotations("name", *g.Name),
+			optionalMapping(
+				"name", g.Name,
+				"path", g.Path,
+				"inlinePolicies", ackInlinePolicies(g.Policies),
+				"policies", policies,
+				"policyRefs", refs,
+			),
+		))
+	}
+
+	for _, r := range set.Roles {
+		policies, refs := ackPolicies(r.ManagedPolicyArns, policyRefs)
+		objects = append(objects, kubernetesObject(ackAPIVersion, "Role", names.name("Role", *r.Name),
+			ackAnnotations("name", *r.Name),
+			optionalMapping(
+				"name", r.Name,
+				"path", r.Path,
+				"description", r.Description,
+				"assumeRolePolicyDocument", r.AssumeRolePolicyDocument,
+				"maxSessionDuration", optionalInt(r.MaxSessionDuration),
+				"inlinePolicies", ackInlinePolicies(r.Policies),
+				"policies", policies,
+				"policyRefs", refs,
+				"tags", ackTags(r.Tags),
+			),
+		))
+	}
+
+	return writeDocuments(w, "IAM resources exported by iam-cf-generator, adopted by ACK", objects)
+}
@@ -0,0 +1,113 @@
+package render
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"gopkg.in/yaml.v3"
+)
+
+// ansibleTask appends a task running module with the given arguments to
+// tasks. Empty arguments are left out.
+func ansibleTask(tasks *yaml.Node, name, module string, args ...interface{}) {
+	args = append(args, "state", "present")
+	tasks.Content = append(tasks.Content, mapping("name", name, "amazon.aws."+module, optionalMapping(args...)))
+}
+
+// ansibleInlinePolicies appends the tasks putting the inline policies of
+// the role, group or user named name to tasks.
+func ansibleInlinePolicies(tasks *yaml.Node, kind, name string, policies model.PolicyResources) error {
+	for _, p := range policies {
+		doc, err := documentNode(*p.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("%s %s: policy %s: %w", kind, name, *p.Name, err)
+		}
+		ansibleTask(tasks, fmt.Sprintf("Inline policy %s of %s %s", *p.Name, kind, name), "iam_policy",
+			"iam_type", kind,
+			"iam_name", name,
+			"policy_name", *p.Name,
+			"policy_json", doc,
+		)
+	}
+	return nil
+}
+
+// ansibleManagedPolicies returns the managed_policies argument attaching
+// arns, naming the policies of the playbook so that it also works in
+// other accounts.
+func ansibleManagedPolicies(arns []string, names map[string]string) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, arn := range arns {
+		if name, ok := names[arn]; ok {
+			arn = name
+		}
+		n.Content = append(n.Content, scalar(arn))
+	}
+	return n
+}
+
+// WriteAnsible writes the managed policies, groups and roles in set to w as
+// an Ansible playbook of amazon.aws collection tasks. The tasks are
+// idempotent, so running the playbook against the account the resources
+// were read from changes nothing, while running it against another account
+// creates them. Other resource types are ignored.
+func WriteAnsible(w io.Writer, set *model.ResourceSet) error {
+	tasks := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	policyNames := map[string]string{}
+
+	for _, p := range set.Policies {
+		doc, err := documentNode(*p.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+		policyNames[*p.Arn] = *p.Name
+		ansibleTask(tasks, "Managed policy "+*p.Name, "iam_managed_policy",
+			"name", p.Name,
+			"path", p.Path,
+			"description", p.Description,
+			"policy", doc,
+			"tags", tagMap(p.Tags),
+		)
+	}
+
+	for _, g := range set.Groups {
+		ansibleTask(tasks, "Group "+*g.Name, "iam_group",
+			"name", g.Name,
+			"path", g.Path,
+			"managed_policies", ansibleManagedPolicies(g.ManagedPolicyArns, policyNames),
+		)
+		if err := ansibleInlinePolicies(tasks, "group", *g.Name, g.Policies); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range set.Roles {
+		trust, err := documentNode(*r.AssumeRolePolicyDocument)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		ansibleTask(tasks, "Role "+*r.Name, "iam_role",
+			"name", r.Name,
+			"path", r.Path,
+			"description", r.Description,
+			"assume_role_policy_document", trust,
+			"max_session_duration", optionalInt(r.MaxSessionDuration),
+			"managed_policies", ansibleManagedPolicies(r.ManagedPolicyArns, policyNames),
+			"tags", tagMap(r.Tags),
+		)
+		if err := ansibleInlinePolicies(tasks, "role", *r.Name, r.Policies); err != nil {
+			return err
+		}
+	}
+
+	play := mapping(
+		"name", "IAM resources exported by iam-cf-generator",
+		"hosts", "localhost",
+		"connection", "local",
+		"gather_facts", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "false"},
+		"tasks", tasks,
+	)
+	playbook := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{play}}
+	return writeDocuments(w, "", []*yaml.Node{playbook})
+}
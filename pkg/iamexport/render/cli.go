@@ -0,0 +1,182 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+const cliHeader = `#!/bin/sh
+# IAM resources exported by iam-cf-generator. Resources that already exist
+# are left alone, so the script can be run again after a failure.
+set -eu
+
+partition=$(aws sts get-caller-identity --query Arn --output text | cut -d: -f2)
+account=$(aws sts get-caller-identity --query Account --output text)
+`
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// compactDocument returns a policy document on a single line.
+func compactDocument(doc string) (string, error) {
+	b := bytes.Buffer{}
+	if err := json.Compact(&b, []byte(doc)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// cliScript accumulates the commands of the script.
+type cliScript struct {
+	bytes.Buffer
+	// policyArns maps the ARNs of the managed policies in the script to
+	// their ARN in the account the script runs in.
+	policyArns map[string]string
+}
+
+// command writes an aws command with the given options. Empty options are
+// left out.
+func (s *cliScript) command(indent, cmd string, opts ...string) {
+	s.WriteString(indent + "aws iam " + cmd)
+	for i := 0; i+1 < len(opts); i += 2 {
+		if opts[i+1] == "" {
+			continue
+		}
+		s.WriteString(" \\\n" + indent + "  " + opts[i] + " " + opts[i+1])
+	}
+	s.WriteString("\n")
+}
+
+// createUnless writes cmd, run only if check fails.
+func (s *cliScript) createUnless(comment, check, cmd string, opts ...string) {
+	fmt.Fprintf(s, "\n# %s\nif ! aws iam %s >/dev/null 2>&1; then\n", comment, check)
+	s.command("  ", cmd, opts...)
+	s.WriteString("fi\n")
+}
+
+// policyArn returns the quoted ARN to attach arn by.
+func (s *cliScript) policyArn(arn string) string {
+	if a, ok := s.policyArns[arn]; ok {
+		return a
+	}
+	return shellQuote(arn)
+}
+
+func cliTags(tags []types.Tag) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return "", err
+	}
+	return shellQuote(string(b)), nil
+}
+
+func cliString(s *string) string {
+	if s == nil || *s == "" {
+		return ""
+	}
+	return shellQuote(*s)
+}
+
+// inlinePolicies writes the put-*-policy commands of the inline policies of
+// the role, group or user named name. They overwrite the existing policy
+// of the same name, so they run unconditionally.
+func (s *cliScript) inlinePolicies(kind, name string, policies model.PolicyResources) error {
+	for _, p := range policies {
+		doc, err := compactDocument(*p.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("%s %s: policy %s: %w", kind, name, *p.Name, err)
+		}
+		s.command("", "put-"+kind+"-policy",
+			"--"+kind+"-name", shellQuote(name),
+			"--policy-name", shellQuote(*p.Name),
+			"--policy-document", shellQuote(doc),
+		)
+	}
+	return nil
+}
+
+// WriteCLI writes the managed policies, groups and roles in set to w as a
+// shell script of AWS CLI commands creating them, for restoring them into
+// another account. Each resource is only created if it does not exist;
+// inline policies are put and managed policies attached unconditionally, as
+// both are idempotent. Other resource types are ignored.
+func WriteCLI(w io.Writer, set *model.ResourceSet) error {
+	s := &cliScript{policyArns: map[string]string{}}
+	s.WriteString(cliHeader)
+
+	for _, p := range set.Policies {
+		doc, err := compactDocument(*p.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+		tags, err := cliTags(p.Tags)
+		if err != nil {
+			return err
+		}
+		arn := fmt.Sprintf(`"arn:${partition}:iam::${account}:policy%s%s"`, pathOf(p.Path), *p.Name)
+		s.policyArns[*p.Arn] = arn
+		s.createUnless("Managed policy "+*p.Name, "get-policy --policy-arn "+arn, "create-policy",
+			"--policy-name", shellQuote(*p.Name),
+			"--path", cliString(p.Path),
+			"--description", cliString(p.Description),
+			"--policy-document", shellQuote(doc),
+			"--tags", tags,
+		)
+	}
+
+	for _, g := range set.Groups {
+		s.createUnless("Group "+*g.Name, "get-group --group-name "+shellQuote(*g.Name), "create-group",
+			"--group-name", shellQuote(*g.Name),
+			"--path", cliString(g.Path),
+		)
+		if err := s.inlinePolicies("group", *g.Name, g.Policies); err != nil {
+			return err
+		}
+		for _, arn := range g.ManagedPolicyArns {
+			s.command("", "attach-group-policy", "--group-name", shellQuote(*g.Name), "--policy-arn", s.policyArn(arn))
+		}
+	}
+
+	for _, r := range set.Roles {
+		trust, err := compactDocument(*r.AssumeRolePolicyDocument)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		tags, err := cliTags(r.Tags)
+		if err != nil {
+			return err
+		}
+		maxSession := ""
+		if r.MaxSessionDuration != 0 {
+			maxSession = fmt.Sprint(r.MaxSessionDuration)
+		}
+		s.createUnless("Role "+*r.Name, "get-role --role-name "+shellQuote(*r.Name), "create-role",
+			"--role-name", shellQuote(*r.Name),
+			"--path", cliString(r.Path),
+			"--description", cliString(r.Description),
+			"--assume-role-policy-document", shellQuote(trust),
+			"--max-session-duration", maxSession,
+			"--tags", tags,
+		)
+		if err := s.inlinePolicies("role", *r.Name, r.Policies); err != nil {
+			return err
+		}
+		for _, arn := range r.ManagedPolicyArns {
+			s.command("", "attach-role-policy", "--role-name", shellQuote(*r.Name), "--policy-arn", s.policyArn(arn))
+		}
+	}
+
+	_, err := s.WriteTo(w)
+	return err
+}
@@ -0,0 +1,88 @@
+package render
+
+import (
+	"io"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"gopkg.in/yaml.v3"
+)
+
+// crossplaneAPIVersion is the API group of the IAM types of Crossplane's
+// provider-aws.
+const crossplaneAPIVersion = "iam.aws.upbound.io/v1beta1"
+
+// crossplaneSpec returns the spec of a managed resource observing the
+// existing resource named in its external name annotation, with the given
+// forProvider fields. Empty fields are left out. The resource is orphaned
+// when the manifest is deleted.
+func crossplaneSpec(fields ...interface{}) *yaml.Node {
+	policies := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle, Content: []*yaml.Node{scalar("Observe")}}
+	return mapping(
+		"managementPolicies", policies,
+		"deletionPolicy", "Orphan",
+		"forProvider", optionalMapping(fields...),
+	)
+}
+
+// WriteCrossplane writes the managed policies and roles in set to w as
+// Kubernetes manifests of Crossplane's provider-aws, with each role's
+// managed policies attached through RolePolicyAttachment resources. Every
+// resource only observes the existing one, so applying the manifests adopts
+// it without changing it; switch managementPolicies to ["*"] once the
+// observed state matches. Other resource types are ignored.
+func WriteCrossplane(w io.Writer, set *model.ResourceSet) error {
+	names := kubernetesNames{}
+	var objects []*yaml.Node
+
+	policyRefs := map[string]string{}
+	for _, p := range set.Policies {
+		name := names.name("Policy", *p.Name)
+		policyRefs[*p.Arn] = name
+		objects = append(objects, kubernetesObject(crossplaneAPIVersion, "Policy", name,
+			mapping("crossplane.io/external-name", *p.Arn),
+			crossplaneSpec(
+				"path", p.Path,
+				"description", p.Description,
+				"policy", p.PolicyDocument,
+				"tags", tagMap(p.Tags),
+			),
+		))
+	}
+
+	for _, r := range set.Roles {
+		name := names.name("Role", *r.Name)
+		inline := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, p := range r.Policies {
+			inline.Content = append(inline.Content, mapping("name", *p.Name, "policy", strings.TrimSpace(*p.PolicyDocument)))
+		}
+		objects = append(objects, kubernetesObject(crossplaneAPIVersion, "Role", name,
+			mapping("crossplane.io/external-name", *r.Name),
+			crossplaneSpec(
+				"path", r.Path,
+				"description", r.Description,
+				"assumeRolePolicy", r.AssumeRolePolicyDocument,
+				"maxSessionDuration", optionalInt(r.MaxSessionDuration),
+				"inlinePolicy", inline,
+				"tags", tagMap(r.Tags),
+			),
+		))
+
+		for _, arn := range r.ManagedPolicyArns {
+			attachment := names.name("RolePolicyAttachment", *r.Name+"-"+policyName(arn))
+			policyKey, policy := "policyArn", scalar(arn)
+			if ref, ok := policyRefs[arn]; ok {
+				policyKey, policy = "policyArnRef", mapping("name", ref)
+			}
+			objects = append(objects, kubernetesObject(crossplaneAPIVersion, "RolePolicyAttachment", attachment,
+				mapping("crossplane.io/external-name", *r.Name+"/"+arn),
+				crossplaneSpec(
+					policyKey, policy,
+					"roleRef", mapping("name", name),
+				),
+			))
+		}
+	}
+
+	return writeDocuments(w, "IAM resources exported by iam-cf-generator, observed by Crossplane", objects)
+}
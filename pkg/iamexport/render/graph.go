@@ -0,0 +1,178 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/policy"
+)
+
+// graphNode is a resource or principal in a graph. Nodes are identified
+// by key, e.g. the ARN of a resource.
+type graphNode struct {
+	key   string
+	label string
+	kind  string
+}
+
+type graphEdge struct {
+	from, to, label string
+}
+
+// graph holds the nodes and edges of a relationship graph, in the order
+// they were added.
+type graph struct {
+	nodes []graphNode
+	index map[string]int
+	edges []graphEdge
+}
+
+func (g *graph) node(key, label, kind string) string {
+	if _, ok := g.index[key]; !ok {
+		g.index[key] = len(g.nodes)
+		g.nodes = append(g.nodes, graphNode{key: key, label: label, kind: kind})
+	}
+	return key
+}
+
+func (g *graph) edge(from, to, label string) {
+	g.edges = append(g.edges, graphEdge{from: from, to: to, label: label})
+}
+
+// policies adds the inline and managed policies of the resource at owner.
+func (g *graph) policies(owner string, inline model.PolicyResources, arns []string) {
+	for _, p := range inline {
+		g.edge(owner, g.node(owner+"/"+*p.Name, *p.Name, "inline"), "inline")
+	}
+	for _, arn := range arns {
+		g.edge(owner, g.node(arn, policyName(arn), "policy"), "attached")
+	}
+}
+
+// relationships returns the graph of the users, groups, roles and managed
+// policies in set: group memberships, attached and inline policies, and
+// the principals each role trusts.
+func relationships(set *model.ResourceSet) (*graph, error) {
+	g := &graph{index: map[string]int{}}
+	for _, p := range set.Policies {
+		g.node(*p.Arn, *p.Name, "policy")
+	}
+
+	groups := map[string]string{}
+	for _, gr := range set.Groups {
+		groups[*gr.Name] = g.node(*gr.Arn, *gr.Name, "group")
+		g.policies(*gr.Arn, gr.Policies, gr.ManagedPolicyArns)
+	}
+
+	for _, u := range set.Users {
+		user := g.node(*u.Arn, *u.Name, "user")
+		for _, name := range u.Groups {
+			group, ok := groups[name]
+			if !ok {
+				group = g.node("group "+name, name, "group")
+			}
+			g.edge(user, group, "member of")
+		}
+		g.policies(user, u.Policies, u.ManagedPolicyArns)
+	}
+
+	for _, r := range set.Roles {
+		role := g.node(*r.Arn, *r.Name, "role")
+		g.policies(role, r.Policies, r.ManagedPolicyArns)
+		if r.AssumeRolePolicyDocument == nil {
+			continue
+		}
+		statements, err := policy.Parse(*r.AssumeRolePolicyDocument)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: trust policy: %w", *r.Name, err)
+		}
+		for _, s := range statements {
+			if s.Effect != "Allow" {
+				continue
+			}
+			for _, p := range policy.Principals(s.Principal) {
+				g.edge(role, g.node(p, p, "principal"), "trusts")
+			}
+		}
+	}
+	return g, nil
+}
+
+// graphShapes are the DOT node shapes of each kind of node.
+var graphShapes = map[string]string{
+	"user":      "ellipse",
+	"group":     "folder",
+	"role":      "box3d",
+	"policy":    "note",
+	"inline":    "note",
+	"principal": "diamond",
+}
+
+func writeDOT(w io.Writer, g *graph) error {
+	b := strings.Builder{}
+	b.WriteString("digraph iam {\n  rankdir=LR;\n  node [fontname=\"sans-serif\"];\n  edge [fontname=\"sans-serif\", fontsize=10];\n")
+	for _, n := range g.nodes {
+		style := ""
+		if n.kind == "inline" {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s%s];\n", strconv.Quote(n.key), strconv.Quote(n.label), graphShapes[n.kind], style)
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", strconv.Quote(e.from), strconv.Quote(e.to), strconv.Quote(e.label))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidLabel escapes s for a quoted Mermaid label.
+func mermaidLabel(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+func writeMermaid(w io.Writer, g *graph) error {
+	b := strings.Builder{}
+	b.WriteString("flowchart LR\n")
+	for i, n := range g.nodes {
+		start, end := "[", "]"
+		switch n.kind {
+		case "user":
+			start, end = "([", "])"
+		case "group":
+			start, end = "[[", "]]"
+		case "principal":
+			start, end = "{", "}"
+		case "policy", "inline":
+			start, end = "[/", "/]"
+		}
+		fmt.Fprintf(&b, "  n%d%s%s%s\n", i, start, mermaidLabel(n.label), end)
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "  n%d -->|%s| n%d\n", g.index[e.from], mermaidLabel(e.label), g.index[e.to])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteGraph writes the relationships between the users, groups, roles and
+// managed policies in set to w, as a Graphviz graph when format is "dot" or
+// as a Mermaid flowchart when it is "mermaid". Users point to their groups
+// and policies, groups and roles to their policies, and roles to the
+// principals their trust policy allows.
+func WriteGraph(w io.Writer, set *model.ResourceSet, format string) error {
+	g, err := relationships(set)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "dot":
+		return writeDOT(w, g)
+	case "mermaid":
+		return writeMermaid(w, g)
+	}
+	return fmt.Errorf("unsupported graph format %q", format)
+}
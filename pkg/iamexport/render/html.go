@@ -0,0 +1,248 @@
+package render
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/internal/shorthash"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+)
+
+const htmlTmplFmt = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>IAM report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #eee; }
+pre { background: #f6f6f6; padding: 0.5em; overflow-x: auto; }
+ul { margin: 0; padding-left: 1.2em; }
+.arn { color: #666; font-size: 0.85em; }
+:target { background: #ffd; }
+</style>
+</head>
+<body>
+<h1>IAM report</h1>
+<p>Generated by iam-cf-generator on {{ .Generated }}.
+{{ len .Roles }} roles, {{ len .Policies }} managed policies, {{ len .Groups }} groups, {{ len .Users }} users.</p>
+<p><input id="search" type="search" placeholder="Filter by name, ARN or policy" size="50"></p>
+{{- define "policies" }}
+{{- range .Inline }}
+<details><summary>{{ .Name }}</summary><pre>{{ .Document }}</pre></details>
+{{- end }}
+{{- if .Attached }}
+<ul>
+{{- range .Attached }}
+<li>{{ if .InReport }}<a href="#{{ anchor .Arn }}">{{ .Name }}</a>{{ else }}{{ .Name }}{{ end }}</li>
+{{- end }}
+</ul>
+{{- end }}
+{{- end }}
+{{- if .Roles }}
+<h2>Roles</h2>
+<table>
+<tr><th>Name</th><th>Description</th><th>Created</th><th>Trust policy</th><th>Policies</th></tr>
+{{- range .Roles }}
+<tr id="{{ anchor .Arn }}"><td>{{ .Name }}<div class="arn">{{ .Arn }}</div></td><td>{{ .Description }}</td><td>{{ .Created }}</td>
+<td><details><summary>Trust policy</summary><pre>{{ .Trust }}</pre></details></td>
+<td>{{ template "policies" . }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Policies }}
+<h2>Managed policies</h2>
+<table>
+<tr><th>Name</th><th>Description</th><th>Created</th><th>Document</th><th>Attached to</th></tr>
+{{- range .Policies }}
+<tr id="{{ anchor .Arn }}"><td>{{ .Name }}<div class="arn">{{ .Arn }}</div></td><td>{{ .Description }}</td><td>{{ .Created }}</td>
+<td><details><summary>Policy document</summary><pre>{{ .Document }}</pre></details></td>
+<td><ul>
+{{- range .AttachedTo }}
+<li><a href="#{{ anchor .Arn }}">{{ .Name }}</a></li>
+{{- end }}
+</ul></td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Groups }}
+<h2>Groups</h2>
+<table>
+<tr><th>Name</th><th>Created</th><th>Members</th><th>Policies</th></tr>
+{{- range .Groups }}
+<tr id="{{ anchor .Arn }}"><td>{{ .Name }}<div class="arn">{{ .Arn }}</div></td><td>{{ .Created }}</td>
+<td><ul>
+{{- range .Members }}
+<li><a href="#{{ anchor .Arn }}">{{ .Name }}</a></li>
+{{- end }}
+</ul></td>
+<td>{{ template "policies" . }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Users }}
+<h2>Users</h2>
+<table>
+<tr><th>Name</th><th>Created</th><th>Groups</th><th>Policies</th></tr>
+{{- range .Users }}
+<tr id="{{ anchor .Arn }}"><td>{{ .Name }}<div class="arn">{{ .Arn }}</div></td><td>{{ .Created }}</td>
+<td><ul>
+{{- range .Groups }}
+<li>{{ if .InReport }}<a href="#{{ anchor .Arn }}">{{ .Name }}</a>{{ else }}{{ .Name }}{{ end }}</li>
+{{- end }}
+</ul></td>
+<td>{{ template "policies" . }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+<script>
+document.getElementById("search").addEventListener("input", function (e) {
+  var q = e.target.value.toLowerCase();
+  document.querySelectorAll("tr[id]").forEach(function (tr) {
+    tr.style.display = tr.textContent.toLowerCase().indexOf(q) < 0 ? "none" : "";
+  });
+});
+</script>
+</body>
+</html>
+`
+
+// htmlLink is a cross-link to another resource of the report.
+type htmlLink struct {
+	Name     string
+	Arn      string
+	InReport bool
+}
+
+type htmlInline struct {
+	Name     string
+	Document string
+}
+
+// htmlEntity is a role, group or user of the report.
+type htmlEntity struct {
+	Name        string
+	Arn         string
+	Description string
+	Created     string
+	Trust       string
+	Inline      []htmlInline
+	Attached    []htmlLink
+	Members     []htmlLink
+	Groups      []htmlLink
+}
+
+type htmlPolicy struct {
+	Name        string
+	Arn         string
+	Description string
+	Created     string
+	Document    string
+	AttachedTo  []htmlLink
+}
+
+// htmlAnchor returns the element ID of the resource arn.
+func htmlAnchor(arn string) string {
+	return "r" + strings.ToLower(shorthash.Sum(arn))
+}
+
+func htmlDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+func htmlString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// WriteHTML writes a self-contained HTML report of the roles, managed
+// policies, groups and users in set to w. Policy documents can be expanded
+// in place, attachments and group memberships link to the resources they
+// refer to, and a search field filters the tables.
+func WriteHTML(w io.Writer, set *model.ResourceSet) error {
+	policyArns := map[string]bool{}
+	attachedTo := map[string][]htmlLink{}
+	for _, p := range set.Policies {
+		policyArns[*p.Arn] = true
+	}
+	policies := func(e *htmlEntity, inline model.PolicyResources, arns []string) {
+		for _, p := range inline {
+			e.Inline = append(e.Inline, htmlInline{Name: *p.Name, Document: *p.PolicyDocument})
+		}
+		for _, arn := range arns {
+			e.Attached = append(e.Attached, htmlLink{Name: policyName(arn), Arn: arn, InReport: policyArns[arn]})
+			attachedTo[arn] = append(attachedTo[arn], htmlLink{Name: e.Name, Arn: e.Arn, InReport: true})
+		}
+	}
+
+	data := struct {
+		Generated string
+		Roles     []htmlEntity
+		Policies  []htmlPolicy
+		Groups    []htmlEntity
+		Users     []htmlEntity
+	}{Generated: time.Now().UTC().Format(time.RFC1123)}
+
+	for _, r := range set.Roles {
+		e := htmlEntity{
+			Name:        *r.Name,
+			Arn:         *r.Arn,
+			Description: htmlString(r.Description),
+			Created:     htmlDate(r.CreateDate),
+			Trust:       htmlString(r.AssumeRolePolicyDocument),
+		}
+		policies(&e, r.Policies, r.ManagedPolicyArns)
+		data.Roles = append(data.Roles, e)
+	}
+
+	groupArns := map[string]string{}
+	members := map[string][]htmlLink{}
+	for _, g := range set.Groups {
+		groupArns[*g.Name] = *g.Arn
+	}
+	for _, u := range set.Users {
+		e := htmlEntity{Name: *u.Name, Arn: *u.Arn, Created: htmlDate(u.CreateDate)}
+		for _, g := range u.Groups {
+			arn, ok := groupArns[g]
+			e.Groups = append(e.Groups, htmlLink{Name: g, Arn: arn, InReport: ok})
+			members[g] = append(members[g], htmlLink{Name: *u.Name, Arn: *u.Arn, InReport: true})
+		}
+		policies(&e, u.Policies, u.ManagedPolicyArns)
+		data.Users = append(data.Users, e)
+	}
+
+	for _, g := range set.Groups {
+		e := htmlEntity{Name: *g.Name, Arn: *g.Arn, Created: htmlDate(g.CreateDate), Members: members[*g.Name]}
+		policies(&e, g.Policies, g.ManagedPolicyArns)
+		data.Groups = append(data.Groups, e)
+	}
+
+	for _, p := range set.Policies {
+		links := attachedTo[*p.Arn]
+		sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+		data.Policies = append(data.Policies, htmlPolicy{
+			Name:        *p.Name,
+			Arn:         *p.Arn,
+			Description: htmlString(p.Description),
+			Created:     htmlDate(p.CreateDate),
+			Document:    htmlString(p.PolicyDocument),
+			AttachedTo:  links,
+		})
+	}
+
+	tmpl, err := template.New("report").Funcs(template.FuncMap{"anchor": htmlAnchor}).Parse(htmlTmplFmt)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
@@ -0,0 +1,105 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// intrinsics writes the intrinsic functions of CloudFormation in their
+// short form, e.g. !GetAtt Role.Arn, or with long set, in their long form,
+// e.g. {"Fn::GetAtt": [Role, Arn]}.
+type intrinsics struct {
+	long bool
+}
+
+// ref returns a Ref to the resource or parameter name.
+func (f intrinsics) ref(name string) string {
+	if f.long {
+		return fmt.Sprintf("{Ref: %s}", name)
+	}
+	return "!Ref " + name
+}
+
+// getAtt returns a Fn::GetAtt of attribute of the resource name.
+func (f intrinsics) getAtt(name, attribute string) string {
+	if f.long {
+		return fmt.Sprintf(`{"Fn::GetAtt": [%s, %s]}`, name, attribute)
+	}
+	return fmt.Sprintf("!GetAtt %s.%s", name, attribute)
+}
+
+// sub returns a Fn::Sub of s.
+func (f intrinsics) sub(s string) string {
+	if f.long {
+		// Plain scalars can not hold the braces of ${} in flow mappings.
+		return fmt.Sprintf(`{"Fn::Sub": %s}`, doubleQuote(s))
+	}
+	return "!Sub " + quote(s)
+}
+
+// equals returns a Fn::Equals of the values a and b, written as YAML.
+func (f intrinsics) equals(a, b string) string {
+	if f.long {
+		return fmt.Sprintf(`{"Fn::Equals": [%s, %s]}`, a, b)
+	}
+	return fmt.Sprintf("!Equals [%s, %s]", a, b)
+}
+
+// not returns a Fn::Not of the condition expression c, written as YAML.
+func (f intrinsics) not(c string) string {
+	if f.long {
+		return fmt.Sprintf(`{"Fn::Not": [%s]}`, c)
+	}
+	return fmt.Sprintf("!Not [%s]", c)
+}
+
+// ifElse returns a Fn::If of the values then and otherwise, written as
+// YAML, depending on condition.
+func (f intrinsics) ifElse(condition, then, otherwise string) string {
+	if f.long {
+		return fmt.Sprintf(`{"Fn::If": [%s, %s, %s]}`, condition, then, otherwise)
+	}
+	return fmt.Sprintf("!If [%s, %s, %s]", condition, then, otherwise)
+}
+
+// importValue returns a Fn::ImportValue of the export named by the Fn::Sub
+// string name. It is written in the long form either way, as the short
+// form of Fn::ImportValue can not hold that of Fn::Sub.
+func (f intrinsics) importValue(name string) string {
+	if f.long {
+		return fmt.Sprintf(`{"Fn::ImportValue": {"Fn::Sub": %s}}`, doubleQuote(name))
+	}
+	return fmt.Sprintf(`{"Fn::ImportValue": !Sub %s}`, doubleQuote(name))
+}
+
+// funcs returns the template functions writing intrinsic functions.
+func (f intrinsics) funcs() map[string]interface{} {
+	return map[string]interface{}{
+		"ref":    f.ref,
+		"getAtt": f.getAtt,
+		"sub":    f.sub,
+	}
+}
+
+// shorten rewrites the intrinsic functions in the long form in n, such as
+// the Fn::Sub objects of transform.Parameterizer, in their short form,
+// unless long is set.
+func (f intrinsics) shorten(n *yaml.Node) {
+	if f.long {
+		return
+	}
+	for _, c := range n.Content {
+		f.shorten(c)
+	}
+	if n.Kind != yaml.MappingNode || len(n.Content) != 2 {
+		return
+	}
+	key := n.Content[0].Value
+	if key != "Ref" && !strings.HasPrefix(key, "Fn::") {
+		return
+	}
+	*n = *n.Content[1]
+	n.Tag = "!" + strings.TrimPrefix(key, "Fn::")
+}
@@ -0,0 +1,142 @@
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// InventoryItem is a role, managed policy, group or user in an inventory.
+type InventoryItem struct {
+	Type       string            `json:"type"`
+	Name       string            `json:"name"`
+	Arn        string            `json:"arn"`
+	Path       string            `json:"path"`
+	CreateDate *time.Time        `json:"createDate,omitempty"`
+	Tags       map[string]string `json:"tags"`
+	// ManagedPolicies and InlinePolicies count the policies of roles,
+	// groups and users. Attachments counts the roles, groups and users a
+	// managed policy is attached to.
+	ManagedPolicies int `json:"managedPolicies"`
+	InlinePolicies  int `json:"inlinePolicies"`
+	Attachments     int `json:"attachments"`
+}
+
+func inventoryTags(tags []types.Tag) map[string]string {
+	m := map[string]string{}
+	for _, t := range tags {
+		m[*t.Key] = *t.Value
+	}
+	return m
+}
+
+// Inventory lists the roles, managed policies, groups and users in set.
+func Inventory(set *model.ResourceSet) []InventoryItem {
+	var items []InventoryItem
+	for _, r := range set.Roles {
+		items = append(items, InventoryItem{
+			Type:            "role",
+			Name:            *r.Name,
+			Arn:             *r.Arn,
+			Path:            pathOf(r.Path),
+			CreateDate:      r.CreateDate,
+			Tags:            inventoryTags(r.Tags),
+			ManagedPolicies: len(r.ManagedPolicyArns),
+			InlinePolicies:  len(r.Policies),
+		})
+	}
+	for _, p := range set.Policies {
+		items = append(items, InventoryItem{
+			Type:        "policy",
+			Name:        *p.Name,
+			Arn:         *p.Arn,
+			Path:        pathOf(p.Path),
+			CreateDate:  p.CreateDate,
+			Tags:        inventoryTags(p.Tags),
+			Attachments: p.AttachmentCount,
+		})
+	}
+	for _, g := range set.Groups {
+		items = append(items, InventoryItem{
+			Type:            "group",
+			Name:            *g.Name,
+			Arn:             *g.Arn,
+			Path:            pathOf(g.Path),
+			CreateDate:      g.CreateDate,
+			Tags:            map[string]string{},
+			ManagedPolicies: len(g.ManagedPolicyArns),
+			InlinePolicies:  len(g.Policies),
+		})
+	}
+	for _, u := range set.Users {
+		items = append(items, InventoryItem{
+			Type:            "user",
+			Name:            *u.Name,
+			Arn:             *u.Arn,
+			Path:            pathOf(u.Path),
+			CreateDate:      u.CreateDate,
+			Tags:            inventoryTags(u.Tags),
+			ManagedPolicies: len(u.ManagedPolicyArns),
+			InlinePolicies:  len(u.Policies),
+		})
+	}
+	return items
+}
+
+// writeInventoryCSV writes items as CSV with a header row. Tags are written
+// as key=value pairs separated by semicolons, sorted by key.
+func writeInventoryCSV(w io.Writer, items []InventoryItem) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"type", "name", "arn", "path", "create_date", "tags", "managed_policies", "inline_policies", "attachments"})
+	for _, it := range items {
+		created := ""
+		if it.CreateDate != nil {
+			created = it.CreateDate.UTC().Format(time.RFC3339)
+		}
+		var tags []string
+		for k, v := range it.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		cw.Write([]string{
+			it.Type, it.Name, it.Arn, it.Path, created, strings.Join(tags, ";"),
+			strconv.Itoa(it.ManagedPolicies), strconv.Itoa(it.InlinePolicies), strconv.Itoa(it.Attachments),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteInventory writes the inventory of set to w as "csv", as a "json"
+// array, or as "ndjson" with one item per line.
+func WriteInventory(w io.Writer, set *model.ResourceSet, format string) error {
+	items := Inventory(set)
+	switch format {
+	case "csv":
+		return writeInventoryCSV(w, items)
+	case "json":
+		if items == nil {
+			items = []InventoryItem{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, it := range items {
+			if err := enc.Encode(it); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported inventory format %q", format)
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"io"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/internal/shorthash"
+	"gopkg.in/yaml.v3"
+)
+
+// maxKubernetesNameLen keeps object names within the DNS label limit, so
+// they are valid for every kind.
+const maxKubernetesNameLen = 63
+
+// kubernetesNames hands out unique Kubernetes object names per kind.
+type kubernetesNames map[string]bool
+
+// name converts an IAM name into a Kubernetes object name of the given
+// kind: lower case letters, digits and dashes, unique among the names
+// handed out so far.
+func (k kubernetesNames) name(kind, s string) string {
+	b := strings.Builder{}
+	dash := false
+	for _, r := range strings.ToLower(transliterate(s)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	n := strings.TrimSuffix(b.String(), "-")
+	if n == "" {
+		n = "resource"
+	}
+
+	max := maxKubernetesNameLen - shorthash.Len - 1
+	if len(n) > maxKubernetesNameLen || k[kind+" "+n] {
+		if len(n) > max {
+			n = strings.TrimSuffix(n[:max], "-")
+		}
+		n += "-" + strings.ToLower(shorthash.Sum(s))
+	}
+	k[kind+" "+n] = true
+	return n
+}
+
+// kubernetesObject returns a manifest of the given kind.
+func kubernetesObject(apiVersion, kind, name string, annotations, spec *yaml.Node) *yaml.Node {
+	metadata := mapping("name", name)
+	if annotations != nil {
+		metadata.Content = append(metadata.Content, scalar("annotations"), annotations)
+	}
+	return mapping(
+		"apiVersion", apiVersion,
+		"kind", kind,
+		"metadata", metadata,
+		"spec", spec,
+	)
+}
+
+// writeDocuments writes objects to w as a multi-document YAML stream,
+// starting with comment.
+func writeDocuments(w io.Writer, comment string, objects []*yaml.Node) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for i, o := range objects {
+		doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{o}}
+		if i == 0 {
+			doc.HeadComment = comment
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
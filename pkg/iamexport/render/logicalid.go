@@ -0,0 +1,169 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/internal/shorthash"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxLogicalIDLen is the longest logical ID CloudFormation accepts.
+const maxLogicalIDLen = 255
+
+// letterFolds covers letters that have no Unicode decomposition into a
+// base ASCII letter.
+var letterFolds = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'þ': "th", 'Þ': "TH", 'ı': "i",
+}
+
+// transliterate reduces accented letters to their ASCII base letter, e.g.
+// "Überprüfung" becomes "Uberprufung". Other runes are left as they are.
+func transliterate(s string) string {
+	b := strings.Builder{}
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if f, ok := letterFolds[r]; ok {
+			b.WriteString(f)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// sanitize converts an IAM name into a valid CloudFormation logical ID,
+// which may only contain ASCII letters and digits. Any other character is
+// treated as a word separator and the words are joined in CamelCase, so
+// "my-role.prod" becomes "MyRoleProd". Names that are already valid are
+// returned unchanged.
+func sanitize(n string) string {
+	words := strings.FieldsFunc(transliterate(n), func(r rune) bool {
+		return !isAlnum(r)
+	})
+
+	b := strings.Builder{}
+	for _, w := range words {
+		if len(words) == 1 && w == n {
+			b.WriteString(w)
+			break
+		}
+		b.WriteString(strings.ToUpper(w[:1]))
+		b.WriteString(w[1:])
+	}
+
+	id := b.String()
+	if id == "" {
+		return "Resource" + shorthash.Sum(n)
+	}
+	if id[0] >= '0' && id[0] <= '9' {
+		id = "Resource" + id
+	}
+	if len(id) > maxLogicalIDLen {
+		id = id[:maxLogicalIDLen-shorthash.Len] + shorthash.Sum(n)
+	}
+	return id
+}
+
+// LogicalIDs hands out unique CloudFormation logical IDs for a single
+// template. Names are sanitized first; when two names sanitize to the same
+// ID, the later one gets a hash of its original name appended. IDs pinned
+// by a previous run's mapping always take precedence.
+type LogicalIDs struct {
+	used   map[string]string
+	pinned map[string]string
+	// claimed maps the pinned IDs handed out to the resource they were
+	// handed out to.
+	claimed map[string]string
+	entries []MappingEntry
+}
+
+// NewLogicalIDs returns an allocator that reuses the logical IDs recorded in
+// pinned, matching resources by ARN or, when no ARN was recorded, by type
+// and name. Entries with neither only keep their logical ID from being
+// allocated.
+func NewLogicalIDs(pinned []MappingEntry) *LogicalIDs {
+	l := &LogicalIDs{
+		used:    map[string]string{},
+		pinned:  map[string]string{},
+		claimed: map[string]string{},
+	}
+	for _, e := range pinned {
+		switch {
+		case e.Arn != "":
+			l.pinned[e.Arn] = e.LogicalID
+		case e.Name != "":
+			l.pinned[e.Type+" "+e.Name] = e.LogicalID
+		}
+		l.used[e.LogicalID] = e.Type + " " + e.Name
+	}
+	return l
+}
+
+// Allocate returns the logical ID for the resource of type typ with the
+// given name and ARN, and records it for Entries.
+func (l *LogicalIDs) Allocate(typ, name, arn string) (string, error) {
+	id, err := l.lookup(typ, name, arn)
+	if err != nil {
+		return "", err
+	}
+	l.entries = append(l.entries, MappingEntry{
+		LogicalID: id,
+		Type:      typ,
+		Name:      name,
+		Arn:       arn,
+	})
+	return id, nil
+}
+
+func (l *LogicalIDs) lookup(typ, name, arn string) (string, error) {
+	key := typ + " " + name
+	id, ok := l.pinned[arn]
+	if !ok || arn == "" {
+		id, ok = l.pinned[key]
+	}
+	if ok {
+		// Two resources can not share a pinned ID, e.g. when a mapping
+		// pins the same ID for several resources.
+		if owner, ok := l.claimed[id]; ok {
+			return "", fmt.Errorf("cannot use the pinned logical ID %s for %q: it is already used by %q", id, name, owner)
+		}
+		l.claimed[id] = key
+		return id, nil
+	}
+
+	id = sanitize(name)
+	if owner, ok := l.used[id]; ok {
+		if owner == key {
+			return "", fmt.Errorf("duplicate resource name %q", name)
+		}
+		if len(id) > maxLogicalIDLen-shorthash.Len {
+			id = id[:maxLogicalIDLen-shorthash.Len]
+		}
+		base := id
+		id = base + shorthash.Sum(name)
+		if _, ok := l.used[id]; ok {
+			// Resources of different types, such as a user and its MFA
+			// device, often share a name.
+			id = base + shorthash.Sum(key)
+		}
+		if owner, ok := l.used[id]; ok {
+			return "", fmt.Errorf("cannot allocate a unique logical ID for %q: %s is already used by %q", name, id, owner)
+		}
+	}
+	l.used[id] = key
+	return id, nil
+}
+
+// Entries returns the mapping of every logical ID allocated so far.
+func (l *LogicalIDs) Entries() []MappingEntry {
+	return l.entries
+}
@@ -0,0 +1,122 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/internal/shorthash"
+)
+
+func TestSanitize(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"AppRole", "AppRole"},
+		{"my.role", "MyRole"},
+		{"my-role.prod", "MyRoleProd"},
+		{"user@example.com", "UserExampleCom"},
+		{"a+b", "AB"},
+		{"deploy+ci@corp", "DeployCiCorp"},
+		{"1role", "Resource1role"},
+		{"123", "Resource123"},
+		{"2-factor", "Resource2Factor"},
+		{"Überprüfung", "Uberprufung"},
+		{"straße-team", "StrasseTeam"},
+		{"łódź", "Lodz"},
+		{long, long[:maxLogicalIDLen-shorthash.Len] + shorthash.Sum(long)},
+		{"日本", "Resource" + shorthash.Sum("日本")},
+		{"---", "Resource" + shorthash.Sum("---")},
+		{"@", "Resource" + shorthash.Sum("@")},
+	}
+	for _, tt := range tests {
+		got := sanitize(tt.name)
+		if got != tt.want {
+			t.Errorf("sanitize(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if len(got) > maxLogicalIDLen {
+			t.Errorf("sanitize(%q) is %d characters, above %d", tt.name, len(got), maxLogicalIDLen)
+		}
+		for _, r := range got {
+			if !isAlnum(r) {
+				t.Errorf("sanitize(%q) = %q, which has the invalid character %q", tt.name, got, r)
+				break
+			}
+		}
+	}
+}
+
+func TestSanitizeCapKeepsLongNamesApart(t *testing.T) {
+	a, b := strings.Repeat("x", 300)+"a", strings.Repeat("x", 300)+"b"
+	if sanitize(a) == sanitize(b) {
+		t.Errorf("sanitize(%q) and sanitize(%q) are both %q", a, b, sanitize(a))
+	}
+}
+
+func TestLogicalIDsCollisions(t *testing.T) {
+	ids := NewLogicalIDs(nil)
+	seen := map[string]string{}
+	for _, r := range []struct{ typ, name string }{
+		{"AWS::IAM::Role", "my-role"},
+		{"AWS::IAM::Role", "my_role"},
+		{"AWS::IAM::Role", "MyRole"},
+		{"AWS::IAM::ManagedPolicy", "my-role"},
+		{"AWS::IAM::User", "alice"},
+		{"AWS::IAM::VirtualMFADevice", "alice"},
+	} {
+		id, err := ids.Allocate(r.typ, r.name, "")
+		if err != nil {
+			t.Fatalf("Allocate(%s, %q): %v", r.typ, r.name, err)
+		}
+		if owner, ok := seen[id]; ok {
+			t.Errorf("%s %q got the logical ID %s of %s", r.typ, r.name, id, owner)
+		}
+		seen[id] = r.typ + " " + r.name
+	}
+	if _, err := ids.Allocate("AWS::IAM::Role", "my-role", ""); err == nil {
+		t.Error("allocating the same role twice did not fail")
+	}
+}
+
+func TestLogicalIDsPinned(t *testing.T) {
+	ids := NewLogicalIDs([]MappingEntry{
+		{LogicalID: "LegacyRole", Type: "AWS::IAM::Role", Name: "app", Arn: "arn:aws:iam::123456789012:role/app"},
+		{LogicalID: "AppPolicy", Type: "AWS::IAM::ManagedPolicy", Name: "app"},
+		{LogicalID: "Reserved"},
+	})
+	tests := []struct {
+		typ, name, arn string
+		want           string
+	}{
+		// Pinned by ARN, whatever the name.
+		{"AWS::IAM::Role", "app-renamed", "arn:aws:iam::123456789012:role/app", "LegacyRole"},
+		// Pinned by type and name.
+		{"AWS::IAM::ManagedPolicy", "app", "", "AppPolicy"},
+		// A user of the same name is not pinned.
+		{"AWS::IAM::User", "app", "", "app"},
+		{"AWS::IAM::Group", "Reserved", "", "Reserved" + shorthash.Sum("Reserved")},
+	}
+	for _, tt := range tests {
+		got, err := ids.Allocate(tt.typ, tt.name, tt.arn)
+		if err != nil {
+			t.Fatalf("Allocate(%s, %q): %v", tt.typ, tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("Allocate(%s, %q) = %s, want %s", tt.typ, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLogicalIDsPinnedOnce(t *testing.T) {
+	ids := NewLogicalIDs([]MappingEntry{
+		{LogicalID: "App", Type: "AWS::IAM::Role", Name: "app", Arn: "arn:aws:iam::123456789012:role/app"},
+		{LogicalID: "App", Type: "AWS::IAM::ManagedPolicy", Name: "app"},
+	})
+	if _, err := ids.Allocate("AWS::IAM::Role", "app", "arn:aws:iam::123456789012:role/app"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := ids.Allocate("AWS::IAM::ManagedPolicy", "app", ""); err == nil {
+		t.Errorf("the policy got the logical ID %s pinned for the role too", id)
+	}
+}
@@ -0,0 +1,89 @@
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MappingEntry records which IAM resource a logical ID was generated for.
+type MappingEntry struct {
+	LogicalID string `json:"logicalId"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Arn       string `json:"arn,omitempty"`
+}
+
+var mappingHeader = []string{"logicalId", "type", "name", "arn"}
+
+func isCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// ReadMapping loads a mapping file written by WriteMapping. Files ending in
+// .csv are read as CSV, anything else as JSON.
+func ReadMapping(path string) ([]MappingEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []MappingEntry
+	if !isCSV(path) {
+		if err := json.NewDecoder(f).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("reading mapping %s: %w", path, err)
+		}
+		return entries, nil
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = len(mappingHeader)
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading mapping %s: %w", path, err)
+	}
+	for i, rec := range records {
+		if i == 0 && rec[0] == mappingHeader[0] {
+			continue
+		}
+		entries = append(entries, MappingEntry{
+			LogicalID: rec[0],
+			Type:      rec[1],
+			Name:      rec[2],
+			Arn:       rec[3],
+		})
+	}
+	return entries, nil
+}
+
+// WriteMapping writes entries to path as CSV or JSON, depending on the
+// file extension.
+func WriteMapping(path string, entries []MappingEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if isCSV(path) {
+		w := csv.NewWriter(f)
+		_ = w.Write(mappingHeader)
+		for _, e := range entries {
+			_ = w.Write([]string{e.LogicalID, e.Type, e.Name, e.Arn})
+		}
+		w.Flush()
+		err = w.Error()
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
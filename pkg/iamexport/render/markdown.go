@@ -0,0 +1,203 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/policy"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// MarkdownDoc is one of the files written by Markdown.
+type MarkdownDoc struct {
+	// Path is relative to the documentation directory, e.g.
+	// roles/app-role.md.
+	Path    string
+	Content []byte
+}
+
+// markdownCell escapes s for a table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// markdownCode returns values as code spans separated by line breaks.
+func markdownCode(values []string) string {
+	var l []string
+	for _, v := range values {
+		l = append(l, "`"+markdownCell(v)+"`")
+	}
+	return strings.Join(l, "<br>")
+}
+
+func markdownConditions(c map[string]map[string][]string) string {
+	var l []string
+	for op, keys := range c {
+		for key, values := range keys {
+			l = append(l, fmt.Sprintf("%s `%s`: %s", op, markdownCell(key), markdownCode(values)))
+		}
+	}
+	sort.Strings(l)
+	return strings.Join(l, "<br>")
+}
+
+// markdownStatements writes the statements of doc as a table. Trust
+// policies have a Principal column instead of the Resource column.
+func markdownStatements(b *bytes.Buffer, doc string, trust bool) error {
+	statements, err := policy.Parse(doc)
+	if err != nil {
+		return err
+	}
+	if trust {
+		b.WriteString("| Sid | Effect | Action | Principal | Condition |\n| --- | --- | --- | --- | --- |\n")
+	} else {
+		b.WriteString("| Sid | Effect | Action | Resource | Condition |\n| --- | --- | --- | --- | --- |\n")
+	}
+	for _, s := range statements {
+		action := markdownCode(s.Action)
+		if len(s.NotAction) > 0 {
+			action = "**Not** " + markdownCode(s.NotAction)
+		}
+		target := markdownCode(s.Resource)
+		if len(s.NotResource) > 0 {
+			target = "**Not** " + markdownCode(s.NotResource)
+		}
+		if trust {
+			target = markdownCode(policy.Principals(s.Principal))
+			if len(s.NotPrincipal) > 0 {
+				target = "**Not** " + markdownCode(policy.Principals(s.NotPrincipal))
+			}
+		}
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s |\n",
+			markdownCell(s.Sid), s.Effect, action, target, markdownConditions(s.Condition))
+	}
+	return nil
+}
+
+// markdownProperties writes the properties of a resource as a table,
+// leaving out empty values.
+func markdownProperties(b *bytes.Buffer, kv ...string) {
+	b.WriteString("| Property | Value |\n| --- | --- |\n")
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			fmt.Fprintf(b, "| %s | %s |\n", kv[i], kv[i+1])
+		}
+	}
+}
+
+func markdownTags(tags []types.Tag) string {
+	var l []string
+	for _, t := range tags {
+		l = append(l, "`"+markdownCell(*t.Key)+"`: "+markdownCell(*t.Value))
+	}
+	sort.Strings(l)
+	return strings.Join(l, "<br>")
+}
+
+// markdownDescription writes the description of a resource, if any.
+func markdownDescription(b *bytes.Buffer, description *string) {
+	if description != nil && *description != "" {
+		b.WriteString("\n" + *description + "\n")
+	}
+	b.WriteString("\n")
+}
+
+// Markdown documents every role and managed policy in set in a Markdown
+// file of its own, with an index listing them. Statements of trust,
+// inline and managed policies are written as tables, and attached policies
+// link to their documentation when they are part of set.
+func Markdown(set *model.ResourceSet) ([]MarkdownDoc, error) {
+	var docs []MarkdownDoc
+	index := bytes.Buffer{}
+	index.WriteString("# IAM resources\n\nGenerated by iam-cf-generator.\n")
+
+	policyDocs := map[string]string{}
+	for _, p := range set.Policies {
+		policyDocs[*p.Arn] = "policies/" + *p.Name + ".md"
+	}
+	attachedTo := map[string][]string{}
+
+	if len(set.Roles) > 0 {
+		index.WriteString("\n## Roles\n\n")
+	}
+	for _, r := range set.Roles {
+		path := "roles/" + *r.Name + ".md"
+		fmt.Fprintf(&index, "- [%s](%s)\n", *r.Name, path)
+
+		b := bytes.Buffer{}
+		fmt.Fprintf(&b, "# Role %s\n", *r.Name)
+		markdownDescription(&b, r.Description)
+		maxSession := ""
+		if r.MaxSessionDuration != 0 {
+			maxSession = fmt.Sprintf("%d seconds", r.MaxSessionDuration)
+		}
+		markdownProperties(&b,
+			"ARN", "`"+*r.Arn+"`",
+			"Path", "`"+pathOf(r.Path)+"`",
+			"Created", htmlDate(r.CreateDate),
+			"Maximum session duration", maxSession,
+			"Tags", markdownTags(r.Tags),
+		)
+
+		b.WriteString("\n## Trust relationships\n\n")
+		if err := markdownStatements(&b, htmlString(r.AssumeRolePolicyDocument), true); err != nil {
+			return nil, fmt.Errorf("role %s: trust policy: %w", *r.Name, err)
+		}
+
+		if len(r.ManagedPolicyArns) > 0 {
+			b.WriteString("\n## Managed policies\n\n")
+		}
+		for _, arn := range r.ManagedPolicyArns {
+			attachedTo[arn] = append(attachedTo[arn], fmt.Sprintf("[%s](../%s)", *r.Name, path))
+			if doc, ok := policyDocs[arn]; ok {
+				fmt.Fprintf(&b, "- [%s](../%s)\n", policyName(arn), doc)
+				continue
+			}
+			fmt.Fprintf(&b, "- `%s`\n", arn)
+		}
+
+		if len(r.Policies) > 0 {
+			b.WriteString("\n## Inline policies\n")
+		}
+		for _, p := range r.Policies {
+			fmt.Fprintf(&b, "\n### %s\n\n", *p.Name)
+			if err := markdownStatements(&b, *p.PolicyDocument, false); err != nil {
+				return nil, fmt.Errorf("role %s: policy %s: %w", *r.Name, *p.Name, err)
+			}
+		}
+		docs = append(docs, MarkdownDoc{Path: path, Content: b.Bytes()})
+	}
+
+	if len(set.Policies) > 0 {
+		index.WriteString("\n## Managed policies\n\n")
+	}
+	for _, p := range set.Policies {
+		path := policyDocs[*p.Arn]
+		fmt.Fprintf(&index, "- [%s](%s)\n", *p.Name, path)
+
+		b := bytes.Buffer{}
+		fmt.Fprintf(&b, "# Managed policy %s\n", *p.Name)
+		markdownDescription(&b, p.Description)
+		markdownProperties(&b,
+			"ARN", "`"+*p.Arn+"`",
+			"Path", "`"+pathOf(p.Path)+"`",
+			"Created", htmlDate(p.CreateDate),
+			"Attachments", fmt.Sprint(p.AttachmentCount),
+			"Tags", markdownTags(p.Tags),
+		)
+		if roles := attachedTo[*p.Arn]; len(roles) > 0 {
+			b.WriteString("\n## Attached to roles\n\n- " + strings.Join(roles, "\n- ") + "\n")
+		}
+		b.WriteString("\n## Statements\n\n")
+		if err := markdownStatements(&b, *p.PolicyDocument, false); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+		docs = append(docs, MarkdownDoc{Path: path, Content: b.Bytes()})
+	}
+
+	return append([]MarkdownDoc{{Path: "README.md", Content: index.Bytes()}}, docs...), nil
+}
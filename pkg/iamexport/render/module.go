@@ -0,0 +1,102 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// moduleSections are the sections of a template a module fragment keeps.
+var moduleSections = map[string]bool{
+	"Parameters": true,
+	"Resources":  true,
+}
+
+// Module returns the fragment and schema of a CloudFormation module of
+// type typeName, e.g. MyOrg::IAM::Roles::MODULE, from template: the
+// fragment is template with only its parameters and resources, and the
+// schema the one the CloudFormation CLI generates from the fragment when
+// submitting the module to the registry.
+func Module(template []byte, typeName string) (fragment, schema []byte, err error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(template, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("empty template")
+	}
+	top := doc.Content[0]
+	var content []*yaml.Node
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		if moduleSections[top.Content[i].Value] {
+			content = append(content, top.Content[i], top.Content[i+1])
+		}
+	}
+	top.Content = content
+
+	b := bytes.Buffer{}
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	var sections struct {
+		Parameters map[string]struct {
+			Description string `yaml:"Description"`
+		} `yaml:"Parameters"`
+		Resources map[string]struct {
+			Type string `yaml:"Type"`
+		} `yaml:"Resources"`
+	}
+	if err := doc.Decode(&sections); err != nil {
+		return nil, nil, err
+	}
+	params := map[string]interface{}{}
+	for name, p := range sections.Parameters {
+		params[name] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Type":        map[string]string{"type": "string"},
+				"Description": map[string]string{"type": "string"},
+			},
+			"required":    []string{"Type", "Description"},
+			"description": p.Description,
+		}
+	}
+	resources := map[string]interface{}{}
+	for id, r := range sections.Resources {
+		resources[id] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Type":       map[string]string{"type": "string", "const": r.Type},
+				"Properties": map[string]string{"type": "object"},
+			},
+		}
+	}
+	properties := map[string]interface{}{
+		"Resources": map[string]interface{}{"type": "object", "properties": resources},
+	}
+	if len(params) > 0 {
+		properties["Parameters"] = map[string]interface{}{
+			"type":        "object",
+			"properties":  params,
+			"description": "Parameters of the module",
+		}
+	}
+	schema, err = json.MarshalIndent(map[string]interface{}{
+		"typeName":             typeName,
+		"description":          "Schema for Module Fragment of type " + typeName,
+		"properties":           properties,
+		"additionalProperties": true,
+	}, "", "    ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.Bytes(), append(schema, '\n'), nil
+}
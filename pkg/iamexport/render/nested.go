@@ -0,0 +1,553 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/internal/shorthash"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// NestedStack is one of the templates written by Split.
+type NestedStack struct {
+	// Name identifies the stack, e.g. Policies. Its logical ID in the root
+	// template is Name followed by "Stack".
+	Name     string
+	Template []byte
+
+	// parameters are the parameters of Template, including those in
+	// external, which maps resources of other stacks, keyed by
+	// externalKey, to the parameter passing them in. outputs maps the
+	// resources of this stack to the outputs holding their ARN or name.
+	parameters []parameter
+	external   map[string]string
+	outputs    map[string]string
+	intrinsics intrinsics
+}
+
+// reference is a resource written to one stack and used in another.
+type reference struct {
+	kind string
+	key  string
+}
+
+// externalKey identifies a managed policy by ARN, or a group or user by
+// name, in Options.external.
+func externalKey(kind, id string) string {
+	return kind + " " + id
+}
+
+func sortedKeys(m map[string]parameter) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pathOf returns the IAM path of p, treating a missing one as "/".
+func pathOf(p *string) string {
+	if p == nil || *p == "" {
+		return "/"
+	}
+	return *p
+}
+
+// policyName returns the name of the managed policy arn.
+func policyName(arn string) string {
+	return arn[strings.LastIndexByte(arn, '/')+1:]
+}
+
+// firstRole returns the name of the role of the instance profile p, or ""
+// when it has none.
+func firstRole(p model.InstanceProfileResource) string {
+	if len(p.Roles) == 0 {
+		return ""
+	}
+	return p.Roles[0]
+}
+
+// splitByType returns one resource set per resource type, in the order
+// they refer to each other. Instance profiles go with the roles.
+func splitByType(set *model.ResourceSet) ([]string, map[string]*model.ResourceSet) {
+	parts := map[string]*model.ResourceSet{
+		"Policies":           {Policies: set.Policies},
+		"Groups":             {Groups: set.Groups},
+		"Users":              {Users: set.Users},
+		"Providers":          {Providers: set.Providers},
+		"Roles":              {Roles: set.Roles, InstanceProfiles: set.InstanceProfiles},
+		"ServerCertificates": {ServerCertificates: set.ServerCertificates},
+		"VirtualMFADevices":  {VirtualMFADevices: set.VirtualMFADevices},
+		"PermissionSets":     {PermissionSets: set.PermissionSets},
+		"Account":            {Account: set.Account},
+	}
+	names := []string{"Policies", "Groups", "Users", "Providers", "Roles", "ServerCertificates", "VirtualMFADevices", "PermissionSets", "Account"}
+	return names, parts
+}
+
+// policyStackParameter is the parameter of the template of Split "exports"
+// importing the managed policies, naming the stack exporting them.
+const policyStackParameter = "PolicyStackName"
+
+// splitByExports returns the managed policies, and the other resources
+// importing them from the exports of their stack.
+func splitByExports(set *model.ResourceSet) ([]string, map[string]*model.ResourceSet) {
+	identities := *set
+	identities.Policies = nil
+	parts := map[string]*model.ResourceSet{
+		"Policies":   {Policies: set.Policies},
+		"Identities": &identities,
+	}
+	return []string{"Policies", "Identities"}, parts
+}
+
+// splitByPath returns one resource set per IAM path. Instance profiles go
+// with their role. Identity providers, permission sets and the account
+// settings, which have no path, go with the resources under /.
+func splitByPath(set *model.ResourceSet) ([]string, map[string]*model.ResourceSet) {
+	parts := map[string]*model.ResourceSet{}
+	part := func(path *string) *model.ResourceSet {
+		p := strings.Trim(pathOf(path), "/")
+		if parts[p] == nil {
+			parts[p] = &model.ResourceSet{}
+		}
+		return parts[p]
+	}
+
+	for _, p := range set.Policies {
+		s := part(p.Path)
+		s.Policies = append(s.Policies, p)
+	}
+	for _, g := range set.Groups {
+		s := part(g.Path)
+		s.Groups = append(s.Groups, g)
+	}
+	for _, u := range set.Users {
+		s := part(u.Path)
+		s.Users = append(s.Users, u)
+	}
+	roles := map[string]*model.ResourceSet{}
+	for _, r := range set.Roles {
+		s := part(r.Path)
+		s.Roles = append(s.Roles, r)
+		roles[*r.Name] = s
+	}
+	for _, p := range set.InstanceProfiles {
+		s := roles[firstRole(p)]
+		if s == nil {
+			s = part(p.Path)
+		}
+		s.InstanceProfiles = append(s.InstanceProfiles, p)
+	}
+	for _, c := range set.ServerCertificates {
+		s := part(c.Path)
+		s.ServerCertificates = append(s.ServerCertificates, c)
+	}
+	for _, d := range set.VirtualMFADevices {
+		s := part(d.Path)
+		s.VirtualMFADevices = append(s.VirtualMFADevices, d)
+	}
+	if len(set.Providers) > 0 || len(set.PermissionSets) > 0 || set.Account != nil {
+		s := part(nil)
+		s.Providers = set.Providers
+		s.PermissionSets = set.PermissionSets
+		s.Account = set.Account
+	}
+
+	return nameParts(parts)
+}
+
+// nameParts names the resource sets of parts, keyed by path or tag value,
+// after their key, sanitized, or Default for "". Keys whose names only
+// differ in case from those of other keys, e.g. team-a and team_a, get a
+// hash of the key appended, so that every key has a stack of its own,
+// whatever order the resources are in. The names are returned sorted.
+func nameParts(parts map[string]*model.ResourceSet) ([]string, map[string]*model.ResourceSet) {
+	name := func(key string) string {
+		if key == "" {
+			return "Default"
+		}
+		return sanitize(key)
+	}
+	keys := map[string]int{}
+	for key := range parts {
+		keys[strings.ToLower(name(key))]++
+	}
+	named := map[string]*model.ResourceSet{}
+	var names []string
+	for key, set := range parts {
+		n := name(key)
+		if keys[strings.ToLower(n)] > 1 && key != "" {
+			n += shorthash.Sum(key)
+		}
+		named[n] = set
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, named
+}
+
+// isEmpty reports whether set has no resources.
+func isEmpty(set *model.ResourceSet) bool {
+	return len(set.Policies) == 0 && len(set.Groups) == 0 && len(set.Users) == 0 &&
+		len(set.Roles) == 0 && len(set.ServerCertificates) == 0 && len(set.VirtualMFADevices) == 0 &&
+		len(set.InstanceProfiles) == 0 && len(set.Providers) == 0 &&
+		len(set.PermissionSets) == 0 && set.Account == nil
+}
+
+// references returns the managed policies, groups and users that resources
+// in set refer to, keyed by externalKey.
+func references(set *model.ResourceSet) map[string]reference {
+	refs := map[string]reference{}
+	add := func(kind, id string) {
+		refs[externalKey(kind, id)] = reference{kind: kind, key: id}
+	}
+	for _, g := range set.Groups {
+		for _, arn := range g.ManagedPolicyArns {
+			add("policy", arn)
+		}
+	}
+	for _, r := range set.Roles {
+		for _, arn := range r.ManagedPolicyArns {
+			add("policy", arn)
+		}
+		if r.PermissionsBoundary != nil {
+			add("policy", *r.PermissionsBoundary)
+		}
+	}
+	for _, u := range set.Users {
+		for _, arn := range u.ManagedPolicyArns {
+			add("policy", arn)
+		}
+		if u.PermissionsBoundary != nil {
+			add("policy", *u.PermissionsBoundary)
+		}
+		for _, g := range u.Groups {
+			add("group", g)
+		}
+	}
+	for _, d := range set.VirtualMFADevices {
+		for _, u := range d.Users {
+			add("user", u)
+		}
+	}
+	return refs
+}
+
+// owned returns the keys of the resources of set that other stacks may
+// refer to.
+func owned(set *model.ResourceSet) []string {
+	var keys []string
+	for _, p := range set.Policies {
+		keys = append(keys, externalKey("policy", *p.Arn))
+	}
+	for _, g := range set.Groups {
+		keys = append(keys, externalKey("group", *g.Name))
+	}
+	for _, u := range set.Users {
+		keys = append(keys, externalKey("user", *u.Name))
+	}
+	return keys
+}
+
+// splitByTag returns one resource set per value of the tag key, e.g. one
+// per team. Instance profiles go with their role. Resources without the
+// tag, groups, which can not be tagged, and the account settings go in
+// Default.
+func splitByTag(set *model.ResourceSet, key string) ([]string, map[string]*model.ResourceSet) {
+	parts := map[string]*model.ResourceSet{}
+	part := func(tags []types.Tag) *model.ResourceSet {
+		v := ""
+		for _, t := range tags {
+			if aws.ToString(t.Key) == key {
+				v = aws.ToString(t.Value)
+			}
+		}
+		if parts[v] == nil {
+			parts[v] = &model.ResourceSet{}
+		}
+		return parts[v]
+	}
+
+	for _, p := range set.Policies {
+		s := part(p.Tags)
+		s.Policies = append(s.Policies, p)
+	}
+	for _, g := range set.Groups {
+		s := part(nil)
+		s.Groups = append(s.Groups, g)
+	}
+	for _, u := range set.Users {
+		s := part(u.Tags)
+		s.Users = append(s.Users, u)
+	}
+	roles := map[string]*model.ResourceSet{}
+	for _, r := range set.Roles {
+		s := part(r.Tags)
+		s.Roles = append(s.Roles, r)
+		roles[*r.Name] = s
+	}
+	for _, p := range set.InstanceProfiles {
+		s := roles[firstRole(p)]
+		if s == nil {
+			s = part(nil)
+		}
+		s.InstanceProfiles = append(s.InstanceProfiles, p)
+	}
+	for _, c := range set.ServerCertificates {
+		s := part(c.Tags)
+		s.ServerCertificates = append(s.ServerCertificates, c)
+	}
+	for _, d := range set.VirtualMFADevices {
+		s := part(d.Tags)
+		s.VirtualMFADevices = append(s.VirtualMFADevices, d)
+	}
+	for _, p := range set.Providers {
+		s := part(p.Tags)
+		s.Providers = append(s.Providers, p)
+	}
+	for _, ps := range set.PermissionSets {
+		s := part(ps.Tags)
+		s.PermissionSets = append(s.PermissionSets, ps)
+	}
+	if set.Account != nil {
+		part(nil).Account = set.Account
+	}
+
+	return nameParts(parts)
+}
+
+// Split renders set as separate templates for nested stacks, one per
+// resource type when by is "type", one per IAM path when by is "path", or
+// one per value of the tag key when by is "tag:key".
+// Resources referring to resources of another stack take their ARN or name
+// from a parameter, which Root fills in from the other stack's outputs.
+//
+// When by is "exports", set is rendered as two templates of stacks of
+// their own instead: Policies with the managed policies, exporting their
+// ARNs, and Identities with the other resources, importing them with
+// Fn::ImportValue from the stack named by its PolicyStackName parameter.
+func Split(set *model.ResourceSet, ids *LogicalIDs, opts Options, by string) ([]NestedStack, error) {
+	var names []string
+	var parts map[string]*model.ResourceSet
+	switch {
+	case by == "type":
+		names, parts = splitByType(set)
+	case by == "path":
+		names, parts = splitByPath(set)
+	case by == "exports":
+		names, parts = splitByExports(set)
+	case strings.HasPrefix(by, "tag:") && by != "tag:":
+		names, parts = splitByTag(set, strings.TrimPrefix(by, "tag:"))
+	default:
+		return nil, fmt.Errorf("unsupported split %q", by)
+	}
+
+	owner := map[string]string{}
+	for _, name := range names {
+		for _, key := range owned(parts[name]) {
+			owner[key] = name
+		}
+	}
+
+	// Other stacks read the ARNs and names from the outputs. Only the
+	// policies are imported from the stacks of exports.
+	withOutputs := opts.Outputs
+	opts.Outputs = true
+
+	var stacks []NestedStack
+	usedParams := map[string]bool{}
+	// exported are the outputs of the stacks written so far.
+	exported := map[string]string{}
+	for _, name := range names {
+		part := parts[name]
+		if isEmpty(part) {
+			continue
+		}
+
+		external := map[string]string{}
+		opts.external = map[string]parameter{}
+		opts.imports = map[string]string{}
+		if by == "exports" {
+			opts.Outputs = withOutputs || name == "Policies"
+		}
+		refs := references(part)
+		var keys []string
+		for key := range refs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if o, ok := owner[key]; !ok || o == name {
+				continue
+			}
+			if by == "exports" {
+				opts.imports[key] = exported[key]
+				continue
+			}
+			p := externalParameter(refs[key], usedParams)
+			opts.external[key] = p
+			external[key] = p.Name
+		}
+
+		b := bytes.Buffer{}
+		params, err := write(&b, part, ids, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		outputs := map[string]string{}
+		for _, p := range part.Policies {
+			outputs[externalKey("policy", *p.Arn)] = p.LogicalID + "Arn"
+		}
+		for _, g := range part.Groups {
+			outputs[externalKey("group", *g.Name)] = g.LogicalID + "Name"
+		}
+		for _, u := range part.Users {
+			outputs[externalKey("user", *u.Name)] = u.LogicalID + "Name"
+		}
+		for key, o := range outputs {
+			exported[key] = o
+		}
+
+		stacks = append(stacks, NestedStack{
+			Name:       name,
+			Template:   b.Bytes(),
+			parameters: params,
+			external:   external,
+			outputs:    outputs,
+			intrinsics: intrinsics{long: opts.LongIntrinsics},
+		})
+	}
+	return stacks, nil
+}
+
+// externalParameter returns the parameter passing in the ARN or name of
+// the resource ref refers to, named after it.
+func externalParameter(ref reference, used map[string]bool) parameter {
+	var p parameter
+	switch ref.kind {
+	case "policy":
+		name := policyName(ref.key)
+		p = parameter{Name: sanitize(name) + "PolicyArn", Description: "ARN of managed policy " + name}
+	case "group":
+		p = parameter{Name: sanitize(ref.key) + "GroupName", Description: "Name of group " + ref.key}
+	case "user":
+		p = parameter{Name: sanitize(ref.key) + "UserName", Description: "Name of user " + ref.key}
+	}
+	if used[p.Name] {
+		p.Name += shorthash.Sum(externalKey(ref.kind, ref.key))
+	}
+	used[p.Name] = true
+	return p
+}
+
+// rootStack is a nested stack in the root template.
+type rootStack struct {
+	LogicalID   string
+	TemplateURL string
+	Parameters  []rootParameter
+}
+
+// rootParameter is a parameter passed to a nested stack, either from a
+// parameter of the root template or from an output of another stack.
+type rootParameter struct {
+	Name  string
+	Value string
+}
+
+const rootTmplFmt = `---
+Description: Root stack of the IAM resources exported by iam-cf-generator
+{{- if .Parameters }}
+Parameters:
+{{- range .Parameters }}
+  {{ .Name }}:
+    Type: String
+    Description: {{ quote .Description }}
+    {{- if .Default }}
+    Default: {{ quote .Default }}
+    {{- end }}
+    {{- if .NoEcho }}
+    NoEcho: true
+    {{- end }}
+{{- end }}
+{{- end }}
+Resources:
+{{- range .Stacks }}
+  {{ .LogicalID }}:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: {{ quote .TemplateURL }}
+      {{- if .Parameters }}
+      Parameters:
+      {{- range .Parameters }}
+        {{ .Name }}: {{ .Value }}
+      {{- end }}
+      {{- end }}
+{{- end }}
+`
+
+// Root writes the root template creating every stack in stacks as a nested
+// stack, with the template of each read from the URL in urls under its
+// name. Parameters of the nested stacks, such as passwords, become
+// parameters of the root template, and references between them are passed
+// from the outputs of the stack owning the resource.
+func Root(w io.Writer, stacks []NestedStack, urls map[string]string) error {
+	owner := map[string]string{}
+	outputs := map[string]string{}
+	for _, s := range stacks {
+		for key, o := range s.outputs {
+			owner[key] = s.Name + "Stack"
+			outputs[key] = o
+		}
+	}
+
+	// The root template writes intrinsic functions as the stacks do.
+	var fn intrinsics
+	if len(stacks) > 0 {
+		fn = stacks[0].intrinsics
+	}
+
+	data := struct {
+		Parameters []parameter
+		Stacks     []rootStack
+	}{}
+	// Parameters of Options.Substitutions are passed to every stack.
+	declared := map[string]bool{}
+	for _, s := range stacks {
+		rs := rootStack{LogicalID: s.Name + "Stack", TemplateURL: urls[s.Name]}
+		external := map[string]bool{}
+		for key, p := range s.external {
+			external[p] = true
+			rs.Parameters = append(rs.Parameters, rootParameter{
+				Name:  p,
+				Value: fn.getAtt(owner[key], "Outputs."+outputs[key]),
+			})
+		}
+		for _, p := range s.parameters {
+			if external[p.Name] {
+				continue
+			}
+			if !declared[p.Name] {
+				declared[p.Name] = true
+				data.Parameters = append(data.Parameters, p)
+			}
+			rs.Parameters = append(rs.Parameters, rootParameter{Name: p.Name, Value: fn.ref(p.Name)})
+		}
+		sort.Slice(rs.Parameters, func(i, j int) bool { return rs.Parameters[i].Name < rs.Parameters[j].Name })
+		data.Stacks = append(data.Stacks, rs)
+	}
+
+	tmpl, err := template.New("root").Funcs(template.FuncMap{"quote": quote}).Parse(rootTmplFmt)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
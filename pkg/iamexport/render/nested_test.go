@@ -0,0 +1,110 @@
+package render
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/internal/shorthash"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func sorted(l ...string) []string {
+	sort.Strings(l)
+	return l
+}
+
+func TestSplitByPathKeepsPathsApart(t *testing.T) {
+	role := func(name, path string) model.RoleResource {
+		return model.RoleResource{Name: aws.String(name), Path: aws.String(path)}
+	}
+	set := &model.ResourceSet{Roles: model.RoleResources{
+		role("a", "/"),
+		role("b", "/team-a/"),
+		role("c", "/team_a/"),
+		role("d", "/ops/"),
+		role("e", "/default/"),
+	}}
+	names, parts := splitByPath(set)
+	want := sorted(
+		"Default",
+		"ops",
+		"TeamA"+shorthash.Sum("team-a"),
+		"TeamA"+shorthash.Sum("team_a"),
+		"default"+shorthash.Sum("default"),
+	)
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %v, want %v", names, want)
+	}
+	for _, name := range names {
+		if n := len(parts[name].Roles); n != 1 {
+			t.Errorf("%s has %d roles, want 1", name, n)
+		}
+	}
+}
+
+func TestSplitByTagKeepsValuesApart(t *testing.T) {
+	role := func(name, team string) model.RoleResource {
+		r := model.RoleResource{Name: aws.String(name)}
+		if team != "" {
+			r.Tags = []types.Tag{{Key: aws.String("Team"), Value: aws.String(team)}}
+		}
+		return r
+	}
+	set := &model.ResourceSet{Roles: model.RoleResources{
+		role("a", ""),
+		role("b", "data.eng"),
+		role("c", "data eng"),
+		role("d", "web"),
+		role("e", "web"),
+	}}
+	names, parts := splitByTag(set, "Team")
+	want := sorted(
+		"DataEng"+shorthash.Sum("data eng"),
+		"DataEng"+shorthash.Sum("data.eng"),
+		"Default",
+		"web",
+	)
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %v, want %v", names, want)
+	}
+	if n := len(parts["web"].Roles); n != 2 {
+		t.Errorf("web has %d roles, want 2", n)
+	}
+}
+
+func TestSplitKeepsInstanceProfilesWithTheirRole(t *testing.T) {
+	set := &model.ResourceSet{
+		Roles: model.RoleResources{{
+			Name: aws.String("app"),
+			Path: aws.String("/ci/"),
+			Tags: []types.Tag{{Key: aws.String("Team"), Value: aws.String("web")}},
+		}},
+		InstanceProfiles: model.InstanceProfileResources{
+			{Name: aws.String("app"), Path: aws.String("/"), Roles: []string{"app"}},
+			{Name: aws.String("other"), Path: aws.String("/ops/"), Roles: []string{"other"}},
+		},
+	}
+	for _, split := range []func(*model.ResourceSet) ([]string, map[string]*model.ResourceSet){
+		splitByPath,
+		func(set *model.ResourceSet) ([]string, map[string]*model.ResourceSet) { return splitByTag(set, "Team") },
+	} {
+		_, parts := split(set)
+		for name, part := range parts {
+			for _, p := range part.InstanceProfiles {
+				if *p.Name == "app" && len(part.Roles) != 1 {
+					t.Errorf("the instance profile app is in %s, without its role", name)
+				}
+			}
+		}
+	}
+	names, parts := splitByPath(set)
+	if want := sorted("ci", "ops"); !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %v, want %v", names, want)
+	}
+	if p := parts["ops"].InstanceProfiles; len(p) != 1 || *p[0].Name != "other" {
+		t.Errorf("ops holds the instance profiles %+v, want other under its own path", p)
+	}
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DeployPlan describes how to roll out the stacks of Split: the order to
+// deploy them in, and the parameters passed from one to another.
+type DeployPlan struct {
+	// Root is the template creating the stacks as nested stacks, or "" for
+	// the stacks of exports, which are deployed one at a time.
+	Root string `json:"root,omitempty"`
+	// Stacks are in the order to deploy them in, every stack after those
+	// it depends on.
+	Stacks []PlanStack `json:"stacks"`
+}
+
+// PlanStack is a stack of a DeployPlan.
+type PlanStack struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+	// DependsOn are the stacks whose outputs or exports the stack uses.
+	DependsOn  []string        `json:"dependsOn,omitempty"`
+	Parameters []PlanParameter `json:"parameters,omitempty"`
+}
+
+// PlanParameter is a parameter of a stack of a DeployPlan, and where its
+// value comes from.
+type PlanParameter struct {
+	Name string `json:"name"`
+	// Source is "output" for an output of Stack, "stackName" for the name
+	// of Stack, or "input" for a value to supply on deployment, passed
+	// through the parameter of the same name of the root template when
+	// there is one.
+	Source string `json:"source"`
+	Stack  string `json:"stack,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// Plan returns the deploy plan of stacks, whose templates are at urls
+// keyed by stack name, created by the root template at root, or deployed
+// one at a time when root is "". It fails when stacks depend on each other
+// in a cycle, which CloudFormation rejects.
+func Plan(stacks []NestedStack, urls map[string]string, root string) (*DeployPlan, error) {
+	owner := map[string]string{}
+	outputs := map[string]string{}
+	for _, s := range stacks {
+		for key, o := range s.outputs {
+			owner[key] = s.Name
+			outputs[key] = o
+		}
+	}
+	policyStack := ""
+	if root == "" && len(stacks) > 0 && stacks[0].Name == "Policies" {
+		policyStack = stacks[0].Name
+	}
+
+	planned := map[string]PlanStack{}
+	for _, s := range stacks {
+		ps := PlanStack{Name: s.Name, Template: urls[s.Name]}
+		external := map[string]bool{}
+		deps := map[string]bool{}
+		for key, p := range s.external {
+			external[p] = true
+			deps[owner[key]] = true
+			ps.Parameters = append(ps.Parameters, PlanParameter{Name: p, Source: "output", Stack: owner[key], Output: outputs[key]})
+		}
+		for _, p := range s.parameters {
+			switch {
+			case external[p.Name]:
+			case p.Name == policyStackParameter && policyStack != "":
+				deps[policyStack] = true
+				ps.Parameters = append(ps.Parameters, PlanParameter{Name: p.Name, Source: "stackName", Stack: policyStack})
+			default:
+				ps.Parameters = append(ps.Parameters, PlanParameter{Name: p.Name, Source: "input"})
+			}
+		}
+		for d := range deps {
+			ps.DependsOn = append(ps.DependsOn, d)
+		}
+		sort.Strings(ps.DependsOn)
+		sort.Slice(ps.Parameters, func(i, j int) bool { return ps.Parameters[i].Name < ps.Parameters[j].Name })
+		planned[s.Name] = ps
+	}
+
+	// Stacks keep the order of Split unless they depend on a later one.
+	plan := &DeployPlan{Root: root}
+	done := map[string]bool{}
+	for len(plan.Stacks) < len(stacks) {
+		progress := false
+		for _, s := range stacks {
+			ps := planned[s.Name]
+			if done[ps.Name] || !ready(ps.DependsOn, done) {
+				continue
+			}
+			done[ps.Name] = true
+			plan.Stacks = append(plan.Stacks, ps)
+			progress = true
+			break
+		}
+		if !progress {
+			var cycle []string
+			for _, s := range stacks {
+				if !done[s.Name] {
+					cycle = append(cycle, s.Name)
+				}
+			}
+			return nil, fmt.Errorf("stacks %s depend on each other", strings.Join(cycle, ", "))
+		}
+	}
+	return plan, nil
+}
+
+// ready reports whether every one of deps is done.
+func ready(deps []string, done map[string]bool) bool {
+	for _, d := range deps {
+		if !done[d] {
+			return false
+		}
+	}
+	return true
+}
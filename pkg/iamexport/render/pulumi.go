@@ -0,0 +1,137 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"gopkg.in/yaml.v3"
+)
+
+// pulumiDocument returns a policy document as a Pulumi fn::toJSON
+// expression, keeping it readable in the program.
+func pulumiDocument(doc *string) (*yaml.Node, error) {
+	n, err := documentNode(*doc)
+	if err != nil {
+		return nil, err
+	}
+	return mapping("fn::toJSON", n), nil
+}
+
+// tagMap returns tags as a mapping of key to value.
+func tagMap(tags []types.Tag) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, t := range tags {
+		n.Content = append(n.Content, scalar(*t.Key), scalar(*t.Value))
+	}
+	return n
+}
+
+// pulumiResource appends the resource name of type typ with the given
+// properties to resources. Empty properties are left out.
+func pulumiResource(resources *yaml.Node, name, typ string, props ...interface{}) {
+	resources.Content = append(resources.Content, scalar(name), mapping("type", typ, "properties", optionalMapping(props...)))
+}
+
+// WritePulumi writes the managed policies and roles in set to w as a
+// Pulumi YAML program, with each role's managed policies attached through
+// aws:iam:RolePolicyAttachment resources. The program starts with the
+// `pulumi import` commands adopting every resource. Other resource types are
+// ignored.
+func WritePulumi(w io.Writer, set *model.ResourceSet, ids *LogicalIDs) error {
+	resources := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	var imports []string
+	importCmd := func(typ, name, id string) {
+		imports = append(imports, fmt.Sprintf("pulumi import %s %s %s", typ, name, id))
+	}
+
+	policyRefs := map[string]string{}
+	for i, p := range set.Policies {
+		id, err := ids.Allocate("aws:iam:Policy", *p.Name, *p.Arn)
+		if err != nil {
+			return err
+		}
+		set.Policies[i].LogicalID = id
+		policyRefs[*p.Arn] = id
+
+		doc, err := pulumiDocument(p.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+		pulumiResource(resources, id, "aws:iam:Policy",
+			"name", p.Name,
+			"path", p.Path,
+			"description", p.Description,
+			"policy", doc,
+			"tags", tagMap(p.Tags),
+		)
+		importCmd("aws:iam/policy:Policy", id, *p.Arn)
+	}
+
+	for i, r := range set.Roles {
+		id, err := ids.Allocate("aws:iam:Role", *r.Name, *r.Arn)
+		if err != nil {
+			return err
+		}
+		set.Roles[i].LogicalID = id
+
+		trust, err := pulumiDocument(r.AssumeRolePolicyDocument)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		inline := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, p := range r.Policies {
+			doc, err := pulumiDocument(p.PolicyDocument)
+			if err != nil {
+				return fmt.Errorf("role %s: policy %s: %w", *r.Name, *p.Name, err)
+			}
+			inline.Content = append(inline.Content, mapping("name", *p.Name, "policy", doc))
+		}
+		pulumiResource(resources, id, "aws:iam:Role",
+			"name", r.Name,
+			"path", r.Path,
+			"description", r.Description,
+			"assumeRolePolicy", trust,
+			"maxSessionDuration", optionalInt(r.MaxSessionDuration),
+			"inlinePolicies", inline,
+			"tags", tagMap(r.Tags),
+		)
+		importCmd("aws:iam/role:Role", id, *r.Name)
+
+		for _, arn := range r.ManagedPolicyArns {
+			attachment, err := ids.Allocate("aws:iam:RolePolicyAttachment", *r.Name+"-"+policyName(arn), "")
+			if err != nil {
+				return err
+			}
+			policyArn := arn
+			if ref, ok := policyRefs[arn]; ok {
+				policyArn = "${" + ref + ".arn}"
+			}
+			pulumiResource(resources, attachment, "aws:iam:RolePolicyAttachment",
+				"role", "${"+id+".name}",
+				"policyArn", policyArn,
+			)
+			importCmd("aws:iam/rolePolicyAttachment:RolePolicyAttachment", attachment, *r.Name+"/"+arn)
+		}
+	}
+
+	program := mapping(
+		"name", "iam-cf-generator",
+		"runtime", "yaml",
+		"description", "IAM resources exported by iam-cf-generator",
+		"resources", resources,
+	)
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{program}}
+	if len(imports) > 0 {
+		doc.HeadComment = "Adopt the existing resources into the stack with:\n" + strings.Join(imports, "\n")
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
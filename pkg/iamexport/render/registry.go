@@ -0,0 +1,123 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+)
+
+// Renderer writes a resource set in an output format.
+type Renderer interface {
+	Render(ctx context.Context, set *model.ResourceSet, w io.Writer) error
+}
+
+// RendererFunc is a function implementing Renderer.
+type RendererFunc func(ctx context.Context, set *model.ResourceSet, w io.Writer) error
+
+// Render calls f.
+func (f RendererFunc) Render(ctx context.Context, set *model.ResourceSet, w io.Writer) error {
+	return f(ctx, set, w)
+}
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = map[string]Renderer{}
+)
+
+// Register makes r available as the output format name. It is meant to be
+// called from the init function of the package implementing the format,
+// which may be a plugin, and panics if name is already registered.
+func Register(name string, r Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	if _, ok := renderers[name]; ok {
+		panic(fmt.Sprintf("render: output format %s registered twice", name))
+	}
+	renderers[name] = r
+}
+
+// Lookup returns the renderer of the output format name.
+func Lookup(name string) (Renderer, bool) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	r, ok := renderers[name]
+	return r, ok
+}
+
+// Formats returns the names of the registered output formats, sorted.
+func Formats() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	var names []string
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type contextKey struct{}
+
+// renderContext is the value of contextKey.
+type renderContext struct {
+	ids  *LogicalIDs
+	opts Options
+}
+
+// NewContext returns a copy of ctx carrying the logical IDs and options
+// used by the renderers of formats with logical IDs, such as
+// cloudformation, sam and pulumi.
+func NewContext(ctx context.Context, ids *LogicalIDs, opts Options) context.Context {
+	return context.WithValue(ctx, contextKey{}, renderContext{ids: ids, opts: opts})
+}
+
+// fromContext returns the logical IDs and options carried by ctx, or new
+// logical IDs and the default options when it carries none.
+func fromContext(ctx context.Context) (*LogicalIDs, Options) {
+	if rc, ok := ctx.Value(contextKey{}).(renderContext); ok {
+		return rc.ids, rc.opts
+	}
+	return NewLogicalIDs(nil), Options{}
+}
+
+// writer adapts the writers of formats without logical IDs to Renderer.
+func writer(write func(io.Writer, *model.ResourceSet) error) Renderer {
+	return RendererFunc(func(_ context.Context, set *model.ResourceSet, w io.Writer) error {
+		return write(w, set)
+	})
+}
+
+// inventory returns the renderer of the inventory in format.
+func inventory(format string) Renderer {
+	return writer(func(w io.Writer, set *model.ResourceSet) error {
+		return WriteInventory(w, set, format)
+	})
+}
+
+func init() {
+	Register("cloudformation", RendererFunc(func(ctx context.Context, set *model.ResourceSet, w io.Writer) error {
+		ids, opts := fromContext(ctx)
+		return Write(w, set, ids, opts)
+	}))
+	Register("sam", RendererFunc(func(ctx context.Context, set *model.ResourceSet, w io.Writer) error {
+		ids, _ := fromContext(ctx)
+		return WriteSAM(w, set, ids)
+	}))
+	Register("pulumi", RendererFunc(func(ctx context.Context, set *model.ResourceSet, w io.Writer) error {
+		ids, _ := fromContext(ctx)
+		return WritePulumi(w, set, ids)
+	}))
+	Register("crossplane", writer(WriteCrossplane))
+	Register("ack", writer(WriteACK))
+	Register("ansible", writer(WriteAnsible))
+	Register("cli", writer(WriteCLI))
+	Register("terraform", writer(WriteTerraform))
+	Register("html", writer(WriteHTML))
+	Register("inventory-csv", inventory("csv"))
+	Register("inventory-json", inventory("json"))
+	Register("inventory-ndjson", inventory("ndjson"))
+}
@@ -0,0 +1,1362 @@
+// Package render writes the resource model as a CloudFormation template.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"gopkg.in/yaml.v3"
+)
+
+func indent(s string, indent int) string {
+	lines := strings.Split(s, "\n")
+	spaces := fmt.Sprintf("%*s", indent, " ")
+	lines[0] = spaces + lines[0]
+	return strings.Join(lines, "\n"+spaces)
+}
+
+func trim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// yaml11Bools are the words YAML 1.1 parsers, such as that of
+// CloudFormation, read as booleans, while YAML 1.2 reads them as strings.
+var yaml11Bools = map[string]bool{
+	"y": true, "yes": true, "n": true, "no": true, "on": true, "off": true,
+}
+
+// quote returns s as a YAML string scalar: as is when it reads back as the
+// same string, or double quoted otherwise, e.g. when it contains ": " or
+// " #", starts with a special character, spans several lines or would read
+// as a number or boolean.
+func quote(s string) string {
+	var n yaml.Node
+	if s != "" && !strings.ContainsAny(s, "\n\r\t") && !yaml11Bools[strings.ToLower(s)] &&
+		yaml.Unmarshal([]byte(s), &n) == nil && len(n.Content) == 1 {
+		if v := n.Content[0]; v.Kind == yaml.ScalarNode && v.Style == 0 && v.Tag == "!!str" && v.Value == s {
+			return s
+		}
+	}
+	return doubleQuote(s)
+}
+
+// doubleQuote returns s as a double quoted YAML scalar.
+func doubleQuote(s string) string {
+	// JSON strings are YAML double quoted scalars.
+	b := bytes.Buffer{}
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return fmt.Sprintf("%q", s)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Options control how resources are written to the template.
+type Options struct {
+	// PreserveNames emits the original physical names (RoleName, GroupName,
+	// UserName, ManagedPolicyName, ServerCertificateName,
+	// VirtualMfaDeviceName) instead of letting CloudFormation generate them.
+	PreserveNames bool
+
+	// Outputs adds an Outputs section exporting the ARN of every resource,
+	// so other stacks can import them.
+	Outputs bool
+
+	// Provenance, when set, adds a template Description and Metadata
+	// recording where the resources were exported from, and the original
+	// ARN of every resource.
+	Provenance *Provenance
+
+	// DeletionPolicies sets DeletionPolicy and UpdateReplacePolicy on
+	// resources, keyed by resource type such as AWS::IAM::Role. The entry
+	// under "" applies to types without one of their own.
+	DeletionPolicies map[string]string
+
+	// UnusedSince, when set, marks the roles not assumed since then with a
+	// comment.
+	UnusedSince time.Time
+
+	// SourceComments writes the original ARN, creation date and, for roles,
+	// last use of every resource as comments above it.
+	SourceComments bool
+
+	// StandalonePolicies writes the inline policies of roles, groups and
+	// users as AWS::IAM::RolePolicy, AWS::IAM::GroupPolicy and
+	// AWS::IAM::UserPolicy resources of their own, referring to their
+	// role, group or user, instead of in its Policies property.
+	StandalonePolicies bool
+
+	// PolicyVersions records the versions of managed policies other than
+	// their default one, when fetched, in the Metadata of the policies.
+	PolicyVersions bool
+
+	// AttachFromPolicies writes the attachments of the managed policies of
+	// the template in the Groups, Roles and Users properties of the
+	// policies, instead of in the ManagedPolicyArns of the groups, roles
+	// and users. Policies from outside the template, such as AWS managed
+	// policies, stay in ManagedPolicyArns.
+	AttachFromPolicies bool
+
+	// Comments are written as YAML comments above policy documents, keyed
+	// by the document, e.g. the findings of analyzer.Validate.
+	Comments map[*string][]string
+
+	// Templates override the templates of resource types, keyed by the
+	// names listed in TemplateNames. See ReadTemplates.
+	Templates map[string]string
+
+	// LongIntrinsics writes intrinsic functions in their long form, e.g.
+	// {"Fn::GetAtt": [Role, Arn]}, rather than in the short form YAML
+	// allows, e.g. !GetAtt Role.Arn.
+	LongIntrinsics bool
+
+	// Substitutions replace values such as the name of an environment
+	// with template parameters. See Substitution.
+	Substitutions []Substitution
+
+	// ResourceConditions create the resources keyed by ARN only when the
+	// condition they map to is true, e.g. IsProd. Each condition is read
+	// from a parameter named after it, e.g. CreateIsProd, which defaults
+	// to true. References to the resources are dropped when it is false.
+	ResourceConditions map[string]string
+
+	// TemplateResources are resources of the template the set does not
+	// hold, such as those of a template it is merged into. References to
+	// its managed policies, groups and users are written as references to
+	// their logical IDs, as for the resources of the set.
+	TemplateResources []MappingEntry
+
+	// external maps resources written to other templates, keyed by
+	// externalKey, to the parameters passing in their ARN or name.
+	external map[string]parameter
+
+	// imports maps the managed policies exported by the stack of
+	// policyStackParameter, keyed by externalKey, to the outputs
+	// exporting their ARN.
+	imports map[string]string
+}
+
+// sourceComments returns the comments tracing a resource back to the
+// account: its ARN, when it was created and, for roles, when it was last
+// assumed. Any of them may be nil.
+func sourceComments(arn *string, created, lastUsed *time.Time) []string {
+	var comments []string
+	if arn != nil {
+		comments = append(comments, "Source: "+*arn)
+	}
+	if created != nil {
+		comments = append(comments, "Created: "+created.UTC().Format("2006-01-02"))
+	}
+	if lastUsed != nil {
+		comments = append(comments, "Last used: "+lastUsed.UTC().Format("2006-01-02"))
+	}
+	return comments
+}
+
+// conditionNames returns the names of the conditions of resources, sorted.
+func conditionNames(resources map[string]string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, name := range resources {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// deletionPolicy returns the deletion policy for resources of type typ, or
+// "" when none is set.
+func (o Options) deletionPolicy(typ string) string {
+	if p, ok := o.DeletionPolicies[typ]; ok {
+		return p
+	}
+	return o.DeletionPolicies[""]
+}
+
+// Provenance describes the source of an exported template.
+type Provenance struct {
+	// AccountID is the account the resources were read from. It may be
+	// empty when unknown.
+	AccountID string
+	Generated time.Time
+	Version   string
+}
+
+// parameter is a template parameter supplying a value that can not be
+// exported, such as a password.
+type parameter struct {
+	Name          string
+	Description   string
+	Default       string
+	AllowedValues []string
+	NoEcho        bool
+}
+
+// condition is a template condition.
+type condition struct {
+	Name       string
+	Expression string
+}
+
+// templateData is the value passed to the render template.
+type templateData struct {
+	Options
+	*model.ResourceSet
+	Parameters []parameter
+	Conditions []condition
+	// ResourceEntries and OutputEntries are the resources and outputs
+	// written by their templates, in the order of their logical IDs.
+	ResourceEntries []string
+	OutputEntries   []string
+}
+
+// entry is a resource or output, written by the template name with data as
+// dot.
+type entry struct {
+	logicalID string
+	name      string
+	data      interface{}
+}
+
+// attachment lists the groups, roles and users a managed policy is attached
+// to, as references, with Options.AttachFromPolicies.
+type attachment struct {
+	Groups []string
+	Roles  []string
+	Users  []string
+}
+
+// inlinePolicy is an inline policy written as a resource of its own, with
+// Options.StandalonePolicies.
+type inlinePolicy struct {
+	model.PolicyResource
+	// Type is the resource type, e.g. AWS::IAM::RolePolicy.
+	Type string
+	// ParentProperty names the role, group or user of the policy, e.g.
+	// RoleName, with the logical ID ParentID and the ARN ParentArn.
+	ParentProperty string
+	ParentID       string
+	ParentArn      string
+}
+
+// allocateInlinePolicies sets the logical ID of every inline policy of
+// set, named after its role, group or user and itself, and returns them as
+// resources of their own.
+func allocateInlinePolicies(set *model.ResourceSet, ids *LogicalIDs) ([]inlinePolicy, error) {
+	var l []inlinePolicy
+	add := func(typ, property, parentID string, parentName, parentArn *string, policies model.PolicyResources) error {
+		for i, p := range policies {
+			id, err := ids.Allocate(typ, *parentName+"/"+*p.Name, "")
+			if err != nil {
+				return err
+			}
+			policies[i].LogicalID = id
+			l = append(l, inlinePolicy{
+				PolicyResource: policies[i],
+				Type:           typ,
+				ParentProperty: property,
+				ParentID:       parentID,
+				ParentArn:      aws.ToString(parentArn),
+			})
+		}
+		return nil
+	}
+
+	for _, g := range set.Groups {
+		if err := add("AWS::IAM::GroupPolicy", "GroupName", g.LogicalID, g.Name, g.Arn, g.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range set.Roles {
+		if err := add("AWS::IAM::RolePolicy", "RoleName", r.LogicalID, r.Name, r.Arn, r.Policies); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range set.Users {
+		if err := add("AWS::IAM::UserPolicy", "UserName", u.LogicalID, u.Name, u.Arn, u.Policies); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// executeEntries executes the template of every entry, in the order of their
+// logical IDs, whatever the type of the resource.
+func executeEntries(tmpl *template.Template, entries []entry) ([]string, error) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := strings.ToLower(entries[i].logicalID), strings.ToLower(entries[j].logicalID)
+		if a != b {
+			return a < b
+		}
+		return entries[i].logicalID < entries[j].logicalID
+	})
+	var out []string
+	for _, e := range entries {
+		b := strings.Builder{}
+		if err := tmpl.ExecuteTemplate(&b, e.name, e.data); err != nil {
+			return nil, err
+		}
+		out = append(out, b.String())
+	}
+	return out, nil
+}
+
+// resourceTmpls are the templates of each resource type, named after
+// the resource types given on the command line. Each is executed with the
+// resource as dot, and may be overridden with Options.Templates.
+const resourceTmpls = `{{ define "policies" }}
+  {{- with .UnusedServices }}
+  # Services not accessed recently according to IAM Access Advisor: {{ join . ", " }}
+  {{- end }}
+  {{- range sourceComments .Arn .CreateDate nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::IAM::ManagedPolicy
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::IAM::ManagedPolicy" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if or (and provenance .Arn) .ProposedDocument (and policyVersions .Versions) }}
+    Metadata:
+      {{- if and provenance .Arn }}
+      SourceArn: {{ quote .Arn }}
+      {{- end }}
+      {{- if and .ProposedDocument }}
+      # Proposed to replace the document of the policy, to review.
+      ProposedPolicyDocument:
+{{ document .ProposedDocument 8 }}
+      {{- end }}
+      {{- if and policyVersions .Versions }}
+      # The versions of the policy other than its default, newest first.
+      PolicyVersions:
+      {{- range .Versions }}
+      - VersionId: {{ quote .VersionID }}
+        {{- with .CreateDate }}
+        CreateDate: "{{ .UTC.Format "2006-01-02T15:04:05Z07:00" }}"
+        {{- end }}
+        PolicyDocument:
+{{ document .Document 10 }}
+      {{- end }}
+      {{- end }}
+    {{- end }}
+    Properties:
+      {{- if and .Description }}
+      Description: {{ value .Description }}
+      {{- end }}
+      {{- with (attachments .Arn).Groups }}
+      Groups:
+      {{- range . }}
+      - {{ . }}
+      {{- end }}
+      {{- end }}
+      {{- if preserveNames }}
+      ManagedPolicyName: {{ value .Name }}
+      {{- end }}
+      {{- with path .Path }}
+      Path: {{ . }}
+      {{- end }}
+      PolicyDocument:
+{{ document .PolicyDocument 8 }}
+      {{- with (attachments .Arn).Roles }}
+      Roles:
+      {{- range . }}
+      - {{ . }}
+      {{- end }}
+      {{- end }}
+    {{- if and .Tags }}
+      Tags:
+      {{- range .Tags }}
+      - Key: {{ quote .Key }}
+        Value: {{ value .Value }}
+      {{- end }}
+    {{- end }}
+      {{- with (attachments .Arn).Users }}
+      Users:
+      {{- range . }}
+      - {{ . }}
+      {{- end }}
+      {{- end }}
+{{ end }}
+{{ define "groups" }}
+  {{- range sourceComments .Arn .CreateDate nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::IAM::Group
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::IAM::Group" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if and provenance .Arn }}
+    Metadata:
+      SourceArn: {{ quote .Arn }}
+    {{- end }}
+    Properties:
+      {{- if preserveNames }}
+      GroupName: {{ value .Name }}
+      {{- end }}
+      {{- with managedPolicyArns .ManagedPolicyArns }}
+      ManagedPolicyArns:
+      {{- range . }}
+      - {{ policyArn . }}
+      {{- end }}
+      {{- end }}
+      {{- with path .Path }}
+      Path: {{ . }}
+      {{- end }}
+      {{- if and .Policies (not standalonePolicies) }}
+      Policies:
+      {{- range .Policies }}
+      - PolicyName: {{ value .Name }}
+        PolicyDocument:
+{{ document .PolicyDocument 10 }}
+      {{- end }}
+      {{- end }}
+{{ end }}
+{{ define "roles" }}
+  {{- with unusedRole . }}
+  # {{ . }}
+  {{- end }}
+  {{- with .UnusedServices }}
+  # Services not accessed recently according to IAM Access Advisor: {{ join . ", " }}
+  {{- end }}
+  {{- range sourceComments .Arn .CreateDate .LastUsed }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::IAM::Role
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::IAM::Role" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if or (and provenance .Arn) .ProposedPolicies }}
+    Metadata:
+      {{- if and provenance .Arn }}
+      SourceArn: {{ quote .Arn }}
+      {{- end }}
+      {{- if and .ProposedPolicies }}
+      # Proposed to replace the policies of the role, to review.
+      ProposedPolicies:
+      {{- range .ProposedPolicies }}
+      - PolicyName: {{ value .Name }}
+        PolicyDocument:
+{{ document .PolicyDocument 10 }}
+      {{- end }}
+      {{- end }}
+    {{- end }}
+    Properties:
+      AssumeRolePolicyDocument:
+{{ document .AssumeRolePolicyDocument 8 }}
+      {{- if and .Description }}
+      Description: {{ value .Description }}
+      {{- end }}
+      {{- with managedPolicyArns .ManagedPolicyArns }}
+      ManagedPolicyArns:
+      {{- range . }}
+      - {{ policyArn . }}
+      {{- end }}
+      {{- end }}
+      {{- if and .MaxSessionDuration }}
+      MaxSessionDuration: {{.MaxSessionDuration}}
+      {{- end }}
+      {{- with path .Path }}
+      Path: {{ . }}
+      {{- end }}
+      {{- with .PermissionsBoundary }}
+      PermissionsBoundary: {{ policyArn . }}
+      {{- end }}
+      {{- if preserveNames }}
+      RoleName: {{ value .Name }}
+      {{- end }}
+      {{- if and .Tags }}
+      Tags:
+      {{- range .Tags }}
+      - Key: {{ quote .Key }}
+        Value: {{ value .Value }}
+      {{- end }}
+      {{- end }}
+      {{- if and .Policies (not standalonePolicies) }}
+      Policies:
+      {{- range .Policies }}
+      - PolicyName: {{ value .Name }}
+        PolicyDocument:
+{{ document .PolicyDocument 10 }}
+      {{- end }}
+      {{- end }}
+{{ end }}
+{{ define "users" }}
+  {{- range sourceComments .Arn .CreateDate nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::IAM::User
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::IAM::User" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if and provenance .Arn }}
+    Metadata:
+      SourceArn: {{ quote .Arn }}
+    {{- end }}
+    Properties:
+      {{- if and .Groups }}
+      Groups:
+      {{- range .Groups }}
+      - {{ groupName . }}
+      {{- end }}
+      {{- end }}
+      {{- with .LoginProfile }}
+      LoginProfile:
+        Password: {{ ref (print $.LogicalID "Password") }}
+        PasswordResetRequired: {{ .PasswordResetRequired }}
+      {{- end }}
+      {{- with managedPolicyArns .ManagedPolicyArns }}
+      ManagedPolicyArns:
+      {{- range . }}
+      - {{ policyArn . }}
+      {{- end }}
+      {{- end }}
+      {{- with path .Path }}
+      Path: {{ . }}
+      {{- end }}
+      {{- with .PermissionsBoundary }}
+      PermissionsBoundary: {{ policyArn . }}
+      {{- end }}
+      {{- if and .Policies (not standalonePolicies) }}
+      Policies:
+      {{- range .Policies }}
+      - PolicyName: {{ value .Name }}
+        PolicyDocument:
+{{ document .PolicyDocument 10 }}
+      {{- end }}
+      {{- end }}
+      {{- if and .Tags }}
+      Tags:
+      {{- range .Tags }}
+      - Key: {{ quote .Key }}
+        Value: {{ value .Value }}
+      {{- end }}
+      {{- end }}
+      {{- if preserveNames }}
+      UserName: {{ value .Name }}
+      {{- end }}
+{{ end }}
+{{ define "sso-permission-sets" }}
+  {{- range sourceComments .Arn nil nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::SSO::PermissionSet
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::SSO::PermissionSet" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if and provenance .Arn }}
+    Metadata:
+      SourceArn: {{ quote .Arn }}
+    {{- end }}
+    Properties:
+      {{- if and .Description }}
+      Description: {{ value .Description }}
+      {{- end }}
+      {{- if and .InlinePolicy }}
+      InlinePolicy:
+{{ document .InlinePolicy 8 }}
+      {{- end }}
+      InstanceArn: {{ value .InstanceArn }}
+      {{- if and .ManagedPolicies }}
+      ManagedPolicies:
+      {{- range .ManagedPolicies }}
+      - {{ value . }}
+      {{- end }}
+      {{- end }}
+      Name: {{ value .Name }}
+      {{- if and .RelayState }}
+      RelayStateType: {{ value .RelayState }}
+      {{- end }}
+      {{- if and .SessionDuration }}
+      SessionDuration: {{ quote .SessionDuration }}
+      {{- end }}
+      {{- if and .Tags }}
+      Tags:
+      {{- range .Tags }}
+      - Key: {{ quote .Key }}
+        Value: {{ value .Value }}
+      {{- end }}
+      {{- end }}
+{{ end }}
+{{ define "server-certificates" }}
+  {{- range sourceComments .Arn nil nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::IAM::ServerCertificate
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::IAM::ServerCertificate" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if and provenance .Arn }}
+    Metadata:
+      SourceArn: {{ quote .Arn }}
+    {{- end }}
+    Properties:
+      CertificateBody: |
+{{ indent (trim .CertificateBody) 8 }}
+      {{- if and .CertificateChain }}
+      CertificateChain: |
+{{ indent (trim .CertificateChain) 8 }}
+      {{- end }}
+      {{- with path .Path }}
+      Path: {{ . }}
+      {{- end }}
+      PrivateKey: {{ ref (print $.LogicalID "PrivateKey") }}
+      {{- if preserveNames }}
+      ServerCertificateName: {{ value .Name }}
+      {{- end }}
+      {{- if and .Tags }}
+      Tags:
+      {{- range .Tags }}
+      - Key: {{ quote .Key }}
+        Value: {{ value .Value }}
+      {{- end }}
+      {{- end }}
+{{ end }}
+{{ define "virtual-mfa-devices" }}
+  # The seed of a virtual MFA device can not be exported. A new seed is
+  # generated on creation and the device must be registered again.
+  {{- range sourceComments .Arn nil nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::IAM::VirtualMFADevice
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::IAM::VirtualMFADevice" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if and provenance .Arn }}
+    Metadata:
+      SourceArn: {{ quote .Arn }}
+    {{- end }}
+    Properties:
+      {{- with path .Path }}
+      Path: {{ . }}
+      {{- end }}
+      {{- if and .Tags }}
+      Tags:
+      {{- range .Tags }}
+      - Key: {{ quote .Key }}
+        Value: {{ value .Value }}
+      {{- end }}
+      {{- end }}
+      {{- if and .Users }}
+      Users:
+      {{- range .Users }}
+      - {{ userName . }}
+      {{- end }}
+      {{- else }}
+      Users: []
+      {{- end }}
+      {{- if preserveNames }}
+      VirtualMfaDeviceName: {{ value .Name }}
+      {{- end }}
+{{ end }}
+{{ define "instance-profiles" }}
+  {{- range sourceComments .Arn .CreateDate nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: AWS::IAM::InstanceProfile
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy "AWS::IAM::InstanceProfile" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if and provenance .Arn }}
+    Metadata:
+      SourceArn: {{ quote .Arn }}
+    {{- end }}
+    Properties:
+      {{- if preserveNames }}
+      InstanceProfileName: {{ value .Name }}
+      {{- end }}
+      {{- with path .Path }}
+      Path: {{ . }}
+      {{- end }}
+      {{- if and .Roles }}
+      Roles:
+      {{- range .Roles }}
+      - {{ roleName . }}
+      {{- end }}
+      {{- else }}
+      Roles: []
+      {{- end }}
+{{ end }}
+{{ define "providers" }}
+  {{- $type := "AWS::IAM::SAMLProvider" }}
+  {{- if eq (print .Kind) "oidc" }}
+  {{- $type = "AWS::IAM::OIDCProvider" }}
+  {{- end }}
+  {{- range sourceComments .Arn .CreateDate nil }}
+  # {{ . }}
+  {{- end }}
+  {{ .LogicalID }}:
+    Type: {{ $type }}
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy $type }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    {{- if and provenance .Arn }}
+    Metadata:
+      SourceArn: {{ quote .Arn }}
+    {{- end }}
+    Properties:
+      {{- if and .ClientIDs }}
+      ClientIdList:
+      {{- range .ClientIDs }}
+      - {{ value . }}
+      {{- end }}
+      {{- end }}
+      {{- if and .MetadataDocument }}
+      {{- if preserveNames }}
+      Name: {{ value .Name }}
+      {{- end }}
+      SamlMetadataDocument: |
+{{ indent (trim .MetadataDocument) 8 }}
+      {{- end }}
+      {{- if and .Tags }}
+      Tags:
+      {{- range .Tags }}
+      - Key: {{ quote .Key }}
+        Value: {{ value .Value }}
+      {{- end }}
+      {{- end }}
+      {{- if and .Thumbprints }}
+      ThumbprintList:
+      {{- range .Thumbprints }}
+      - {{ quote . }}
+      {{- end }}
+      {{- end }}
+      {{- if and .URL }}
+      Url: {{ value .URL }}
+      {{- end }}
+{{ end }}
+{{ define "inline-policies" }}
+  {{ .LogicalID }}:
+    Type: {{ .Type }}
+    {{- with condition .ParentArn }}
+    Condition: {{ . }}
+    {{- end }}
+    {{- with deletionPolicy .Type }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    Properties:
+      {{ .ParentProperty }}: {{ ref .ParentID }}
+      PolicyDocument:
+{{ document .PolicyDocument 8 }}
+      PolicyName: {{ value .Name }}
+{{ end }}
+{{ define "account" }}
+{{- with .Alias }}
+  {{ .LogicalID }}:
+    Type: Custom::AccountAlias
+    {{- with deletionPolicy "Custom::AccountAlias" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    Properties:
+      ServiceToken: {{ ref "AccountSettingsServiceToken" }}
+      AccountAlias: {{ value .Name }}
+{{end}}
+{{- with .PasswordPolicy }}
+  {{ .LogicalID }}:
+    Type: Custom::AccountPasswordPolicy
+    {{- with deletionPolicy "Custom::AccountPasswordPolicy" }}
+    DeletionPolicy: {{ . }}
+    UpdateReplacePolicy: {{ . }}
+    {{- end }}
+    Properties:
+      ServiceToken: {{ ref "AccountSettingsServiceToken" }}
+      AllowUsersToChangePassword: {{ .AllowUsersToChangePassword }}
+      {{- with .HardExpiry }}
+      HardExpiry: {{ . }}
+      {{- end }}
+      {{- with .MaxPasswordAge }}
+      MaxPasswordAge: {{ . }}
+      {{- end }}
+      {{- with .MinimumPasswordLength }}
+      MinimumPasswordLength: {{ . }}
+      {{- end }}
+      {{- with .PasswordReusePrevention }}
+      PasswordReusePrevention: {{ . }}
+      {{- end }}
+      RequireLowercaseCharacters: {{ .RequireLowercaseCharacters }}
+      RequireNumbers: {{ .RequireNumbers }}
+      RequireSymbols: {{ .RequireSymbols }}
+      RequireUppercaseCharacters: {{ .RequireUppercaseCharacters }}
+{{end}}
+{{- end }}`
+
+const tmplFmt = `---
+{{- with .Provenance }}
+Description: IAM resources exported
+{{- if .AccountID }} from account {{ .AccountID }}{{ end }} by iam-cf-generator
+Metadata:
+  IamCfGenerator:
+    {{- if .AccountID }}
+    SourceAccountId: {{ quote .AccountID }}
+    {{- end }}
+    GeneratedAt: "{{ .Generated.UTC.Format "2006-01-02T15:04:05Z07:00" }}"
+    Version: {{ quote .Version }}
+{{- end }}
+{{- if .Parameters }}
+Parameters:
+{{- range .Parameters }}
+  {{ .Name }}:
+    Type: String
+    Description: {{ quote .Description }}
+    {{- if .Default }}
+    Default: {{ quote .Default }}
+    {{- end }}
+    {{- if .AllowedValues }}
+    AllowedValues: [{{ join .AllowedValues ", " }}]
+    {{- end }}
+    {{- if .NoEcho }}
+    NoEcho: true
+    {{- end }}
+{{- end }}
+{{- end }}
+{{- if .Conditions }}
+Conditions:
+{{- range .Conditions }}
+  {{ .Name }}: {{ .Expression }}
+{{- end }}
+{{- end }}
+Resources:
+{{- range .ResourceEntries }}{{ . }}{{ end }}
+{{- if .OutputEntries }}
+Outputs:
+{{- range .OutputEntries }}{{ . }}{{ end }}
+{{ end }}`
+
+// outputTmpls are the templates of the outputs of each resource type,
+// executed with the resource as dot.
+const outputTmpls = `{{ define "ref-output" }}
+  {{ .LogicalID }}Arn:
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    Value: {{ ref .LogicalID }}
+    Export:
+      Name: {{ sub (print "${AWS::StackName}-" .LogicalID "Arn") }}
+{{- end }}
+{{ define "arn-output" }}
+  {{ .LogicalID }}Arn:
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    Value: {{ getAtt .LogicalID "Arn" }}
+    Export:
+      Name: {{ sub (print "${AWS::StackName}-" .LogicalID "Arn") }}
+{{- end }}
+{{ define "arn-name-output" }}
+  {{- template "arn-output" . }}
+  {{ .LogicalID }}Name:
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    Value: {{ ref .LogicalID }}
+    Export:
+      Name: {{ sub (print "${AWS::StackName}-" .LogicalID "Name") }}
+{{- end }}
+{{ define "permission-set-output" }}
+  {{ .LogicalID }}Arn:
+    {{- with condition .Arn }}
+    Condition: {{ . }}
+    {{- end }}
+    Value: {{ getAtt .LogicalID "PermissionSetArn" }}
+    Export:
+      Name: {{ sub (print "${AWS::StackName}-" .LogicalID "Arn") }}
+{{- end }}`
+
+// Render writes set to w as a CloudFormation template, allocating logical
+// IDs for every resource from ids.
+func Render(w io.Writer, set *model.ResourceSet, ids *LogicalIDs, opts Options) error {
+	return Write(w, set, ids, opts)
+}
+
+// RenderString is like Render but returns the template.
+func RenderString(set *model.ResourceSet, ids *LogicalIDs, opts Options) (string, error) {
+	var b strings.Builder
+	if err := Write(&b, set, ids, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Write writes set to w as a CloudFormation template, as Render does.
+func Write(w io.Writer, set *model.ResourceSet, ids *LogicalIDs, opts Options) error {
+	_, err := write(w, set, ids, opts)
+	return err
+}
+
+// AllocateLogicalIDs sets the logical ID of every resource in set,
+// allocating them from ids in the order Write does, so that they match
+// those of the template.
+func AllocateLogicalIDs(set *model.ResourceSet, ids *LogicalIDs) error {
+	var err error
+	for i, p := range set.Policies {
+		if set.Policies[i].LogicalID, err = ids.Allocate("AWS::IAM::ManagedPolicy", *p.Name, *p.Arn); err != nil {
+			return err
+		}
+	}
+	for i, g := range set.Groups {
+		if set.Groups[i].LogicalID, err = ids.Allocate("AWS::IAM::Group", *g.Name, *g.Arn); err != nil {
+			return err
+		}
+	}
+	for i, r := range set.Roles {
+		if set.Roles[i].LogicalID, err = ids.Allocate("AWS::IAM::Role", *r.Name, *r.Arn); err != nil {
+			return err
+		}
+	}
+	for i, u := range set.Users {
+		if set.Users[i].LogicalID, err = ids.Allocate("AWS::IAM::User", *u.Name, *u.Arn); err != nil {
+			return err
+		}
+	}
+	for i, c := range set.ServerCertificates {
+		if set.ServerCertificates[i].LogicalID, err = ids.Allocate("AWS::IAM::ServerCertificate", *c.Name, *c.Arn); err != nil {
+			return err
+		}
+	}
+	for i, d := range set.VirtualMFADevices {
+		if set.VirtualMFADevices[i].LogicalID, err = ids.Allocate("AWS::IAM::VirtualMFADevice", *d.Name, *d.Arn); err != nil {
+			return err
+		}
+	}
+	for i, p := range set.InstanceProfiles {
+		if set.InstanceProfiles[i].LogicalID, err = ids.Allocate("AWS::IAM::InstanceProfile", *p.Name, *p.Arn); err != nil {
+			return err
+		}
+	}
+	for i, p := range set.Providers {
+		typ := "AWS::IAM::SAMLProvider"
+		if p.Kind == model.OIDCProvider {
+			typ = "AWS::IAM::OIDCProvider"
+		}
+		if set.Providers[i].LogicalID, err = ids.Allocate(typ, *p.Name, *p.Arn); err != nil {
+			return err
+		}
+	}
+	if a := set.Account; a != nil {
+		if a.Alias != nil {
+			if a.Alias.LogicalID, err = ids.Allocate("Custom::AccountAlias", "AccountAlias", ""); err != nil {
+				return err
+			}
+		}
+		if a.PasswordPolicy != nil {
+			if a.PasswordPolicy.LogicalID, err = ids.Allocate("Custom::AccountPasswordPolicy", "AccountPasswordPolicy", ""); err != nil {
+				return err
+			}
+		}
+	}
+	for i, ps := range set.PermissionSets {
+		if set.PermissionSets[i].LogicalID, err = ids.Allocate("AWS::SSO::PermissionSet", *ps.Name, *ps.Arn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the template and returns its parameters.
+func write(w io.Writer, set *model.ResourceSet, ids *LogicalIDs, opts Options) ([]parameter, error) {
+	if err := AllocateLogicalIDs(set, ids); err != nil {
+		return nil, err
+	}
+	var inline []inlinePolicy
+	if opts.StandalonePolicies {
+		var err error
+		if inline, err = allocateInlinePolicies(set, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	// Managed policies, groups, roles and users exported in the same
+	// template are referenced by logical ID rather than by ARN or name, keeping the
+	// template self-contained.
+	policyRefs := map[string]string{}
+	groupRefs := map[string]string{}
+	userRefs := map[string]string{}
+	roleRefs := map[string]string{}
+	groupArns := map[string]string{}
+	roleArns := map[string]string{}
+	userArns := map[string]string{}
+	for _, p := range set.Policies {
+		policyRefs[*p.Arn] = p.LogicalID
+	}
+	for _, g := range set.Groups {
+		groupRefs[*g.Name] = g.LogicalID
+		groupArns[*g.Name] = *g.Arn
+	}
+	for _, r := range set.Roles {
+		roleRefs[*r.Name] = r.LogicalID
+		roleArns[*r.Name] = *r.Arn
+	}
+	// held maps the resources of opts.TemplateResources, keyed by
+	// externalKey, to their logical IDs.
+	held := map[string]string{}
+	for _, e := range opts.TemplateResources {
+		switch e.Type {
+		case "AWS::IAM::ManagedPolicy":
+			if e.Arn != "" {
+				held[externalKey("policy", e.Arn)] = e.LogicalID
+			}
+		case "AWS::IAM::Group":
+			held[externalKey("group", e.Name)] = e.LogicalID
+		case "AWS::IAM::Role":
+			held[externalKey("role", e.Name)] = e.LogicalID
+		case "AWS::IAM::User":
+			held[externalKey("user", e.Name)] = e.LogicalID
+		}
+	}
+
+	fn := intrinsics{long: opts.LongIntrinsics}
+	subst := substitutions{rules: opts.Substitutions, fn: fn}
+	params := subst.parameters()
+
+	// Conditions are read from parameters, so that the resources they
+	// wrap are created by default, as in the exported account.
+	var conditions []condition
+	for _, name := range conditionNames(opts.ResourceConditions) {
+		param := "Create" + name
+		params = append(params, parameter{
+			Name:          param,
+			Description:   "Whether to create the resources of condition " + name,
+			Default:       "true",
+			AllowedValues: []string{`"true"`, `"false"`},
+		})
+		conditions = append(conditions, condition{Name: name, Expression: fn.equals(fn.ref(param), `"true"`)})
+	}
+	// conditional returns value, a reference to the resource at arn, or
+	// AWS::NoValue when the resource is not created.
+	conditional := func(arn, value string) string {
+		if c, ok := opts.ResourceConditions[arn]; ok {
+			return fn.ifElse(c, value, fn.ref("AWS::NoValue"))
+		}
+		return value
+	}
+
+	// Passwords and private keys can not be read back from IAM, so they
+	// are taken from parameters instead.
+	for _, u := range set.Users {
+		userRefs[*u.Name] = u.LogicalID
+		userArns[*u.Name] = *u.Arn
+		if u.LoginProfile != nil {
+			params = append(params, parameter{
+				Name:        u.LogicalID + "Password",
+				Description: "Console password of user " + *u.Name,
+				NoEcho:      true,
+			})
+		}
+	}
+	// With AttachFromPolicies, the managed policies of the template list
+	// the groups, roles and users attached to them.
+	attachments := map[string]*attachment{}
+	attach := func(arn string) *attachment {
+		if attachments[arn] == nil {
+			attachments[arn] = &attachment{}
+		}
+		return attachments[arn]
+	}
+	if opts.AttachFromPolicies {
+		for _, g := range set.Groups {
+			for _, arn := range g.ManagedPolicyArns {
+				if _, ok := policyRefs[arn]; ok {
+					a := attach(arn)
+					a.Groups = append(a.Groups, conditional(*g.Arn, fn.ref(g.LogicalID)))
+				}
+			}
+		}
+		for _, r := range set.Roles {
+			for _, arn := range r.ManagedPolicyArns {
+				if _, ok := policyRefs[arn]; ok {
+					a := attach(arn)
+					a.Roles = append(a.Roles, conditional(*r.Arn, fn.ref(r.LogicalID)))
+				}
+			}
+		}
+		for _, u := range set.Users {
+			for _, arn := range u.ManagedPolicyArns {
+				if _, ok := policyRefs[arn]; ok {
+					a := attach(arn)
+					a.Users = append(a.Users, conditional(*u.Arn, fn.ref(u.LogicalID)))
+				}
+			}
+		}
+	}
+
+	for _, c := range set.ServerCertificates {
+		params = append(params, parameter{
+			Name:        c.LogicalID + "PrivateKey",
+			Description: "PEM encoded private key of server certificate " + *c.Name,
+			NoEcho:      true,
+		})
+	}
+	// CloudFormation has no resource types for the account alias and
+	// password policy, so they are written as custom resources backed by a
+	// function supplied at deploy time.
+	if a := set.Account; a != nil && (a.Alias != nil || a.PasswordPolicy != nil) {
+		params = append(params, parameter{
+			Name:        "AccountSettingsServiceToken",
+			Description: "ARN of the function implementing Custom::AccountAlias and Custom::AccountPasswordPolicy",
+		})
+	}
+	for _, key := range sortedKeys(opts.external) {
+		params = append(params, opts.external[key])
+	}
+	if len(opts.imports) > 0 {
+		params = append(params, parameter{
+			Name:        policyStackParameter,
+			Description: "Name of the stack of Policies.yaml, exporting the ARNs of the managed policies",
+		})
+	}
+
+	tmpl := template.New("render")
+	tmpl.Funcs(fn.funcs())
+	tmpl.Funcs(template.FuncMap{
+		"attachments": func(arn *string) attachment {
+			if a, ok := attachments[aws.ToString(arn)]; ok {
+				return *a
+			}
+			return attachment{}
+		},
+		"condition":      func(arn string) string { return opts.ResourceConditions[arn] },
+		"deletionPolicy": opts.deletionPolicy,
+		"document": func(doc *string, n int) (string, error) {
+			s, err := document(doc, n, subst.document, fn.shorten)
+			if err != nil {
+				return "", err
+			}
+			var comments strings.Builder
+			for _, c := range opts.Comments[doc] {
+				for _, line := range strings.Split(c, "\n") {
+					comments.WriteString(indent("# "+line, n) + "\n")
+				}
+			}
+			return comments.String() + s, nil
+		},
+		"groupName": func(name string) string {
+			if id, ok := groupRefs[name]; ok {
+				return conditional(groupArns[name], fn.ref(id))
+			}
+			if id, ok := held[externalKey("group", name)]; ok {
+				return fn.ref(id)
+			}
+			if p, ok := opts.external[externalKey("group", name)]; ok {
+				return fn.ref(p.Name)
+			}
+			return subst.value(name)
+		},
+		"indent": indent,
+		"join":   strings.Join,
+		"managedPolicyArns": func(arns []string) []string {
+			if !opts.AttachFromPolicies {
+				return arns
+			}
+			var l []string
+			for _, arn := range arns {
+				if _, ok := policyRefs[arn]; !ok {
+					l = append(l, arn)
+				}
+			}
+			return l
+		},
+		// path returns the path of a resource, or "" for the default /,
+		// which is left out.
+		"path": func(p *string) string {
+			if p == nil || *p == "" || *p == "/" {
+				return ""
+			}
+			return subst.value(*p)
+		},
+		"policyVersions": func() bool { return opts.PolicyVersions },
+		"preserveNames":  func() bool { return opts.PreserveNames },
+		"provenance":     func() *Provenance { return opts.Provenance },
+		"policyArn": func(arn string) string {
+			if id, ok := policyRefs[arn]; ok {
+				return conditional(arn, fn.ref(id))
+			}
+			if id, ok := held[externalKey("policy", arn)]; ok {
+				return fn.ref(id)
+			}
+			if p, ok := opts.external[externalKey("policy", arn)]; ok {
+				return fn.ref(p.Name)
+			}
+			if o, ok := opts.imports[externalKey("policy", arn)]; ok {
+				return fn.importValue("${" + policyStackParameter + "}-" + o)
+			}
+			return subst.value(arn)
+		},
+		"quote": quote,
+		"roleName": func(name string) string {
+			if id, ok := roleRefs[name]; ok {
+				return conditional(roleArns[name], fn.ref(id))
+			}
+			if id, ok := held[externalKey("role", name)]; ok {
+				return fn.ref(id)
+			}
+			return subst.value(name)
+		},
+		"standalonePolicies": func() bool { return opts.StandalonePolicies },
+		"sourceComments": func(arn *string, created, lastUsed *time.Time) []string {
+			if !opts.SourceComments {
+				return nil
+			}
+			return sourceComments(arn, created, lastUsed)
+		},
+		"trim":  trim,
+		"value": subst.value,
+		"unusedRole": func(r model.RoleResource) string {
+			switch {
+			case opts.UnusedSince.IsZero():
+				return ""
+			case r.LastUsed != nil && r.LastUsed.Before(opts.UnusedSince):
+				return "Not assumed since " + r.LastUsed.Format("2006-01-02")
+			case r.LastUsed == nil && r.CreateDate != nil && r.CreateDate.Before(opts.UnusedSince):
+				return "Not assumed since it was created on " + r.CreateDate.Format("2006-01-02")
+			}
+			return ""
+		},
+		"userName": func(name string) string {
+			if id, ok := userRefs[name]; ok {
+				return conditional(userArns[name], fn.ref(id))
+			}
+			if id, ok := held[externalKey("user", name)]; ok {
+				return fn.ref(id)
+			}
+			if p, ok := opts.external[externalKey("user", name)]; ok {
+				return fn.ref(p.Name)
+			}
+			return subst.value(name)
+		},
+	})
+
+	if _, err := tmpl.Parse(resourceTmpls); err != nil {
+		return nil, err
+	}
+	for name, text := range opts.Templates {
+		if _, err := tmpl.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+	}
+	if _, err := tmpl.Parse(outputTmpls); err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(tmplFmt); err != nil {
+		return nil, err
+	}
+
+	var resources, outputs []entry
+	for _, p := range set.Policies {
+		resources = append(resources, entry{p.LogicalID, "policies", p})
+		outputs = append(outputs, entry{p.LogicalID, "ref-output", p})
+	}
+	for _, g := range set.Groups {
+		resources = append(resources, entry{g.LogicalID, "groups", g})
+		outputs = append(outputs, entry{g.LogicalID, "arn-name-output", g})
+	}
+	for _, r := range set.Roles {
+		resources = append(resources, entry{r.LogicalID, "roles", r})
+		outputs = append(outputs, entry{r.LogicalID, "arn-output", r})
+	}
+	for _, u := range set.Users {
+		resources = append(resources, entry{u.LogicalID, "users", u})
+		outputs = append(outputs, entry{u.LogicalID, "arn-name-output", u})
+	}
+	for _, ps := range set.PermissionSets {
+		resources = append(resources, entry{ps.LogicalID, "sso-permission-sets", ps})
+		outputs = append(outputs, entry{ps.LogicalID, "permission-set-output", ps})
+	}
+	for _, c := range set.ServerCertificates {
+		resources = append(resources, entry{c.LogicalID, "server-certificates", c})
+		outputs = append(outputs, entry{c.LogicalID, "arn-output", c})
+	}
+	for _, d := range set.VirtualMFADevices {
+		resources = append(resources, entry{d.LogicalID, "virtual-mfa-devices", d})
+		outputs = append(outputs, entry{d.LogicalID, "ref-output", d})
+	}
+	for _, p := range set.InstanceProfiles {
+		resources = append(resources, entry{p.LogicalID, "instance-profiles", p})
+		outputs = append(outputs, entry{p.LogicalID, "arn-output", p})
+	}
+	for _, p := range set.Providers {
+		resources = append(resources, entry{p.LogicalID, "providers", p})
+		outputs = append(outputs, entry{p.LogicalID, "ref-output", p})
+	}
+	for _, p := range inline {
+		resources = append(resources, entry{p.LogicalID, "inline-policies", p})
+	}
+	if a := set.Account; a != nil {
+		// The alias and the password policy are sorted each by its own
+		// logical ID, executing the account template with an account
+		// holding only it.
+		if a.Alias != nil {
+			resources = append(resources, entry{a.Alias.LogicalID, "account", &model.AccountResource{Alias: a.Alias}})
+		}
+		if a.PasswordPolicy != nil {
+			resources = append(resources, entry{a.PasswordPolicy.LogicalID, "account", &model.AccountResource{PasswordPolicy: a.PasswordPolicy}})
+		}
+	}
+
+	data := templateData{ResourceSet: set, Options: opts, Parameters: params, Conditions: conditions}
+	var err error
+	if data.ResourceEntries, err = executeEntries(tmpl, resources); err != nil {
+		return nil, err
+	}
+	if opts.Outputs {
+		if data.OutputEntries, err = executeEntries(tmpl, outputs); err != nil {
+			return nil, err
+		}
+	}
+	return params, tmpl.Execute(w, data)
+}
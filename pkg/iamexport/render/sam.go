@@ -0,0 +1,406 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"gopkg.in/yaml.v3"
+)
+
+// samPolicyTemplate is one of the SAM policy templates. Resources are ARN
+// patterns in which {name} stands for the template's one parameter and
+// {region} and {account} for the region and account of the stack.
+type samPolicyTemplate struct {
+	Name      string
+	Parameter string
+	Actions   []string
+	Resources []string
+}
+
+// samPolicyTemplates are the policy templates statements are matched
+// against, narrowest first.
+var samPolicyTemplates = []samPolicyTemplate{
+	{
+		Name:      "S3ReadPolicy",
+		Parameter: "BucketName",
+		Actions:   []string{"s3:GetObject", "s3:ListBucket", "s3:GetBucketLocation", "s3:GetObjectVersion", "s3:GetLifecycleConfiguration"},
+		Resources: []string{"arn:*:s3:::{name}", "arn:*:s3:::{name}/*"},
+	},
+	{
+		Name:      "S3CrudPolicy",
+		Parameter: "BucketName",
+		Actions: []string{"s3:GetObject", "s3:ListBucket", "s3:GetBucketLocation", "s3:GetObjectVersion", "s3:PutObject",
+			"s3:PutObjectAcl", "s3:GetLifecycleConfiguration", "s3:PutLifecycleConfiguration", "s3:DeleteObject"},
+		Resources: []string{"arn:*:s3:::{name}", "arn:*:s3:::{name}/*"},
+	},
+	{
+		Name:      "DynamoDBReadPolicy",
+		Parameter: "TableName",
+		Actions:   []string{"dynamodb:GetItem", "dynamodb:Scan", "dynamodb:Query", "dynamodb:BatchGetItem", "dynamodb:DescribeTable"},
+		Resources: []string{"arn:*:dynamodb:{region}:{account}:table/{name}", "arn:*:dynamodb:{region}:{account}:table/{name}/index/*"},
+	},
+	{
+		Name:      "DynamoDBCrudPolicy",
+		Parameter: "TableName",
+		Actions: []string{"dynamodb:GetItem", "dynamodb:DeleteItem", "dynamodb:PutItem", "dynamodb:Scan", "dynamodb:Query",
+			"dynamodb:UpdateItem", "dynamodb:BatchWriteItem", "dynamodb:BatchGetItem", "dynamodb:DescribeTable", "dynamodb:ConditionCheckItem"},
+		Resources: []string{"arn:*:dynamodb:{region}:{account}:table/{name}", "arn:*:dynamodb:{region}:{account}:table/{name}/index/*"},
+	},
+	{
+		Name:      "SQSPollerPolicy",
+		Parameter: "QueueName",
+		Actions: []string{"sqs:ChangeMessageVisibility", "sqs:ChangeMessageVisibilityBatch", "sqs:DeleteMessage",
+			"sqs:DeleteMessageBatch", "sqs:GetQueueAttributes", "sqs:ReceiveMessage"},
+		Resources: []string{"arn:*:sqs:{region}:{account}:{name}"},
+	},
+	{
+		Name:      "SQSSendMessagePolicy",
+		Parameter: "QueueName",
+		Actions:   []string{"sqs:SendMessage*"},
+		Resources: []string{"arn:*:sqs:{region}:{account}:{name}"},
+	},
+	{
+		Name:      "SNSPublishMessagePolicy",
+		Parameter: "TopicName",
+		Actions:   []string{"sns:Publish"},
+		Resources: []string{"arn:*:sns:{region}:{account}:{name}"},
+	},
+	{
+		Name:      "LambdaInvokePolicy",
+		Parameter: "FunctionName",
+		Actions:   []string{"lambda:InvokeFunction"},
+		Resources: []string{"arn:*:lambda:{region}:{account}:function:{name}*"},
+	},
+}
+
+// stringList returns v, a string or a list of strings, as a list. It returns
+// false for anything else, such as intrinsic functions.
+func stringList(v interface{}) ([]string, bool) {
+	switch t := v.(type) {
+	case string:
+		return []string{t}, true
+	case []interface{}:
+		var l []string
+		for _, e := range t {
+			s, ok := e.(string)
+			if !ok {
+				return nil, false
+			}
+			l = append(l, s)
+		}
+		return l, len(l) > 0
+	}
+	return nil, false
+}
+
+// matchAction reports whether action is granted by one of the patterns.
+func matchAction(patterns []string, action string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(action)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchResource returns the value of {name} when arn matches pattern in
+// account, or false.
+func matchResource(pattern, arn, account string) (string, bool) {
+	pattern = strings.ReplaceAll(pattern, "{account}", account)
+	i := strings.Index(pattern, "{name}")
+	prefix, suffix := pattern[:i], pattern[i+len("{name}"):]
+
+	// The partition and region may be anything, but must be given.
+	prefixParts := strings.Split(prefix, ":")
+	arnParts := strings.SplitN(arn, ":", len(prefixParts))
+	if len(arnParts) < len(prefixParts) {
+		return "", false
+	}
+	for j, p := range prefixParts[:len(prefixParts)-1] {
+		if p == "*" || p == "{region}" {
+			if arnParts[j] == "" || strings.ContainsAny(arnParts[j], "*?") {
+				return "", false
+			}
+			continue
+		}
+		if p != arnParts[j] {
+			return "", false
+		}
+	}
+	rest := arnParts[len(arnParts)-1]
+	last := prefixParts[len(prefixParts)-1]
+	if suffix == "*" {
+		// A statement for the exact resource is covered by the wildcard.
+		rest, suffix = strings.TrimSuffix(rest, "*"), ""
+	}
+	if !strings.HasPrefix(rest, last) || !strings.HasSuffix(rest, suffix) || len(rest) < len(last)+len(suffix) {
+		return "", false
+	}
+	name := rest[len(last) : len(rest)-len(suffix)]
+	if name == "" || strings.ContainsAny(name, "*?/:") {
+		return "", false
+	}
+	return name, true
+}
+
+// samPolicyFor returns the SAM policy template covering statement, as a
+// mapping of the template name to its parameter, or nil when there is none.
+// Statements with conditions, exclusions or resources in other accounts
+// are never matched.
+func samPolicyFor(statement map[string]interface{}, account string) map[string]interface{} {
+	for k := range statement {
+		switch k {
+		case "Sid", "Effect", "Action", "Resource":
+		default:
+			return nil
+		}
+	}
+	if statement["Effect"] != "Allow" {
+		return nil
+	}
+	actions, ok := stringList(statement["Action"])
+	if !ok {
+		return nil
+	}
+	resources, ok := stringList(statement["Resource"])
+	if !ok {
+		return nil
+	}
+
+next:
+	for _, t := range samPolicyTemplates {
+		for _, a := range actions {
+			if !matchAction(t.Actions, a) {
+				continue next
+			}
+		}
+		name := ""
+		for _, r := range resources {
+			matched := false
+			for _, p := range t.Resources {
+				if n, ok := matchResource(p, r, account); ok && (name == "" || n == name) {
+					name, matched = n, true
+					break
+				}
+			}
+			if !matched {
+				continue next
+			}
+		}
+		return map[string]interface{}{t.Name: map[string]interface{}{t.Parameter: name}}
+	}
+	return nil
+}
+
+// trustsLambda reports whether the trust policy doc lets Lambda assume the
+// role.
+func trustsLambda(doc *string) bool {
+	if doc == nil {
+		return false
+	}
+	node, err := documentNode(*doc)
+	if err != nil {
+		return false
+	}
+	var v map[string]interface{}
+	if err := node.Decode(&v); err != nil {
+		return false
+	}
+	statements, _ := v["Statement"].([]interface{})
+	if m, ok := v["Statement"].(map[string]interface{}); ok {
+		statements = []interface{}{m}
+	}
+	for _, s := range statements {
+		m, _ := s.(map[string]interface{})
+		p, _ := m["Principal"].(map[string]interface{})
+		services, _ := stringList(p["Service"])
+		for _, svc := range services {
+			if m["Effect"] == "Allow" && svc == "lambda.amazonaws.com" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func scalar(v string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+}
+
+func mapping(kv ...interface{}) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(kv); i += 2 {
+		v, ok := kv[i+1].(*yaml.Node)
+		if !ok {
+			v = scalar(kv[i+1].(string))
+		}
+		n.Content = append(n.Content, scalar(kv[i].(string)), v)
+	}
+	return n
+}
+
+// optionalInt returns v as a node for optionalMapping, or nil when it is 0.
+func optionalInt(v int) *yaml.Node {
+	if v == 0 {
+		return nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(v)}
+}
+
+// optionalMapping is like mapping, but leaves out nil and empty values.
+// Values may also be *string.
+func optionalMapping(kv ...interface{}) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(kv); i += 2 {
+		var v *yaml.Node
+		switch f := kv[i+1].(type) {
+		case *yaml.Node:
+			if f == nil || (f.Kind != yaml.ScalarNode && len(f.Content) == 0) {
+				continue
+			}
+			v = f
+		case *string:
+			if f == nil || *f == "" {
+				continue
+			}
+			v = scalar(strings.TrimSpace(*f))
+		case string:
+			v = scalar(f)
+		}
+		n.Content = append(n.Content, scalar(kv[i].(string)), v)
+	}
+	return n
+}
+
+// samPolicies converts the permissions of role into the entries of the
+// Policies property of a SAM function: AWS managed policies by name, other
+// managed policies by ARN, statements matching a SAM policy template as
+// that template, and the remaining statements as policy documents.
+func samPolicies(role model.RoleResource) (*yaml.Node, error) {
+	account := ""
+	if parts := strings.SplitN(*role.Arn, ":", 6); len(parts) == 6 {
+		account = parts[4]
+	}
+
+	policies := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, arn := range role.ManagedPolicyArns {
+		if strings.Contains(arn, ":iam::aws:policy/") {
+			arn = policyName(arn)
+		}
+		policies.Content = append(policies.Content, scalar(arn))
+	}
+
+	seen := map[string]bool{}
+	for _, p := range role.Policies {
+		doc, err := documentNode(*p.PolicyDocument)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+
+		var rest []*yaml.Node
+		var statements *yaml.Node
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			if doc.Content[i].Value == "Statement" {
+				statements = doc.Content[i+1]
+			}
+		}
+		list := []*yaml.Node{statements}
+		if statements != nil && statements.Kind == yaml.SequenceNode {
+			list = statements.Content
+		}
+		for _, s := range list {
+			if s == nil {
+				continue
+			}
+			var m map[string]interface{}
+			if err := s.Decode(&m); err != nil {
+				rest = append(rest, s)
+				continue
+			}
+			t := samPolicyFor(m, account)
+			if t == nil {
+				rest = append(rest, s)
+				continue
+			}
+			n := &yaml.Node{}
+			if err := n.Encode(t); err != nil {
+				return nil, err
+			}
+			key := canonicalYAML(n)
+			if !seen[key] {
+				seen[key] = true
+				policies.Content = append(policies.Content, n)
+			}
+		}
+
+		if len(rest) > 0 {
+			residual := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			for i := 0; i+1 < len(doc.Content); i += 2 {
+				if doc.Content[i].Value == "Statement" {
+					residual.Content = append(residual.Content, doc.Content[i], &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: rest})
+					continue
+				}
+				residual.Content = append(residual.Content, doc.Content[i], doc.Content[i+1])
+			}
+			policies.Content = append(policies.Content, residual)
+		}
+	}
+	return policies, nil
+}
+
+// canonicalYAML returns n encoded as YAML, for comparing nodes.
+func canonicalYAML(n *yaml.Node) string {
+	b, err := yaml.Marshal(n)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// WriteSAM writes the Lambda execution roles in set to w as a fragment of
+// a SAM template: one AWS::Serverless::Function per role, with the role's
+// permissions in Policies, ready to be merged into the function using it.
+// Statements matching a SAM policy template are written as that template.
+// Other resource types are ignored.
+func WriteSAM(w io.Writer, set *model.ResourceSet, ids *LogicalIDs) error {
+	resources := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i, r := range set.Roles {
+		if !trustsLambda(r.AssumeRolePolicyDocument) {
+			continue
+		}
+		id, err := ids.Allocate("AWS::Serverless::Function", *r.Name, *r.Arn)
+		if err != nil {
+			return err
+		}
+		set.Roles[i].LogicalID = id
+
+		policies, err := samPolicies(r)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		fn := mapping(
+			"Type", "AWS::Serverless::Function",
+			"Properties", mapping("Policies", policies),
+		)
+		key := scalar(id)
+		key.HeadComment = "Permissions of role " + *r.Name
+		resources.Content = append(resources.Content, key, fn)
+	}
+
+	doc := &yaml.Node{
+		Kind: yaml.DocumentNode,
+		HeadComment: "SAM function policies exported by iam-cf-generator. Merge the Policies of each function into\n" +
+			"the AWS::Serverless::Function that used the role.",
+		Content: []*yaml.Node{mapping("Resources", resources)},
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,85 @@
+package render
+
+import (
+	"io"
+	"text/template"
+)
+
+const portfolioTmplFmt = `---
+Description: Service Catalog portfolio distributing the IAM resources exported by iam-cf-generator
+Parameters:
+  PortfolioName:
+    Type: String
+    Description: Display name of the portfolio
+    Default: IAM
+  ProviderName:
+    Type: String
+    Description: Name of the team providing the portfolio
+    Default: Platform
+  ProductName:
+    Type: String
+    Description: Name of the product
+    Default: IAM resources
+  ProductOwner:
+    Type: String
+    Description: Owner of the product
+    Default: Platform
+  ProductVersion:
+    Type: String
+    Description: Name of the provisioning artifact, the version of the product
+    Default: v1
+  ShareAccountId:
+    Type: String
+    Description: ID of a member account to share the portfolio with, or empty to share it with none
+    Default: ""
+Conditions:
+  Share: {{ not (equals (ref "ShareAccountId") "\"\"") }}
+Resources:
+  Portfolio:
+    Type: AWS::ServiceCatalog::Portfolio
+    Properties:
+      DisplayName: {{ ref "PortfolioName" }}
+      ProviderName: {{ ref "ProviderName" }}
+  Product:
+    Type: AWS::ServiceCatalog::CloudFormationProduct
+    Properties:
+      Name: {{ ref "ProductName" }}
+      Owner: {{ ref "ProductOwner" }}
+      ProvisioningArtifactParameters:
+        - Name: {{ ref "ProductVersion" }}
+          Info:
+            LoadTemplateFromURL: {{ quote .TemplateURL }}
+  PortfolioProduct:
+    Type: AWS::ServiceCatalog::PortfolioProductAssociation
+    Properties:
+      PortfolioId: {{ ref "Portfolio" }}
+      ProductId: {{ ref "Product" }}
+  PortfolioShare:
+    Type: AWS::ServiceCatalog::PortfolioShare
+    Condition: Share
+    Properties:
+      AccountId: {{ ref "ShareAccountId" }}
+      PortfolioId: {{ ref "Portfolio" }}
+Outputs:
+  PortfolioId:
+    Value: {{ ref "Portfolio" }}
+  ProductId:
+    Value: {{ ref "Product" }}
+`
+
+// ServiceCatalog writes a template creating a Service Catalog portfolio
+// with a product provisioning the template at templateURL, and sharing the
+// portfolio with a member account given as a parameter. templateURL may be
+// a local file, for aws cloudformation package to upload.
+func ServiceCatalog(w io.Writer, templateURL string, opts Options) error {
+	fn := intrinsics{long: opts.LongIntrinsics}
+	funcs := fn.funcs()
+	funcs["quote"] = quote
+	funcs["not"] = fn.not
+	funcs["equals"] = fn.equals
+	tmpl, err := template.New("portfolio").Funcs(funcs).Parse(portfolioTmplFmt)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, struct{ TemplateURL string }{templateURL})
+}
@@ -0,0 +1,121 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Substitution replaces Value wherever it appears in the names, ARNs and
+// policy documents of the template with a reference to the template
+// parameter Parameter, which defaults to Value. A template exported from
+// one environment, e.g. with prod=Environment, can then be deployed to
+// others by setting the parameter.
+type Substitution struct {
+	Value     string
+	Parameter string
+}
+
+var parameterName = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// ParseSubstitution parses a substitution written as <value>=<parameter>,
+// e.g. prod=Environment.
+func ParseSubstitution(s string) (Substitution, error) {
+	i := strings.LastIndexByte(s, '=')
+	if i <= 0 {
+		return Substitution{}, fmt.Errorf("invalid substitution %q, must be <value>=<parameter>", s)
+	}
+	sub := Substitution{Value: s[:i], Parameter: s[i+1:]}
+	if !parameterName.MatchString(sub.Parameter) {
+		return Substitution{}, fmt.Errorf("invalid substitution %q: parameter names must be alphanumeric", s)
+	}
+	return sub, nil
+}
+
+// substitutions applies the Substitutions of Options to the values of the
+// template.
+type substitutions struct {
+	rules []Substitution
+	fn    intrinsics
+}
+
+// parameters returns the template parameters of the substitutions.
+func (s substitutions) parameters() []parameter {
+	var params []parameter
+	seen := map[string]bool{}
+	for _, r := range s.rules {
+		if seen[r.Parameter] {
+			continue
+		}
+		seen[r.Parameter] = true
+		params = append(params, parameter{
+			Name:        r.Parameter,
+			Description: "Replaces " + r.Value + " in names, ARNs and policy documents",
+			Default:     r.Value,
+		})
+	}
+	return params
+}
+
+// replace returns the Fn::Sub string of v with the values of the rules
+// replaced by their parameters, and whether any was. v is taken to be a
+// Fn::Sub string already when escaped is set.
+func (s substitutions) replace(v string, escaped bool) (string, bool) {
+	found := false
+	for _, r := range s.rules {
+		found = found || strings.Contains(v, r.Value)
+	}
+	if !found {
+		return v, false
+	}
+	out := v
+	if !escaped {
+		// Escape IAM policy variables such as ${aws:username}, as
+		// Parameterizer does.
+		out = strings.ReplaceAll(out, "${", "${!")
+	}
+	for _, r := range s.rules {
+		out = strings.ReplaceAll(out, r.Value, "${"+r.Parameter+"}")
+	}
+	return out, true
+}
+
+// value returns v as a YAML string, or as a Fn::Sub when it contains the
+// value of one of the rules.
+func (s substitutions) value(v string) string {
+	if out, ok := s.replace(v, false); ok {
+		return s.fn.sub(out)
+	}
+	return quote(v)
+}
+
+// document replaces the values of the rules in the string values of the
+// policy document n with Fn::Sub objects.
+func (s substitutions) document(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Content) == 2 && n.Content[0].Value == "Fn::Sub" && n.Content[1].Kind == yaml.ScalarNode {
+			n.Content[1].Value, _ = s.replace(n.Content[1].Value, true)
+			return
+		}
+		for i := 1; i < len(n.Content); i += 2 {
+			s.document(n.Content[i])
+		}
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			s.document(c)
+		}
+	case yaml.ScalarNode:
+		if n.Tag != "!!str" {
+			return
+		}
+		if out, ok := s.replace(n.Value, false); ok {
+			*n = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "Fn::Sub"},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: out},
+			}}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TemplateNames are the names of the templates of resource types, which
+// Options.Templates may override. Each is executed with a resource of the
+// model as dot, e.g. a model.RoleResource for "roles", or a
+// model.AccountResource holding either the alias or the password policy
+// for "account".
+var TemplateNames = []string{
+	"policies", "groups", "roles", "users", "sso-permission-sets", "server-certificates", "virtual-mfa-devices",
+	"instance-profiles", "providers", "account",
+}
+
+// ReadTemplates reads the templates overriding those of resource types
+// from dir, one <name>.tmpl file per template, e.g. roles.tmpl, named
+// after TemplateNames. Other files are skipped.
+func ReadTemplates(dir string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]string{}
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".tmpl")
+		known := false
+		for _, n := range TemplateNames {
+			known = known || n == name
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: no template %s, must be one of %s", f, name, strings.Join(TemplateNames, ", "))
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = string(b)
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no templates in %s", dir)
+	}
+	return templates, nil
+}
@@ -0,0 +1,205 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// hclString returns s as a quoted HCL string, escaping template sequences
+// such as the ${aws:username} policy variable.
+func hclString(s string) string {
+	q := strconv.Quote(s)
+	q = strings.ReplaceAll(q, "${", "$${")
+	return strings.ReplaceAll(q, "%{", "%%{")
+}
+
+// hclDocument returns a policy document as a jsonencode expression. JSON is
+// valid HCL object syntax, so only the template sequences are escaped.
+func hclDocument(doc string) (string, error) {
+	b := bytes.Buffer{}
+	if err := json.Indent(&b, []byte(strings.TrimSpace(doc)), "  ", "  "); err != nil {
+		return "", err
+	}
+	s := strings.ReplaceAll(b.String(), "${", "$${")
+	return "jsonencode(" + strings.ReplaceAll(s, "%{", "%%{") + ")", nil
+}
+
+func hclTags(tags []types.Tag) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	sorted := append([]types.Tag(nil), tags...)
+	sort.Slice(sorted, func(i, j int) bool { return *sorted[i].Key < *sorted[j].Key })
+	b := strings.Builder{}
+	b.WriteString("{\n")
+	for _, t := range sorted {
+		fmt.Fprintf(&b, "    %s = %s\n", hclString(*t.Key), hclString(*t.Value))
+	}
+	b.WriteString("  }")
+	return b.String()
+}
+
+func hclOptional(s *string) string {
+	if s == nil || *s == "" {
+		return ""
+	}
+	return hclString(*s)
+}
+
+// terraformConfig accumulates the resource and import blocks of the
+// configuration.
+type terraformConfig struct {
+	bytes.Buffer
+	names kubernetesNames
+	// policyArns maps the ARNs of the managed policies in the configuration
+	// to the expression referring to them.
+	policyArns map[string]string
+}
+
+// address allocates the address of a resource of type typ named after s.
+func (c *terraformConfig) address(typ, s string) string {
+	name := strings.ReplaceAll(c.names.name(typ, s), "-", "_")
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return typ + "." + name
+}
+
+// resource writes the resource block at address with the given arguments,
+// aligned as terraform fmt does, followed by the import block adopting the
+// resource with ID id. Empty arguments are left out.
+func (c *terraformConfig) resource(address, id string, args ...string) {
+	dot := strings.IndexByte(address, '.')
+	fmt.Fprintf(c, "\nresource %q %q {\n", address[:dot], address[dot+1:])
+
+	for i := 0; i+1 < len(args); {
+		// Consecutive single line arguments are aligned.
+		j, width := i, 0
+		for ; j+1 < len(args) && !strings.Contains(args[j+1], "\n"); j += 2 {
+			if args[j+1] != "" && len(args[j]) > width {
+				width = len(args[j])
+			}
+		}
+		if j == i {
+			width = len(args[i])
+			j += 2
+		}
+		for ; i < j; i += 2 {
+			if args[i+1] != "" {
+				fmt.Fprintf(c, "  %-*s = %s\n", width, args[i], args[i+1])
+			}
+		}
+	}
+	fmt.Fprintf(c, "}\n\nimport {\n  to = %s\n  id = %s\n}\n", address, hclString(id))
+}
+
+// policyArn returns the expression attaching arn.
+func (c *terraformConfig) policyArn(arn string) string {
+	if a, ok := c.policyArns[arn]; ok {
+		return a
+	}
+	return hclString(arn)
+}
+
+// inlinePolicies writes the aws_iam_role_policy or aws_iam_group_policy
+// resources of the inline policies of the role or group at owner, named
+// name.
+func (c *terraformConfig) inlinePolicies(kind, owner, name string, policies model.PolicyResources) error {
+	for _, p := range policies {
+		doc, err := hclDocument(*p.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("%s %s: policy %s: %w", kind, name, *p.Name, err)
+		}
+		c.resource(c.address("aws_iam_"+kind+"_policy", name+"-"+*p.Name), name+":"+*p.Name,
+			"name", hclString(*p.Name),
+			kind, owner+".name",
+			"policy", doc,
+		)
+	}
+	return nil
+}
+
+// attachments writes the aws_iam_role_policy_attachment or
+// aws_iam_group_policy_attachment resources attaching arns to the role or
+// group at owner, named name.
+func (c *terraformConfig) attachments(kind, owner, name string, arns []string) {
+	for _, arn := range arns {
+		c.resource(c.address("aws_iam_"+kind+"_policy_attachment", name+"-"+policyName(arn)), name+"/"+arn,
+			kind, owner+".name",
+			"policy_arn", c.policyArn(arn),
+		)
+	}
+}
+
+// WriteTerraform writes the managed policies, groups and roles in set to w
+// as Terraform configuration, also valid for OpenTofu. Every resource block
+// is followed by an import block with the resource's ID, so that `terraform
+// plan` shows the adoption of the existing resources and `terraform apply`
+// performs it. Other resource types are ignored.
+func WriteTerraform(w io.Writer, set *model.ResourceSet) error {
+	c := &terraformConfig{names: kubernetesNames{}, policyArns: map[string]string{}}
+	c.WriteString("# IAM resources exported by iam-cf-generator\n")
+
+	for _, p := range set.Policies {
+		doc, err := hclDocument(*p.PolicyDocument)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+		address := c.address("aws_iam_policy", *p.Name)
+		c.policyArns[*p.Arn] = address + ".arn"
+		c.resource(address, *p.Arn,
+			"name", hclString(*p.Name),
+			"path", hclOptional(p.Path),
+			"description", hclOptional(p.Description),
+			"policy", doc,
+			"tags", hclTags(p.Tags),
+		)
+	}
+
+	for _, g := range set.Groups {
+		address := c.address("aws_iam_group", *g.Name)
+		c.resource(address, *g.Name,
+			"name", hclString(*g.Name),
+			"path", hclOptional(g.Path),
+		)
+		if err := c.inlinePolicies("group", address, *g.Name, g.Policies); err != nil {
+			return err
+		}
+		c.attachments("group", address, *g.Name, g.ManagedPolicyArns)
+	}
+
+	for _, r := range set.Roles {
+		trust, err := hclDocument(*r.AssumeRolePolicyDocument)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		maxSession := ""
+		if r.MaxSessionDuration != 0 {
+			maxSession = strconv.Itoa(r.MaxSessionDuration)
+		}
+		address := c.address("aws_iam_role", *r.Name)
+		c.resource(address, *r.Name,
+			"name", hclString(*r.Name),
+			"path", hclOptional(r.Path),
+			"description", hclOptional(r.Description),
+			"max_session_duration", maxSession,
+			"assume_role_policy", trust,
+			"tags", hclTags(r.Tags),
+		)
+		if err := c.inlinePolicies("role", address, *r.Name, r.Policies); err != nil {
+			return err
+		}
+		c.attachments("role", address, *r.Name, r.ManagedPolicyArns)
+	}
+
+	_, err := c.WriteTo(w)
+	return err
+}
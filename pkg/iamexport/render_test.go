@@ -0,0 +1,166 @@
+package iamexport_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/iamfake"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"gopkg.in/yaml.v3"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata with the rendered templates")
+
+// fetchAll fetches every resource of client the way the command does.
+func fetchAll(t *testing.T, client *iamfake.Client) *model.ResourceSet {
+	t.Helper()
+	ctx := context.Background()
+	var (
+		set model.ResourceSet
+		err error
+	)
+	if set.Policies, err = iamexport.FetchPolicies(ctx, client, iamexport.FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if set.Groups, err = iamexport.FetchGroups(ctx, client, iamexport.FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if set.Roles, err = iamexport.FetchRoles(ctx, client, iamexport.FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if set.Users, err = iamexport.FetchUsers(ctx, client, iamexport.FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if set.InstanceProfiles, err = iamexport.FetchInstanceProfiles(ctx, client, iamexport.FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if set.Providers, err = iamexport.FetchProviders(ctx, client, iamexport.FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return &set
+}
+
+func TestRenderGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		opts   render.Options
+	}{
+		{"default.yaml", render.Options{}},
+		{"preserve-names.yaml", render.Options{PreserveNames: true, Outputs: true}},
+		{"standalone-policies.yaml", render.Options{StandalonePolicies: true, AttachFromPolicies: true}},
+		{"long-intrinsics.yaml", render.Options{LongIntrinsics: true}},
+		{"source-comments.yaml", render.Options{SourceComments: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := render.RenderString(fetchAll(t, account()), render.NewLogicalIDs(nil), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("the template differs from %s, rerun with -update to accept it:\n%s", path, got)
+			}
+		})
+	}
+}
+
+func TestRenderRoleProperties(t *testing.T) {
+	client := account()
+	// A tag value YAML 1.1 reads as a boolean must stay a string.
+	client.Roles[0].Tags = append(client.Roles[0].Tags, tag("public", "yes"))
+	got, err := render.RenderString(fetchAll(t, client), render.NewLogicalIDs(nil), render.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var template struct {
+		Resources map[string]struct {
+			Type       string                 `yaml:"Type"`
+			Properties map[string]interface{} `yaml:"Properties"`
+		} `yaml:"Resources"`
+	}
+	if err := yaml.Unmarshal([]byte(got), &template); err != nil {
+		t.Fatalf("the template is not valid YAML: %v\n%s", err, got)
+	}
+
+	app := template.Resources["app"]
+	if app.Type != "AWS::IAM::Role" {
+		t.Fatalf("app is a %q, want a role:\n%s", app.Type, got)
+	}
+	want := map[string]interface{}{
+		"Description":         "Runs the app",
+		"MaxSessionDuration":  7200,
+		"Path":                "/ci/",
+		"PermissionsBoundary": boundary,
+		"Tags": []interface{}{
+			map[string]interface{}{"Key": "team", "Value": "ci"},
+			map[string]interface{}{"Key": "env", "Value": "prod"},
+			map[string]interface{}{"Key": "public", "Value": "yes"},
+		},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(app.Properties[k], v) {
+			t.Errorf("%s = %#v, want %#v", k, app.Properties[k], v)
+		}
+	}
+	for _, k := range []string{"AssumeRolePolicyDocument", "ManagedPolicyArns", "Policies"} {
+		if app.Properties[k] == nil {
+			t.Errorf("%s is missing", k)
+		}
+	}
+
+	// The role at / with the default session duration has none of them.
+	plain := template.Resources["plain"]
+	for _, k := range []string{"Description", "Path", "PermissionsBoundary", "Tags"} {
+		if v, ok := plain.Properties[k]; ok {
+			t.Errorf("plain has %s %#v, want none", k, v)
+		}
+	}
+}
+
+func TestRenderAccountEntries(t *testing.T) {
+	client := account()
+	client.AccountAlias = aws.String("example")
+	client.PasswordPolicy = &types.PasswordPolicy{MinimumPasswordLength: aws.Int32(14)}
+	// A role sorted between the alias and the password policy.
+	role := client.Roles[1]
+	role.Arn, role.RoleName = aws.String("arn:aws:iam::123456789012:role/AccountBackup"), aws.String("AccountBackup")
+	client.Roles = append(client.Roles, role)
+
+	set := fetchAll(t, client)
+	var err error
+	if set.Account, err = iamexport.FetchAccount(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	got, err := render.RenderString(set, render.NewLogicalIDs(nil), render.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias := strings.Index(got, "\n  AccountAlias:\n")
+	backup := strings.Index(got, "\n  AccountBackup:\n")
+	policy := strings.Index(got, "\n  AccountPasswordPolicy:\n")
+	if alias < 0 || backup < 0 || policy < 0 || !(alias < backup && backup < policy) {
+		t.Errorf("want the alias, the role AccountBackup and the password policy in order:\n%s", got)
+	}
+	if n := strings.Count(got, "Type: Custom::Account"); n != 2 {
+		t.Errorf("%d account resources, want 2:\n%s", n, got)
+	}
+}
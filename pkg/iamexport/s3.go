@@ -0,0 +1,56 @@
+package iamexport
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ParseS3URI returns the bucket and key prefix of the S3 URI u, e.g.
+// s3://bucket/iam/. Prefixes are taken to be folders.
+func ParseS3URI(u string) (string, string, error) {
+	p, err := url.Parse(u)
+	if err != nil || p.Scheme != "s3" || p.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 URI %s, must be s3://bucket/prefix/", u)
+	}
+	prefix := strings.TrimPrefix(p.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return p.Host, prefix, nil
+}
+
+// ObjectURL returns the URL of the object key in bucket, e.g. to pass as
+// the TemplateURL of a stack, from the S3 endpoint of the region of cfg.
+// An endpoint the resolver of cfg overrides, e.g. that of LoadConfig, is
+// addressed in the path style local emulators serve; the endpoint of AWS,
+// in the partition of the region, in the virtual-hosted style.
+func ObjectURL(cfg aws.Config, bucket, key string) (string, error) {
+	pathStyle := false
+	var e aws.Endpoint
+	var err error
+	if r := cfg.EndpointResolverWithOptions; r != nil {
+		e, err = r.ResolveEndpoint(s3.ServiceID, cfg.Region)
+		pathStyle = err == nil
+	}
+	if !pathStyle {
+		if e, err = s3.NewDefaultEndpointResolver().ResolveEndpoint(cfg.Region, s3.EndpointResolverOptions{}); err != nil {
+			return "", fmt.Errorf("resolving the S3 endpoint of %s: %w", cfg.Region, err)
+		}
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid S3 endpoint %s: %w", e.URL, err)
+	}
+	if pathStyle {
+		u.Path = path.Join("/", u.Path, bucket, key)
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = path.Join("/", key)
+	}
+	return u.String(), nil
+}
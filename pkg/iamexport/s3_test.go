@@ -0,0 +1,32 @@
+package iamexport_test
+
+import (
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestObjectURL(t *testing.T) {
+	local := func(service string) string { return "http://localhost:4566" }
+	none := func(service string) string { return "" }
+	tests := []struct {
+		region   string
+		endpoint func(string) string
+		want     string
+	}{
+		{"eu-west-1", none, "https://bucket.s3.eu-west-1.amazonaws.com/iam/Roles.yaml"},
+		{"cn-north-1", none, "https://bucket.s3.cn-north-1.amazonaws.com.cn/iam/Roles.yaml"},
+		{"eu-west-1", local, "http://localhost:4566/bucket/iam/Roles.yaml"},
+	}
+	for _, tt := range tests {
+		cfg := aws.Config{Region: tt.region, EndpointResolverWithOptions: iamexport.EndpointResolver(tt.endpoint)}
+		got, err := iamexport.ObjectURL(cfg, "bucket", "iam/Roles.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("ObjectURL in %s = %s, want %s", tt.region, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package securityhub imports the findings of the audit and trust analyses
+// into AWS Security Hub, in the AWS Security Finding Format (ASFF), so that
+// they join the other findings of the account.
+package securityhub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// Finding is a finding in the AWS Security Finding Format, with the fields
+// the analyses fill in.
+type Finding struct {
+	SchemaVersion string     `json:"SchemaVersion"`
+	ID            string     `json:"Id"`
+	ProductArn    string     `json:"ProductArn"`
+	GeneratorID   string     `json:"GeneratorId"`
+	AwsAccountID  string     `json:"AwsAccountId"`
+	Types         []string   `json:"Types"`
+	CreatedAt     string     `json:"CreatedAt"`
+	UpdatedAt     string     `json:"UpdatedAt"`
+	Severity      Severity   `json:"Severity"`
+	Title         string     `json:"Title"`
+	Description   string     `json:"Description"`
+	Resources     []Resource `json:"Resources"`
+	// ProductFields hold the details of the analysis, e.g. the Sid of the
+	// statement.
+	ProductFields map[string]string `json:"ProductFields,omitempty"`
+}
+
+// Severity is the severity of a finding, e.g. HIGH.
+type Severity struct {
+	Label string `json:"Label"`
+}
+
+// Resource is the resource a finding is about.
+type Resource struct {
+	Type      string `json:"Type"`
+	ID        string `json:"Id"`
+	Partition string `json:"Partition"`
+	Region    string `json:"Region"`
+}
+
+// Source is the account and region of the Security Hub the findings are
+// imported into, and the time they were found at.
+type Source struct {
+	AccountID string
+	Region    string
+	Partition string
+	Time      time.Time
+}
+
+// schemaVersion is the version of the ASFF findings are written in.
+const schemaVersion = "2018-10-08"
+
+// finding returns a finding of src on the resource arn, of the ASFF type
+// typ, e.g. AwsIamRole, with the fields other than the title, description
+// and details filled in. Its ID is derived from id, so that importing the
+// finding again updates it.
+func (src Source) finding(generator, id, typ, arn string, severity analyze.Severity) Finding {
+	at := src.Time.UTC().Format(time.RFC3339)
+	return Finding{
+		SchemaVersion: schemaVersion,
+		ID:            "iam-cf-generator/" + generator + "/" + id,
+		ProductArn:    fmt.Sprintf("arn:%s:securityhub:%s:%s:product/%s/default", src.Partition, src.Region, src.AccountID, src.AccountID),
+		GeneratorID:   "iam-cf-generator/" + generator,
+		AwsAccountID:  src.AccountID,
+		Types:         []string{"Software and Configuration Checks/AWS Security Best Practices"},
+		CreatedAt:     at,
+		UpdatedAt:     at,
+		Severity:      Severity{Label: label(severity)},
+		Resources: []Resource{{
+			Type:      typ,
+			ID:        arn,
+			Partition: src.Partition,
+			Region:    src.Region,
+		}},
+	}
+}
+
+// label returns the ASFF severity label of s.
+func label(s analyze.Severity) string {
+	if s == analyze.Info {
+		return "INFORMATIONAL"
+	}
+	return strings.ToUpper(s.String())
+}
+
+// resourceTypes are the ASFF types of the resources of findings, keyed by
+// analyze.Finding.Type. Other resources are of type Other.
+var resourceTypes = map[string]string{
+	"policy": "AwsIamPolicy",
+	"role":   "AwsIamRole",
+	"group":  "AwsIamGroup",
+	"user":   "AwsIamUser",
+}
+
+// join joins the non-empty elements of an ID with slashes.
+func join(elems ...string) string {
+	var l []string
+	for _, e := range elems {
+		if e != "" {
+			l = append(l, e)
+		}
+	}
+	return strings.Join(l, "/")
+}
+
+// truncate shortens s to the n characters ASFF allows in a field.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-3]) + "..."
+	}
+	return s
+}
+
+// FromAudit returns the findings of analyze.Audit as ASFF findings.
+func FromAudit(src Source, findings []analyze.Finding) []Finding {
+	var l []Finding
+	for _, f := range findings {
+		typ, ok := resourceTypes[f.Type]
+		if !ok {
+			typ = "Other"
+		}
+		af := src.finding("audit/"+f.Check, join(f.Resource(), f.Sid), typ, f.Arn, f.Severity)
+		af.Title = truncate(fmt.Sprintf("%s: %s", f.Resource(), f.Reason), 256)
+		af.Description = truncate(fmt.Sprintf("The policy %s of %s %s %s.", policyName(f), f.Type, f.Name, f.Reason), 1024)
+		af.ProductFields = map[string]string{"Check": f.Check}
+		if f.Sid != "" {
+			af.ProductFields["Sid"] = f.Sid
+		}
+		l = append(l, af)
+	}
+	return l
+}
+
+func policyName(f analyze.Finding) string {
+	if f.Policy == "" {
+		return f.Name
+	}
+	return f.Policy
+}
+
+// FromTrust returns the risky relationships of analyze.TrustRelationships
+// as ASFF findings, leaving out those of info severity.
+func FromTrust(src Source, trusts []analyze.Trust) []Finding {
+	var l []Finding
+	for _, t := range trusts {
+		if t.Severity == analyze.Info {
+			continue
+		}
+		f := src.finding("trust/"+t.Kind, join("role/"+t.Role, t.Sid, t.Principal), "AwsIamRole", t.RoleArn, t.Severity)
+		f.Title = truncate(fmt.Sprintf("role/%s: %s", t.Role, t.Reason), 256)
+		f.Description = truncate(fmt.Sprintf("The trust policy of role %s allows %s to assume it: %s.", t.Role, t.Principal, t.Reason), 1024)
+		f.ProductFields = map[string]string{"Kind": t.Kind, "Principal": t.Principal}
+		if t.Sid != "" {
+			f.ProductFields["Sid"] = t.Sid
+		}
+		l = append(l, f)
+	}
+	return l
+}
+
+// Client imports findings into Security Hub with BatchImportFindings. It
+// signs the requests itself, as this module does not depend on the Security
+// Hub client of the SDK.
+type Client struct {
+	HTTP        *http.Client
+	Credentials aws.CredentialsProvider
+	Region      string
+	// Endpoint is the URL of Security Hub, e.g.
+	// https://securityhub.us-east-1.amazonaws.com.
+	Endpoint string
+	// SigningRegion is the region requests are signed for, Region when
+	// empty.
+	SigningRegion string
+}
+
+// NewFromConfig returns a client for the region and credentials of cfg,
+// resolving the endpoint of Security Hub with its endpoint resolver.
+func NewFromConfig(cfg aws.Config) *Client {
+	c := &Client{
+		HTTP:        http.DefaultClient,
+		Credentials: cfg.Credentials,
+		Region:      cfg.Region,
+		Endpoint:    fmt.Sprintf("https://securityhub.%s.amazonaws.com", cfg.Region),
+	}
+	if cfg.EndpointResolverWithOptions != nil {
+		if e, err := cfg.EndpointResolverWithOptions.ResolveEndpoint("SecurityHub", cfg.Region); err == nil {
+			c.Endpoint, c.SigningRegion = e.URL, e.SigningRegion
+		}
+	}
+	return c
+}
+
+// batchSize is the most findings BatchImportFindings accepts at once.
+const batchSize = 100
+
+// Import imports findings into Security Hub, updating those imported
+// before with the same ID, and returns the number imported. It fails when
+// Security Hub rejects any of them.
+func (c *Client) Import(ctx context.Context, findings []Finding) (int, error) {
+	imported := 0
+	for start := 0; start < len(findings); start += batchSize {
+		end := start + batchSize
+		if end > len(findings) {
+			end = len(findings)
+		}
+		n, err := c.importBatch(ctx, findings[start:end])
+		imported += n
+		if err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// importBatch calls BatchImportFindings with findings.
+func (c *Client) importBatch(ctx context.Context, findings []Finding) (int, error) {
+	body, err := json.Marshal(struct {
+		Findings []Finding `json:"Findings"`
+	}{findings})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.Endpoint, "/")+"/findings/import", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	creds, err := c.Credentials.Retrieve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	region := c.SigningRegion
+	if region == "" {
+		region = c.Region
+	}
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "securityhub", region, time.Now()); err != nil {
+		return 0, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("BatchImportFindings: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	var out struct {
+		SuccessCount   int
+		FailedCount    int
+		FailedFindings []struct {
+			ID           string `json:"Id"`
+			ErrorCode    string
+			ErrorMessage string
+		}
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return 0, fmt.Errorf("BatchImportFindings: %w", err)
+	}
+	if out.FailedCount > 0 {
+		err := fmt.Errorf("BatchImportFindings: %d findings failed", out.FailedCount)
+		if len(out.FailedFindings) > 0 {
+			f := out.FailedFindings[0]
+			err = fmt.Errorf("%w, e.g. %s: %s: %s", err, f.ID, f.ErrorCode, f.ErrorMessage)
+		}
+		return out.SuccessCount, err
+	}
+	return out.SuccessCount, nil
+}
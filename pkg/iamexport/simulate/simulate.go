@@ -0,0 +1,296 @@
+// Package simulate checks the access the exported policies grant with the
+// IAM policy simulator, so that a migration to the generated template can
+// be shown to preserve it.
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Client is the subset of the IAM API used to simulate policies.
+// *iam.Client satisfies it.
+type Client interface {
+	iam.SimulateCustomPolicyAPIClient
+
+	GetPolicy(context.Context, *iam.GetPolicyInput, ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(context.Context, *iam.GetPolicyVersionInput, ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+}
+
+var _ Client = (*iam.Client)(nil)
+
+// Case is a test case of a cases file: the actions on resources the
+// principals are expected to be allowed or denied.
+type Case struct {
+	Name string `yaml:"name"`
+	// Principals are the roles, users and groups simulated, e.g.
+	// role/app-role. A user is simulated with the policies of its groups.
+	Principals []string `yaml:"principals"`
+	Actions    []string `yaml:"actions"`
+	// Resources are the ARNs of the resources simulated, or * when
+	// omitted.
+	Resources []string     `yaml:"resources"`
+	Context   []ContextKey `yaml:"context"`
+	// Expect is "allowed" or "denied", or "" to only report the decisions.
+	Expect string `yaml:"expect"`
+}
+
+// ContextKey is a value of a condition key the policies are simulated
+// with, e.g. aws:SourceIp.
+type ContextKey struct {
+	Key string `yaml:"key"`
+	// Type is the type of the key, e.g. ip, and defaults to string.
+	Type   string   `yaml:"type"`
+	Values []string `yaml:"values"`
+}
+
+// ReadCases reads the test cases of the YAML file path, a list under the
+// key cases.
+func ReadCases(path string) ([]Case, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Cases []Case `yaml:"cases"`
+	}
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, c := range file.Cases {
+		switch {
+		case len(c.Principals) == 0 || len(c.Actions) == 0:
+			return nil, fmt.Errorf("%s: case %d: principals and actions are required", path, i+1)
+		case c.Expect != "" && c.Expect != "allowed" && c.Expect != "denied":
+			return nil, fmt.Errorf("%s: case %d: invalid expect %s, must be allowed or denied", path, i+1, c.Expect)
+		}
+	}
+	return file.Cases, nil
+}
+
+// Result is the decision of the simulator on an action of a case.
+type Result struct {
+	Case      string
+	Principal string
+	Action    string
+	Resource  string
+	// Decision is allowed, explicitDeny or implicitDeny.
+	Decision string
+	Expect   string
+	// MissingContext are the condition keys the decision depends on that
+	// the case gives no value for.
+	MissingContext []string
+}
+
+// Failed reports whether the decision is not the expected one.
+func (r Result) Failed() bool {
+	switch r.Expect {
+	case "allowed":
+		return r.Decision != string(types.PolicyEvaluationDecisionTypeAllowed)
+	case "denied":
+		return r.Decision == string(types.PolicyEvaluationDecisionTypeAllowed)
+	}
+	return false
+}
+
+// principal is the identity policies and permissions boundary a principal
+// is simulated with.
+type principal struct {
+	policies []string
+	boundary *string
+}
+
+// simulator simulates the principals of a resource set, reading the
+// managed policies the set does not hold from IAM.
+type simulator struct {
+	client    Client
+	set       *model.ResourceSet
+	documents map[string]string
+}
+
+// document returns the document of the managed policy arn.
+func (s *simulator) document(ctx context.Context, arn string) (string, error) {
+	if doc, ok := s.documents[arn]; ok {
+		return doc, nil
+	}
+	p, err := s.client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(arn)})
+	if err != nil {
+		return "", fmt.Errorf("policy %s: %w", arn, err)
+	}
+	v, err := s.client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{PolicyArn: aws.String(arn), VersionId: p.Policy.DefaultVersionId})
+	if err != nil {
+		return "", fmt.Errorf("policy %s: %w", arn, err)
+	}
+	doc, err := url.QueryUnescape(aws.ToString(v.PolicyVersion.Document))
+	if err != nil {
+		return "", fmt.Errorf("policy %s: %w", arn, err)
+	}
+	s.documents[arn] = doc
+	return doc, nil
+}
+
+// identity appends the documents of the inline policies and of the managed
+// policies arns to policies.
+func (s *simulator) identity(ctx context.Context, policies []string, inline model.PolicyResources, arns []string) ([]string, error) {
+	for _, p := range inline {
+		policies = append(policies, aws.ToString(p.PolicyDocument))
+	}
+	for _, arn := range arns {
+		doc, err := s.document(ctx, arn)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, doc)
+	}
+	return policies, nil
+}
+
+// principal returns the policies of the role, user or group name, e.g.
+// role/app-role.
+func (s *simulator) principal(ctx context.Context, name string) (*principal, error) {
+	typ, n, _ := strings.Cut(name, "/")
+	var p principal
+	var err error
+	switch typ {
+	case "role":
+		for _, r := range s.set.Roles {
+			if aws.ToString(r.Name) == n {
+				p.boundary = r.PermissionsBoundary
+				p.policies, err = s.identity(ctx, nil, r.Policies, r.ManagedPolicyArns)
+				return &p, err
+			}
+		}
+	case "user":
+		for _, u := range s.set.Users {
+			if aws.ToString(u.Name) != n {
+				continue
+			}
+			p.boundary = u.PermissionsBoundary
+			if p.policies, err = s.identity(ctx, nil, u.Policies, u.ManagedPolicyArns); err != nil {
+				return nil, err
+			}
+			for _, g := range u.Groups {
+				group, err := s.principal(ctx, "group/"+g)
+				if err != nil {
+					return nil, fmt.Errorf("user %s: %w", n, err)
+				}
+				p.policies = append(p.policies, group.policies...)
+			}
+			return &p, nil
+		}
+	case "group":
+		for _, g := range s.set.Groups {
+			if aws.ToString(g.Name) == n {
+				p.policies, err = s.identity(ctx, nil, g.Policies, g.ManagedPolicyArns)
+				return &p, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid principal %s, must be role/<name>, user/<name> or group/<name>", name)
+	}
+	return nil, fmt.Errorf("%s %s is not exported", typ, n)
+}
+
+// Run simulates the cases with the policies of the principals in set as
+// they are exported, and returns one result per principal, action and
+// resource. The managed policies attached to them that set does not hold,
+// such as AWS managed policies, are read from IAM.
+func Run(ctx context.Context, client Client, set *model.ResourceSet, cases []Case) ([]Result, error) {
+	s := &simulator{client: client, set: set, documents: map[string]string{}}
+	for _, p := range set.Policies {
+		s.documents[aws.ToString(p.Arn)] = aws.ToString(p.PolicyDocument)
+	}
+
+	var results []Result
+	for i, c := range cases {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i+1)
+		}
+		var entries []types.ContextEntry
+		for _, k := range c.Context {
+			typ := types.ContextKeyTypeEnum(k.Type)
+			if typ == "" {
+				typ = types.ContextKeyTypeEnumString
+			}
+			entries = append(entries, types.ContextEntry{
+				ContextKeyName:   aws.String(k.Key),
+				ContextKeyType:   typ,
+				ContextKeyValues: k.Values,
+			})
+		}
+		for _, pn := range c.Principals {
+			p, err := s.principal(ctx, pn)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			in := &iam.SimulateCustomPolicyInput{
+				ActionNames:     c.Actions,
+				PolicyInputList: p.policies,
+				ResourceArns:    c.Resources,
+				ContextEntries:  entries,
+			}
+			if p.boundary != nil {
+				doc, err := s.document(ctx, *p.boundary)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s: permissions boundary: %w", name, pn, err)
+				}
+				in.PermissionsBoundaryPolicyInputList = []string{doc}
+			}
+			// The simulator requires at least one policy; a principal
+			// without any is denied everything.
+			if len(in.PolicyInputList) == 0 {
+				in.PolicyInputList = []string{`{"Version":"2012-10-17","Statement":[]}`}
+			}
+
+			pages := iam.NewSimulateCustomPolicyPaginator(client, in)
+			for pages.HasMorePages() {
+				out, err := pages.NextPage(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s: %w", name, pn, err)
+				}
+				for _, r := range out.EvaluationResults {
+					results = append(results, Result{
+						Case:           name,
+						Principal:      pn,
+						Action:         aws.ToString(r.EvalActionName),
+						Resource:       aws.ToString(r.EvalResourceName),
+						Decision:       string(r.EvalDecision),
+						Expect:         c.Expect,
+						MissingContext: r.MissingContextValues,
+					})
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// WriteResults writes results to w as a table, one decision per line,
+// marking those that are not the expected one as FAIL.
+func WriteResults(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tCASE\tPRINCIPAL\tACTION\tRESOURCE\tDECISION\tMISSING CONTEXT")
+	for _, r := range results {
+		result := "-"
+		switch {
+		case r.Failed():
+			result = "FAIL"
+		case r.Expect != "":
+			result = "ok"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", result, r.Case, r.Principal, r.Action, r.Resource, r.Decision, strings.Join(r.MissingContext, ","))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,251 @@
+// Package sqlite writes fetched resources to a SQLite database, for ad-hoc
+// queries over an account's IAM.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	// Registers the sqlite3 driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE roles (
+	arn TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT,
+	description TEXT,
+	create_date TEXT,
+	max_session_duration INTEGER,
+	trust_policy TEXT
+);
+CREATE TABLE groups (
+	arn TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT,
+	create_date TEXT
+);
+CREATE TABLE users (
+	arn TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT,
+	create_date TEXT
+);
+CREATE TABLE group_members (
+	group_name TEXT NOT NULL,
+	user_arn TEXT NOT NULL REFERENCES users (arn)
+);
+-- Customer managed policies.
+CREATE TABLE policies (
+	arn TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT,
+	description TEXT,
+	create_date TEXT,
+	attachment_count INTEGER,
+	document TEXT
+);
+CREATE TABLE inline_policies (
+	owner_type TEXT NOT NULL,
+	owner_arn TEXT NOT NULL,
+	name TEXT NOT NULL,
+	document TEXT
+);
+-- Managed policies, customer or AWS managed, attached to roles, groups
+-- and users.
+CREATE TABLE attachments (
+	owner_type TEXT NOT NULL,
+	owner_arn TEXT NOT NULL,
+	policy_arn TEXT NOT NULL
+);
+CREATE TABLE tags (
+	resource_arn TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT
+);
+-- Statements of managed, inline and trust policies. policy is the ARN of a
+-- managed policy or the name of an inline policy of owner_arn, and is NULL
+-- for the trust policy of role owner_arn. Elements are stored as JSON.
+CREATE TABLE statements (
+	policy_type TEXT NOT NULL,
+	owner_arn TEXT,
+	policy TEXT,
+	sid TEXT,
+	effect TEXT,
+	principal TEXT,
+	not_principal TEXT,
+	action TEXT,
+	not_action TEXT,
+	resource TEXT,
+	not_resource TEXT,
+	condition TEXT
+);
+`
+
+// statement holds the elements of a policy statement as raw JSON.
+type statement struct {
+	Sid          *string
+	Effect       *string
+	Principal    json.RawMessage
+	NotPrincipal json.RawMessage
+	Action       json.RawMessage
+	NotAction    json.RawMessage
+	Resource     json.RawMessage
+	NotResource  json.RawMessage
+	Condition    json.RawMessage
+}
+
+// statements returns the statements of doc, which may hold a single
+// statement or a list of them.
+func statements(doc string) ([]statement, error) {
+	var d struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(doc), &d); err != nil {
+		return nil, err
+	}
+	if len(d.Statement) == 0 {
+		return nil, nil
+	}
+	if d.Statement[0] == '{' {
+		var s statement
+		err := json.Unmarshal(d.Statement, &s)
+		return []statement{s}, err
+	}
+	var list []statement
+	err := json.Unmarshal(d.Statement, &list)
+	return list, err
+}
+
+// nullable returns raw as a column value, or nil when it is empty.
+func nullable(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+func date(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writer inserts resources within a transaction, remembering the first
+// error.
+type writer struct {
+	tx  *sql.Tx
+	err error
+}
+
+func (w *writer) exec(query string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.tx.Exec(query, args...)
+}
+
+func (w *writer) tags(arn *string, tags []types.Tag) {
+	for _, t := range tags {
+		w.exec(`INSERT INTO tags VALUES (?, ?, ?)`, arn, t.Key, t.Value)
+	}
+}
+
+func (w *writer) statements(policyType string, owner, policy, doc *string) {
+	if w.err != nil || doc == nil {
+		return
+	}
+	list, err := statements(*doc)
+	if err != nil {
+		name := owner
+		if policy != nil {
+			name = policy
+		}
+		w.err = fmt.Errorf("%s policy %s: %w", policyType, *name, err)
+		return
+	}
+	for _, s := range list {
+		w.exec(`INSERT INTO statements VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			policyType, owner, policy, s.Sid, s.Effect,
+			nullable(s.Principal), nullable(s.NotPrincipal),
+			nullable(s.Action), nullable(s.NotAction),
+			nullable(s.Resource), nullable(s.NotResource),
+			nullable(s.Condition),
+		)
+	}
+}
+
+func (w *writer) policies(ownerType string, owner *string, inline model.PolicyResources, attached []string) {
+	for _, p := range inline {
+		w.exec(`INSERT INTO inline_policies VALUES (?, ?, ?, ?)`, ownerType, owner, p.Name, p.PolicyDocument)
+		w.statements("inline", owner, p.Name, p.PolicyDocument)
+	}
+	for _, arn := range attached {
+		w.exec(`INSERT INTO attachments VALUES (?, ?, ?)`, ownerType, owner, arn)
+	}
+}
+
+// Write writes the roles, managed policies, groups and users in set to a
+// new SQLite database at path, replacing any existing file.
+func Write(path string, set *model.ResourceSet) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(schema); err != nil {
+		return fmt.Errorf("creating tables: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	w := &writer{tx: tx}
+
+	for _, r := range set.Roles {
+		w.exec(`INSERT INTO roles VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.Arn, r.Name, r.Path, r.Description, date(r.CreateDate), r.MaxSessionDuration, r.AssumeRolePolicyDocument)
+		w.tags(r.Arn, r.Tags)
+		w.statements("trust", r.Arn, nil, r.AssumeRolePolicyDocument)
+		w.policies("role", r.Arn, r.Policies, r.ManagedPolicyArns)
+	}
+	for _, p := range set.Policies {
+		w.exec(`INSERT INTO policies VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			p.Arn, p.Name, p.Path, p.Description, date(p.CreateDate), p.AttachmentCount, p.PolicyDocument)
+		w.tags(p.Arn, p.Tags)
+		w.statements("managed", nil, p.Arn, p.PolicyDocument)
+	}
+	for _, g := range set.Groups {
+		w.exec(`INSERT INTO groups VALUES (?, ?, ?, ?)`, g.Arn, g.Name, g.Path, date(g.CreateDate))
+		w.policies("group", g.Arn, g.Policies, g.ManagedPolicyArns)
+	}
+	for _, u := range set.Users {
+		w.exec(`INSERT INTO users VALUES (?, ?, ?, ?)`, u.Arn, u.Name, u.Path, date(u.CreateDate))
+		w.tags(u.Arn, u.Tags)
+		for _, g := range u.Groups {
+			w.exec(`INSERT INTO group_members VALUES (?, ?)`, g, u.Arn)
+		}
+		w.policies("user", u.Arn, u.Policies, u.ManagedPolicyArns)
+	}
+
+	if w.err != nil {
+		tx.Rollback()
+		return w.err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,145 @@
+package iamexport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+)
+
+// SSOAdminClient is the subset of the IAM Identity Center (SSO admin) API
+// used to fetch permission sets. *ssoadmin.Client satisfies it.
+type SSOAdminClient interface {
+	ssoadmin.ListInstancesAPIClient
+	ssoadmin.ListManagedPoliciesInPermissionSetAPIClient
+	ssoadmin.ListPermissionSetsAPIClient
+	ssoadmin.ListTagsForResourceAPIClient
+
+	DescribePermissionSet(context.Context, *ssoadmin.DescribePermissionSetInput, ...func(*ssoadmin.Options)) (*ssoadmin.DescribePermissionSetOutput, error)
+	GetInlinePolicyForPermissionSet(context.Context, *ssoadmin.GetInlinePolicyForPermissionSetInput, ...func(*ssoadmin.Options)) (*ssoadmin.GetInlinePolicyForPermissionSetOutput, error)
+}
+
+var _ SSOAdminClient = (*ssoadmin.Client)(nil)
+
+// FetchPermissionSets returns every permission set of every IAM Identity
+// Center instance visible to the client, along with its inline policy,
+// managed policies and tags.
+func FetchPermissionSets(ctx context.Context, client SSOAdminClient, opts FetchOptions) (model.PermissionSetResources, error) {
+	type item struct {
+		instanceArn string
+		arn         string
+	}
+	var list []item
+
+	ipages := ssoadmin.NewListInstancesPaginator(client, &ssoadmin.ListInstancesInput{})
+	for ipages.HasMorePages() {
+		instances, err := ipages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing Identity Center instances: %w", err)
+		}
+
+		for _, inst := range instances.Instances {
+			pages := ssoadmin.NewListPermissionSetsPaginator(client, &ssoadmin.ListPermissionSetsInput{
+				InstanceArn: inst.InstanceArn,
+			})
+			for pages.HasMorePages() {
+				resp, err := pages.NextPage(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("listing permission sets: %w", err)
+				}
+				for _, arn := range resp.PermissionSets {
+					list = append(list, item{*inst.InstanceArn, arn})
+				}
+			}
+		}
+	}
+
+	sets := make(model.PermissionSetResources, len(list))
+	err := opts.forEach(ctx, "sso-permission-sets", len(list), func(i int) *string { return &list[i].arn }, func(ctx context.Context, i int) error {
+		it := list[i]
+		desc, err := client.DescribePermissionSet(ctx, &ssoadmin.DescribePermissionSetInput{
+			InstanceArn:      &it.instanceArn,
+			PermissionSetArn: &it.arn,
+		})
+		if err != nil {
+			return fmt.Errorf("permission set %s: %w", it.arn, err)
+		}
+
+		ps := desc.PermissionSet
+		// Permission sets are listed by ARN only, so the name to select
+		// them by is only known here.
+		if !opts.selected("sso-permission-sets", ps.Name, &it.arn) {
+			return nil
+		}
+		rec := model.PermissionSetResource{
+			Arn:             &it.arn,
+			Description:     ps.Description,
+			InstanceArn:     &it.instanceArn,
+			Name:            ps.Name,
+			RelayState:      ps.RelayState,
+			SessionDuration: ps.SessionDuration,
+		}
+		if opts.ListOnly {
+			sets[i] = rec
+			return nil
+		}
+
+		inline, err := client.GetInlinePolicyForPermissionSet(ctx, &ssoadmin.GetInlinePolicyForPermissionSetInput{
+			InstanceArn:      &it.instanceArn,
+			PermissionSetArn: &it.arn,
+		})
+		if err != nil {
+			return fmt.Errorf("permission set %s: inline policy: %w", *ps.Name, err)
+		}
+		if inline.InlinePolicy != nil && *inline.InlinePolicy != "" {
+			// Unlike IAM, Identity Center returns documents as plain JSON.
+			if rec.InlinePolicy, err = indentPolicy([]byte(*inline.InlinePolicy)); err != nil {
+				return fmt.Errorf("permission set %s: inline policy: %w", *ps.Name, err)
+			}
+		}
+
+		mpages := ssoadmin.NewListManagedPoliciesInPermissionSetPaginator(client, &ssoadmin.ListManagedPoliciesInPermissionSetInput{
+			InstanceArn:      &it.instanceArn,
+			PermissionSetArn: &it.arn,
+		})
+		for mpages.HasMorePages() {
+			policies, err := mpages.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("permission set %s: listing managed policies: %w", *ps.Name, err)
+			}
+			for _, p := range policies.AttachedManagedPolicies {
+				rec.ManagedPolicies = append(rec.ManagedPolicies, *p.Arn)
+			}
+		}
+
+		tpages := ssoadmin.NewListTagsForResourcePaginator(client, &ssoadmin.ListTagsForResourceInput{
+			InstanceArn: &it.instanceArn,
+			ResourceArn: &it.arn,
+		})
+		for tpages.HasMorePages() {
+			tags, err := tpages.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("permission set %s: listing tags: %w", *ps.Name, err)
+			}
+			for _, t := range tags.Tags {
+				rec.Tags = append(rec.Tags, types.Tag{Key: t.Key, Value: t.Value})
+			}
+		}
+
+		sets[i] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	selected := sets[:0]
+	for _, ps := range sets {
+		if ps.Arn != nil {
+			selected = append(selected, ps)
+		}
+	}
+	return selected, nil
+}
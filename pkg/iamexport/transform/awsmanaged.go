@@ -0,0 +1,60 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Attachment is the attachment of a managed policy to a group, role, user
+// or permission set.
+type Attachment struct {
+	// Type is the resource type of the group, role, user or permission
+	// set, e.g. "roles".
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	PolicyArn string `json:"policyArn"`
+}
+
+// IsAWSManaged reports whether arn is that of a policy managed by AWS,
+// e.g. arn:aws:iam::aws:policy/ReadOnlyAccess, rather than by an account.
+func IsAWSManaged(arn string) bool {
+	parts := strings.SplitN(arn, ":", 6)
+	return len(parts) == 6 && parts[2] == "iam" && parts[4] == "aws"
+}
+
+// DetachAWSManaged removes the AWS managed policies from the managed
+// policies of the groups, roles, users and permission sets of set, and
+// returns the attachments it removed.
+func DetachAWSManaged(set *model.ResourceSet) []Attachment {
+	var removed []Attachment
+	detach := func(typ string, name *string, arns []string) []string {
+		kept := arns[:0]
+		for _, arn := range arns {
+			if IsAWSManaged(arn) {
+				removed = append(removed, Attachment{Type: typ, Name: aws.ToString(name), PolicyArn: arn})
+				continue
+			}
+			kept = append(kept, arn)
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		return kept
+	}
+
+	for i, g := range set.Groups {
+		set.Groups[i].ManagedPolicyArns = detach("groups", g.Name, g.ManagedPolicyArns)
+	}
+	for i, r := range set.Roles {
+		set.Roles[i].ManagedPolicyArns = detach("roles", r.Name, r.ManagedPolicyArns)
+	}
+	for i, u := range set.Users {
+		set.Users[i].ManagedPolicyArns = detach("users", u.Name, u.ManagedPolicyArns)
+	}
+	for i, ps := range set.PermissionSets {
+		set.PermissionSets[i].ManagedPolicies = detach("sso-permission-sets", ps.Name, ps.ManagedPolicies)
+	}
+	return removed
+}
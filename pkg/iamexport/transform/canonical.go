@@ -0,0 +1,270 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+)
+
+// canonicalKeys is the order of the known elements of policy documents and
+// statements. Other keys follow them in alphabetical order.
+var canonicalKeys = map[string]int{
+	"Version":      1,
+	"Id":           2,
+	"Statement":    3,
+	"Sid":          4,
+	"Effect":       5,
+	"Principal":    6,
+	"NotPrincipal": 7,
+	"Action":       8,
+	"NotAction":    9,
+	"Resource":     10,
+	"NotResource":  11,
+	"Condition":    12,
+}
+
+// unorderedLists are the elements whose lists mean the same in any order.
+var unorderedLists = map[string]bool{
+	"Action":      true,
+	"NotAction":   true,
+	"Resource":    true,
+	"NotResource": true,
+}
+
+func sortKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := canonicalKeys[keys[i]], canonicalKeys[keys[j]]
+		if ri == 0 {
+			ri = len(canonicalKeys) + 1
+		}
+		if rj == 0 {
+			rj = len(canonicalKeys) + 1
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// canonicalValues sorts and deduplicates a list of values, and returns a
+// single value on its own rather than as a list.
+func canonicalValues(v interface{}) interface{} {
+	list, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	if len(list) == 1 {
+		return list[0]
+	}
+	strs := make([]string, 0, len(list))
+	for _, e := range list {
+		s, ok := e.(string)
+		if !ok {
+			// Lists of numbers, booleans or objects keep their order.
+			return v
+		}
+		strs = append(strs, s)
+	}
+	sort.Strings(strs)
+	var out []interface{}
+	for i, s := range strs {
+		if i == 0 || s != strs[i-1] {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 1 {
+		return out[0]
+	}
+	return out
+}
+
+// canonicalStatement normalizes the lists of a statement: actions,
+// resources, principals and condition values are sorted, and lists of
+// one value are replaced by the value.
+func canonicalStatement(s map[string]interface{}) {
+	for k, v := range s {
+		switch {
+		case unorderedLists[k]:
+			s[k] = canonicalValues(v)
+		case k == "Principal" || k == "NotPrincipal":
+			if m, ok := v.(map[string]interface{}); ok {
+				for typ, values := range m {
+					m[typ] = canonicalValues(values)
+				}
+			}
+		case k == "Condition":
+			if m, ok := v.(map[string]interface{}); ok {
+				for _, keys := range m {
+					if keys, ok := keys.(map[string]interface{}); ok {
+						for key, values := range keys {
+							keys[key] = canonicalValues(values)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// writeCanonical writes v as compact JSON with the keys of objects in
+// canonical order.
+func writeCanonical(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		b.WriteByte('{')
+		for i, k := range sortKeys(v) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSON(b, k); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := writeCanonical(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case []interface{}:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	default:
+		return writeJSON(b, v)
+	}
+	return nil
+}
+
+// CanonicalDocument returns the policy document doc in a canonical form,
+// so that documents granting the same permissions in a different layout
+// compare equal: the elements are in the conventional order, the lists of
+// actions, resources, principals and condition values are sorted, lists of
+// one value are replaced by the value, and statements are sorted by Sid,
+// then by content. The result is indented the same way as fetched
+// documents.
+func CanonicalDocument(doc string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var d map[string]interface{}
+	if err := dec.Decode(&d); err != nil {
+		return "", err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return "", fmt.Errorf("unexpected data after JSON document")
+	}
+
+	if s, ok := d["Statement"].(map[string]interface{}); ok {
+		d["Statement"] = []interface{}{s}
+	}
+	if statements, ok := d["Statement"].([]interface{}); ok {
+		type keyed struct {
+			sid, text string
+			s         interface{}
+		}
+		list := make([]keyed, len(statements))
+		for i, s := range statements {
+			m, ok := s.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("statement %d is not an object", i)
+			}
+			canonicalStatement(m)
+			b := bytes.Buffer{}
+			if err := writeCanonical(&b, m); err != nil {
+				return "", err
+			}
+			sid, _ := m["Sid"].(string)
+			list[i] = keyed{sid, b.String(), m}
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].sid != list[j].sid {
+				return list[i].sid < list[j].sid
+			}
+			return list[i].text < list[j].text
+		})
+		for i := range list {
+			statements[i] = list[i].s
+		}
+	}
+
+	b := bytes.Buffer{}
+	if err := writeCanonical(&b, d); err != nil {
+		return "", err
+	}
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, b.Bytes(), "", "  "); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func canonicalize(doc *string) error {
+	if doc == nil || *doc == "" {
+		return nil
+	}
+	out, err := CanonicalDocument(*doc)
+	if err != nil {
+		return err
+	}
+	*doc = out
+	return nil
+}
+
+func canonicalizePolicies(policies model.PolicyResources) error {
+	for i := range policies {
+		if err := canonicalize(policies[i].PolicyDocument); err != nil {
+			return fmt.Errorf("policy %s: %w", *policies[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Canonicalize rewrites every policy and trust policy document in
+// resources with CanonicalDocument, so that exporting the same account
+// twice writes the same documents.
+func Canonicalize(resources *model.ResourceSet) error {
+	if err := canonicalizePolicies(resources.Policies); err != nil {
+		return err
+	}
+	for _, g := range resources.Groups {
+		if err := canonicalizePolicies(g.Policies); err != nil {
+			return fmt.Errorf("group %s: %w", *g.Name, err)
+		}
+	}
+	for _, r := range resources.Roles {
+		if err := canonicalize(r.AssumeRolePolicyDocument); err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		if err := canonicalizePolicies(r.Policies); err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+	}
+	for _, u := range resources.Users {
+		if err := canonicalizePolicies(u.Policies); err != nil {
+			return fmt.Errorf("user %s: %w", *u.Name, err)
+		}
+	}
+	for _, ps := range resources.PermissionSets {
+		if err := canonicalize(ps.InlinePolicy); err != nil {
+			return fmt.Errorf("permission set %s: %w", *ps.Name, err)
+		}
+	}
+	return nil
+}
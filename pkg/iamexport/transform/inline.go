@@ -0,0 +1,130 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/internal/shorthash"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// maxManagedPolicyNameLen is the longest name IAM accepts for a managed
+// policy.
+const maxManagedPolicyNameLen = 128
+
+// inlineOwner is a role or group whose inline policies can be externalized.
+type inlineOwner struct {
+	kind     string
+	name     *string
+	arn      *string
+	policies *model.PolicyResources
+	arns     *[]string
+}
+
+// managedPolicyArn returns the ARN a managed policy called name would get
+// in the account and partition of ownerArn.
+func managedPolicyArn(ownerArn, name string) string {
+	parts := strings.SplitN(ownerArn, ":", 6)
+	if len(parts) < 6 {
+		return "policy/" + name
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:policy/%s", parts[1], parts[4], name)
+}
+
+// managedPolicyName keeps generated names within the IAM length limit,
+// replacing the tail with a hash when necessary.
+func managedPolicyName(name string) string {
+	if len(name) <= maxManagedPolicyNameLen {
+		return name
+	}
+	return name[:maxManagedPolicyNameLen-shorthash.Len-1] + "-" + shorthash.Sum(name)
+}
+
+// ExternalizeInline moves inline policies of roles, groups and users into
+// standalone managed policies attached through ManagedPolicyArns. With all
+// set, every inline policy is moved into a policy of its own. With dedupe
+// set, documents that occur more than once are moved into a single shared
+// policy attached to every owner. Names taken by another policy get a hash
+// suffix.
+func ExternalizeInline(set *model.ResourceSet, all, dedupe bool) {
+	var owners []inlineOwner
+	for i := range set.Groups {
+		g := &set.Groups[i]
+		owners = append(owners, inlineOwner{"group", g.Name, g.Arn, &g.Policies, &g.ManagedPolicyArns})
+	}
+	for i := range set.Roles {
+		r := &set.Roles[i]
+		owners = append(owners, inlineOwner{"role", r.Name, r.Arn, &r.Policies, &r.ManagedPolicyArns})
+	}
+	for i := range set.Users {
+		u := &set.Users[i]
+		owners = append(owners, inlineOwner{"user", u.Name, u.Arn, &u.Policies, &u.ManagedPolicyArns})
+	}
+
+	count := map[string]int{}
+	if dedupe {
+		for _, o := range owners {
+			for _, p := range *o.policies {
+				count[*p.PolicyDocument]++
+			}
+		}
+	}
+
+	// Managed policy names are unique in the account, whatever their path:
+	// a name already taken, e.g. by role a-b with policy c and role a with
+	// policy b-c, gets a hash of key.
+	taken := map[string]bool{}
+	for _, p := range set.Policies {
+		taken[aws.ToString(p.Name)] = true
+	}
+	unique := func(name, key string) string {
+		n := managedPolicyName(name)
+		if taken[n] {
+			n = managedPolicyName(name + "-" + shorthash.Sum(key))
+		}
+		taken[n] = true
+		return n
+	}
+
+	add := func(name, description string, o inlineOwner, p model.PolicyResource) string {
+		path := "/"
+		arn := managedPolicyArn(*o.arn, name)
+		set.Policies = append(set.Policies, model.PolicyResource{
+			Arn:            &arn,
+			Description:    &description,
+			Name:           &name,
+			Path:           &path,
+			PolicyDocument: p.PolicyDocument,
+		})
+		return arn
+	}
+
+	shared := map[string]string{}
+	for _, o := range owners {
+		var keep model.PolicyResources
+		for _, p := range *o.policies {
+			doc := *p.PolicyDocument
+			switch {
+			case count[doc] > 1:
+				arn, ok := shared[doc]
+				if !ok {
+					name := unique(*p.Name+"-"+shorthash.Sum(doc), *p.Name+"\x00"+doc)
+					arn = add(name, fmt.Sprintf("Shared inline policy %s", *p.Name), o, p)
+					shared[doc] = arn
+				}
+				// An owner with the same document twice attaches the
+				// shared policy once.
+				if !contains(*o.arns, arn) {
+					*o.arns = append(*o.arns, arn)
+				}
+			case all:
+				name := unique(*o.name+"-"+*p.Name, o.kind+"/"+*o.name+"/"+*p.Name)
+				*o.arns = append(*o.arns, add(name, fmt.Sprintf("Inline policy %s of %s %s", *p.Name, o.kind, *o.name), o, p))
+			default:
+				keep = append(keep, p)
+			}
+		}
+		*o.policies = keep
+	}
+}
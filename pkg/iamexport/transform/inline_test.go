@@ -0,0 +1,73 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestExternalizeInlineDedupe(t *testing.T) {
+	doc := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	inline := func(name string) model.PolicyResource {
+		return model.PolicyResource{Name: aws.String(name), PolicyDocument: aws.String(doc)}
+	}
+	set := &model.ResourceSet{
+		Roles: model.RoleResources{
+			{Name: aws.String("app"), Arn: aws.String("arn:aws:iam::123456789012:role/app"), Policies: model.PolicyResources{inline("read"), inline("read-again")}},
+			{Name: aws.String("ci"), Arn: aws.String("arn:aws:iam::123456789012:role/ci"), Policies: model.PolicyResources{inline("read")}},
+		},
+	}
+	ExternalizeInline(set, false, true)
+
+	if len(set.Policies) != 1 {
+		t.Fatalf("got %d managed policies, want 1 shared policy", len(set.Policies))
+	}
+	arn := *set.Policies[0].Arn
+	for _, r := range set.Roles {
+		if len(r.Policies) != 0 {
+			t.Errorf("role %s kept %d inline policies", *r.Name, len(r.Policies))
+		}
+		if len(r.ManagedPolicyArns) != 1 || r.ManagedPolicyArns[0] != arn {
+			t.Errorf("role %s has the managed policies %v, want [%s]", *r.Name, r.ManagedPolicyArns, arn)
+		}
+	}
+}
+
+func TestExternalizeInlineNameCollisions(t *testing.T) {
+	doc := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	role := func(name, policy string) model.RoleResource {
+		return model.RoleResource{
+			Name:     aws.String(name),
+			Arn:      aws.String("arn:aws:iam::123456789012:role/" + name),
+			Policies: model.PolicyResources{{Name: aws.String(policy), PolicyDocument: aws.String(doc)}},
+		}
+	}
+	set := &model.ResourceSet{
+		Policies: model.PolicyResources{{Name: aws.String("app-read"), Arn: aws.String("arn:aws:iam::123456789012:policy/ci/app-read")}},
+		Roles:    model.RoleResources{role("a-b", "c"), role("a", "b-c"), role("app", "read")},
+	}
+	ExternalizeInline(set, true, false)
+
+	names := map[string]bool{}
+	for _, p := range set.Policies {
+		if names[*p.Name] {
+			t.Errorf("two managed policies are called %s", *p.Name)
+		}
+		names[*p.Name] = true
+	}
+	if len(names) != 4 {
+		t.Fatalf("got the managed policies %v, want 4", names)
+	}
+	if !names["a-b-c"] {
+		t.Errorf("the first policy called a-b-c was renamed: %v", names)
+	}
+	for _, r := range set.Roles {
+		if len(r.ManagedPolicyArns) != 1 {
+			t.Fatalf("role %s has the managed policies %v, want its own", *r.Name, r.ManagedPolicyArns)
+		}
+	}
+	if set.Roles[0].ManagedPolicyArns[0] == set.Roles[1].ManagedPolicyArns[0] {
+		t.Errorf("roles a-b and a attach the same policy %s", set.Roles[0].ManagedPolicyArns[0])
+	}
+}
@@ -0,0 +1,260 @@
+// Package transform rewrites the resource model between fetching and
+// rendering.
+package transform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Parameterizer rewrites account specific values in policy documents into
+// Fn::Sub expressions over the AWS::AccountId, AWS::Region and
+// AWS::Partition pseudo parameters, so templates can be deployed to other
+// accounts, regions and partitions.
+type Parameterizer struct {
+	AccountID string
+	Region    string
+	Partition string
+}
+
+// CallerIdentityClient is the subset of the STS API used to look up the
+// current account.
+type CallerIdentityClient interface {
+	GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// NewParameterizer looks up the account and partition of the credentials
+// used by client. Region may be empty, in which case regions are left as
+// they are.
+func NewParameterizer(ctx context.Context, client CallerIdentityClient, region string) (*Parameterizer, error) {
+	id, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("looking up account ID: %w", err)
+	}
+
+	return ParameterizerFromArn(*id.Arn, region)
+}
+
+// ParameterizerFromArn takes the account and partition from arn, which is
+// useful when working offline from resources of the account.
+func ParameterizerFromArn(arn, region string) (*Parameterizer, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[4] == "" {
+		return nil, fmt.Errorf("no account ID in ARN %q", arn)
+	}
+
+	return &Parameterizer{
+		AccountID: parts[4],
+		Region:    region,
+		Partition: parts[1],
+	}, nil
+}
+
+// isWordByte reports whether c is a letter or digit, which can not border
+// an account ID replaced by sub.
+func isWordByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// replaceToken replaces the occurrences of old in s that are not part of a
+// longer run of letters and digits, e.g. the account ID of
+// arn:aws:iam::123456789012:root or logs-123456789012 but not of
+// 91234567890123.
+func replaceToken(s, old, new string) string {
+	b := strings.Builder{}
+	for {
+		i := strings.Index(s, old)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(old)
+		if (i > 0 && isWordByte(s[i-1])) || (end < len(s) && isWordByte(s[end])) {
+			b.WriteString(s[:i+1])
+			s = s[i+1:]
+			continue
+		}
+		b.WriteString(s[:i])
+		b.WriteString(new)
+		s = s[end:]
+	}
+}
+
+// arnRegion matches the region segment of ARNs: arn:<partition>:<service>:
+// followed by the region and a colon.
+var arnRegion = regexp.MustCompile(`arn:[^:]*:[^:]*:([^:]*):`)
+
+// replaceRegion replaces the region of s when it is the whole of s, e.g. a
+// condition on aws:RequestedRegion, or the region segment of an ARN.
+func replaceRegion(s, region, new string) string {
+	if s == region {
+		return new
+	}
+	return arnRegion.ReplaceAllStringFunc(s, func(m string) string {
+		sm := arnRegion.FindStringSubmatchIndex(m)
+		if m[sm[2]:sm[3]] != region {
+			return m
+		}
+		return m[:sm[2]] + new + m[sm[3]:]
+	})
+}
+
+// sub returns s as a Fn::Sub object when it references the account, region
+// or partition, and s unchanged otherwise. The account ID is only replaced
+// where it is not part of a longer number or word, and the region where it
+// is a whole value or the region of an ARN.
+func (p *Parameterizer) sub(s string) interface{} {
+	// Regions are replaced first, while the ARNs are still whole.
+	out := s
+	if p.Region != "" {
+		out = replaceRegion(out, p.Region, "${AWS::Region}")
+	}
+	out = strings.ReplaceAll(out, "arn:"+p.Partition+":", "arn:${AWS::Partition}:")
+	out = replaceToken(out, p.AccountID, "${AWS::AccountId}")
+	if out == s {
+		return s
+	}
+
+	// Escape IAM policy variables such as ${aws:username} that would
+	// otherwise be interpreted by Fn::Sub. The placeholders inserted above
+	// are the only ones that should be substituted.
+	out = strings.ReplaceAll(out, "${", "${!")
+	for _, v := range []string{"AWS::Partition", "AWS::AccountId", "AWS::Region"} {
+		out = strings.ReplaceAll(out, "${!"+v+"}", "${"+v+"}")
+	}
+
+	return map[string]string{"Fn::Sub": out}
+}
+
+func (p *Parameterizer) document(doc *string) error {
+	if doc == nil {
+		return nil
+	}
+	out, err := rewriteStrings(*doc, p.sub)
+	if err != nil {
+		return err
+	}
+	*doc = out
+	return nil
+}
+
+func (p *Parameterizer) policies(policies model.PolicyResources) error {
+	for i := range policies {
+		if err := p.document(policies[i].PolicyDocument); err != nil {
+			return fmt.Errorf("policy %s: %w", *policies[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Apply parameterizes every policy and trust policy document in resources.
+func (p *Parameterizer) Apply(resources *model.ResourceSet) error {
+	if err := p.policies(resources.Policies); err != nil {
+		return err
+	}
+	for _, g := range resources.Groups {
+		if err := p.policies(g.Policies); err != nil {
+			return fmt.Errorf("group %s: %w", *g.Name, err)
+		}
+	}
+	for _, r := range resources.Roles {
+		if err := p.document(r.AssumeRolePolicyDocument); err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+		if err := p.policies(r.Policies); err != nil {
+			return fmt.Errorf("role %s: %w", *r.Name, err)
+		}
+	}
+	for _, u := range resources.Users {
+		if err := p.policies(u.Policies); err != nil {
+			return fmt.Errorf("user %s: %w", *u.Name, err)
+		}
+	}
+	for _, ps := range resources.PermissionSets {
+		if err := p.document(ps.InlinePolicy); err != nil {
+			return fmt.Errorf("permission set %s: %w", *ps.Name, err)
+		}
+	}
+	return nil
+}
+
+// rewriteStrings replaces every string value in the JSON document doc with
+// the result of fn, keeping the original key order, and returns the
+// document indented the same way as decodePolicy.
+func rewriteStrings(doc string, fn func(string) interface{}) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+
+	b := bytes.Buffer{}
+	if err := copyJSONValue(dec, &b, fn); err != nil {
+		return "", err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return "", fmt.Errorf("unexpected data after JSON document")
+	}
+
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, b.Bytes(), "", "  "); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func copyJSONValue(dec *json.Decoder, b *bytes.Buffer, fn func(string) interface{}) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		b.WriteRune(rune(t))
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if t == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := writeJSON(b, key); err != nil {
+					return err
+				}
+				b.WriteByte(':')
+			}
+			if err := copyJSONValue(dec, b, fn); err != nil {
+				return err
+			}
+		}
+		end, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		b.WriteRune(rune(end.(json.Delim)))
+		return nil
+	case string:
+		return writeJSON(b, fn(t))
+	default:
+		return writeJSON(b, t)
+	}
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	// Encode terminates every value with a newline.
+	b.Truncate(b.Len() - 1)
+	return nil
+}
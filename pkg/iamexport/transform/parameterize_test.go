@@ -0,0 +1,34 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParameterizerSub(t *testing.T) {
+	p := &Parameterizer{AccountID: "123456789012", Region: "us-east-1", Partition: "aws"}
+	sub := func(s string) map[string]string { return map[string]string{"Fn::Sub": s} }
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"arn:aws:iam::123456789012:role/app", sub("arn:${AWS::Partition}:iam::${AWS::AccountId}:role/app")},
+		{"arn:aws:sqs:us-east-1:123456789012:queue", sub("arn:${AWS::Partition}:sqs:${AWS::Region}:${AWS::AccountId}:queue")},
+		{"123456789012", sub("${AWS::AccountId}")},
+		{"logs-123456789012", sub("logs-${AWS::AccountId}")},
+		{"us-east-1", sub("${AWS::Region}")},
+		{"arn:aws:s3:::bucket-${aws:username}-123456789012/*", sub("arn:${AWS::Partition}:s3:::bucket-${!aws:username}-${AWS::AccountId}/*")},
+		// Other numbers and names containing the values are left alone.
+		{"91234567890123", "91234567890123"},
+		{"1234567890123", "1234567890123"},
+		{"app-us-east-1-logs", "app-us-east-1-logs"},
+		{"us-east-1a", "us-east-1a"},
+		{"arn:aws:s3:::us-east-1-bucket/*", sub("arn:${AWS::Partition}:s3:::us-east-1-bucket/*")},
+		{"*", "*"},
+	}
+	for _, tt := range tests {
+		if got := p.sub(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sub(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
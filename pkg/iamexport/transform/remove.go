@@ -0,0 +1,45 @@
+package transform
+
+import (
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+)
+
+// RemoveRoles drops the roles with the given names from set and returns the
+// names of those it removed.
+func RemoveRoles(set *model.ResourceSet, names ...string) []string {
+	drop := map[string]bool{}
+	for _, n := range names {
+		drop[n] = true
+	}
+
+	var removed []string
+	kept := set.Roles[:0]
+	for _, r := range set.Roles {
+		if drop[*r.Name] {
+			removed = append(removed, *r.Name)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	set.Roles = kept
+	return removed
+}
+
+// UnusedRoles returns the names of the roles in set that were not assumed
+// since since. A role that was never assumed is unused when it was created
+// before since.
+func UnusedRoles(set *model.ResourceSet, since time.Time) []string {
+	var unused []string
+	for _, r := range set.Roles {
+		last := r.LastUsed
+		if last == nil {
+			last = r.CreateDate
+		}
+		if last != nil && last.Before(since) {
+			unused = append(unused, *r.Name)
+		}
+	}
+	return unused
+}
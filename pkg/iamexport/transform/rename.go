@@ -0,0 +1,203 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+)
+
+// RenameRule rewrites the names matching Pattern to Replacement, which may
+// refer to submatches as $1, as regexp.ReplaceAllString does.
+type RenameRule struct {
+	// Type is the resource type the rule applies to, e.g. "roles", or ""
+	// for groups, managed policies, roles and users alike.
+	Type        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+var renameTypes = map[string]bool{"groups": true, "policies": true, "roles": true, "users": true}
+
+// ParseRenameRule parses a rule written as [<type>:]<pattern>=<replacement>,
+// e.g. roles:^legacy-= to strip the legacy- prefix of role names, or
+// $=-imported to add an -imported suffix to every name.
+func ParseRenameRule(s string) (RenameRule, error) {
+	var rule RenameRule
+	if i := strings.IndexByte(s, ':'); i > 0 && renameTypes[s[:i]] {
+		rule.Type, s = s[:i], s[i+1:]
+	}
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return rule, fmt.Errorf("invalid rename rule %q, must be [<type>:]<pattern>=<replacement>", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return rule, fmt.Errorf("invalid rename rule %q: %w", s, err)
+	}
+	rule.Pattern, rule.Replacement = re, s[i+1:]
+	return rule, nil
+}
+
+// renamer applies rename rules, recording the ARNs of the resources it
+// renames.
+type renamer struct {
+	rules []RenameRule
+	// arns maps the ARN of every renamed resource to its ARN once renamed.
+	arns map[string]string
+}
+
+// rename applies the rules for typ to the name of the resource at arn,
+// recording the new ARN of the resource.
+func (r *renamer) rename(typ string, name, arn *string) error {
+	if name == nil {
+		return nil
+	}
+	renamed := *name
+	for _, rule := range r.rules {
+		if rule.Type == "" || rule.Type == typ {
+			renamed = rule.Pattern.ReplaceAllString(renamed, rule.Replacement)
+		}
+	}
+	if renamed == *name {
+		return nil
+	}
+	if renamed == "" {
+		return fmt.Errorf("%s %s: renamed to an empty name", strings.TrimSuffix(typ, "s"), *name)
+	}
+	if arn != nil && strings.HasSuffix(*arn, "/"+*name) {
+		r.arns[*arn] = strings.TrimSuffix(*arn, *name) + renamed
+	}
+	*name = renamed
+	return nil
+}
+
+// isNameChar reports whether c may be part of an IAM name.
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("+=,.@_-", c) >= 0
+}
+
+// arn replaces the ARNs of renamed resources at the start of s, e.g. in
+// arn:aws:iam::123456789012:role/legacy-app or a role/legacy-app/* path.
+func (r *renamer) arn(s string) interface{} {
+	for old, renamed := range r.arns {
+		if strings.HasPrefix(s, old) && (len(s) == len(old) || !isNameChar(s[len(old)])) {
+			return renamed + s[len(old):]
+		}
+	}
+	return s
+}
+
+func (r *renamer) document(doc *string) error {
+	if doc == nil {
+		return nil
+	}
+	out, err := rewriteStrings(*doc, r.arn)
+	if err != nil {
+		return err
+	}
+	*doc = out
+	return nil
+}
+
+func (r *renamer) policies(policies model.PolicyResources) error {
+	for i := range policies {
+		if err := r.document(policies[i].PolicyDocument); err != nil {
+			return fmt.Errorf("policy %s: %w", *policies[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Rename applies rules, in order, to the names of the groups, managed
+// policies, roles and users in set, so that they are created under new
+// names. Group memberships, MFA devices and instance profiles follow the
+// groups, users and roles they refer to, and so do the ARNs of renamed resources in policy and
+// trust documents. The ARNs of the resources themselves are kept, as they
+// name the resources exported.
+func Rename(set *model.ResourceSet, rules []RenameRule) error {
+	r := &renamer{rules: rules, arns: map[string]string{}}
+
+	groups := map[string]string{}
+	for i := range set.Groups {
+		g := &set.Groups[i]
+		old := *g.Name
+		if err := r.rename("groups", g.Name, g.Arn); err != nil {
+			return err
+		}
+		groups[old] = *g.Name
+	}
+	for i := range set.Policies {
+		if err := r.rename("policies", set.Policies[i].Name, set.Policies[i].Arn); err != nil {
+			return err
+		}
+	}
+	roles := map[string]string{}
+	for i := range set.Roles {
+		old := *set.Roles[i].Name
+		if err := r.rename("roles", set.Roles[i].Name, set.Roles[i].Arn); err != nil {
+			return err
+		}
+		roles[old] = *set.Roles[i].Name
+	}
+	users := map[string]string{}
+	for i := range set.Users {
+		u := &set.Users[i]
+		old := *u.Name
+		if err := r.rename("users", u.Name, u.Arn); err != nil {
+			return err
+		}
+		users[old] = *u.Name
+		for j, g := range u.Groups {
+			if renamed, ok := groups[g]; ok {
+				u.Groups[j] = renamed
+			}
+		}
+	}
+	for _, d := range set.VirtualMFADevices {
+		for j, u := range d.Users {
+			if renamed, ok := users[u]; ok {
+				d.Users[j] = renamed
+			}
+		}
+	}
+	for _, p := range set.InstanceProfiles {
+		for j, role := range p.Roles {
+			if renamed, ok := roles[role]; ok {
+				p.Roles[j] = renamed
+			}
+		}
+	}
+	if len(r.arns) == 0 {
+		return nil
+	}
+
+	if err := r.policies(set.Policies); err != nil {
+		return err
+	}
+	for _, g := range set.Groups {
+		if err := r.policies(g.Policies); err != nil {
+			return fmt.Errorf("group %s: %w", *g.Name, err)
+		}
+	}
+	for _, ro := range set.Roles {
+		if err := r.document(ro.AssumeRolePolicyDocument); err != nil {
+			return fmt.Errorf("role %s: %w", *ro.Name, err)
+		}
+		if err := r.policies(ro.Policies); err != nil {
+			return fmt.Errorf("role %s: %w", *ro.Name, err)
+		}
+	}
+	for _, u := range set.Users {
+		if err := r.policies(u.Policies); err != nil {
+			return fmt.Errorf("user %s: %w", *u.Name, err)
+		}
+	}
+	for _, ps := range set.PermissionSets {
+		if err := r.document(ps.InlinePolicy); err != nil {
+			return fmt.Errorf("permission set %s: %w", *ps.Name, err)
+		}
+	}
+	return nil
+}
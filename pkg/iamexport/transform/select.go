@@ -0,0 +1,130 @@
+package transform
+
+import (
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Filter keeps the groups, managed policies, roles, users, server
+// certificates, virtual MFA devices, instance profiles, identity providers
+// and permission sets of set for which
+// keep returns true, given their resource type, e.g. "roles", name and
+// ARN, and returns the number of resources it removed. The account
+// settings are kept.
+func Filter(set *model.ResourceSet, keep func(typ, name, arn string) bool) int {
+	removed := 0
+	kept := func(typ string, name, arn *string) bool {
+		if keep(typ, aws.ToString(name), aws.ToString(arn)) {
+			return true
+		}
+		removed++
+		return false
+	}
+
+	groups := set.Groups[:0]
+	for _, g := range set.Groups {
+		if kept("groups", g.Name, g.Arn) {
+			groups = append(groups, g)
+		}
+	}
+	set.Groups = groups
+
+	policies := set.Policies[:0]
+	for _, p := range set.Policies {
+		if kept("policies", p.Name, p.Arn) {
+			policies = append(policies, p)
+		}
+	}
+	set.Policies = policies
+
+	roles := set.Roles[:0]
+	for _, r := range set.Roles {
+		if kept("roles", r.Name, r.Arn) {
+			roles = append(roles, r)
+		}
+	}
+	set.Roles = roles
+
+	users := set.Users[:0]
+	for _, u := range set.Users {
+		if kept("users", u.Name, u.Arn) {
+			users = append(users, u)
+		}
+	}
+	set.Users = users
+
+	certs := set.ServerCertificates[:0]
+	for _, c := range set.ServerCertificates {
+		if kept("server-certificates", c.Name, c.Arn) {
+			certs = append(certs, c)
+		}
+	}
+	set.ServerCertificates = certs
+
+	devices := set.VirtualMFADevices[:0]
+	for _, d := range set.VirtualMFADevices {
+		if kept("virtual-mfa-devices", d.Name, d.Arn) {
+			devices = append(devices, d)
+		}
+	}
+	set.VirtualMFADevices = devices
+
+	profiles := set.InstanceProfiles[:0]
+	for _, p := range set.InstanceProfiles {
+		if kept("instance-profiles", p.Name, p.Arn) {
+			profiles = append(profiles, p)
+		}
+	}
+	set.InstanceProfiles = profiles
+
+	providers := set.Providers[:0]
+	for _, p := range set.Providers {
+		if kept("providers", p.Name, p.Arn) {
+			providers = append(providers, p)
+		}
+	}
+	set.Providers = providers
+
+	permissionSets := set.PermissionSets[:0]
+	for _, ps := range set.PermissionSets {
+		if kept("sso-permission-sets", ps.Name, ps.Arn) {
+			permissionSets = append(permissionSets, ps)
+		}
+	}
+	set.PermissionSets = permissionSets
+
+	return removed
+}
+
+// SelectNames keeps the resources of set whose name or ARN is in names, as
+// Filter does, and returns the names that matched none of them.
+func SelectNames(set *model.ResourceSet, names []string) []string {
+	matched := map[string]bool{}
+	Filter(set, func(_, name, arn string) bool {
+		ok := false
+		for _, v := range []string{name, arn} {
+			if v != "" && contains(names, v) {
+				matched[v] = true
+				ok = true
+			}
+		}
+		return ok
+	})
+
+	var missing []string
+	for _, n := range names {
+		if !matched[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"sort"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// Sort orders the resources of set by name, and their lists whose order
+// does not matter, such as tags, attached managed policies and group
+// memberships, so that exports of the same resources are identical
+// whatever order IAM or the input listed them in.
+func Sort(set *model.ResourceSet) {
+	sort.SliceStable(set.Groups, func(i, j int) bool {
+		return aws.ToString(set.Groups[i].Name) < aws.ToString(set.Groups[j].Name)
+	})
+	for _, g := range set.Groups {
+		sort.Strings(g.ManagedPolicyArns)
+		sortPolicies(g.Policies)
+	}
+
+	sortPolicies(set.Policies)
+	for _, p := range set.Policies {
+		sortTags(p.Tags)
+	}
+
+	sort.SliceStable(set.Roles, func(i, j int) bool {
+		return aws.ToString(set.Roles[i].Name) < aws.ToString(set.Roles[j].Name)
+	})
+	for _, r := range set.Roles {
+		sort.Strings(r.ManagedPolicyArns)
+		sortPolicies(r.Policies)
+		sortTags(r.Tags)
+	}
+
+	sort.SliceStable(set.Users, func(i, j int) bool {
+		return aws.ToString(set.Users[i].Name) < aws.ToString(set.Users[j].Name)
+	})
+	for _, u := range set.Users {
+		sort.Strings(u.Groups)
+		sort.Strings(u.ManagedPolicyArns)
+		sortPolicies(u.Policies)
+		sortTags(u.Tags)
+	}
+
+	sort.SliceStable(set.ServerCertificates, func(i, j int) bool {
+		return aws.ToString(set.ServerCertificates[i].Name) < aws.ToString(set.ServerCertificates[j].Name)
+	})
+	for _, c := range set.ServerCertificates {
+		sortTags(c.Tags)
+	}
+
+	sort.SliceStable(set.VirtualMFADevices, func(i, j int) bool {
+		return aws.ToString(set.VirtualMFADevices[i].Name) < aws.ToString(set.VirtualMFADevices[j].Name)
+	})
+	for _, d := range set.VirtualMFADevices {
+		sort.Strings(d.Users)
+		sortTags(d.Tags)
+	}
+
+	sort.SliceStable(set.InstanceProfiles, func(i, j int) bool {
+		return aws.ToString(set.InstanceProfiles[i].Name) < aws.ToString(set.InstanceProfiles[j].Name)
+	})
+
+	sort.SliceStable(set.Providers, func(i, j int) bool {
+		return aws.ToString(set.Providers[i].Name) < aws.ToString(set.Providers[j].Name)
+	})
+	for _, p := range set.Providers {
+		sort.Strings(p.ClientIDs)
+		sort.Strings(p.Thumbprints)
+		sortTags(p.Tags)
+	}
+
+	sort.SliceStable(set.PermissionSets, func(i, j int) bool {
+		return aws.ToString(set.PermissionSets[i].Name) < aws.ToString(set.PermissionSets[j].Name)
+	})
+	for _, ps := range set.PermissionSets {
+		sort.Strings(ps.ManagedPolicies)
+		sortTags(ps.Tags)
+	}
+}
+
+func sortPolicies(policies model.PolicyResources) {
+	sort.SliceStable(policies, func(i, j int) bool {
+		return aws.ToString(policies[i].Name) < aws.ToString(policies[j].Name)
+	})
+}
+
+func sortTags(tags []types.Tag) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		return aws.ToString(tags[i].Key) < aws.ToString(tags[j].Key)
+	})
+}
@@ -0,0 +1,164 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// ParseTag parses a tag written as <key>=<value>. The value may be empty.
+func ParseTag(s string) (types.Tag, error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return types.Tag{}, fmt.Errorf("invalid tag %q, must be <key>=<value>", s)
+	}
+	return types.Tag{Key: aws.String(s[:i]), Value: aws.String(s[i+1:])}, nil
+}
+
+// AddTags sets tags on the taggable resources of set: managed policies,
+// roles, users, server certificates, virtual MFA devices, identity
+// providers and permission sets. A tag replaces the value of the tag a
+// resource already has with the same key. Groups and instance profiles can
+// not be tagged.
+func AddTags(set *model.ResourceSet, tags []types.Tag) {
+	for i := range set.Policies {
+		set.Policies[i].Tags = addTags(set.Policies[i].Tags, tags)
+	}
+	for i := range set.Roles {
+		set.Roles[i].Tags = addTags(set.Roles[i].Tags, tags)
+	}
+	for i := range set.Users {
+		set.Users[i].Tags = addTags(set.Users[i].Tags, tags)
+	}
+	for i := range set.ServerCertificates {
+		set.ServerCertificates[i].Tags = addTags(set.ServerCertificates[i].Tags, tags)
+	}
+	for i := range set.VirtualMFADevices {
+		set.VirtualMFADevices[i].Tags = addTags(set.VirtualMFADevices[i].Tags, tags)
+	}
+	for i := range set.Providers {
+		set.Providers[i].Tags = addTags(set.Providers[i].Tags, tags)
+	}
+	for i := range set.PermissionSets {
+		set.PermissionSets[i].Tags = addTags(set.PermissionSets[i].Tags, tags)
+	}
+}
+
+func addTags(tags, added []types.Tag) []types.Tag {
+	l := make([]types.Tag, 0, len(tags)+len(added))
+	for _, t := range tags {
+		if !hasTag(added, aws.ToString(t.Key)) {
+			l = append(l, t)
+		}
+	}
+	l = append(l, added...)
+	sortTags(l)
+	return l
+}
+
+func hasTag(tags []types.Tag, key string) bool {
+	for _, t := range tags {
+		if aws.ToString(t.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludeTags removes the tags whose key starts with one of prefixes, e.g.
+// aws: or cdk-, from the taggable resources of set.
+func ExcludeTags(set *model.ResourceSet, prefixes []string) {
+	for i := range set.Policies {
+		set.Policies[i].Tags = excludeTags(set.Policies[i].Tags, prefixes)
+	}
+	for i := range set.Roles {
+		set.Roles[i].Tags = excludeTags(set.Roles[i].Tags, prefixes)
+	}
+	for i := range set.Users {
+		set.Users[i].Tags = excludeTags(set.Users[i].Tags, prefixes)
+	}
+	for i := range set.ServerCertificates {
+		set.ServerCertificates[i].Tags = excludeTags(set.ServerCertificates[i].Tags, prefixes)
+	}
+	for i := range set.VirtualMFADevices {
+		set.VirtualMFADevices[i].Tags = excludeTags(set.VirtualMFADevices[i].Tags, prefixes)
+	}
+	for i := range set.Providers {
+		set.Providers[i].Tags = excludeTags(set.Providers[i].Tags, prefixes)
+	}
+	for i := range set.PermissionSets {
+		set.PermissionSets[i].Tags = excludeTags(set.PermissionSets[i].Tags, prefixes)
+	}
+}
+
+func excludeTags(tags []types.Tag, prefixes []string) []types.Tag {
+	var l []types.Tag
+	for _, t := range tags {
+		excluded := false
+		for _, p := range prefixes {
+			if strings.HasPrefix(aws.ToString(t.Key), p) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			l = append(l, t)
+		}
+	}
+	return l
+}
+
+// Untagged is a resource lacking required tags.
+type Untagged struct {
+	// Type is the type of the resource, e.g. role, and Name its name.
+	Type string
+	Name string
+	// Missing are the keys of the required tags it lacks.
+	Missing []string
+}
+
+func (u Untagged) String() string {
+	return fmt.Sprintf("%s/%s: %s", u.Type, u.Name, strings.Join(u.Missing, ", "))
+}
+
+// MissingTags returns the taggable resources of set that lack a tag with
+// one of keys, in the order of set.
+func MissingTags(set *model.ResourceSet, keys []string) []Untagged {
+	var l []Untagged
+	check := func(typ string, name *string, tags []types.Tag) {
+		var missing []string
+		for _, k := range keys {
+			if !hasTag(tags, k) {
+				missing = append(missing, k)
+			}
+		}
+		if len(missing) > 0 {
+			l = append(l, Untagged{Type: typ, Name: aws.ToString(name), Missing: missing})
+		}
+	}
+	for _, p := range set.Policies {
+		check("policy", p.Name, p.Tags)
+	}
+	for _, r := range set.Roles {
+		check("role", r.Name, r.Tags)
+	}
+	for _, u := range set.Users {
+		check("user", u.Name, u.Tags)
+	}
+	for _, c := range set.ServerCertificates {
+		check("server-certificate", c.Name, c.Tags)
+	}
+	for _, d := range set.VirtualMFADevices {
+		check("virtual-mfa-device", d.Name, d.Tags)
+	}
+	for _, p := range set.Providers {
+		check("provider", p.Name, p.Tags)
+	}
+	for _, ps := range set.PermissionSets {
+		check("permission-set", ps.Name, ps.Tags)
+	}
+	return l
+}
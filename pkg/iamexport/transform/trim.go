@@ -0,0 +1,224 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// jsonMember is a member of a JSON object.
+type jsonMember struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// jsonObject is a JSON object that keeps the order of its members.
+type jsonObject []jsonMember
+
+func (o *jsonObject) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("expected a JSON object: %s", b)
+	}
+	*o = nil
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		*o = append(*o, jsonMember{key.(string), v})
+	}
+	return nil
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	b := bytes.Buffer{}
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := writeJSON(&b, m.Key); err != nil {
+			return nil, err
+		}
+		b.WriteByte(':')
+		b.Write(m.Value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (o jsonObject) get(key string) json.RawMessage {
+	for _, m := range o {
+		if m.Key == key {
+			return m.Value
+		}
+	}
+	return nil
+}
+
+func (o jsonObject) set(key string, v json.RawMessage) jsonObject {
+	for i, m := range o {
+		if m.Key == key {
+			o[i].Value = v
+			return o
+		}
+	}
+	return append(o, jsonMember{key, v})
+}
+
+// trimStatement removes the actions of the unused services from the Allow
+// statement s. It returns false when no action is left.
+func trimStatement(s jsonObject, unused map[string]bool) (jsonObject, bool, error) {
+	var effect string
+	if err := json.Unmarshal(s.get("Effect"), &effect); err != nil || effect != "Allow" || s.get("Action") == nil {
+		return s, true, nil
+	}
+
+	var actions []string
+	raw := s.get("Action")
+	if err := json.Unmarshal(raw, &actions); err != nil {
+		var action string
+		if err := json.Unmarshal(raw, &action); err != nil {
+			return nil, false, fmt.Errorf("Action: expected a string or a list of strings: %s", raw)
+		}
+		actions = []string{action}
+	}
+
+	var kept []string
+	for _, a := range actions {
+		service := strings.ToLower(strings.SplitN(a, ":", 2)[0])
+		if !strings.Contains(a, ":") || !unused[service] {
+			kept = append(kept, a)
+		}
+	}
+	if len(kept) == len(actions) {
+		return s, true, nil
+	}
+	if len(kept) == 0 {
+		return nil, false, nil
+	}
+
+	var v interface{} = kept
+	if len(kept) == 1 {
+		v = kept[0]
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.set("Action", b), true, nil
+}
+
+// trimServices returns doc without the actions of the services in unused,
+// keeping the order of its elements. Statements left without actions are
+// removed. It returns "" when doc allows nothing of the unused services,
+// or nothing but them.
+func trimServices(doc string, unused []string) (string, error) {
+	services := map[string]bool{}
+	for _, s := range unused {
+		services[strings.ToLower(s)] = true
+	}
+
+	var d jsonObject
+	if err := json.Unmarshal([]byte(doc), &d); err != nil {
+		return "", err
+	}
+	raw := bytes.TrimSpace(d.get("Statement"))
+	var statements []jsonObject
+	if len(raw) > 0 && raw[0] == '{' {
+		statements = make([]jsonObject, 1)
+		if err := json.Unmarshal(raw, &statements[0]); err != nil {
+			return "", err
+		}
+	} else if err := json.Unmarshal(raw, &statements); err != nil {
+		return "", err
+	}
+
+	trimmed := []jsonObject{}
+	changed := false
+	for _, s := range statements {
+		before, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		s, keep, err := trimStatement(s, services)
+		if err != nil {
+			return "", err
+		}
+		if !keep {
+			changed = true
+			continue
+		}
+		after, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		changed = changed || !bytes.Equal(before, after)
+		trimmed = append(trimmed, s)
+	}
+	if !changed || len(trimmed) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(trimmed)
+	if err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(d.set("Statement", b))
+	if err != nil {
+		return "", err
+	}
+	indented := bytes.Buffer{}
+	if err := json.Indent(&indented, out, "", "  "); err != nil {
+		return "", err
+	}
+	return indented.String(), nil
+}
+
+// TrimUnusedServices proposes narrower policies for the roles and managed
+// policies in set that have UnusedServices, without the actions of those
+// services: the inline policies of roles as ProposedPolicies called
+// <policy>-trimmed, and managed policies as their ProposedDocument.
+func TrimUnusedServices(set *model.ResourceSet) error {
+	for i := range set.Roles {
+		r := &set.Roles[i]
+		if len(r.UnusedServices) == 0 {
+			continue
+		}
+		for _, p := range r.Policies {
+			doc, err := trimServices(*p.PolicyDocument, r.UnusedServices)
+			if err != nil {
+				return fmt.Errorf("role %s: policy %s: %w", *r.Name, *p.Name, err)
+			}
+			if doc != "" {
+				r.ProposedPolicies = append(r.ProposedPolicies, model.PolicyResource{
+					Name:           aws.String(*p.Name + "-trimmed"),
+					PolicyDocument: aws.String(doc),
+				})
+			}
+		}
+	}
+	for i := range set.Policies {
+		p := &set.Policies[i]
+		if len(p.UnusedServices) == 0 {
+			continue
+		}
+		doc, err := trimServices(*p.PolicyDocument, p.UnusedServices)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *p.Name, err)
+		}
+		if doc != "" {
+			p.ProposedDocument = aws.String(doc)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package iamexport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+)
+
+// ResourceField returns a pointer to the field of set holding the
+// resources of type typ, as named on the command line, e.g. roles, or nil
+// when typ is not a resource type.
+func ResourceField(set *model.ResourceSet, typ string) interface{} {
+	switch typ {
+	case "groups":
+		return &set.Groups
+	case "policies":
+		return &set.Policies
+	case "roles":
+		return &set.Roles
+	case "users":
+		return &set.Users
+	case "server-certificates":
+		return &set.ServerCertificates
+	case "virtual-mfa-devices":
+		return &set.VirtualMFADevices
+	case "instance-profiles":
+		return &set.InstanceProfiles
+	case "providers":
+		return &set.Providers
+	case "account":
+		return &set.Account
+	case "sso-permission-sets":
+		return &set.PermissionSets
+	}
+	return nil
+}
+
+// Fetch fetches the resources of type typ, as named on the command line,
+// e.g. roles, into their field of set, with the fetch function of the
+// type. Permission sets are fetched with sso, every other type with
+// client.
+func Fetch(ctx context.Context, client Client, sso SSOAdminClient, typ string, set *model.ResourceSet, opts FetchOptions) error {
+	var err error
+	switch typ {
+	case "groups":
+		set.Groups, err = FetchGroups(ctx, client, opts)
+	case "policies":
+		set.Policies, err = FetchPolicies(ctx, client, opts)
+	case "roles":
+		set.Roles, err = FetchRoles(ctx, client, opts)
+	case "users":
+		set.Users, err = FetchUsers(ctx, client, opts)
+	case "server-certificates":
+		set.ServerCertificates, err = FetchServerCertificates(ctx, client, opts)
+	case "virtual-mfa-devices":
+		set.VirtualMFADevices, err = FetchVirtualMFADevices(ctx, client, opts)
+	case "instance-profiles":
+		set.InstanceProfiles, err = FetchInstanceProfiles(ctx, client, opts)
+	case "providers":
+		set.Providers, err = FetchProviders(ctx, client, opts)
+	case "account":
+		set.Account, err = FetchAccount(ctx, client)
+	case "sso-permission-sets":
+		set.PermissionSets, err = FetchPermissionSets(ctx, sso, opts)
+	default:
+		return fmt.Errorf("invalid resource type %s", typ)
+	}
+	return err
+}
@@ -0,0 +1,720 @@
+// Package verify reads generated templates back into the resource model
+// and compares them with the resources IAM holds, reporting what the
+// conversion lost or rewrote before the template is imported.
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the kind of loss of a property.
+type Kind string
+
+const (
+	// Dropped is a resource, property or value IAM holds that the
+	// template leaves out.
+	Dropped Kind = "dropped"
+	// Added is a resource, property or value of the template IAM does not
+	// hold.
+	Added Kind = "added"
+	// Truncated is a value the template holds the beginning of.
+	Truncated Kind = "truncated"
+	// Changed is a value the template holds differently.
+	Changed Kind = "changed"
+	// Reordered is a list, or a policy document, the template holds in
+	// another order.
+	Reordered Kind = "reordered"
+	// Reformatted is a policy document the template holds in another but
+	// equivalent form, e.g. a single action instead of a list of one.
+	Reformatted Kind = "reformatted"
+)
+
+// Loss is a difference between a resource as IAM holds it and as the
+// template writes it.
+type Loss struct {
+	// Type is the type of the resource, e.g. "role", and Name its name.
+	Type string
+	Name string
+	// Property is the property that differs, e.g. Description or
+	// Policies/s3-access, or "" for the whole resource.
+	Property string
+	Kind     Kind
+	Live     string
+	Template string
+}
+
+// reference is a resource of a template others can refer to with !Ref:
+// managed policies by ARN, and roles, groups and users by name.
+type reference struct {
+	typ  string
+	arn  string
+	name string
+}
+
+// parser resolves the intrinsic functions of a template.
+type parser struct {
+	refs      map[string]reference
+	accountID string
+	partition string
+}
+
+// value converts a YAML node into plain Go values, resolving !Ref to the
+// resources of the template and !Sub of pseudo parameters. Other
+// intrinsic functions are kept in their mapping form.
+func (p *parser) value(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return p.value(n.Content[0])
+	case yaml.AliasNode:
+		return p.value(n.Alias)
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := p.value(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = v
+		}
+		if len(m) == 1 {
+			if id, ok := m["Ref"].(string); ok {
+				return p.ref(id), nil
+			}
+			if s, ok := m["Fn::Sub"].(string); ok {
+				return p.sub(s), nil
+			}
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		l := []interface{}{}
+		for _, c := range n.Content {
+			v, err := p.value(c)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		if n.Tag != "!!seq" && strings.HasPrefix(n.Tag, "!") {
+			return map[string]interface{}{"Fn::" + n.Tag[1:]: l}, nil
+		}
+		return l, nil
+	}
+
+	switch n.Tag {
+	case "!Ref":
+		return p.ref(n.Value), nil
+	case "!Sub":
+		return p.sub(n.Value), nil
+	}
+	if strings.HasPrefix(n.Tag, "!") && !strings.HasPrefix(n.Tag, "!!") {
+		return map[string]interface{}{"Fn::" + n.Tag[1:]: n.Value}, nil
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ref resolves a reference to the resource id, or keeps it in its mapping
+// form when id is not a resource of the template, e.g. a parameter.
+func (p *parser) ref(id string) interface{} {
+	r, ok := p.refs[id]
+	switch {
+	case !ok:
+		return map[string]interface{}{"Ref": id}
+	case r.typ == "policy":
+		return r.arn
+	}
+	return r.name
+}
+
+// sub substitutes the pseudo parameters of the account of the template
+// in s.
+func (p *parser) sub(s string) string {
+	if p.accountID != "" {
+		s = strings.ReplaceAll(s, "${AWS::AccountId}", p.accountID)
+	}
+	return strings.ReplaceAll(s, "${AWS::Partition}", p.partition)
+}
+
+// resourceTypes maps the CloudFormation resource types read back to the
+// types of losses.
+var resourceTypes = map[string]string{
+	"AWS::IAM::ManagedPolicy": "policy",
+	"AWS::IAM::Role":          "role",
+	"AWS::IAM::Group":         "group",
+	"AWS::IAM::User":          "user",
+}
+
+// nameFromArn returns the name of the resource arn, the last element of
+// its path.
+func nameFromArn(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// mapping returns the value of key in the mapping node n, or nil.
+func mapping(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// resourceType returns the Type of the resource n.
+func resourceType(n *yaml.Node) string {
+	if t := mapping(n, "Type"); t != nil {
+		return t.Value
+	}
+	return ""
+}
+
+// props is the properties of a resource of a template.
+type props map[string]interface{}
+
+// str returns the string property key, or its JSON when it is an
+// intrinsic function that could not be resolved.
+func (p props) str(key string) *string {
+	switch v := p[key].(type) {
+	case nil:
+		return nil
+	case string:
+		return &v
+	default:
+		b, _ := json.Marshal(v)
+		return aws.String(string(b))
+	}
+}
+
+// path returns the Path property, / when the template leaves it out as
+// IAM then defaults to it.
+func (p props) path() *string {
+	if s := p.str("Path"); s != nil {
+		return s
+	}
+	return aws.String("/")
+}
+
+// strs returns the list of strings property key.
+func (p props) strs(key string) []string {
+	l, _ := p[key].([]interface{})
+	var s []string
+	for _, v := range l {
+		s = append(s, *props{"": v}.str(""))
+	}
+	return s
+}
+
+// document returns the policy document property key as JSON.
+func (p props) document(key string) *string {
+	v, ok := p[key]
+	if !ok {
+		return nil
+	}
+	b, _ := json.Marshal(v)
+	return aws.String(string(b))
+}
+
+// tags returns the Tags property.
+func (p props) tags() []types.Tag {
+	var tags []types.Tag
+	l, _ := p["Tags"].([]interface{})
+	for _, t := range l {
+		t, _ := t.(map[string]interface{})
+		tp := props(t)
+		tags = append(tags, types.Tag{Key: tp.str("Key"), Value: tp.str("Value")})
+	}
+	return tags
+}
+
+// policies returns the inline policies of the Policies property.
+func (p props) policies() model.PolicyResources {
+	var policies model.PolicyResources
+	l, _ := p["Policies"].([]interface{})
+	for _, v := range l {
+		v, _ := v.(map[string]interface{})
+		pp := props(v)
+		policies = append(policies, model.PolicyResource{Name: pp.str("PolicyName"), PolicyDocument: pp.document("PolicyDocument")})
+	}
+	return policies
+}
+
+// Parse reads the managed policies, roles, groups and users of a template
+// back into a resource set. Resources are identified by their SourceArn
+// metadata, or by the names written with --preserve-names, and references
+// between them are resolved to the ARNs and names they stand for. Inline
+// policies written as resources of their own, and attachments written on
+// the managed policies, are moved back to their roles, groups and users.
+func Parse(template []byte) (*model.ResourceSet, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(template, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	top := doc.Content[0]
+	resources := mapping(top, "Resources")
+	if resources == nil {
+		return nil, fmt.Errorf("template has no resources")
+	}
+
+	p := &parser{refs: map[string]reference{}, partition: "aws"}
+	if id := mapping(mapping(mapping(top, "Metadata"), "IamCfGenerator"), "SourceAccountId"); id != nil {
+		p.accountID = id.Value
+	}
+	nameKeys := map[string]string{"policy": "ManagedPolicyName", "role": "RoleName", "group": "GroupName", "user": "UserName"}
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		id, res := resources.Content[i].Value, resources.Content[i+1]
+		typ, ok := resourceTypes[resourceType(res)]
+		if !ok {
+			continue
+		}
+		r := reference{typ: typ}
+		if arn := mapping(mapping(res, "Metadata"), "SourceArn"); arn != nil {
+			r.arn = arn.Value
+			r.name = nameFromArn(arn.Value)
+			if parts := strings.SplitN(arn.Value, ":", 3); len(parts) == 3 {
+				p.partition = parts[1]
+			}
+		}
+		if name := mapping(mapping(res, "Properties"), nameKeys[typ]); name != nil && name.Kind == yaml.ScalarNode && name.Tag == "!!str" {
+			r.name = name.Value
+		}
+		p.refs[id] = r
+	}
+
+	set := &model.ResourceSet{}
+	standalone := map[string][]props{}
+	attached := map[string][]string{}
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		id, res := resources.Content[i].Value, resources.Content[i+1]
+		n := mapping(res, "Properties")
+		if n == nil {
+			continue
+		}
+		v, err := p.value(n)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		pr, _ := v.(map[string]interface{})
+		ps := props(pr)
+		r := p.refs[id]
+		arn, name := aws.String(r.arn), aws.String(r.name)
+		if r.arn == "" {
+			arn = nil
+		}
+
+		switch resourceType(res) {
+		case "AWS::IAM::ManagedPolicy":
+			set.Policies = append(set.Policies, model.PolicyResource{
+				LogicalID:      id,
+				Arn:            arn,
+				Description:    ps.str("Description"),
+				Name:           name,
+				Path:           ps.path(),
+				PolicyDocument: ps.document("PolicyDocument"),
+				Tags:           ps.tags(),
+			})
+			for _, typ := range []string{"Groups", "Roles", "Users"} {
+				for _, n := range ps.strs(typ) {
+					attached[typ+"/"+n] = append(attached[typ+"/"+n], r.arn)
+				}
+			}
+		case "AWS::IAM::Role":
+			rec := model.RoleResource{
+				LogicalID:                id,
+				Arn:                      arn,
+				AssumeRolePolicyDocument: ps.document("AssumeRolePolicyDocument"),
+				Description:              ps.str("Description"),
+				ManagedPolicyArns:        ps.strs("ManagedPolicyArns"),
+				Name:                     name,
+				Path:                     ps.path(),
+				PermissionsBoundary:      ps.str("PermissionsBoundary"),
+				Policies:                 ps.policies(),
+				Tags:                     ps.tags(),
+			}
+			if d, ok := ps["MaxSessionDuration"].(int); ok {
+				rec.MaxSessionDuration = d
+			}
+			set.Roles = append(set.Roles, rec)
+		case "AWS::IAM::Group":
+			set.Groups = append(set.Groups, model.GroupResource{
+				LogicalID:         id,
+				Arn:               arn,
+				ManagedPolicyArns: ps.strs("ManagedPolicyArns"),
+				Name:              name,
+				Path:              ps.path(),
+				Policies:          ps.policies(),
+			})
+		case "AWS::IAM::User":
+			rec := model.UserResource{
+				LogicalID:           id,
+				Arn:                 arn,
+				Groups:              ps.strs("Groups"),
+				ManagedPolicyArns:   ps.strs("ManagedPolicyArns"),
+				Name:                name,
+				Path:                ps.path(),
+				PermissionsBoundary: ps.str("PermissionsBoundary"),
+				Policies:            ps.policies(),
+				Tags:                ps.tags(),
+			}
+			if lp, ok := ps["LoginProfile"].(map[string]interface{}); ok {
+				reset, _ := lp["PasswordResetRequired"].(bool)
+				rec.LoginProfile = &model.LoginProfile{PasswordResetRequired: reset}
+			}
+			set.Users = append(set.Users, rec)
+		case "AWS::IAM::RolePolicy":
+			standalone["Roles/"+aws.ToString(ps.str("RoleName"))] = append(standalone["Roles/"+aws.ToString(ps.str("RoleName"))], ps)
+		case "AWS::IAM::GroupPolicy":
+			standalone["Groups/"+aws.ToString(ps.str("GroupName"))] = append(standalone["Groups/"+aws.ToString(ps.str("GroupName"))], ps)
+		case "AWS::IAM::UserPolicy":
+			standalone["Users/"+aws.ToString(ps.str("UserName"))] = append(standalone["Users/"+aws.ToString(ps.str("UserName"))], ps)
+		}
+	}
+
+	move := func(key string, policies *model.PolicyResources, arns *[]string) {
+		for _, ps := range standalone[key] {
+			*policies = append(*policies, model.PolicyResource{Name: ps.str("PolicyName"), PolicyDocument: ps.document("PolicyDocument")})
+		}
+		*arns = append(*arns, attached[key]...)
+	}
+	for i, r := range set.Roles {
+		move("Roles/"+aws.ToString(r.Name), &set.Roles[i].Policies, &set.Roles[i].ManagedPolicyArns)
+	}
+	for i, g := range set.Groups {
+		move("Groups/"+aws.ToString(g.Name), &set.Groups[i].Policies, &set.Groups[i].ManagedPolicyArns)
+	}
+	for i, u := range set.Users {
+		move("Users/"+aws.ToString(u.Name), &set.Users[i].Policies, &set.Users[i].ManagedPolicyArns)
+	}
+	return set, nil
+}
+
+// comparison collects the losses of a resource.
+type comparison struct {
+	typ    string
+	name   string
+	losses []Loss
+}
+
+func (c *comparison) add(property string, kind Kind, live, template string) {
+	c.losses = append(c.losses, Loss{Type: c.typ, Name: c.name, Property: property, Kind: kind, Live: live, Template: template})
+}
+
+// str compares the string property of the live resource with that of the
+// template. Unset and empty values are the same.
+func (c *comparison) str(property string, live, template *string) {
+	l, t := aws.ToString(live), aws.ToString(template)
+	switch {
+	case l == t:
+	case t == "":
+		c.add(property, Dropped, l, t)
+	case l == "":
+		c.add(property, Added, l, t)
+	case strings.HasPrefix(l, t):
+		c.add(property, Truncated, l, t)
+	default:
+		c.add(property, Changed, l, t)
+	}
+}
+
+// list compares the list property of the live resource with that of the
+// template, reporting each value dropped or added, or else a change of
+// their order.
+func (c *comparison) list(property string, live, template []string) {
+	counts := map[string]int{}
+	for _, v := range live {
+		counts[v]++
+	}
+	for _, v := range template {
+		counts[v]--
+	}
+	differ := false
+	for _, v := range live {
+		if counts[v] > 0 {
+			c.add(property, Dropped, v, "")
+			counts[v]--
+			differ = true
+		}
+	}
+	for _, v := range template {
+		if counts[v] < 0 {
+			c.add(property, Added, "", v)
+			counts[v]++
+			differ = true
+		}
+	}
+	if !differ && !reflect.DeepEqual(live, template) && len(live) > 0 {
+		c.add(property, Reordered, strings.Join(live, ", "), strings.Join(template, ", "))
+	}
+}
+
+// set compares the list property of the live resource with that of the
+// template regardless of order, as IAM keeps none for attached policies and
+// group memberships, and --attach-from-policies moves attachments to the
+// end of the list.
+func (c *comparison) set(property string, live, template []string) {
+	sorted := func(l []string) []string {
+		l = append([]string(nil), l...)
+		sort.Strings(l)
+		return l
+	}
+	c.list(property, sorted(live), sorted(template))
+}
+
+// tags compares the tags of the live resource with those of the template.
+func (c *comparison) tags(live, template []types.Tag) {
+	pairs := func(tags []types.Tag) []string {
+		var l []string
+		for _, t := range tags {
+			l = append(l, aws.ToString(t.Key)+"="+aws.ToString(t.Value))
+		}
+		return l
+	}
+	c.list("Tags", pairs(live), pairs(template))
+}
+
+// document compares the policy document property of the live resource
+// with that of the template.
+func (c *comparison) document(property string, live, template *string) {
+	if live == nil || template == nil {
+		c.str(property, live, template)
+		return
+	}
+	var l, t interface{}
+	if err := json.Unmarshal([]byte(*live), &l); err != nil {
+		c.add(property, Changed, *live, *template)
+		return
+	}
+	json.Unmarshal([]byte(*template), &t)
+	switch {
+	case reflect.DeepEqual(l, t):
+	case reflect.DeepEqual(canonical(l, false), canonical(t, false)):
+		c.add(property, Reordered, compact(l), compact(t))
+	case reflect.DeepEqual(canonical(l, true), canonical(t, true)):
+		c.add(property, Reformatted, compact(l), compact(t))
+	default:
+		c.add(property, Changed, compact(l), compact(t))
+	}
+}
+
+// policies compares the inline policies of the live resource with those
+// of the template by name.
+func (c *comparison) policies(live, template model.PolicyResources) {
+	byName := map[string]model.PolicyResource{}
+	for _, p := range template {
+		byName[aws.ToString(p.Name)] = p
+	}
+	for _, p := range live {
+		name := aws.ToString(p.Name)
+		t, ok := byName[name]
+		if !ok {
+			c.add("Policies/"+name, Dropped, "", "")
+			continue
+		}
+		delete(byName, name)
+		c.document("Policies/"+name, p.PolicyDocument, t.PolicyDocument)
+	}
+	for _, p := range template {
+		if _, ok := byName[aws.ToString(p.Name)]; ok {
+			c.add("Policies/"+aws.ToString(p.Name), Added, "", "")
+		}
+	}
+}
+
+// canonical returns v with its lists sorted, and with fold, lists of one
+// value replaced by the value.
+func canonical(v interface{}, fold bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range v {
+			m[k] = canonical(e, fold)
+		}
+		return m
+	case []interface{}:
+		if fold && len(v) == 1 {
+			return canonical(v[0], fold)
+		}
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = canonical(e, fold)
+		}
+		sort.Slice(l, func(i, j int) bool { return compact(l[i]) < compact(l[j]) })
+		return l
+	}
+	return v
+}
+
+// compact returns v as compact JSON.
+func compact(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// key identifies a resource of a set by ARN, or by name when the template
+// has no ARN for it.
+func key(arn, name *string) string {
+	if arn != nil {
+		return aws.ToString(arn)
+	}
+	return "name:" + aws.ToString(name)
+}
+
+// Compare returns the losses of the managed policies, roles, groups and
+// users of template, as read by Parse, against live, as fetched from IAM.
+// Only the resource types live holds are compared, and resources of
+// template without an ARN are matched by name.
+func Compare(live, template *model.ResourceSet) []Loss {
+	var losses []Loss
+	compare := func(typ string, liveKeys, templateKeys []string, names map[string]string, each func(c *comparison, l, t int)) {
+		index := map[string]int{}
+		for i, k := range templateKeys {
+			index[k] = i
+		}
+		for i, k := range liveKeys {
+			c := &comparison{typ: typ, name: names[k]}
+			t, ok := index[k]
+			if !ok {
+				t, ok = index["name:"+names[k]]
+			}
+			if !ok {
+				c.add("", Dropped, "", "")
+			} else {
+				delete(index, templateKeys[t])
+				each(c, i, t)
+			}
+			losses = append(losses, c.losses...)
+		}
+		var added []Loss
+		for k := range index {
+			added = append(added, Loss{Type: typ, Name: strings.TrimPrefix(nameFromArn(k), "name:"), Kind: Added})
+		}
+		sort.Slice(added, func(i, j int) bool { return added[i].Name < added[j].Name })
+		losses = append(losses, added...)
+	}
+
+	if len(live.Policies) > 0 {
+		var lk, tk []string
+		names := map[string]string{}
+		for _, p := range live.Policies {
+			lk = append(lk, key(p.Arn, nil))
+			names[key(p.Arn, nil)] = aws.ToString(p.Name)
+		}
+		for _, p := range template.Policies {
+			tk = append(tk, key(p.Arn, p.Name))
+		}
+		compare("policy", lk, tk, names, func(c *comparison, l, t int) {
+			lp, tp := live.Policies[l], template.Policies[t]
+			c.str("Description", lp.Description, tp.Description)
+			c.str("Path", lp.Path, tp.Path)
+			c.document("PolicyDocument", lp.PolicyDocument, tp.PolicyDocument)
+			c.tags(lp.Tags, tp.Tags)
+		})
+	}
+	if len(live.Roles) > 0 {
+		var lk, tk []string
+		names := map[string]string{}
+		for _, r := range live.Roles {
+			lk = append(lk, key(r.Arn, nil))
+			names[key(r.Arn, nil)] = aws.ToString(r.Name)
+		}
+		for _, r := range template.Roles {
+			tk = append(tk, key(r.Arn, r.Name))
+		}
+		compare("role", lk, tk, names, func(c *comparison, l, t int) {
+			lr, tr := live.Roles[l], template.Roles[t]
+			c.document("AssumeRolePolicyDocument", lr.AssumeRolePolicyDocument, tr.AssumeRolePolicyDocument)
+			c.str("Description", lr.Description, tr.Description)
+			c.set("ManagedPolicyArns", lr.ManagedPolicyArns, tr.ManagedPolicyArns)
+			if lr.MaxSessionDuration != tr.MaxSessionDuration && tr.MaxSessionDuration != 0 {
+				c.add("MaxSessionDuration", Changed, fmt.Sprint(lr.MaxSessionDuration), fmt.Sprint(tr.MaxSessionDuration))
+			}
+			c.str("Path", lr.Path, tr.Path)
+			c.str("PermissionsBoundary", lr.PermissionsBoundary, tr.PermissionsBoundary)
+			c.policies(lr.Policies, tr.Policies)
+			c.tags(lr.Tags, tr.Tags)
+		})
+	}
+	if len(live.Groups) > 0 {
+		var lk, tk []string
+		names := map[string]string{}
+		for _, g := range live.Groups {
+			lk = append(lk, key(g.Arn, nil))
+			names[key(g.Arn, nil)] = aws.ToString(g.Name)
+		}
+		for _, g := range template.Groups {
+			tk = append(tk, key(g.Arn, g.Name))
+		}
+		compare("group", lk, tk, names, func(c *comparison, l, t int) {
+			lg, tg := live.Groups[l], template.Groups[t]
+			c.set("ManagedPolicyArns", lg.ManagedPolicyArns, tg.ManagedPolicyArns)
+			c.str("Path", lg.Path, tg.Path)
+			c.policies(lg.Policies, tg.Policies)
+		})
+	}
+	if len(live.Users) > 0 {
+		var lk, tk []string
+		names := map[string]string{}
+		for _, u := range live.Users {
+			lk = append(lk, key(u.Arn, nil))
+			names[key(u.Arn, nil)] = aws.ToString(u.Name)
+		}
+		for _, u := range template.Users {
+			tk = append(tk, key(u.Arn, u.Name))
+		}
+		compare("user", lk, tk, names, func(c *comparison, l, t int) {
+			lu, tu := live.Users[l], template.Users[t]
+			c.set("Groups", lu.Groups, tu.Groups)
+			if (lu.LoginProfile == nil) != (tu.LoginProfile == nil) {
+				if lu.LoginProfile != nil {
+					c.add("LoginProfile", Dropped, "", "")
+				} else {
+					c.add("LoginProfile", Added, "", "")
+				}
+			}
+			c.set("ManagedPolicyArns", lu.ManagedPolicyArns, tu.ManagedPolicyArns)
+			c.str("Path", lu.Path, tu.Path)
+			c.str("PermissionsBoundary", lu.PermissionsBoundary, tu.PermissionsBoundary)
+			c.policies(lu.Policies, tu.Policies)
+			c.tags(lu.Tags, tu.Tags)
+		})
+	}
+	return losses
+}
+
+// shorten cuts values longer than n characters for display.
+func shorten(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+// WriteLosses writes losses to w as a table, one property or value per
+// line.
+func WriteLosses(w io.Writer, losses []Loss) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tPROPERTY\tKIND\tLIVE\tTEMPLATE")
+	for _, l := range losses {
+		fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\t%s\n", l.Type, l.Name, l.Property, l.Kind, shorten(l.Live, 60), shorten(l.Template, 60))
+	}
+	return tw.Flush()
+}
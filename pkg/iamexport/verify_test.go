@@ -0,0 +1,178 @@
+package iamexport_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/diff"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/iamfake"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/verify"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// verifyTemplate renders the resources of the fake account with opts and
+// the provenance the command adds, and reads the template back.
+func verifyTemplate(t *testing.T, opts render.Options) *model.ResourceSet {
+	t.Helper()
+	opts.Provenance = &render.Provenance{AccountID: "123456789012"}
+	got, err := render.RenderString(fetchAll(t, account()), render.NewLogicalIDs(nil), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := verify.Parse([]byte(got))
+	if err != nil {
+		t.Fatalf("reading the template back: %v\n%s", err, got)
+	}
+	return template
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		opts render.Options
+	}{
+		{"default", render.Options{}},
+		{"preserve-names", render.Options{PreserveNames: true}},
+		{"standalone-policies", render.Options{StandalonePolicies: true, AttachFromPolicies: true}},
+		{"long-intrinsics", render.Options{LongIntrinsics: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := verifyTemplate(t, tt.opts)
+			for _, l := range verify.Compare(fetchAll(t, account()), template) {
+				t.Errorf("the template lost %s/%s %s: %s %q, template %q", l.Type, l.Name, l.Property, l.Kind, l.Live, l.Template)
+			}
+		})
+	}
+}
+
+func TestVerifyLosses(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *iamfake.Client)
+		want   verify.Loss
+	}{
+		{
+			"dropped resource",
+			func(c *iamfake.Client) {
+				r := c.Roles[1]
+				r.Arn, r.RoleName = aws.String("arn:aws:iam::123456789012:role/new"), aws.String("new")
+				c.Roles = append(c.Roles, r)
+			},
+			verify.Loss{Type: "role", Name: "new", Kind: verify.Dropped},
+		},
+		{
+			"added resource",
+			func(c *iamfake.Client) { c.Roles = c.Roles[:1] },
+			verify.Loss{Type: "role", Name: "plain", Kind: verify.Added},
+		},
+		{
+			"dropped value",
+			func(c *iamfake.Client) { c.Roles[0].Tags = append(c.Roles[0].Tags, tag("owner", "ops")) },
+			verify.Loss{Type: "role", Name: "app", Property: "Tags", Kind: verify.Dropped, Live: "owner=ops"},
+		},
+		{
+			"added policy",
+			func(c *iamfake.Client) { c.Users[0].InlinePolicies = nil },
+			verify.Loss{Type: "user", Name: "alice", Property: "Policies/s3", Kind: verify.Added},
+		},
+		{
+			"added login profile",
+			func(c *iamfake.Client) { c.Users[0].LoginProfile = nil },
+			verify.Loss{Type: "user", Name: "alice", Property: "LoginProfile", Kind: verify.Added},
+		},
+		{
+			"truncated",
+			func(c *iamfake.Client) { c.Policies[0].Description = aws.String("Deploys the app to production") },
+			verify.Loss{Type: "policy", Name: "deploy", Property: "Description", Kind: verify.Truncated, Live: "Deploys the app to production", Template: "Deploys the app"},
+		},
+		{
+			"changed",
+			func(c *iamfake.Client) { c.Roles[0].Description = aws.String("Serves the site") },
+			verify.Loss{Type: "role", Name: "app", Property: "Description", Kind: verify.Changed, Live: "Serves the site", Template: "Runs the app"},
+		},
+		{
+			"changed document",
+			func(c *iamfake.Client) {
+				c.Groups[0].InlinePolicies[0].Document = strings.Replace(allowS3, "s3:GetObject", "s3:PutObject", 1)
+			},
+			verify.Loss{Type: "group", Name: "admins", Property: "Policies/s3", Kind: verify.Changed},
+		},
+		{
+			"reordered",
+			func(c *iamfake.Client) { c.Roles[0].Tags = []types.Tag{tag("env", "prod"), tag("team", "ci")} },
+			verify.Loss{Type: "role", Name: "app", Property: "Tags", Kind: verify.Reordered, Live: "env=prod, team=ci", Template: "team=ci, env=prod"},
+		},
+		{
+			"reformatted",
+			func(c *iamfake.Client) {
+				c.Roles[0].AssumeRolePolicyDocument = aws.String(strings.Replace(trustEC2, `"sts:AssumeRole"`, `["sts:AssumeRole"]`, 1))
+			},
+			verify.Loss{Type: "role", Name: "app", Property: "AssumeRolePolicyDocument", Kind: verify.Reformatted},
+		},
+	}
+	template := verifyTemplate(t, render.Options{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := account()
+			tt.change(client)
+			losses := verify.Compare(fetchAll(t, client), template)
+			if len(losses) != 1 {
+				t.Fatalf("losses = %+v, want only %+v", losses, tt.want)
+			}
+			got := losses[0]
+			if tt.want.Live == "" && tt.want.Template == "" {
+				got.Live, got.Template = "", ""
+			}
+			if got != tt.want {
+				t.Errorf("loss = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLongIntrinsics(t *testing.T) {
+	opts := render.Options{
+		Provenance:         &render.Provenance{AccountID: "123456789012"},
+		Outputs:            true,
+		StandalonePolicies: true,
+		Substitutions:      []render.Substitution{{Value: "ci", Parameter: "Team"}},
+		ResourceConditions: map[string]string{"arn:aws:iam::123456789012:role/plain": "Plain"},
+	}
+	short, err := render.RenderString(fetchAll(t, account()), render.NewLogicalIDs(nil), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.LongIntrinsics = true
+	long, err := render.RenderString(fetchAll(t, account()), render.NewLogicalIDs(nil), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if short == long {
+		t.Fatal("the long form is the same as the short one")
+	}
+
+	changes, err := diff.Templates([]byte(short), []byte(long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) > 0 {
+		t.Errorf("diff between the short and long forms = %+v, want none", changes)
+	}
+
+	shortSet, err := verify.Parse([]byte(short))
+	if err != nil {
+		t.Fatal(err)
+	}
+	longSet, err := verify.Parse([]byte(long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(shortSet, longSet) {
+		t.Errorf("the long form reads back as %+v, want %+v", longSet, shortSet)
+	}
+}
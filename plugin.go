@@ -0,0 +1,13 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import "plugin"
+
+// loadPlugin opens the Go plugin at path, whose init functions register
+// its output formats with render.Register.
+func loadPlugin(path string) error {
+	_, err := plugin.Open(path)
+	return err
+}
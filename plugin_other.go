@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import "errors"
+
+// loadPlugin fails, as Go plugins are not supported on this platform.
+func loadPlugin(path string) error {
+	return errors.New("plugins are not supported on this platform")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyzer"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+)
+
+// generationPollInterval is how often the status of a policy generation
+// job is checked.
+const generationPollInterval = 15 * time.Second
+
+var (
+	trailAccessRole = flag.String("trail-access-role", "", "with --propose-policies, the `arn` of the role Access Analyzer assumes to read the trails")
+	activityPeriod  = flag.Duration("activity-period", 90*24*time.Hour, "with --propose-policies, how far back to read the activity of the roles (at most 90 days)")
+)
+
+// stringValues is a flag.Value collecting the values of a repeatable
+// flag. Each value may also be a comma separated list.
+type stringValues []string
+
+var (
+	proposeRoles stringValues
+	trailArns    stringValues
+)
+
+func init() {
+	flag.Var(&proposeRoles, "propose-policies", "generate least-privilege policies for the `role` from its CloudTrail activity with IAM Access Analyzer (repeatable)")
+	flag.Var(&trailArns, "trail-arn", "with --propose-policies, the `arn` of a CloudTrail trail to read the activity from (repeatable)")
+}
+
+func (s *stringValues) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringValues) Set(v string) error {
+	*s = append(*s, strings.Split(v, ",")...)
+	return nil
+}
+
+// proposePolicies generates least-privilege policies for the roles named
+// by --propose-policies, proposed in the template next to their current
+// policies.
+func proposePolicies(ctx context.Context, cfg aws.Config, resources *model.ResourceSet) error {
+	slog.Info("Generating policies from CloudTrail activity, which can take several minutes", "roles", len(proposeRoles))
+	end := time.Now()
+	return analyzer.ProposePolicies(ctx, accessanalyzer.NewFromConfig(cfg), resources, proposeRoles, analyzer.GenerateOptions{
+		AccessRole:   *trailAccessRole,
+		Trails:       trailArns,
+		Start:        end.Add(-*activityPeriod),
+		End:          end,
+		PollInterval: generationPollInterval,
+	})
+}
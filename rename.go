@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+)
+
+// renameRules is a flag.Value collecting the rules of --rename, applied
+// in the order given.
+type renameRules []transform.RenameRule
+
+var renames renameRules
+
+func init() {
+	flag.Var(&renames, "rename", "rename groups, managed policies, roles and users matching the regular expression of a `[type:]pattern=replacement` rule, e.g. roles:^legacy-= (repeatable)")
+}
+
+func (r *renameRules) String() string {
+	var l []string
+	for _, rule := range *r {
+		s := rule.Pattern.String() + "=" + rule.Replacement
+		if rule.Type != "" {
+			s = rule.Type + ":" + s
+		}
+		l = append(l, s)
+	}
+	return strings.Join(l, ",")
+}
+
+func (r *renameRules) Set(v string) error {
+	rule, err := transform.ParseRenameRule(v)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rule)
+	return nil
+}
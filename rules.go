@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+)
+
+var rulesOut = flag.String("rules-out", "", "write rules enforcing the tags, paths and permissions boundaries every exported resource of a type has to this `file`, as cfn-guard rules, or Rego rules for files ending in .rego")
+
+// writeRules writes the conventions resources follow to --rules-out.
+func writeRules(resources *model.ResourceSet) error {
+	conventions := analyze.Conventions(resources)
+	b := bytes.Buffer{}
+	write := analyze.WriteGuardRules
+	if strings.EqualFold(filepath.Ext(*rulesOut), ".rego") {
+		write = analyze.WriteRegoRules
+	}
+	if err := write(&b, conventions); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*rulesOut, b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Wrote rules", "file", *rulesOut, "types", len(conventions))
+	return nil
+}
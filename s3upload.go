@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var (
+	s3URI         = flag.String("s3-uri", "", "also upload the templates written to this S3 `prefix`, e.g. s3://bucket/iam/")
+	s3SSE         = flag.String("s3-sse", "AES256", "with --s3-uri, encrypt the templates uploaded with this server-side `encryption`: AES256 or aws:kms")
+	s3KMSKeyID    = flag.String("s3-kms-key-id", "", "with --s3-sse aws:kms, the `key` to encrypt the templates with (defaults to the AWS managed key of S3)")
+	s3VersionKeys = flag.Bool("s3-versioned-keys", false, "with --s3-uri, upload the templates under a prefix named by when they were generated, e.g. 20261015T093000Z/, keeping earlier uploads")
+)
+
+// newS3Client returns the client uploading templates.
+func newS3Client(cfg aws.Config) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// Local emulators do not serve virtual hosted buckets.
+		o.UsePathStyle = endpointFor("S3") != ""
+	})
+}
+
+// s3Uploader uploads the templates of a run to --s3-uri.
+type s3Uploader struct {
+	client *s3.Client
+	cfg    aws.Config
+	bucket string
+	prefix string
+}
+
+// newS3Uploader returns the uploader of --s3-uri. With --s3-versioned-keys,
+// every template of the run is uploaded under the same prefix, named by
+// the current time.
+func newS3Uploader(cfg aws.Config) (*s3Uploader, error) {
+	bucket, prefix, err := iamexport.ParseS3URI(*s3URI)
+	if err != nil {
+		return nil, err
+	}
+	if *s3VersionKeys {
+		prefix += time.Now().UTC().Format("20060102T150405Z") + "/"
+	}
+	return &s3Uploader{client: newS3Client(cfg), cfg: cfg, bucket: bucket, prefix: prefix}, nil
+}
+
+// upload stores template under file in the prefix of --s3-uri, encrypted
+// with --s3-sse, and returns its URL.
+func (u *s3Uploader) upload(ctx context.Context, file string, template []byte) (string, error) {
+	in := &s3.PutObjectInput{
+		Bucket:               aws.String(u.bucket),
+		Key:                  aws.String(u.prefix + file),
+		Body:                 bytes.NewReader(template),
+		ContentType:          aws.String("application/x-yaml"),
+		ServerSideEncryption: s3types.ServerSideEncryption(*s3SSE),
+	}
+	if *s3KMSKeyID != "" {
+		in.SSEKMSKeyId = s3KMSKeyID
+	}
+	if _, err := u.client.PutObject(ctx, in); err != nil {
+		return "", fmt.Errorf("uploading %s to s3://%s/%s: %w", file, u.bucket, u.prefix, err)
+	}
+	slog.Info("Uploaded template", "uri", "s3://"+u.bucket+"/"+u.prefix+file)
+	return iamexport.ObjectURL(u.cfg, u.bucket, u.prefix+file)
+}
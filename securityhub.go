@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/securityhub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+var toSecurityHub = flag.Bool("security-hub", false, "with audit or trust, also import the findings into AWS Security Hub, in the region of the configuration")
+
+// securityHubSource returns the account, partition and region the findings
+// are imported into: those of the caller.
+func securityHubSource(ctx context.Context, cfg aws.Config) (securityhub.Source, error) {
+	id, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return securityhub.Source{}, fmt.Errorf("looking up account ID: %w", err)
+	}
+	partition := "aws"
+	if a, err := arn.Parse(aws.ToString(id.Arn)); err == nil {
+		partition = a.Partition
+	}
+	return securityhub.Source{
+		AccountID: aws.ToString(id.Account),
+		Region:    cfg.Region,
+		Partition: partition,
+		Time:      time.Now(),
+	}, nil
+}
+
+// importFindings imports the findings made by findings from the source of
+// the caller into Security Hub.
+func importFindings(ctx context.Context, cfg aws.Config, findings func(securityhub.Source) []securityhub.Finding) error {
+	src, err := securityHubSource(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	l := findings(src)
+	n, err := securityhub.NewFromConfig(cfg).Import(ctx, l)
+	if err != nil {
+		return fmt.Errorf("importing findings into Security Hub: %w", err)
+	}
+	slog.Info("Imported findings into Security Hub", "findings", n, "region", src.Region)
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+)
+
+// writeServiceCatalog writes the template of resources to --output-dir,
+// service-catalog by default, as template.yaml, along with portfolio.yaml
+// creating a Service Catalog portfolio and a product provisioning it.
+// portfolio.yaml refers to the local template, ready for
+// `aws cloudformation package`.
+func writeServiceCatalog(resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	if err := checkLimits(resources, b.Bytes()); err != nil {
+		return err
+	}
+	portfolio := bytes.Buffer{}
+	if err := render.ServiceCatalog(&portfolio, "template.yaml", opts); err != nil {
+		return err
+	}
+
+	dir := *outputDir
+	if dir == "" {
+		dir = dirFormats["service-catalog"]
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "template.yaml"), b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "portfolio.yaml"), portfolio.Bytes(), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Wrote the Service Catalog product", "dir", dir)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/simulate"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+var simulateCases = flag.String("cases", "", "with simulate, the YAML `file` of the test cases to simulate")
+
+// runSimulate simulates the cases of --cases with the policies of
+// resources, writes the decisions to stdout and reports whether any of
+// them is not the expected one.
+func runSimulate(ctx context.Context, cfg aws.Config, resources *model.ResourceSet) (bool, error) {
+	cases, err := simulate.ReadCases(*simulateCases)
+	if err != nil {
+		return false, err
+	}
+	results, err := simulate.Run(ctx, iam.NewFromConfig(cfg), resources, cases)
+	if err != nil {
+		return false, err
+	}
+	if err := simulate.WriteResults(out, results); err != nil {
+		return false, err
+	}
+	var failures int
+	for _, r := range results {
+		if r.Failed() {
+			failures++
+		}
+	}
+	if failures > 0 {
+		slog.Warn("Simulated decisions differ from the expected ones", "failures", failures, "decisions", len(results))
+	}
+	return failures > 0, nil
+}
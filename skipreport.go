@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport"
+)
+
+var (
+	continueOnError = flag.Bool("continue-on-error", false, "leave out the resources, or resource types, that can not be fetched, e.g. for lack of permissions, instead of failing")
+	skipReport      = flag.String("skip-report", "", "with --continue-on-error, write the resources left out and why to this JSON `file`")
+)
+
+// fetchFailure is an entry of the skip report.
+type fetchFailure struct {
+	Type string `json:"type"`
+	// Name is empty when the resources of Type could not be listed.
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+var (
+	failuresMu sync.Mutex
+	failures   []fetchFailure
+)
+
+// recordFailure records that the resource of err, or every resource of
+// its type when its name is empty, was left out. It is called
+// concurrently while fetching.
+func recordFailure(err *iamexport.ResourceError) {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+	if err.Name == "" {
+		slog.Warn("Leaving out resources that can not be listed", "type", err.Type, "error", err.Err)
+	} else {
+		slog.Warn("Leaving out resource that can not be fetched", "type", err.Type, "name", err.Name, "error", err.Err)
+	}
+	failures = append(failures, fetchFailure{Type: err.Type, Name: err.Name, Error: err.Err.Error()})
+}
+
+// writeSkipReport writes the failures recorded to --skip-report, if given.
+func writeSkipReport() error {
+	skip("error", len(failures))
+	if *skipReport == "" {
+		return nil
+	}
+	report := failures
+	if report == nil {
+		report = []fetchFailure{}
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*skipReport, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Wrote skip report", "file", *skipReport, "failures", len(failures))
+	return nil
+}
+
+// canSkip reports whether the resources whose fetch failed with err can be
+// left out: with --continue-on-error, unless the command was cancelled.
+func canSkip(err error) bool {
+	return *continueOnError && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// stackSetAdministrationRole is the role CloudFormation assumes in the
+// administrator account of a self-managed StackSet by default.
+const stackSetAdministrationRole = "AWSCloudFormationStackSetAdministrationRole"
+
+var (
+	stackSetName          = flag.String("stack-set-name", "", "with stackset, create a StackSet with this name from the template")
+	administrationRoleArn = flag.String("administration-role-arn", "", "with stackset, the role CloudFormation uses to manage the StackSet (defaults to "+stackSetAdministrationRole+")")
+	executionRoleName     = flag.String("execution-role-name", "AWSCloudFormationStackSetExecutionRole", "with stackset, the role CloudFormation assumes in every target account")
+)
+
+// prepareStackSet removes the roles StackSets themselves rely on, which
+// have to exist in every account before the StackSet can be deployed.
+func prepareStackSet(resources *model.ResourceSet) {
+	removed := transform.RemoveRoles(resources, stackSetAdministrationRole, *executionRoleName)
+	for _, name := range removed {
+		slog.Info("Leaving out StackSet role, which must exist before the StackSet is deployed", "role", name)
+	}
+	skip("stackset-role", len(removed))
+}
+
+// runStackSet writes the StackSet template generated from resources to
+// stdout and, with --stack-set-name, creates the StackSet from it.
+func runStackSet(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	template := b.Bytes()
+	if err := checkLimits(resources, template); err != nil {
+		return err
+	}
+	if _, err := out.Write(template); err != nil {
+		return err
+	}
+	if *stackSetName == "" {
+		return nil
+	}
+
+	params, err := templateParameters(template, nil)
+	if err != nil {
+		return err
+	}
+	in := &cloudformation.CreateStackSetInput{
+		StackSetName:      stackSetName,
+		Description:       aws.String("IAM baseline exported by iam-cf-generator"),
+		Capabilities:      []cftypes.Capability{cftypes.CapabilityCapabilityIam, cftypes.CapabilityCapabilityNamedIam},
+		Parameters:        params,
+		PermissionModel:   cftypes.PermissionModelsSelfManaged,
+		ExecutionRoleName: executionRoleName,
+	}
+	if *administrationRoleArn != "" {
+		in.AdministrationRoleARN = administrationRoleArn
+	}
+	if in.TemplateBody, in.TemplateURL, err = templateSource(ctx, cfg, *stackSetName, template); err != nil {
+		return err
+	}
+
+	out, err := cloudformation.NewFromConfig(cfg).CreateStackSet(ctx, in)
+	if err != nil {
+		return fmt.Errorf("creating StackSet %s: %w", *stackSetName, err)
+	}
+	slog.Info("Created StackSet; add stack instances to deploy it to accounts", "stackSet", aws.ToString(out.StackSetId))
+	return nil
+}
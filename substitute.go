@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+)
+
+// substitutionRules is a flag.Value collecting the substitutions of
+// --substitute.
+type substitutionRules []render.Substitution
+
+var substitutions substitutionRules
+
+func init() {
+	flag.Var(&substitutions, "substitute", "replace a value in names, ARNs and policy documents with a template parameter defaulting to it, given as `value=Parameter`, e.g. prod=Environment (repeatable)")
+}
+
+func (s *substitutionRules) String() string {
+	var l []string
+	for _, sub := range *s {
+		l = append(l, sub.Value+"="+sub.Parameter)
+	}
+	return strings.Join(l, ",")
+}
+
+func (s *substitutionRules) Set(v string) error {
+	sub, err := render.ParseSubstitution(v)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, sub)
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/smithy-go/middleware"
+)
+
+var resultJSON = flag.String("result-json", "", "write the outcome of the command to this JSON `file`: its exit status, the resources exported and skipped, and the warnings logged")
+
+// The exit statuses of the command, besides 130 when it is interrupted.
+const (
+	// exitOK is the status of a command that found no changes.
+	exitOK = 0
+	// exitError is the status of a command that failed.
+	exitError = 1
+	// exitChanges is the status of diff and diff-accounts finding
+	// differences, and of audit finding findings as severe as --fail-on.
+	exitChanges = 2
+)
+
+// started is when the command started, for the duration in the summary.
+var started = time.Now()
+
+// apiCalls counts the API requests sent, retries included.
+var apiCalls int64
+
+// skipped counts the resources left out, by the reason they were, e.g.
+// ignore-file for those matching the ignore file.
+var (
+	skipped   = map[string]int{}
+	skippedMu sync.Mutex
+)
+
+// skip records that n resources were left out for reason. It may be
+// called concurrently, e.g. while fetching.
+func skip(reason string, n int) {
+	if n > 0 {
+		skippedMu.Lock()
+		skipped[reason] += n
+		skippedMu.Unlock()
+	}
+}
+
+// countAPICalls registers a middleware counting the requests sent by a
+// client. Like the request limiter, it is added after the retry middleware
+// so that every attempt is counted.
+func countAPICalls(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("CountAPICalls",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+			middleware.FinalizeOutput, middleware.Metadata, error,
+		) {
+			atomic.AddInt64(&apiCalls, 1)
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+}
+
+// exportedCounts returns the number of resources of every type in
+// resources, which may be nil, leaving out the types without any.
+func exportedCounts(resources *model.ResourceSet) map[string]int {
+	counts := map[string]int{}
+	add := func(typ string, n int) {
+		if n > 0 {
+			counts[typ] = n
+		}
+	}
+	if resources != nil {
+		add("groups", len(resources.Groups))
+		add("policies", len(resources.Policies))
+		add("roles", len(resources.Roles))
+		add("users", len(resources.Users))
+		add("server-certificates", len(resources.ServerCertificates))
+		add("virtual-mfa-devices", len(resources.VirtualMFADevices))
+		add("instance-profiles", len(resources.InstanceProfiles))
+		add("providers", len(resources.Providers))
+		add("sso-permission-sets", len(resources.PermissionSets))
+		if resources.Account != nil {
+			add("account", 1)
+		}
+	}
+	return counts
+}
+
+// group returns the slog attributes of counts, ordered by key.
+func group(counts map[string]int) []interface{} {
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var attrs []interface{}
+	for _, k := range keys {
+		attrs = append(attrs, k, counts[k])
+	}
+	return attrs
+}
+
+// logSummary logs the number of resources of every type in resources, which
+// may be nil, the resources skipped and why, the API requests sent and how
+// long the command took.
+func logSummary(resources *model.ResourceSet) {
+	slog.Info("Done",
+		slog.Group("resources", group(exportedCounts(resources))...),
+		slog.Group("skipped", group(skipped)...),
+		"apiCalls", atomic.LoadInt64(&apiCalls),
+		"duration", time.Since(started).Round(time.Millisecond))
+}
+
+// finish logs the summary of the command, writes --result-json and exits
+// with status, unless it is exitOK.
+func finish(resources *model.ResourceSet, status int) {
+	logSummary(resources)
+	if err := writeResult(resources, status, nil); err != nil {
+		slog.Error(err.Error())
+		os.Exit(exitError)
+	}
+	if status != exitOK {
+		os.Exit(status)
+	}
+}
+
+// result is the outcome of the command written to --result-json.
+type result struct {
+	ExitStatus int            `json:"exitStatus"`
+	Error      string         `json:"error,omitempty"`
+	Resources  map[string]int `json:"resources"`
+	Skipped    map[string]int `json:"skipped"`
+	Warnings   []string       `json:"warnings"`
+	APICalls   int64          `json:"apiCalls"`
+	Duration   float64        `json:"durationSeconds"`
+}
+
+// writeResult writes the outcome of the command to --result-json, if
+// given: its exit status, the error it failed with, if any, the resources
+// exported, which may be nil, and skipped, and the warnings logged.
+func writeResult(resources *model.ResourceSet, status int, err error) error {
+	if *resultJSON == "" {
+		return nil
+	}
+	r := result{
+		ExitStatus: status,
+		Resources:  exportedCounts(resources),
+		Skipped:    skipped,
+		Warnings:   warnings.list(),
+		APICalls:   atomic.LoadInt64(&apiCalls),
+		Duration:   time.Since(started).Round(time.Millisecond).Seconds(),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*resultJSON, append(b, '\n'), 0o644)
+}
+
+// warningRecorder is a slog.Handler keeping the warnings logged through
+// it, with their attributes, for --result-json.
+type warningRecorder struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+// warnings holds the warnings logged.
+var warnings recordedWarnings
+
+type recordedWarnings struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (w *recordedWarnings) add(s string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, s)
+}
+
+func (w *recordedWarnings) list() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.messages...)
+}
+
+func (h warningRecorder) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelWarn {
+		msg := []string{r.Message}
+		add := func(a slog.Attr) bool {
+			msg = append(msg, fmt.Sprintf("%s=%v", a.Key, a.Value))
+			return true
+		}
+		for _, a := range h.attrs {
+			add(a)
+		}
+		r.Attrs(add)
+		warnings.add(strings.Join(msg, " "))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h warningRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return warningRecorder{Handler: h.Handler.WithAttrs(attrs), attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h warningRecorder) WithGroup(name string) slog.Handler {
+	return warningRecorder{Handler: h.Handler.WithGroup(name), attrs: h.attrs}
+}
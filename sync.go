@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/diff"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/render"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var (
+	repoDir     = flag.String("repo", "", "with sync, the `directory` of the git working tree to commit the template to")
+	repoPath    = flag.String("repo-path", "template.yaml", "with sync, the `path` of the template in the git working tree")
+	syncBranch  = flag.String("branch", "", "with sync, commit to `branch`, recreated from the checked-out branch, or the one it was created from when checked out, instead of the checked-out branch")
+	pullRequest = flag.String("pull-request", "", "with sync and --branch, push the branch to origin and open a pull request on `github` or gitlab, with the token in $GITHUB_TOKEN or $GITLAB_TOKEN")
+)
+
+// syncSubject is the subject of the commits and pull requests of sync.
+const syncSubject = "Update IAM resources"
+
+// runSync writes the template generated from resources to --repo-path in
+// --repo and commits it when its resources differ from those committed,
+// on --branch if given. With --pull-request, the branch is pushed and a
+// pull request opened for it. The changes committed are notified with
+// --notify-sns-topic and --notify-webhook.
+func runSync(ctx context.Context, cfg aws.Config, resources *model.ResourceSet, ids *render.LogicalIDs, opts render.Options) error {
+	b := bytes.Buffer{}
+	if err := render.Write(&b, resources, ids, opts); err != nil {
+		return err
+	}
+	if err := checkLimits(resources, b.Bytes()); err != nil {
+		return err
+	}
+
+	base, err := git(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	branch := base
+	if *syncBranch != "" {
+		if base == "HEAD" && *pullRequest != "" {
+			return fmt.Errorf("%s has no branch checked out for the pull request to merge into", *repoDir)
+		}
+		if base, err = syncBase(ctx, base); err != nil {
+			return err
+		}
+		// The branch is recreated from its base, so that it holds a
+		// single commit whatever previous syncs committed to it.
+		if _, err := git(ctx, "checkout", "--quiet", "-B", *syncBranch, base); err != nil {
+			return err
+		}
+		branch = *syncBranch
+	}
+
+	path := filepath.Join(*repoDir, *repoPath)
+	old, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// Templates are compared by their resources, not their text, which
+	// also holds the time they were generated.
+	changes := []diff.Change{}
+	if old != nil {
+		if changes, err = diff.Templates(old, b.Bytes()); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if len(changes) == 0 {
+			slog.Info("The template in the repository is up to date", "file", path)
+			return nil
+		}
+	}
+	summary := bytes.Buffer{}
+	if err := diff.Write(&summary, changes); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if _, err := git(ctx, "add", "--", *repoPath); err != nil {
+		return err
+	}
+	message := syncSubject + "\n\n" + summary.String()
+	if old == nil {
+		message = syncSubject + "\n\nAdd the template of the exported resources.\n"
+	}
+	if _, err := git(ctx, "commit", "--quiet", "--message", message); err != nil {
+		return err
+	}
+	slog.Info("Committed the template", "file", path, "changes", len(changes), "branch", branch)
+
+	subject := fmt.Sprintf("Committed %d changed IAM resources to %s on %s", len(changes), *repoPath, branch)
+	if old == nil {
+		subject = fmt.Sprintf("Committed the IAM resources to %s on %s", *repoPath, branch)
+	}
+	if *pullRequest == "" {
+		return notifyChanges(ctx, cfg, subject, changes)
+	}
+	if _, err := git(ctx, "push", "--quiet", "--force", "--set-upstream", "origin", branch); err != nil {
+		return err
+	}
+	remote, err := git(ctx, "remote", "get-url", "origin")
+	if err != nil {
+		return err
+	}
+	host, project, err := remoteProject(remote)
+	if err != nil {
+		return err
+	}
+	body := "Generated by iam-cf-generator.\n"
+	if len(changes) > 0 {
+		body += "\n```\n" + summary.String() + "```\n"
+	}
+	var link string
+	if *pullRequest == "github" {
+		link, err = openGitHubPullRequest(ctx, host, project, base, body)
+	} else {
+		link, err = openGitLabMergeRequest(ctx, host, project, base, body)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Opened a pull request", "url", link)
+	return notifyChanges(ctx, cfg, subject+": "+link, changes)
+}
+
+// syncBaseKey is the git config key recording the base of --branch.
+func syncBaseKey() string {
+	return "branch." + *syncBranch + ".iamCfGeneratorBase"
+}
+
+// syncBase returns the base --branch is created from, given head, the
+// branch checked out. When it is --branch itself, left checked out by a
+// previous sync, the base is the one recorded then. Otherwise head is the
+// base, recorded in the git config of --repo; a detached HEAD is recorded
+// as its commit.
+func syncBase(ctx context.Context, head string) (string, error) {
+	if head == *syncBranch {
+		base, err := git(ctx, "config", "--get", syncBaseKey())
+		if err != nil {
+			return "", fmt.Errorf("%s has %s checked out, but not the branch it was created from", *repoDir, head)
+		}
+		return base, nil
+	}
+	base := head
+	if head == "HEAD" {
+		var err error
+		if base, err = git(ctx, "rev-parse", "HEAD"); err != nil {
+			return "", err
+		}
+	}
+	if _, err := git(ctx, "config", syncBaseKey(), base); err != nil {
+		return "", err
+	}
+	return base, nil
+}
+
+// git runs git in --repo with args, returning its trimmed output.
+func git(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", *repoDir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// scpRemote matches the scp-like syntax of git remotes, e.g.
+// git@github.com:owner/repo.git.
+var scpRemote = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// remoteProject returns the host and the path of the project of the git
+// remote URL u, e.g. github.com and owner/repo.
+func remoteProject(u string) (string, string, error) {
+	var host, path string
+	if m := scpRemote.FindStringSubmatch(u); m != nil && !strings.Contains(u, "://") {
+		host, path = m[1], m[2]
+	} else if p, err := url.Parse(u); err == nil && p.Host != "" {
+		host, path = p.Hostname(), p.Path
+	} else {
+		return "", "", fmt.Errorf("can not find the project of remote %s", u)
+	}
+	return host, strings.TrimSuffix(strings.Trim(path, "/"), ".git"), nil
+}
+
+// requestJSON sends a request with method to the API endpoint u with the
+// header auth set to value, with the JSON of in as its body unless nil,
+// and decodes the response into out.
+func requestJSON(ctx context.Context, method, u, auth, value string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(auth, value)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message interface{} `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("%s: %s: %v", u, resp.Status, apiErr.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// openGitHubPullRequest opens a pull request of --branch into base in the
+// GitHub repository project, e.g. owner/repo, and returns its URL. The
+// pull request a previous sync opened, updated by the push, is returned
+// instead when still open. Hosts other than github.com are taken to be
+// GitHub Enterprise Server.
+func openGitHubPullRequest(ctx context.Context, host, project, base, body string) (string, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	api := "https://api.github.com"
+	if host != "github.com" {
+		api = "https://" + host + "/api/v3"
+	}
+	owner, _, _ := strings.Cut(project, "/")
+	var open []struct {
+		HTMLURL string `json:"html_url"`
+	}
+	q := url.Values{"state": {"open"}, "head": {owner + ":" + *syncBranch}, "base": {base}}
+	if err := requestJSON(ctx, http.MethodGet, api+"/repos/"+project+"/pulls?"+q.Encode(), "Authorization", "Bearer "+token, nil, &open); err != nil {
+		return "", err
+	}
+	if len(open) > 0 {
+		return open[0].HTMLURL, nil
+	}
+	var pr struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := requestJSON(ctx, http.MethodPost, api+"/repos/"+project+"/pulls", "Authorization", "Bearer "+token, map[string]string{
+		"title": syncSubject,
+		"head":  *syncBranch,
+		"base":  base,
+		"body":  body,
+	}, &pr)
+	return pr.HTMLURL, err
+}
+
+// openGitLabMergeRequest opens a merge request of --branch into base in
+// the GitLab project at host, e.g. group/project, and returns its URL. The
+// merge request a previous sync opened is returned instead when still
+// open.
+func openGitLabMergeRequest(ctx context.Context, host, project, base, body string) (string, error) {
+	token := os.Getenv("GITLAB_TOKEN")
+	api := "https://" + host + "/api/v4/projects/" + url.PathEscape(project) + "/merge_requests"
+	var open []struct {
+		WebURL string `json:"web_url"`
+	}
+	q := url.Values{"state": {"opened"}, "source_branch": {*syncBranch}, "target_branch": {base}}
+	if err := requestJSON(ctx, http.MethodGet, api+"?"+q.Encode(), "PRIVATE-TOKEN", token, nil, &open); err != nil {
+		return "", err
+	}
+	if len(open) > 0 {
+		return open[0].WebURL, nil
+	}
+	var mr struct {
+		WebURL string `json:"web_url"`
+	}
+	err := requestJSON(ctx, http.MethodPost, api, "PRIVATE-TOKEN", token, map[string]string{
+		"title":         syncSubject,
+		"source_branch": *syncBranch,
+		"target_branch": base,
+		"description":   body,
+	}, &mr)
+	return mr.WebURL, err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/transform"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// tagValues is a flag.Value collecting the tags of --add-tag.
+type tagValues []types.Tag
+
+var (
+	addedTags           tagValues
+	requiredTags        stringValues
+	excludedTagPrefixes stringValues
+)
+
+func init() {
+	flag.Var(&addedTags, "add-tag", "add the tag `key=value` to every exported resource that can be tagged, replacing its value of the tag (repeatable)")
+	flag.Var(&excludedTagPrefixes, "exclude-tag-prefix", "leave the tags whose key starts with `prefix`, e.g. aws: or cdk-, out of the output (repeatable)")
+	flag.Var(&requiredTags, "require-tag", "fail when an exported resource that can be tagged lacks the tag `key` in the account (repeatable)")
+}
+
+func (t *tagValues) String() string {
+	var l []string
+	for _, tag := range *t {
+		l = append(l, aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+	}
+	return strings.Join(l, ",")
+}
+
+func (t *tagValues) Set(v string) error {
+	tag, err := transform.ParseTag(v)
+	if err != nil {
+		return err
+	}
+	*t = append(*t, tag)
+	return nil
+}
+
+// checkRequiredTags fails when resources lack a tag of --require-tag,
+// listing them.
+func checkRequiredTags(resources *model.ResourceSet) error {
+	untagged := transform.MissingTags(resources, requiredTags)
+	if len(untagged) == 0 {
+		return nil
+	}
+	l := make([]string, len(untagged))
+	for i, u := range untagged {
+		l[i] = u.String()
+	}
+	return fmt.Errorf("%d resources lack required tags: %s", len(untagged), strings.Join(l, "; "))
+}
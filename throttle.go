@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// requestLimiter spaces out API requests so that no more than a fixed
+// number are sent per second, across all goroutines.
+type requestLimiter struct {
+	mu       sync.Mutex
+	next     time.Time
+	interval time.Duration
+}
+
+func newRequestLimiter(perSecond float64) *requestLimiter {
+	return &requestLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (l *requestLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	at := time.Now()
+	if at.Before(l.next) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// addMiddleware registers the limiter on a client's middleware stack. It is
+// added after the retry middleware so every attempt, including retries,
+// counts towards the rate.
+func (l *requestLimiter) addMiddleware(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("RequestLimiter",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+			middleware.FinalizeOutput, middleware.Metadata, error,
+		) {
+			if err := l.wait(ctx); err != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+			}
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+}
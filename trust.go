@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyze"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/securityhub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// runTrust writes the trust relationships of the roles in resources to
+// stdout, and with --security-hub imports the risky ones into Security
+// Hub.
+func runTrust(ctx context.Context, cfg aws.Config, resources *model.ResourceSet) error {
+	trusts, err := analyze.TrustRelationships(resources)
+	if err != nil {
+		return err
+	}
+	if err := analyze.WriteTrust(out, trusts); err != nil {
+		return err
+	}
+	if !*toSecurityHub {
+		return nil
+	}
+	return importFindings(ctx, cfg, func(src securityhub.Source) []securityhub.Finding {
+		return securityhub.FromTrust(src, trusts)
+	})
+}
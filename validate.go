@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/analyzer"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+)
+
+// runValidate validates the policies of resources with Access Analyzer,
+// logs how many findings of each type it reported and writes them to
+// --validate-findings. It returns the findings as template comments.
+func runValidate(ctx context.Context, cfg aws.Config, resources *model.ResourceSet) (map[*string][]string, error) {
+	findings, err := analyzer.Validate(ctx, accessanalyzer.NewFromConfig(cfg), resources)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.FindingType]++
+	}
+	slog.Info("Validated documents with Access Analyzer", "errors", counts["ERROR"], "securityWarnings", counts["SECURITY_WARNING"],
+		"warnings", counts["WARNING"], "suggestions", counts["SUGGESTION"])
+	for _, f := range findings {
+		if f.FindingType == "ERROR" || f.FindingType == "SECURITY_WARNING" {
+			slog.Warn(f.Details, "resource", f.Resource(), "type", f.FindingType, "issue", f.IssueCode)
+		}
+	}
+
+	if *validateFindings != "" {
+		if findings == nil {
+			findings = []analyzer.Finding{}
+		}
+		b, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(*validateFindings, append(b, '\n'), 0o644); err != nil {
+			return nil, err
+		}
+		slog.Info("Wrote findings", "file", *validateFindings)
+	}
+	return analyzer.Comments(findings), nil
+}
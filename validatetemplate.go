@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+)
+
+var validateTemplate = flag.Bool("validate-template", false, "check the template with CloudFormation's ValidateTemplate API, and with cfn-lint when it is installed")
+
+// cfnLintErrors is the bit of the exit status of cfn-lint set when it
+// found errors, as opposed to warnings or informational findings.
+const cfnLintErrors = 2
+
+// runValidateTemplate checks template with the ValidateTemplate API, and
+// with cfn-lint when it is in the PATH, failing when either finds errors.
+func runValidateTemplate(ctx context.Context, cfg aws.Config, template []byte) error {
+	body, url, err := templateSource(ctx, cfg, "validate", template)
+	if err != nil {
+		return err
+	}
+	_, err = cloudformation.NewFromConfig(cfg).ValidateTemplate(ctx, &cloudformation.ValidateTemplateInput{
+		TemplateBody: body,
+		TemplateURL:  url,
+	})
+	if err != nil {
+		return fmt.Errorf("CloudFormation rejected the template: %w", err)
+	}
+	slog.Info("CloudFormation validated the template")
+
+	lint, err := exec.LookPath("cfn-lint")
+	if err != nil {
+		slog.Debug("Not running cfn-lint, which is not installed")
+		return nil
+	}
+	return runCfnLint(ctx, lint, template)
+}
+
+// runCfnLint runs the cfn-lint executable at path on template, logging
+// every finding.
+func runCfnLint(ctx context.Context, path string, template []byte) error {
+	f, err := os.CreateTemp("", "iam-cf-generator-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(template); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "--format", "parseable", "--", f.Name())
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+
+	findings := 0
+	lines := bufio.NewScanner(&stdout)
+	for lines.Scan() {
+		// Findings are written as <file>:<line>:<column>:<end line>:<end
+		// column>:<rule>:<message>, naming the temporary file. The rules of
+		// errors start with E.
+		finding := strings.TrimPrefix(lines.Text(), f.Name()+":")
+		level := slog.LevelWarn
+		if fields := strings.SplitN(finding, ":", 6); len(fields) == 6 && strings.HasPrefix(fields[4], "E") {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "cfn-lint: "+finding)
+		findings++
+	}
+
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		slog.Info("cfn-lint found no issues")
+		return nil
+	case !errors.As(err, &exit):
+		return fmt.Errorf("running cfn-lint: %w", err)
+	case exit.ExitCode()&cfnLintErrors != 0:
+		return errors.New("cfn-lint found errors in the template")
+	}
+	slog.Info("cfn-lint found warnings only", "findings", findings)
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/model"
+	"github.com/EdgeJ/iam-cf-generator/pkg/iamexport/verify"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// runVerify reads the template given to verify back into the resource
+// model, prints what it lost or rewrote of resources and reports whether
+// it lost anything.
+func runVerify(ctx context.Context, cfg aws.Config, resources *model.ResourceSet) (bool, error) {
+	b, err := readTemplate(ctx, cfg)
+	if err != nil {
+		return false, err
+	}
+	template, err := verify.Parse(b)
+	if err != nil {
+		return false, err
+	}
+	losses := verify.Compare(resources, template)
+	if err := verify.WriteLosses(out, losses); err != nil {
+		return false, err
+	}
+	if len(losses) > 0 {
+		slog.Warn("The template differs from IAM", "losses", len(losses))
+	}
+	return len(losses) > 0, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var watch = flag.Duration("watch", 0, "keep running, exporting the resources again, or running diff or sync again, every `interval`, e.g. 1h")
+
+// runWatch runs the command again every --watch interval until it is
+// interrupted: the export, or diff or sync, e.g. to notify the changes they
+// find. Every run is a process of its own, given the same arguments with
+// --watch turned off, so that one failing, e.g. on an expired session, is
+// logged and retried at the next interval rather than ending the watch.
+func runWatch() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(*watch)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		switch err := rerun(ctx, "--watch=0"); {
+		case ctx.Err() != nil:
+		case err != nil:
+			slog.Error("Run failed, retrying at the next interval", "error", err)
+		default:
+			slog.Info("Ran the command", "took", time.Since(start).Round(time.Second), "next", start.Add(*watch).Format(time.TimeOnly))
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped watching")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// rerun runs the command again in a process of its own, given the same
+// arguments followed by args, which take precedence over them and the
+// config file. It is interrupted along with ctx. The differences diff
+// finds are not an error.
+func rerun(ctx context.Context, args ...string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, self, append(append([]string{}, os.Args[1:]...), args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	err = cmd.Run()
+
+	var exit *exec.ExitError
+	if command == "diff" && errors.As(err, &exit) && exit.ExitCode() == exitChanges {
+		slog.Info("Found differences")
+		return nil
+	}
+	return err
+}